@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"GoSearch/internal/server"
@@ -43,6 +44,14 @@ func main() {
 
 	// Create HTTP handler and register API routes.
 	handler := server.NewHandler(mgr, logger)
+	if v := getEnv("GOTEXTSEARCH_MAX_RESULT_WINDOW", ""); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid GOTEXTSEARCH_MAX_RESULT_WINDOW %q\n", v)
+			os.Exit(1)
+		}
+		handler.MaxResultWindow = n
+	}
 	mux := http.NewServeMux()
 	handler.RegisterRoutes(mux)
 
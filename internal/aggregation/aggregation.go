@@ -0,0 +1,355 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+)
+
+// Aggregation limits.
+const (
+	DefaultTermsSize    = 10
+	MaxTermsSize        = 10_000
+	MaxAggregations     = 100
+	MaxAggregationDepth = 5
+	MaxBuckets          = 10_000
+)
+
+// Aggregation types, as named in requests and partial results.
+const (
+	TypeTerms         = "terms"
+	TypeMin           = "min"
+	TypeMax           = "max"
+	TypeAvg           = "avg"
+	TypeSum           = "sum"
+	TypeValueCount    = "value_count"
+	TypeCardinality   = "cardinality"
+	TypeHistogram     = "histogram"
+	TypeDateHistogram = "date_histogram"
+	TypeRange         = "range"
+)
+
+var ErrInvalidAggregation = errors.New("invalid aggregation")
+
+// Request is the JSON form of a single aggregation. Exactly one kind must
+// be set. Bucket aggregations may nest further aggregations, which are
+// computed separately within each bucket.
+//
+//	{"terms": {"field": "tags", "size": 5},
+//	 "aggregations": {"avg_price": {"avg": {"field": "price"}}}}
+type Request struct {
+	Terms         *TermsRequest         `json:"terms,omitempty"`
+	Min           *MetricRequest        `json:"min,omitempty"`
+	Max           *MetricRequest        `json:"max,omitempty"`
+	Avg           *MetricRequest        `json:"avg,omitempty"`
+	Sum           *MetricRequest        `json:"sum,omitempty"`
+	ValueCount    *MetricRequest        `json:"value_count,omitempty"`
+	Cardinality   *CardinalityRequest   `json:"cardinality,omitempty"`
+	Histogram     *HistogramRequest     `json:"histogram,omitempty"`
+	DateHistogram *DateHistogramRequest `json:"date_histogram,omitempty"`
+	Range         *RangeRequest         `json:"range,omitempty"`
+
+	// Aggregations are sub-aggregations computed per bucket.
+	Aggregations map[string]Request `json:"aggregations,omitempty"`
+}
+
+// Type returns the aggregation type of the request, or "" if it does not
+// set exactly one kind.
+func (r *Request) Type() string {
+	var types []string
+	add := func(set bool, t string) {
+		if set {
+			types = append(types, t)
+		}
+	}
+	add(r.Terms != nil, TypeTerms)
+	add(r.Min != nil, TypeMin)
+	add(r.Max != nil, TypeMax)
+	add(r.Avg != nil, TypeAvg)
+	add(r.Sum != nil, TypeSum)
+	add(r.ValueCount != nil, TypeValueCount)
+	add(r.Cardinality != nil, TypeCardinality)
+	add(r.Histogram != nil, TypeHistogram)
+	add(r.DateHistogram != nil, TypeDateHistogram)
+	add(r.Range != nil, TypeRange)
+	if len(types) != 1 {
+		return ""
+	}
+	return types[0]
+}
+
+// aggregator computes one aggregation over the documents of successive
+// segments.
+type aggregator interface {
+	// setSegment prepares for documents of a new segment.
+	setSegment(seg engine.Segment)
+
+	// collect accounts for a matching document of the current segment.
+	collect(docID uint32)
+
+	// partial returns the mergeable state accumulated so far.
+	partial() *Partial
+
+	// err returns the error that stopped collection, if any.
+	err() error
+}
+
+// spec is a validated aggregation request from which aggregators are
+// created, one per top-level search or per bucket of a parent aggregation.
+type spec interface {
+	newAggregator() aggregator
+}
+
+// setSpec is a validated set of named aggregation requests.
+type setSpec struct {
+	names []string
+	specs []spec
+}
+
+func compileSet(schema *index.Schema, reqs map[string]Request, depth int) (*setSpec, error) {
+	if depth > MaxAggregationDepth {
+		return nil, fmt.Errorf("%w: aggregations nested deeper than %d", ErrInvalidAggregation, MaxAggregationDepth)
+	}
+	if len(reqs) > MaxAggregations {
+		return nil, fmt.Errorf("%w: more than %d aggregations", ErrInvalidAggregation, MaxAggregations)
+	}
+	s := &setSpec{}
+	for name := range reqs {
+		if name == "" {
+			return nil, fmt.Errorf("%w: aggregation name is required", ErrInvalidAggregation)
+		}
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	for _, name := range s.names {
+		sp, err := compile(schema, reqs[name], depth)
+		if err != nil {
+			return nil, fmt.Errorf("aggregation %q: %w", name, err)
+		}
+		s.specs = append(s.specs, sp)
+	}
+	return s, nil
+}
+
+func compile(schema *index.Schema, req Request, depth int) (spec, error) {
+	typ := req.Type()
+	if typ == "" {
+		return nil, fmt.Errorf("%w: exactly one aggregation type must be given", ErrInvalidAggregation)
+	}
+
+	var subs *setSpec
+	if len(req.Aggregations) > 0 {
+		switch typ {
+		case TypeTerms, TypeHistogram, TypeDateHistogram, TypeRange:
+		default:
+			return nil, fmt.Errorf("%w: %s aggregation cannot have sub-aggregations", ErrInvalidAggregation, typ)
+		}
+		var err error
+		if subs, err = compileSet(schema, req.Aggregations, depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	switch typ {
+	case TypeTerms:
+		return compileTerms(schema, *req.Terms, subs)
+	case TypeMin:
+		return compileMetric(schema, typ, *req.Min)
+	case TypeMax:
+		return compileMetric(schema, typ, *req.Max)
+	case TypeAvg:
+		return compileMetric(schema, typ, *req.Avg)
+	case TypeSum:
+		return compileMetric(schema, typ, *req.Sum)
+	case TypeValueCount:
+		return compileMetric(schema, typ, *req.ValueCount)
+	case TypeCardinality:
+		return compileCardinality(schema, *req.Cardinality)
+	case TypeHistogram:
+		return compileHistogram(schema, *req.Histogram, subs)
+	case TypeDateHistogram:
+		return compileDateHistogram(schema, *req.DateHistogram, subs)
+	default:
+		return compileRange(schema, *req.Range, subs)
+	}
+}
+
+// aggregatorSet runs a set of named aggregators side by side.
+type aggregatorSet struct {
+	names []string
+	aggs  []aggregator
+}
+
+func (s *setSpec) newSet() *aggregatorSet {
+	set := &aggregatorSet{names: s.names, aggs: make([]aggregator, len(s.specs))}
+	for i, sp := range s.specs {
+		set.aggs[i] = sp.newAggregator()
+	}
+	return set
+}
+
+func (s *aggregatorSet) setSegment(seg engine.Segment) {
+	for _, a := range s.aggs {
+		a.setSegment(seg)
+	}
+}
+
+func (s *aggregatorSet) collect(docID uint32) {
+	for _, a := range s.aggs {
+		a.collect(docID)
+	}
+}
+
+func (s *aggregatorSet) err() error {
+	for _, a := range s.aggs {
+		if err := a.err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *aggregatorSet) partials() map[string]*Partial {
+	out := make(map[string]*Partial, len(s.names))
+	for i, name := range s.names {
+		out[name] = s.aggs[i].partial()
+	}
+	return out
+}
+
+// Collector computes a set of named aggregations over the documents matched
+// by a search. It implements engine.SegmentCollector.
+type Collector struct {
+	reqs map[string]Request
+	set  *aggregatorSet
+}
+
+var _ engine.SegmentCollector = (*Collector)(nil)
+
+// NewCollector validates the requests against the schema and creates a
+// collector for them.
+func NewCollector(schema *index.Schema, reqs map[string]Request) (*Collector, error) {
+	s, err := compileSet(schema, reqs, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{reqs: reqs, set: s.newSet()}, nil
+}
+
+// SetSegment prepares every aggregation for documents of a new segment. It
+// fails once an aggregation has failed, such as on too many buckets.
+func (c *Collector) SetSegment(ord int, seg engine.Segment) error {
+	if err := c.set.err(); err != nil {
+		return err
+	}
+	c.set.setSegment(seg)
+	return nil
+}
+
+// Collect accounts for a matching document of the current segment.
+func (c *Collector) Collect(docID uint32, score float32) {
+	c.set.collect(docID)
+}
+
+// Partials returns the mergeable per-aggregation state, for reduction with
+// the partials of other shards.
+func (c *Collector) Partials() map[string]*Partial {
+	return c.set.partials()
+}
+
+// Results returns the final aggregation results keyed by name.
+func (c *Collector) Results() (map[string]*Result, error) {
+	if err := c.set.err(); err != nil {
+		return nil, err
+	}
+	return Reduce(c.reqs, c.Partials())
+}
+
+// fieldSource reads a field's doc values for the current segment.
+type fieldSource struct {
+	field     string
+	kind      numeric.Kind
+	isNumeric bool
+
+	numbers *docvalues.NumericField
+	ords    *docvalues.SortedSetField
+}
+
+// newFieldSource looks up a field, checks that it has doc values and that
+// its type is numeric (allowNumeric) or keyword (allowKeyword).
+func newFieldSource(schema *index.Schema, field string, allowNumeric, allowKeyword bool) (*fieldSource, error) {
+	if field == "" {
+		return nil, fmt.Errorf("%w: field is required", ErrInvalidAggregation)
+	}
+	var f *index.FieldDef
+	if schema != nil {
+		f = schema.Field(field)
+	}
+	if f == nil {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidAggregation, field)
+	}
+	if !f.DocValues {
+		return nil, fmt.Errorf("%w: field %q does not have doc_values enabled", ErrInvalidAggregation, field)
+	}
+	src := &fieldSource{field: field}
+	src.kind, src.isNumeric = index.NumericKind(f.Type)
+	switch {
+	case src.isNumeric && allowNumeric:
+	case f.Type == index.FieldTypeKeyword && allowKeyword:
+	default:
+		return nil, fmt.Errorf("%w: field %q has unsupported type %q", ErrInvalidAggregation, field, f.Type)
+	}
+	return src, nil
+}
+
+func (s *fieldSource) setSegment(seg engine.Segment) {
+	s.numbers, s.ords = nil, nil
+	dv := seg.DocValues()
+	if dv == nil {
+		return
+	}
+	if s.isNumeric {
+		s.numbers = dv.NumericField(s.field)
+	} else {
+		s.ords = dv.SortedSetField(s.field)
+	}
+}
+
+// values returns the sortable numeric values of a document.
+func (s *fieldSource) values(docID uint32) []int64 {
+	if s.numbers == nil {
+		return nil
+	}
+	return s.numbers.Values(docID)
+}
+
+// docOrds returns the keyword ordinals of a document.
+func (s *fieldSource) docOrds(docID uint32) []uint32 {
+	if s.ords == nil {
+		return nil
+	}
+	return s.ords.Ords(docID)
+}
+
+// float converts a sortable value to the number it represents.
+func (s *fieldSource) float(v int64) float64 {
+	if s.kind == numeric.KindDouble {
+		return numeric.SortableToDouble(v)
+	}
+	return float64(v)
+}
+
+func (s *fieldSource) isDate() bool {
+	return s.isNumeric && s.kind == numeric.KindDate
+}
+
+// clone returns a copy of a validated source for a new aggregator.
+func (s *fieldSource) clone() *fieldSource {
+	c := *s
+	return &c
+}
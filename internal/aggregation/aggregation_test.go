@@ -0,0 +1,530 @@
+package aggregation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+)
+
+// dvSegment is an engine.Segment exposing only doc values.
+type dvSegment struct {
+	dv *docvalues.Segment
+}
+
+func (s *dvSegment) MaxDoc() uint32                               { return s.dv.MaxDoc() }
+func (s *dvSegment) DocCount() int                                { return int(s.dv.MaxDoc()) }
+func (s *dvSegment) AvgDocLength() float32                        { return 1 }
+func (s *dvSegment) Terms(field string) []string                  { return nil }
+func (s *dvSegment) Postings(field, term string) *engine.Postings { return nil }
+func (s *dvSegment) DocValues() *docvalues.Segment                { return s.dv }
+
+func testSchema() *index.Schema {
+	return &index.Schema{Fields: []index.FieldDef{
+		{Name: "tags", Type: index.FieldTypeKeyword, Indexed: true, MultiValued: true, DocValues: true},
+		{Name: "status", Type: index.FieldTypeKeyword, Indexed: true},
+		{Name: "title", Type: index.FieldTypeText, Indexed: true, Analyzer: "standard"},
+		{Name: "price", Type: index.FieldTypeDouble, Indexed: true, MultiValued: true, DocValues: true},
+		{Name: "qty", Type: index.FieldTypeLong, Indexed: true, DocValues: true},
+		{Name: "when", Type: index.FieldTypeDate, Indexed: true, DocValues: true},
+	}}
+}
+
+// testDoc is a document of a product segment.
+type testDoc struct {
+	tag    string
+	prices []float64
+	when   string
+}
+
+// productSegment builds a segment with one document per testDoc.
+func productSegment(t *testing.T, docs ...testDoc) engine.Segment {
+	t.Helper()
+	b := docvalues.NewBuilder()
+	for i, d := range docs {
+		doc := uint32(i)
+		if d.tag != "" {
+			b.AddSortedSet("tags", doc, d.tag)
+		}
+		for _, p := range d.prices {
+			b.AddNumeric("price", doc, numeric.DoubleToSortable(p))
+		}
+		if d.when != "" {
+			ms, err := numeric.ParseDate(d.when)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.AddNumeric("when", doc, ms)
+		}
+	}
+	return &dvSegment{dv: b.Build(uint32(len(docs)))}
+}
+
+func productSegments(t *testing.T) []engine.Segment {
+	return []engine.Segment{
+		productSegment(t,
+			testDoc{"a", []float64{5, 12}, "2024-01-15T10:00:00Z"},
+			testDoc{"b", []float64{40}, "2024-01-31T23:00:00Z"},
+			testDoc{"a", nil, "2024-03-02T00:00:00Z"},
+		),
+		productSegment(t,
+			testDoc{"b", []float64{120.5}, "2024-03-20T00:00:00Z"},
+			testDoc{"c", []float64{8}, ""},
+		),
+	}
+}
+
+// results returns the results of c, failing the test on an error.
+func results(t *testing.T, c *Collector) map[string]*Result {
+	t.Helper()
+	res, err := c.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// runAggs collects reqs over segs and returns the results rendered as JSON.
+func runAggs(t *testing.T, reqs map[string]Request, segs ...engine.Segment) string {
+	t.Helper()
+	c, err := NewCollector(testSchema(), reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectAll(t, c, segs...)
+	out, err := json.Marshal(results(t, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// tagSegment builds a segment where document i has the tags in docs[i].
+func tagSegment(docs ...[]string) engine.Segment {
+	b := docvalues.NewBuilder()
+	for doc, tags := range docs {
+		for _, tag := range tags {
+			b.AddSortedSet("tags", uint32(doc), tag)
+		}
+	}
+	return &dvSegment{dv: b.Build(uint32(len(docs)))}
+}
+
+// collectAll runs the collector over every document of each segment.
+func collectAll(t *testing.T, c *Collector, segs ...engine.Segment) {
+	t.Helper()
+	for ord, seg := range segs {
+		if err := c.SetSegment(ord, seg); err != nil {
+			t.Fatal(err)
+		}
+		for doc := uint32(0); doc < seg.MaxDoc(); doc++ {
+			c.Collect(doc, 1)
+		}
+	}
+}
+
+func bucketKeys(r *Result) []string {
+	keys := make([]string, len(r.Buckets))
+	for i, b := range r.Buckets {
+		keys[i] = b.Key.(string)
+	}
+	return keys
+}
+
+func TestTerms_MergesSegments(t *testing.T) {
+	c, err := NewCollector(testSchema(), map[string]Request{
+		"tags": {Terms: &TermsRequest{Field: "tags"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectAll(t, c,
+		tagSegment([]string{"search", "go"}, []string{"search"}, nil),
+		tagSegment([]string{"go"}, []string{"search", "rust"}),
+	)
+
+	res := results(t, c)["tags"]
+	want := []Bucket{{Key: "search", DocCount: 3}, {Key: "go", DocCount: 2}, {Key: "rust", DocCount: 1}}
+	if len(res.Buckets) != len(want) {
+		t.Fatalf("buckets = %v, want %v", res.Buckets, want)
+	}
+	for i, b := range res.Buckets {
+		if b.Key != want[i].Key || b.DocCount != want[i].DocCount {
+			t.Errorf("bucket %d = %v, want %v", i, b, want[i])
+		}
+	}
+}
+
+func TestTerms_Options(t *testing.T) {
+	segs := []engine.Segment{
+		tagSegment([]string{"b"}, []string{"a"}, []string{"c"}, []string{"c"}, []string{"z"}),
+	}
+	zero := int64(0)
+	two := int64(2)
+	tests := []struct {
+		name      string
+		req       TermsRequest
+		matchDocs []uint32
+		want      []string
+		wantOther int64
+	}{
+		{"count desc ties by key", TermsRequest{Field: "tags"}, nil, []string{"c", "a", "b", "z"}, 0},
+		{"size", TermsRequest{Field: "tags", Size: 2}, nil, []string{"c", "a"}, 2},
+		{"key desc", TermsRequest{Field: "tags", Order: map[string]string{"_key": "desc"}}, nil, []string{"z", "c", "b", "a"}, 0},
+		{"count asc", TermsRequest{Field: "tags", Order: map[string]string{"_count": "asc"}}, nil, []string{"a", "b", "z", "c"}, 0},
+		{"min doc count", TermsRequest{Field: "tags", MinDocCount: &two}, nil, []string{"c"}, 0},
+		{"min doc count zero", TermsRequest{Field: "tags", MinDocCount: &zero, Order: map[string]string{"_key": "asc"}}, []uint32{0}, []string{"a", "b", "c", "z"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCollector(testSchema(), map[string]Request{"agg": {Terms: &tt.req}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.matchDocs == nil {
+				collectAll(t, c, segs...)
+			} else {
+				if err := c.SetSegment(0, segs[0]); err != nil {
+					t.Fatal(err)
+				}
+				for _, doc := range tt.matchDocs {
+					c.Collect(doc, 1)
+				}
+			}
+			res := results(t, c)["agg"]
+			got := bucketKeys(res)
+			if len(got) != len(tt.want) {
+				t.Fatalf("keys = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("keys = %v, want %v", got, tt.want)
+				}
+			}
+			if res.SumOtherDocCount != tt.wantOther {
+				t.Errorf("sum_other_doc_count = %d, want %d", res.SumOtherDocCount, tt.wantOther)
+			}
+		})
+	}
+}
+
+func TestNewCollector_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{"no type", Request{}},
+		{"unknown field", Request{Terms: &TermsRequest{Field: "missing"}}},
+		{"no doc values", Request{Terms: &TermsRequest{Field: "status"}}},
+		{"text field", Request{Terms: &TermsRequest{Field: "title"}}},
+		{"bad order key", Request{Terms: &TermsRequest{Field: "tags", Order: map[string]string{"_score": "desc"}}}},
+		{"bad order direction", Request{Terms: &TermsRequest{Field: "tags", Order: map[string]string{"_count": "up"}}}},
+		{"size too large", Request{Terms: &TermsRequest{Field: "tags", Size: MaxTermsSize + 1}}},
+		{"two types", Request{Min: &MetricRequest{Field: "price"}, Max: &MetricRequest{Field: "price"}}},
+		{"avg on keyword", Request{Avg: &MetricRequest{Field: "tags"}}},
+		{"metric with sub-aggregations", Request{
+			Sum:          &MetricRequest{Field: "price"},
+			Aggregations: map[string]Request{"n": {ValueCount: &MetricRequest{Field: "price"}}},
+		}},
+		{"invalid sub-aggregation", Request{
+			Terms:        &TermsRequest{Field: "tags"},
+			Aggregations: map[string]Request{"n": {Sum: &MetricRequest{Field: "status"}}},
+		}},
+		{"cardinality precision", Request{Cardinality: &CardinalityRequest{Field: "tags", Precision: 20}}},
+		{"histogram interval", Request{Histogram: &HistogramRequest{Field: "price"}}},
+		{"date histogram on double", Request{DateHistogram: &DateHistogramRequest{Field: "price", CalendarInterval: "day"}}},
+		{"date histogram no interval", Request{DateHistogram: &DateHistogramRequest{Field: "when"}}},
+		{"calendar interval", Request{DateHistogram: &DateHistogramRequest{Field: "when", CalendarInterval: "2d"}}},
+		{"fixed interval", Request{DateHistogram: &DateHistogramRequest{Field: "when", FixedInterval: "1M"}}},
+		{"time zone", Request{DateHistogram: &DateHistogramRequest{Field: "when", CalendarInterval: "day", TimeZone: "Mars/Olympus"}}},
+		{"no ranges", Request{Range: &RangeRequest{Field: "price"}}},
+		{"bad range bound", Request{Range: &RangeRequest{Field: "price", Ranges: []RangeSpec{{From: "cheap"}}}}},
+		{"duplicate range key", Request{Range: &RangeRequest{Field: "price", Ranges: []RangeSpec{{Key: "x", To: 1}, {Key: "x", From: 1}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCollector(testSchema(), map[string]Request{"agg": tt.req})
+			if !errors.Is(err, ErrInvalidAggregation) {
+				t.Errorf("expected ErrInvalidAggregation, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"min", Request{Min: &MetricRequest{Field: "price"}}, `{"value":5}`},
+		{"max", Request{Max: &MetricRequest{Field: "price"}}, `{"value":120.5}`},
+		{"sum", Request{Sum: &MetricRequest{Field: "price"}}, `{"value":185.5}`},
+		{"avg", Request{Avg: &MetricRequest{Field: "price"}}, `{"value":37.1}`},
+		{"value count", Request{ValueCount: &MetricRequest{Field: "price"}}, `{"value":5}`},
+		{"value count keyword", Request{ValueCount: &MetricRequest{Field: "tags"}}, `{"value":5}`},
+		{"min date", Request{Min: &MetricRequest{Field: "when"}}, `{"value":1705312800000,"value_as_string":"2024-01-15T10:00:00.000Z"}`},
+		{"max without values", Request{Max: &MetricRequest{Field: "qty"}}, `{"value":null}`},
+		{"cardinality", Request{Cardinality: &CardinalityRequest{Field: "tags"}}, `{"value":3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAggs(t, map[string]Request{"m": tt.req}, productSegments(t)...)
+			if want := `{"m":` + tt.want + `}`; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHistograms(t *testing.T) {
+	one := int64(1)
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{
+			"histogram fills gaps",
+			Request{Histogram: &HistogramRequest{Field: "price", Interval: 50}},
+			`{"buckets":[{"key":0,"doc_count":3},{"key":50,"doc_count":0},{"key":100,"doc_count":1}]}`,
+		},
+		{
+			"histogram min doc count and offset",
+			Request{Histogram: &HistogramRequest{Field: "price", Interval: 10, Offset: 5, MinDocCount: &one}},
+			`{"buckets":[{"key":5,"doc_count":2},{"key":35,"doc_count":1},{"key":115,"doc_count":1}]}`,
+		},
+		{
+			"calendar month",
+			Request{DateHistogram: &DateHistogramRequest{Field: "when", CalendarInterval: "month"}},
+			`{"buckets":[{"key":1704067200000,"key_as_string":"2024-01-01T00:00:00.000Z","doc_count":2},` +
+				`{"key":1706745600000,"key_as_string":"2024-02-01T00:00:00.000Z","doc_count":0},` +
+				`{"key":1709251200000,"key_as_string":"2024-03-01T00:00:00.000Z","doc_count":2}]}`,
+		},
+		{
+			"calendar month in time zone",
+			Request{DateHistogram: &DateHistogramRequest{Field: "when", CalendarInterval: "1M", TimeZone: "+02:00", MinDocCount: &one}},
+			`{"buckets":[{"key":1704060000000,"key_as_string":"2024-01-01T00:00:00.000+02:00","doc_count":1},` +
+				`{"key":1706738400000,"key_as_string":"2024-02-01T00:00:00.000+02:00","doc_count":1},` +
+				`{"key":1709244000000,"key_as_string":"2024-03-01T00:00:00.000+02:00","doc_count":2}]}`,
+		},
+		{
+			// Fixed intervals are aligned to the epoch.
+			"fixed interval",
+			Request{DateHistogram: &DateHistogramRequest{Field: "when", FixedInterval: "30d", MinDocCount: &one}},
+			`{"buckets":[{"key":1702944000000,"key_as_string":"2023-12-19T00:00:00.000Z","doc_count":1},` +
+				`{"key":1705536000000,"key_as_string":"2024-01-18T00:00:00.000Z","doc_count":1},` +
+				`{"key":1708128000000,"key_as_string":"2024-02-17T00:00:00.000Z","doc_count":1},` +
+				`{"key":1710720000000,"key_as_string":"2024-03-18T00:00:00.000Z","doc_count":1}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAggs(t, map[string]Request{"h": tt.req}, productSegments(t)...)
+			if want := `{"h":` + tt.want + `}`; got != want {
+				t.Errorf("got  %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHistogram_FractionalInterval(t *testing.T) {
+	seg := productSegment(t, testDoc{prices: []float64{0.1, 0.7, 1.3}})
+	got := runAggs(t, map[string]Request{"h": {Histogram: &HistogramRequest{Field: "price", Interval: 0.1}}}, seg)
+	var res struct {
+		H struct {
+			Buckets []struct {
+				Key      float64 `json:"key"`
+				DocCount int64   `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"h"`
+	}
+	if err := json.Unmarshal([]byte(got), &res); err != nil {
+		t.Fatal(err)
+	}
+	// Repeatedly adding 0.1 drifts from 0.1*i, which split buckets in two.
+	buckets := res.H.Buckets
+	if len(buckets) != 13 {
+		t.Fatalf("expected the 13 buckets from 0.1 through 1.3, got %s", got)
+	}
+	var docs int64
+	for i, b := range buckets {
+		if want := float64(i+1) * 0.1; b.Key != want {
+			t.Errorf("bucket %d has key %v, want %v", i, b.Key, want)
+		}
+		docs += b.DocCount
+	}
+	if docs != 3 {
+		t.Errorf("buckets hold %d values, want 3: %s", docs, got)
+	}
+}
+
+func TestHistogram_TooManyBuckets(t *testing.T) {
+	one := int64(1)
+	many := make([]testDoc, MaxBuckets+1)
+	for i := range many {
+		many[i] = testDoc{prices: []float64{float64(i)}}
+	}
+	tests := []struct {
+		name string
+		req  Request
+		segs []engine.Segment
+	}{
+		{"distinct buckets", Request{Histogram: &HistogramRequest{Field: "price", Interval: 1, MinDocCount: &one}},
+			[]engine.Segment{productSegment(t, many...)}},
+		{"filled gaps", Request{Histogram: &HistogramRequest{Field: "price", Interval: 1}},
+			[]engine.Segment{productSegment(t, testDoc{prices: []float64{0, float64(MaxBuckets)}})}},
+		{"filled calendar gaps", Request{DateHistogram: &DateHistogramRequest{Field: "when", CalendarInterval: "day"}},
+			[]engine.Segment{productSegment(t, testDoc{when: "1990-01-01T00:00:00Z"}, testDoc{when: "2024-01-01T00:00:00Z"})}},
+		{"sub-aggregation", Request{
+			Terms:        &TermsRequest{Field: "tags"},
+			Aggregations: map[string]Request{"h": {Histogram: &HistogramRequest{Field: "price", Interval: 0.001}}},
+		}, []engine.Segment{productSegment(t, testDoc{tag: "a", prices: []float64{0, 100}})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCollector(testSchema(), map[string]Request{"agg": tt.req})
+			if err != nil {
+				t.Fatal(err)
+			}
+			collectAll(t, c, tt.segs...)
+			if _, err := c.Results(); !errors.Is(err, ErrInvalidAggregation) {
+				t.Errorf("expected ErrInvalidAggregation, got %v", err)
+			}
+		})
+	}
+
+	// Shards within the limit on their own can exceed it together.
+	req := map[string]Request{"h": {Histogram: &HistogramRequest{Field: "price", Interval: 1}}}
+	var shards []map[string]*Partial
+	for _, price := range []float64{0, MaxBuckets} {
+		c, err := NewCollector(testSchema(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		collectAll(t, c, productSegment(t, testDoc{prices: []float64{price}}))
+		shards = append(shards, c.Partials())
+	}
+	if _, err := Reduce(req, shards...); !errors.Is(err, ErrInvalidAggregation) {
+		t.Errorf("reduce: expected ErrInvalidAggregation, got %v", err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	got := runAggs(t, map[string]Request{
+		"prices": {Range: &RangeRequest{Field: "price", Ranges: []RangeSpec{
+			{To: 10}, {Key: "mid", From: 10, To: 100}, {From: 100},
+		}}},
+		"dates": {Range: &RangeRequest{Field: "when", Ranges: []RangeSpec{
+			{From: "2024-02-01"},
+		}}},
+	}, productSegments(t)...)
+	want := `{"dates":{"buckets":[{"key":"2024-02-01T00:00:00.000Z-*","from":1706745600000,` +
+		`"from_as_string":"2024-02-01T00:00:00.000Z","doc_count":2}]},` +
+		`"prices":{"buckets":[{"key":"*-10","to":10,"doc_count":2},` +
+		`{"key":"mid","from":10,"to":100,"doc_count":2},{"key":"100-*","from":100,"doc_count":1}]}}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestSubAggregations(t *testing.T) {
+	got := runAggs(t, map[string]Request{
+		"tags": {
+			Terms: &TermsRequest{Field: "tags", Size: 2},
+			Aggregations: map[string]Request{
+				"max_price": {Max: &MetricRequest{Field: "price"}},
+				"months": {
+					DateHistogram: &DateHistogramRequest{Field: "when", CalendarInterval: "month"},
+					Aggregations: map[string]Request{
+						"n": {ValueCount: &MetricRequest{Field: "price"}},
+					},
+				},
+			},
+		},
+	}, productSegments(t)...)
+	want := `{"tags":{"sum_other_doc_count":1,"buckets":[` +
+		`{"key":"a","doc_count":2,"max_price":{"value":12},"months":{"buckets":[` +
+		`{"key":1704067200000,"key_as_string":"2024-01-01T00:00:00.000Z","doc_count":1,"n":{"value":2}},` +
+		`{"key":1706745600000,"key_as_string":"2024-02-01T00:00:00.000Z","doc_count":0,"n":{"value":0}},` +
+		`{"key":1709251200000,"key_as_string":"2024-03-01T00:00:00.000Z","doc_count":1,"n":{"value":0}}]}},` +
+		`{"key":"b","doc_count":2,"max_price":{"value":120.5},"months":{"buckets":[` +
+		`{"key":1704067200000,"key_as_string":"2024-01-01T00:00:00.000Z","doc_count":1,"n":{"value":1}},` +
+		`{"key":1706745600000,"key_as_string":"2024-02-01T00:00:00.000Z","doc_count":0,"n":{"value":0}},` +
+		`{"key":1709251200000,"key_as_string":"2024-03-01T00:00:00.000Z","doc_count":1,"n":{"value":1}}]}}]}}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestReduce_MatchesSingleCollector(t *testing.T) {
+	reqs := map[string]Request{
+		"tags": {
+			Terms:        &TermsRequest{Field: "tags", Size: 1},
+			Aggregations: map[string]Request{"avg": {Avg: &MetricRequest{Field: "price"}}},
+		},
+		"hist":     {Histogram: &HistogramRequest{Field: "price", Interval: 25}},
+		"distinct": {Cardinality: &CardinalityRequest{Field: "price"}},
+		"first":    {Min: &MetricRequest{Field: "when"}},
+	}
+	segs := productSegments(t)
+	want := runAggs(t, reqs, segs...)
+
+	// Each segment plays the role of a shard whose partials travel as JSON.
+	var shards []map[string]*Partial
+	for _, seg := range segs {
+		c, err := NewCollector(testSchema(), reqs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		collectAll(t, c, seg)
+		data, err := json.Marshal(c.Partials())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var partials map[string]*Partial
+		if err := json.Unmarshal(data, &partials); err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, partials)
+	}
+	reduced, err := Reduce(reqs, shards...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(reduced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); got != want {
+		t.Errorf("reduced  %s\nsingle   %s", got, want)
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{10, 1000, 100_000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			a, b := newHyperLogLog(DefaultPrecision), newHyperLogLog(DefaultPrecision)
+			// b overlaps a by half.
+			for i := 0; i < n; i++ {
+				a.add(hashInt(int64(i)))
+				b.add(hashInt(int64(i + n/2)))
+			}
+			a.merge(hyperLogLogFromPartial(b.partial()))
+			want := float64(n + n/2)
+			got := float64(a.estimate())
+			if math.Abs(got-want)/want > 0.05 {
+				t.Errorf("estimate = %v, want %v within 5%%", got, want)
+			}
+			if n == 10 && got != want {
+				t.Errorf("small estimate = %v, want exact %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package aggregation
+
+import "GoSearch/internal/engine"
+
+// bucket is the per-bucket state of a bucket aggregation: its document
+// count and, when the request has sub-aggregations, their aggregators.
+type bucket struct {
+	docCount int64
+	subs     *aggregatorSet
+}
+
+// buckets creates buckets for a bucket aggregation and keeps the
+// sub-aggregators of every bucket positioned on the current segment.
+type buckets struct {
+	subSpec *setSpec
+	seg     engine.Segment
+	all     []*bucket
+}
+
+func (b *buckets) newBucket() *bucket {
+	bk := &bucket{}
+	if b.subSpec != nil {
+		bk.subs = b.subSpec.newSet()
+		if b.seg != nil {
+			bk.subs.setSegment(b.seg)
+		}
+	}
+	b.all = append(b.all, bk)
+	return bk
+}
+
+func (b *buckets) setSegment(seg engine.Segment) {
+	b.seg = seg
+	for _, bk := range b.all {
+		if bk.subs != nil {
+			bk.subs.setSegment(seg)
+		}
+	}
+}
+
+// err returns the first error of a bucket's sub-aggregations.
+func (b *buckets) err() error {
+	for _, bk := range b.all {
+		if bk.subs != nil {
+			if err := bk.subs.err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (bk *bucket) collect(docID uint32) {
+	bk.docCount++
+	if bk.subs != nil {
+		bk.subs.collect(docID)
+	}
+}
+
+func (bk *bucket) partial(key interface{}) *PartialBucket {
+	pb := &PartialBucket{Key: key, DocCount: bk.docCount}
+	if bk.subs != nil {
+		pb.Aggregations = bk.subs.partials()
+	}
+	return pb
+}
@@ -0,0 +1,459 @@
+package aggregation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+)
+
+// HistogramRequest buckets numeric values into fixed-width intervals. The
+// bucket of value v has key floor((v-offset)/interval)*interval + offset.
+//
+//	{"field": "price", "interval": 50}
+type HistogramRequest struct {
+	Field    string  `json:"field"`
+	Interval float64 `json:"interval"`
+	Offset   float64 `json:"offset,omitempty"`
+
+	// MinDocCount drops buckets with fewer documents. Defaults to 0, which
+	// also returns the empty buckets between the first and last key.
+	MinDocCount *int64 `json:"min_doc_count,omitempty"`
+}
+
+// DateHistogramRequest buckets date values by calendar unit or fixed
+// duration. Exactly one of CalendarInterval and FixedInterval must be set.
+//
+//	{"field": "published", "calendar_interval": "month", "time_zone": "Europe/Paris"}
+type DateHistogramRequest struct {
+	Field string `json:"field"`
+
+	// CalendarInterval is one of minute, hour, day, week, month, quarter or
+	// year (or 1m, 1h, 1d, 1w, 1M, 1q, 1y). Weeks start on Monday.
+	CalendarInterval string `json:"calendar_interval,omitempty"`
+
+	// FixedInterval is a multiple of ms, s, m, h or d, such as "90m".
+	FixedInterval string `json:"fixed_interval,omitempty"`
+
+	// TimeZone is an IANA name or a "+hh:mm" offset that calendar buckets
+	// are aligned to. Defaults to UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+
+	// MinDocCount behaves as in HistogramRequest.
+	MinDocCount *int64 `json:"min_doc_count,omitempty"`
+}
+
+var calendarUnits = map[string]string{
+	"minute": "minute", "1m": "minute",
+	"hour": "hour", "1h": "hour",
+	"day": "day", "1d": "day",
+	"week": "week", "1w": "week",
+	"month": "month", "1M": "month",
+	"quarter": "quarter", "1q": "quarter",
+	"year": "year", "1y": "year",
+}
+
+// histogramParams are the validated options of a histogram or
+// date_histogram request. Buckets are identified by an integer: bucket maps
+// a value to its bucket, key and index convert between a bucket and its
+// key, and next returns the following bucket. Keys are computed from the
+// bucket rather than by adding intervals, so that every value and every
+// filled gap of a bucket agree on its key.
+type histogramParams struct {
+	bucket      func(v float64) (int64, bool)
+	key         func(b int64) float64
+	index       func(key float64) int64
+	next        func(b int64) int64
+	uniform     bool // next(b) is b+1
+	minDocCount int64
+	loc         *time.Location
+}
+
+// maxBucketIndex bounds bucket numbers so that spans between them do not
+// overflow and their keys stay exact.
+const maxBucketIndex = 1 << 53
+
+// uniformBuckets numbers the buckets of width interval from offset.
+func uniformBuckets(p *histogramParams, interval, offset float64) {
+	p.bucket = func(v float64) (int64, bool) {
+		b := math.Floor((v - offset) / interval)
+		if !(math.Abs(b) <= maxBucketIndex) {
+			return 0, false
+		}
+		return int64(b), true
+	}
+	p.key = func(b int64) float64 { return offset + float64(b)*interval }
+	p.index = func(key float64) int64 { return int64(math.Round((key - offset) / interval)) }
+	p.next = func(b int64) int64 { return b + 1 }
+	p.uniform = true
+}
+
+// span returns the number of buckets from lo through hi, or limit+1 if
+// there are more than limit.
+func (p *histogramParams) span(lo, hi int64, limit int) int {
+	if p.uniform {
+		if hi-lo < int64(limit) {
+			return int(hi-lo) + 1
+		}
+		return limit + 1
+	}
+	n := 1
+	for b := lo; b < hi && n <= limit; b = p.next(b) {
+		n++
+	}
+	return n
+}
+
+func errTooManyBuckets(field string) error {
+	return fmt.Errorf("%w: too many buckets, histogram on %q would have more than %d", ErrInvalidAggregation, field, MaxBuckets)
+}
+
+func parseMinDocCount(v *int64) (int64, error) {
+	if v == nil {
+		return 0, nil
+	}
+	if *v < 0 {
+		return 0, fmt.Errorf("%w: min_doc_count must not be negative", ErrInvalidAggregation)
+	}
+	return *v, nil
+}
+
+func parseHistogram(req HistogramRequest) (*histogramParams, error) {
+	interval, offset := req.Interval, req.Offset
+	if !(interval > 0) || math.IsInf(interval, 0) {
+		return nil, fmt.Errorf("%w: histogram interval must be positive", ErrInvalidAggregation)
+	}
+	minDocCount, err := parseMinDocCount(req.MinDocCount)
+	if err != nil {
+		return nil, err
+	}
+	p := &histogramParams{minDocCount: minDocCount}
+	uniformBuckets(p, interval, offset)
+	return p, nil
+}
+
+func parseDateHistogram(req DateHistogramRequest) (*histogramParams, error) {
+	minDocCount, err := parseMinDocCount(req.MinDocCount)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := loadTimeZone(req.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	p := &histogramParams{minDocCount: minDocCount, loc: loc}
+
+	switch {
+	case req.CalendarInterval != "" && req.FixedInterval != "":
+		return nil, fmt.Errorf("%w: only one of calendar_interval and fixed_interval may be set", ErrInvalidAggregation)
+	case req.FixedInterval != "":
+		interval, err := parseFixedInterval(req.FixedInterval)
+		if err != nil {
+			return nil, err
+		}
+		uniformBuckets(p, interval, 0)
+	case req.CalendarInterval != "":
+		unit, ok := calendarUnits[req.CalendarInterval]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown calendar_interval %q", ErrInvalidAggregation, req.CalendarInterval)
+		}
+		// Calendar buckets are numbered by their start in epoch milliseconds.
+		p.bucket = func(v float64) (int64, bool) {
+			if !(math.Abs(v) <= maxBucketIndex) {
+				return 0, false
+			}
+			return truncateTime(time.UnixMilli(int64(v)).In(loc), unit).UnixMilli(), true
+		}
+		p.key = func(b int64) float64 { return float64(b) }
+		p.index = func(key float64) int64 { return int64(key) }
+		p.next = func(b int64) int64 {
+			return truncateTime(addCalendarUnit(time.UnixMilli(b).In(loc), unit), unit).UnixMilli()
+		}
+	default:
+		return nil, fmt.Errorf("%w: date_histogram requires calendar_interval or fixed_interval", ErrInvalidAggregation)
+	}
+	return p, nil
+}
+
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "UTC" || name == "Z" {
+		return time.UTC, nil
+	}
+	if name[0] == '+' || name[0] == '-' {
+		t, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid time_zone %q", ErrInvalidAggregation, name)
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(name, offset), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid time_zone %q", ErrInvalidAggregation, name)
+	}
+	return loc, nil
+}
+
+func parseFixedInterval(s string) (float64, error) {
+	ms, err := numeric.ParseDuration(s)
+	if err == nil && ms > 0 {
+		return float64(ms), nil
+	}
+	return 0, fmt.Errorf("%w: invalid fixed_interval %q", ErrInvalidAggregation, s)
+}
+
+func truncateTime(t time.Time, unit string) time.Time {
+	y, mo, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case "minute":
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, loc)
+	case "hour":
+		return time.Date(y, mo, d, t.Hour(), 0, 0, 0, loc)
+	case "day":
+		return time.Date(y, mo, d, 0, 0, 0, 0, loc)
+	case "week":
+		return time.Date(y, mo, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(y, mo, 1, 0, 0, 0, 0, loc)
+	case "quarter":
+		return time.Date(y, (mo-1)/3*3+1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+func addCalendarUnit(t time.Time, unit string) time.Time {
+	switch unit {
+	case "minute":
+		return t.Add(time.Minute)
+	case "hour":
+		return t.Add(time.Hour)
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	default:
+		return t.AddDate(1, 0, 0)
+	}
+}
+
+type histogramSpec struct {
+	typ    string
+	src    *fieldSource
+	params *histogramParams
+	subs   *setSpec
+}
+
+func compileHistogram(schema *index.Schema, req HistogramRequest, subs *setSpec) (spec, error) {
+	src, err := newFieldSource(schema, req.Field, true, false)
+	if err != nil {
+		return nil, err
+	}
+	params, err := parseHistogram(req)
+	if err != nil {
+		return nil, err
+	}
+	return &histogramSpec{typ: TypeHistogram, src: src, params: params, subs: subs}, nil
+}
+
+func compileDateHistogram(schema *index.Schema, req DateHistogramRequest, subs *setSpec) (spec, error) {
+	src, err := newFieldSource(schema, req.Field, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if !src.isDate() {
+		return nil, fmt.Errorf("%w: field %q is not a date field", ErrInvalidAggregation, req.Field)
+	}
+	params, err := parseDateHistogram(req)
+	if err != nil {
+		return nil, err
+	}
+	return &histogramSpec{typ: TypeDateHistogram, src: src, params: params, subs: subs}, nil
+}
+
+func (s *histogramSpec) newAggregator() aggregator {
+	return &histogramAggregator{
+		spec:    s,
+		src:     s.src.clone(),
+		buckets: buckets{subSpec: s.subs},
+		byIndex: make(map[int64]*bucket),
+	}
+}
+
+// histogramAggregator keeps one bucket per bucket number. A document with
+// several values in the same bucket is counted once.
+type histogramAggregator struct {
+	spec *histogramSpec
+	src  *fieldSource
+	buckets
+
+	byIndex map[int64]*bucket
+
+	// lo and hi are the first and last buckets, and span the number of
+	// buckets from lo through hi, which the response fills in when
+	// min_doc_count is 0.
+	lo, hi int64
+	span   int
+	failed error
+}
+
+func (a *histogramAggregator) setSegment(seg engine.Segment) {
+	a.buckets.setSegment(seg)
+	a.src.setSegment(seg)
+}
+
+func (a *histogramAggregator) collect(docID uint32) {
+	if a.failed != nil {
+		return
+	}
+	var last int64
+	// Values are sorted, so equal buckets are adjacent.
+	for i, v := range a.src.values(docID) {
+		f := a.src.float(v)
+		b, ok := a.spec.params.bucket(f)
+		if !ok {
+			a.failed = fmt.Errorf("%w: value %v of %q is out of range for the histogram", ErrInvalidAggregation, f, a.src.field)
+			return
+		}
+		if i > 0 && b == last {
+			continue
+		}
+		last = b
+		bk := a.byIndex[b]
+		if bk == nil {
+			if a.failed = a.grow(b); a.failed != nil {
+				return
+			}
+			bk = a.newBucket()
+			a.byIndex[b] = bk
+		}
+		bk.collect(docID)
+	}
+}
+
+// grow accounts for a new bucket b, and for the empty buckets the response
+// will fill in around it, failing once there would be more than
+// MaxBuckets.
+func (a *histogramAggregator) grow(b int64) error {
+	p := a.spec.params
+	switch {
+	case len(a.byIndex) == 0:
+		a.lo, a.hi, a.span = b, b, 1
+	case b < a.lo:
+		a.span += p.span(b, a.lo, MaxBuckets) - 1
+		a.lo = b
+	case b > a.hi:
+		a.span += p.span(a.hi, b, MaxBuckets) - 1
+		a.hi = b
+	}
+	n := len(a.byIndex) + 1
+	if p.minDocCount == 0 {
+		n = a.span
+	}
+	if n > MaxBuckets {
+		return errTooManyBuckets(a.src.field)
+	}
+	return nil
+}
+
+func (a *histogramAggregator) err() error {
+	if a.failed != nil {
+		return a.failed
+	}
+	return a.buckets.err()
+}
+
+func (a *histogramAggregator) partial() *Partial {
+	p := &Partial{Type: a.spec.typ, Date: a.src.isDate(), Buckets: make([]*PartialBucket, 0, len(a.byIndex))}
+	for b, bk := range a.byIndex {
+		p.Buckets = append(p.Buckets, bk.partial(a.spec.params.key(b)))
+	}
+	sortByNumericKey(p.Buckets)
+	return p
+}
+
+func sortByNumericKey(buckets []*PartialBucket) {
+	sort.Slice(buckets, func(i, j int) bool {
+		return numericKey(buckets[i].Key) < numericKey(buckets[j].Key)
+	})
+}
+
+func finalizeHistogram(req Request, p *Partial) (*Result, error) {
+	var params *histogramParams
+	var field string
+	if req.Histogram != nil {
+		params, _ = parseHistogram(*req.Histogram)
+		field = req.Histogram.Field
+	} else {
+		params, _ = parseDateHistogram(*req.DateHistogram)
+		field = req.DateHistogram.Field
+	}
+	res := &Result{Type: p.Type, Buckets: []Bucket{}}
+	if params == nil {
+		return res, nil
+	}
+
+	partials := append([]*PartialBucket(nil), p.Buckets...)
+	sortByNumericKey(partials)
+	if params.minDocCount == 0 && len(partials) > 1 {
+		// Fill the gaps between the first and last buckets with empty ones.
+		lo, hi := params.index(numericKey(partials[0].Key)), params.index(numericKey(partials[len(partials)-1].Key))
+		n := params.span(lo, hi, MaxBuckets)
+		if n > MaxBuckets {
+			return nil, errTooManyBuckets(field)
+		}
+		byIndex := make(map[int64]*PartialBucket, len(partials))
+		for _, b := range partials {
+			byIndex[params.index(numericKey(b.Key))] = b
+		}
+		filled := make([]*PartialBucket, 0, n)
+		for b := lo; ; b = params.next(b) {
+			pb := byIndex[b]
+			if pb == nil {
+				pb = &PartialBucket{Key: params.key(b)}
+			}
+			filled = append(filled, pb)
+			if b >= hi {
+				break
+			}
+		}
+		partials = filled
+	}
+
+	for _, b := range partials {
+		if b.DocCount < params.minDocCount {
+			continue
+		}
+		if len(res.Buckets) == MaxBuckets {
+			return nil, errTooManyBuckets(field)
+		}
+		key := numericKey(b.Key)
+		out, err := finalizeBucket(req, b, key)
+		if err != nil {
+			return nil, err
+		}
+		if p.Date {
+			out.Key = int64(key)
+			out.KeyAsString = formatDateIn(int64(key), params.loc)
+		}
+		res.Buckets = append(res.Buckets, out)
+	}
+	return res, nil
+}
+
+// formatDateIn renders epoch milliseconds as RFC 3339 in a time zone.
+func formatDateIn(ms int64, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.UnixMilli(ms).In(loc).Format("2006-01-02T15:04:05.000Z07:00")
+}
@@ -0,0 +1,157 @@
+package aggregation
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// HyperLogLog precision bounds. Precision p uses 2^p one-byte registers and
+// has a standard error of about 1.04/sqrt(2^p).
+const (
+	DefaultPrecision = 12
+	MinPrecision     = 4
+	MaxPrecision     = 16
+)
+
+// hyperLogLog estimates the number of distinct 64-bit hashes added to it.
+// While small it keeps the exact set of hashes, switching to registers once
+// the set would use more memory than they do.
+type hyperLogLog struct {
+	precision uint8
+	hashes    map[uint64]struct{}
+	registers []uint8
+}
+
+func newHyperLogLog(precision uint8) *hyperLogLog {
+	return &hyperLogLog{precision: precision, hashes: make(map[uint64]struct{})}
+}
+
+// sparseLimit is the largest exact set kept before switching to registers.
+func (h *hyperLogLog) sparseLimit() int {
+	return (1 << h.precision) / 8
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	if h.registers == nil {
+		h.hashes[hash] = struct{}{}
+		if len(h.hashes) > h.sparseLimit() {
+			h.toRegisters()
+		}
+		return
+	}
+	idx := hash >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) toRegisters() {
+	h.registers = make([]uint8, 1<<h.precision)
+	for hash := range h.hashes {
+		h.add(hash)
+	}
+	h.hashes = nil
+}
+
+// merge folds another sketch of the same precision into h.
+func (h *hyperLogLog) merge(o *hyperLogLog) {
+	if o.registers != nil && len(o.registers) != 1<<h.precision {
+		return
+	}
+	if o.registers != nil && h.registers == nil {
+		h.toRegisters()
+	}
+	for hash := range o.hashes {
+		h.add(hash)
+	}
+	for i, r := range o.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	if h.registers == nil {
+		return int64(len(h.hashes))
+	}
+	m := float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	switch m {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	}
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(e + 0.5)
+}
+
+// partial returns a copy of the sketch as cardinality partial state.
+func (h *hyperLogLog) partial() *Partial {
+	p := &Partial{Type: TypeCardinality, Precision: h.precision}
+	if h.registers != nil {
+		p.Registers = append([]byte(nil), h.registers...)
+	}
+	for hash := range h.hashes {
+		p.Hashes = append(p.Hashes, hash)
+	}
+	sort.Slice(p.Hashes, func(i, j int) bool { return p.Hashes[i] < p.Hashes[j] })
+	return p
+}
+
+// hyperLogLogFromPartial restores a sketch from cardinality partial state.
+func hyperLogLogFromPartial(p *Partial) *hyperLogLog {
+	precision := p.Precision
+	if precision < MinPrecision || precision > MaxPrecision {
+		precision = DefaultPrecision
+	}
+	h := newHyperLogLog(precision)
+	if len(p.Registers) == 1<<precision {
+		h.registers = append([]uint8(nil), p.Registers...)
+		h.hashes = nil
+	}
+	for _, hash := range p.Hashes {
+		h.add(hash)
+	}
+	return h
+}
+
+// hashInt and hashString give well-mixed hashes that are stable across
+// processes, so sketches built on different shards can be merged.
+func hashInt(v int64) uint64 {
+	return mix64(uint64(v))
+}
+
+func hashString(s string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(s))
+	return mix64(f.Sum64())
+}
+
+// mix64 is the MurmurHash3 64-bit finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
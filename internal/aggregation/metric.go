@@ -0,0 +1,153 @@
+package aggregation
+
+import (
+	"fmt"
+	"math"
+
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+)
+
+// MetricRequest computes a single value over a field: min, max, avg and
+// sum take numeric fields; value_count also takes keyword fields.
+//
+//	{"field": "price"}
+type MetricRequest struct {
+	Field string `json:"field"`
+}
+
+// CardinalityRequest approximately counts the distinct values of a numeric
+// or keyword field using HyperLogLog.
+//
+//	{"field": "tags", "precision": 14}
+type CardinalityRequest struct {
+	Field string `json:"field"`
+
+	// Precision is the number of register index bits, between MinPrecision
+	// and MaxPrecision. Defaults to DefaultPrecision. Counts up to
+	// 2^precision/8 are exact.
+	Precision int `json:"precision,omitempty"`
+}
+
+type metricSpec struct {
+	typ string
+	src *fieldSource
+}
+
+func compileMetric(schema *index.Schema, typ string, req MetricRequest) (spec, error) {
+	src, err := newFieldSource(schema, req.Field, true, typ == TypeValueCount)
+	if err != nil {
+		return nil, err
+	}
+	return &metricSpec{typ: typ, src: src}, nil
+}
+
+func (s *metricSpec) newAggregator() aggregator {
+	return &metricAggregator{
+		spec: s,
+		src:  s.src.clone(),
+		min:  math.Inf(1),
+		max:  math.Inf(-1),
+	}
+}
+
+// metricAggregator tracks the count, sum and bounds of a field's values;
+// each metric type reports the statistic it needs.
+type metricAggregator struct {
+	spec          *metricSpec
+	src           *fieldSource
+	count         int64
+	sum, min, max float64
+}
+
+func (a *metricAggregator) setSegment(seg engine.Segment) {
+	a.src.setSegment(seg)
+}
+
+func (a *metricAggregator) collect(docID uint32) {
+	if !a.src.isNumeric {
+		a.count += int64(len(a.src.docOrds(docID)))
+		return
+	}
+	for _, v := range a.src.values(docID) {
+		f := a.src.float(v)
+		a.count++
+		a.sum += f
+		a.min = math.Min(a.min, f)
+		a.max = math.Max(a.max, f)
+	}
+}
+
+func (a *metricAggregator) err() error { return nil }
+
+func (a *metricAggregator) partial() *Partial {
+	p := &Partial{Type: a.spec.typ, Date: a.src.isDate(), Count: a.count, Sum: a.sum}
+	if a.count > 0 && a.src.isNumeric {
+		p.Min, p.Max = a.min, a.max
+	}
+	return p
+}
+
+type cardinalitySpec struct {
+	src       *fieldSource
+	precision uint8
+}
+
+func compileCardinality(schema *index.Schema, req CardinalityRequest) (spec, error) {
+	src, err := newFieldSource(schema, req.Field, true, true)
+	if err != nil {
+		return nil, err
+	}
+	p := req.Precision
+	if p == 0 {
+		p = DefaultPrecision
+	}
+	if p < MinPrecision || p > MaxPrecision {
+		return nil, fmt.Errorf("%w: precision must be between %d and %d", ErrInvalidAggregation, MinPrecision, MaxPrecision)
+	}
+	return &cardinalitySpec{src: src, precision: uint8(p)}, nil
+}
+
+func (s *cardinalitySpec) newAggregator() aggregator {
+	return &cardinalityAggregator{src: s.src.clone(), hll: newHyperLogLog(s.precision)}
+}
+
+// cardinalityAggregator adds the hash of every value to a sketch. Keyword
+// hashes are cached per ordinal for the current segment.
+type cardinalityAggregator struct {
+	src       *fieldSource
+	hll       *hyperLogLog
+	ordHashes []uint64
+	ordHashed []bool
+}
+
+func (a *cardinalityAggregator) setSegment(seg engine.Segment) {
+	a.src.setSegment(seg)
+	a.ordHashes, a.ordHashed = nil, nil
+	if a.src.ords != nil {
+		a.ordHashes = make([]uint64, a.src.ords.ValueCount())
+		a.ordHashed = make([]bool, a.src.ords.ValueCount())
+	}
+}
+
+func (a *cardinalityAggregator) collect(docID uint32) {
+	if a.src.isNumeric {
+		for _, v := range a.src.values(docID) {
+			a.hll.add(hashInt(v))
+		}
+		return
+	}
+	for _, ord := range a.src.docOrds(docID) {
+		if !a.ordHashed[ord] {
+			a.ordHashes[ord] = hashString(a.src.ords.LookupOrd(ord))
+			a.ordHashed[ord] = true
+		}
+		a.hll.add(a.ordHashes[ord])
+	}
+}
+
+func (a *cardinalityAggregator) err() error { return nil }
+
+func (a *cardinalityAggregator) partial() *Partial {
+	return a.hll.partial()
+}
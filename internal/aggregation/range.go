@@ -0,0 +1,200 @@
+package aggregation
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+)
+
+// RangeRequest buckets documents by value ranges. Ranges include From and
+// exclude To, may overlap, and are returned in request order.
+//
+//	{"field": "price", "ranges": [{"to": 50}, {"from": 50, "to": 100}, {"from": 100}]}
+type RangeRequest struct {
+	Field  string      `json:"field"`
+	Ranges []RangeSpec `json:"ranges"`
+}
+
+// RangeSpec is one range of a RangeRequest. From and To are numbers, or
+// dates for date fields; either may be omitted for an open bound. Key
+// defaults to "from-to" with "*" for an open bound.
+type RangeSpec struct {
+	Key  string      `json:"key,omitempty"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// rangeBounds is a validated range; open bounds are infinite.
+type rangeBounds struct {
+	key      string
+	from, to float64
+}
+
+func parseRanges(req RangeRequest, date bool) ([]rangeBounds, error) {
+	if len(req.Ranges) == 0 {
+		return nil, fmt.Errorf("%w: range requires at least one range", ErrInvalidAggregation)
+	}
+	if len(req.Ranges) > MaxBuckets {
+		return nil, fmt.Errorf("%w: more than %d ranges", ErrInvalidAggregation, MaxBuckets)
+	}
+	out := make([]rangeBounds, len(req.Ranges))
+	seen := make(map[string]bool, len(req.Ranges))
+	for i, r := range req.Ranges {
+		b := rangeBounds{key: r.Key, from: math.Inf(-1), to: math.Inf(1)}
+		var err error
+		if r.From != nil {
+			if b.from, err = parseBound(r.From, date); err != nil {
+				return nil, err
+			}
+		}
+		if r.To != nil {
+			if b.to, err = parseBound(r.To, date); err != nil {
+				return nil, err
+			}
+		}
+		if b.key == "" {
+			b.key = formatBound(b.from, date) + "-" + formatBound(b.to, date)
+		}
+		if seen[b.key] {
+			return nil, fmt.Errorf("%w: duplicate range key %q", ErrInvalidAggregation, b.key)
+		}
+		seen[b.key] = true
+		out[i] = b
+	}
+	return out, nil
+}
+
+func parseBound(v interface{}, date bool) (float64, error) {
+	if date {
+		ms, err := numeric.ParseDate(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: range bound: %v", ErrInvalidAggregation, err)
+		}
+		return float64(ms), nil
+	}
+	f, err := numeric.ParseDouble(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: range bound: %v", ErrInvalidAggregation, err)
+	}
+	return f, nil
+}
+
+func formatBound(f float64, date bool) string {
+	switch {
+	case math.IsInf(f, 0):
+		return "*"
+	case date:
+		return numeric.FormatDate(int64(f))
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
+
+type rangeSpec struct {
+	src    *fieldSource
+	ranges []rangeBounds
+	subs   *setSpec
+}
+
+func compileRange(schema *index.Schema, req RangeRequest, subs *setSpec) (spec, error) {
+	src, err := newFieldSource(schema, req.Field, true, false)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := parseRanges(req, src.isDate())
+	if err != nil {
+		return nil, err
+	}
+	return &rangeSpec{src: src, ranges: ranges, subs: subs}, nil
+}
+
+func (s *rangeSpec) newAggregator() aggregator {
+	a := &rangeAggregator{spec: s, src: s.src.clone(), buckets: buckets{subSpec: s.subs}}
+	a.byRange = make([]*bucket, len(s.ranges))
+	for i := range a.byRange {
+		a.byRange[i] = a.newBucket()
+	}
+	return a
+}
+
+// rangeAggregator keeps one bucket per range. A document is counted once
+// in each range that any of its values falls in.
+type rangeAggregator struct {
+	spec *rangeSpec
+	src  *fieldSource
+	buckets
+
+	byRange []*bucket
+}
+
+func (a *rangeAggregator) setSegment(seg engine.Segment) {
+	a.buckets.setSegment(seg)
+	a.src.setSegment(seg)
+}
+
+func (a *rangeAggregator) collect(docID uint32) {
+	values := a.src.values(docID)
+	if len(values) == 0 {
+		return
+	}
+	for i, r := range a.spec.ranges {
+		for _, v := range values {
+			if f := a.src.float(v); f >= r.from && f < r.to {
+				a.byRange[i].collect(docID)
+				break
+			}
+		}
+	}
+}
+
+func (a *rangeAggregator) partial() *Partial {
+	p := &Partial{Type: TypeRange, Date: a.src.isDate(), Buckets: make([]*PartialBucket, len(a.byRange))}
+	for i, bk := range a.byRange {
+		p.Buckets[i] = bk.partial(a.spec.ranges[i].key)
+	}
+	return p
+}
+
+func finalizeRange(req Request, p *Partial) (*Result, error) {
+	res := &Result{Type: TypeRange, Buckets: []Bucket{}}
+	ranges, err := parseRanges(*req.Range, p.Date)
+	if err != nil {
+		return res, nil
+	}
+	byKey := make(map[string]*PartialBucket, len(p.Buckets))
+	for _, b := range p.Buckets {
+		if key, ok := b.Key.(string); ok {
+			byKey[key] = b
+		}
+	}
+	for _, r := range ranges {
+		pb := byKey[r.key]
+		if pb == nil {
+			pb = &PartialBucket{Key: r.key}
+		}
+		out, err := finalizeBucket(req, pb, r.key)
+		if err != nil {
+			return nil, err
+		}
+		if !math.IsInf(r.from, 0) {
+			from := r.from
+			out.From = &from
+			if p.Date {
+				out.FromAsString = numeric.FormatDate(int64(from))
+			}
+		}
+		if !math.IsInf(r.to, 0) {
+			to := r.to
+			out.To = &to
+			if p.Date {
+				out.ToAsString = numeric.FormatDate(int64(to))
+			}
+		}
+		res.Buckets = append(res.Buckets, out)
+	}
+	return res, nil
+}
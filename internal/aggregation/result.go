@@ -0,0 +1,329 @@
+package aggregation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"GoSearch/internal/numeric"
+)
+
+// Partial is the mergeable state of one aggregation over part of the
+// corpus, such as a single shard. Partials of the same request are
+// combined with Merge and turned into a Result by Reduce. A Partial
+// round-trips through JSON so shards can return it to a coordinator.
+type Partial struct {
+	Type string `json:"type"`
+
+	// Date is set when the values are epoch milliseconds of a date field.
+	Date bool `json:"date,omitempty"`
+
+	// Metric state. Min and Max are meaningful only when Count > 0.
+	Count int64   `json:"count,omitempty"`
+	Sum   float64 `json:"sum,omitempty"`
+	Min   float64 `json:"min,omitempty"`
+	Max   float64 `json:"max,omitempty"`
+
+	// Cardinality state: a HyperLogLog sketch of the given precision, as
+	// registers or, while small, as the exact set of value hashes.
+	Precision uint8    `json:"precision,omitempty"`
+	Registers []byte   `json:"registers,omitempty"`
+	Hashes    []uint64 `json:"hashes,omitempty"`
+
+	// Buckets of a bucket aggregation, including empty ones.
+	Buckets []*PartialBucket `json:"buckets,omitempty"`
+}
+
+// PartialBucket is one bucket of a Partial. Key is a string for terms and
+// range buckets, and a number for histogram buckets.
+type PartialBucket struct {
+	Key          interface{}         `json:"key"`
+	DocCount     int64               `json:"doc_count"`
+	Aggregations map[string]*Partial `json:"aggregations,omitempty"`
+}
+
+// Merge folds another partial of the same request into p.
+func (p *Partial) Merge(o *Partial) {
+	if o == nil {
+		return
+	}
+	if p.Type == "" {
+		p.Type = o.Type
+	}
+	p.Date = p.Date || o.Date
+
+	switch p.Type {
+	case TypeCardinality:
+		h := hyperLogLogFromPartial(p)
+		h.merge(hyperLogLogFromPartial(o))
+		merged := h.partial()
+		p.Precision, p.Registers, p.Hashes = merged.Precision, merged.Registers, merged.Hashes
+		return
+	case TypeMin, TypeMax, TypeAvg, TypeSum, TypeValueCount:
+		if o.Count > 0 {
+			if p.Count == 0 {
+				p.Min, p.Max = o.Min, o.Max
+			} else {
+				p.Min, p.Max = math.Min(p.Min, o.Min), math.Max(p.Max, o.Max)
+			}
+		}
+		p.Count += o.Count
+		p.Sum += o.Sum
+		return
+	}
+
+	byKey := make(map[interface{}]*PartialBucket, len(p.Buckets))
+	for _, b := range p.Buckets {
+		byKey[normalizeKey(b.Key)] = b
+	}
+	for _, ob := range o.Buckets {
+		key := normalizeKey(ob.Key)
+		b := byKey[key]
+		if b == nil {
+			b = &PartialBucket{Key: key}
+			byKey[key] = b
+			p.Buckets = append(p.Buckets, b)
+		}
+		b.DocCount += ob.DocCount
+		b.Aggregations = mergePartials(b.Aggregations, ob.Aggregations)
+	}
+}
+
+// mergePartials merges named partials of src into dst, returning dst.
+func mergePartials(dst, src map[string]*Partial) map[string]*Partial {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]*Partial, len(src))
+	}
+	for name, p := range src {
+		if dst[name] == nil {
+			dst[name] = &Partial{}
+		}
+		dst[name].Merge(p)
+	}
+	return dst
+}
+
+// normalizeKey makes bucket keys decoded from JSON comparable with keys
+// produced locally.
+func normalizeKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case string:
+		return k
+	case nil:
+		return nil
+	default:
+		return numericKey(k)
+	}
+}
+
+func numericKey(key interface{}) float64 {
+	switch k := key.(type) {
+	case float64:
+		return k
+	case int64:
+		return float64(k)
+	case int:
+		return float64(k)
+	case json.Number:
+		f, _ := k.Float64()
+		return f
+	default:
+		return math.NaN()
+	}
+}
+
+// Reduce merges the partials of each named aggregation, typically one map
+// per shard, and returns the final results. Aggregations missing from
+// every partial yield empty results. It fails when a histogram would have
+// more than MaxBuckets buckets.
+func Reduce(reqs map[string]Request, partials ...map[string]*Partial) (map[string]*Result, error) {
+	var merged map[string]*Partial
+	for _, ps := range partials {
+		merged = mergePartials(merged, ps)
+	}
+	out := make(map[string]*Result, len(reqs))
+	for name, req := range reqs {
+		res, err := finalize(req, merged[name])
+		if err != nil {
+			return nil, fmt.Errorf("aggregation %q: %w", name, err)
+		}
+		out[name] = res
+	}
+	return out, nil
+}
+
+func finalize(req Request, p *Partial) (*Result, error) {
+	if p == nil {
+		p = &Partial{}
+	}
+	typ := req.Type()
+	if p.Type == "" {
+		p.Type = typ
+	}
+	switch typ {
+	case TypeTerms:
+		return finalizeTerms(req, p)
+	case TypeHistogram, TypeDateHistogram:
+		return finalizeHistogram(req, p)
+	case TypeRange:
+		return finalizeRange(req, p)
+	case TypeCardinality:
+		n := float64(hyperLogLogFromPartial(p).estimate())
+		return &Result{Type: typ, Value: &n}, nil
+	case TypeValueCount:
+		n := float64(p.Count)
+		return &Result{Type: typ, Value: &n}, nil
+	case TypeSum:
+		sum := p.Sum
+		return &Result{Type: typ, Value: &sum}, nil
+	}
+
+	// min, max and avg have no value without documents.
+	res := &Result{Type: typ}
+	if p.Count == 0 {
+		return res, nil
+	}
+	var v float64
+	switch typ {
+	case TypeMin:
+		v = p.Min
+	case TypeMax:
+		v = p.Max
+	default:
+		v = p.Sum / float64(p.Count)
+	}
+	res.Value = &v
+	if p.Date {
+		res.ValueAsString = numeric.FormatDate(int64(math.Round(v)))
+	}
+	return res, nil
+}
+
+// finalizeBucket finalizes a bucket's sub-aggregations.
+func finalizeBucket(req Request, b *PartialBucket, key interface{}) (Bucket, error) {
+	out := Bucket{Key: key, DocCount: b.DocCount}
+	if len(req.Aggregations) > 0 {
+		var err error
+		if out.Aggregations, err = Reduce(req.Aggregations, b.Aggregations); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// Result is the final output of one aggregation. Metric aggregations set
+// Value, which is nil when there were no values to compute it from; bucket
+// aggregations set Buckets.
+type Result struct {
+	Type             string
+	Value            *float64
+	ValueAsString    string
+	SumOtherDocCount int64
+	Buckets          []Bucket
+}
+
+// Bucket is one bucket of a Result. Key is a string for terms and range
+// buckets, a number for histogram buckets and epoch milliseconds for date
+// histogram buckets.
+type Bucket struct {
+	Key          interface{}
+	KeyAsString  string
+	From, To     *float64
+	FromAsString string
+	ToAsString   string
+	DocCount     int64
+	Aggregations map[string]*Result
+}
+
+// MarshalJSON renders metric results as {"value": v} and bucket results as
+// {"buckets": [...]}, with sum_other_doc_count for terms.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	fields := &object{}
+	switch r.Type {
+	case TypeTerms, TypeHistogram, TypeDateHistogram, TypeRange:
+		if r.Type == TypeTerms {
+			fields.add("sum_other_doc_count", r.SumOtherDocCount)
+		}
+		buckets := r.Buckets
+		if buckets == nil {
+			buckets = []Bucket{}
+		}
+		fields.add("buckets", buckets)
+	default:
+		fields.add("value", r.Value)
+		if r.ValueAsString != "" {
+			fields.add("value_as_string", r.ValueAsString)
+		}
+	}
+	return fields.marshal()
+}
+
+// MarshalJSON renders a bucket with its sub-aggregations inlined by name.
+func (b Bucket) MarshalJSON() ([]byte, error) {
+	fields := &object{}
+	fields.add("key", b.Key)
+	if b.KeyAsString != "" {
+		fields.add("key_as_string", b.KeyAsString)
+	}
+	if b.From != nil {
+		fields.add("from", *b.From)
+	}
+	if b.FromAsString != "" {
+		fields.add("from_as_string", b.FromAsString)
+	}
+	if b.To != nil {
+		fields.add("to", *b.To)
+	}
+	if b.ToAsString != "" {
+		fields.add("to_as_string", b.ToAsString)
+	}
+	fields.add("doc_count", b.DocCount)
+	names := make([]string, 0, len(b.Aggregations))
+	for name := range b.Aggregations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields.add(name, b.Aggregations[name])
+	}
+	return fields.marshal()
+}
+
+// object is a JSON object that keeps its fields in insertion order.
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *object) add(key string, value interface{}) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+func (o *object) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
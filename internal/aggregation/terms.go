@@ -0,0 +1,203 @@
+package aggregation
+
+import (
+	"fmt"
+	"sort"
+
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+)
+
+// Terms order keys.
+const (
+	OrderCount = "_count"
+	OrderKey   = "_key"
+)
+
+// TermsRequest groups documents by the values of a keyword field.
+//
+//	{"field": "tags", "size": 10, "min_doc_count": 1, "order": {"_count": "desc"}}
+type TermsRequest struct {
+	Field string `json:"field"`
+
+	// Size is the number of buckets returned. Defaults to DefaultTermsSize.
+	Size int `json:"size,omitempty"`
+
+	// MinDocCount drops buckets with fewer documents. Defaults to 1; with 0,
+	// every value of the field is returned, including unmatched ones.
+	MinDocCount *int64 `json:"min_doc_count,omitempty"`
+
+	// Order is a single {key: direction} pair where key is "_count" or
+	// "_key" and direction is "asc" or "desc". Defaults to count descending.
+	// Ties are broken by key ascending.
+	Order map[string]string `json:"order,omitempty"`
+}
+
+// termsOptions are the validated options of a TermsRequest.
+type termsOptions struct {
+	size        int
+	minDocCount int64
+	byKey       bool
+	ascending   bool
+}
+
+func parseTermsOptions(req TermsRequest) (termsOptions, error) {
+	o := termsOptions{size: req.Size, minDocCount: 1}
+	if o.size == 0 {
+		o.size = DefaultTermsSize
+	}
+	if o.size < 0 || o.size > MaxTermsSize {
+		return o, fmt.Errorf("%w: terms size must be between 1 and %d", ErrInvalidAggregation, MaxTermsSize)
+	}
+	if req.MinDocCount != nil {
+		if *req.MinDocCount < 0 {
+			return o, fmt.Errorf("%w: min_doc_count must not be negative", ErrInvalidAggregation)
+		}
+		o.minDocCount = *req.MinDocCount
+	}
+	if len(req.Order) > 1 {
+		return o, fmt.Errorf("%w: terms order takes a single key", ErrInvalidAggregation)
+	}
+	for key, dir := range req.Order {
+		switch key {
+		case OrderCount:
+		case OrderKey:
+			o.byKey = true
+		default:
+			return o, fmt.Errorf("%w: unknown terms order key %q", ErrInvalidAggregation, key)
+		}
+		switch dir {
+		case "asc":
+			o.ascending = true
+		case "desc":
+		default:
+			return o, fmt.Errorf("%w: order direction must be asc or desc", ErrInvalidAggregation)
+		}
+	}
+	return o, nil
+}
+
+type termsSpec struct {
+	src         *fieldSource
+	minDocCount int64
+	subs        *setSpec
+}
+
+func compileTerms(schema *index.Schema, req TermsRequest, subs *setSpec) (spec, error) {
+	src, err := newFieldSource(schema, req.Field, false, true)
+	if err != nil {
+		return nil, err
+	}
+	o, err := parseTermsOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	return &termsSpec{src: src, minDocCount: o.minDocCount, subs: subs}, nil
+}
+
+func (s *termsSpec) newAggregator() aggregator {
+	return &termsAggregator{
+		spec:    s,
+		src:     s.src.clone(),
+		buckets: buckets{subSpec: s.subs},
+		byTerm:  make(map[string]*bucket),
+	}
+}
+
+// termsAggregator keeps one bucket per term. Within a segment, ordinals are
+// resolved to their term's bucket on first use.
+type termsAggregator struct {
+	spec *termsSpec
+	src  *fieldSource
+	buckets
+
+	byTerm     map[string]*bucket
+	ordBuckets []*bucket
+}
+
+func (a *termsAggregator) setSegment(seg engine.Segment) {
+	a.buckets.setSegment(seg)
+	a.src.setSegment(seg)
+	a.ordBuckets = nil
+	if a.src.ords == nil {
+		return
+	}
+	a.ordBuckets = make([]*bucket, a.src.ords.ValueCount())
+	if a.spec.minDocCount == 0 {
+		for ord := range a.ordBuckets {
+			a.bucketFor(uint32(ord))
+		}
+	}
+}
+
+func (a *termsAggregator) bucketFor(ord uint32) *bucket {
+	if bk := a.ordBuckets[ord]; bk != nil {
+		return bk
+	}
+	term := a.src.ords.LookupOrd(ord)
+	bk := a.byTerm[term]
+	if bk == nil {
+		bk = a.newBucket()
+		a.byTerm[term] = bk
+	}
+	a.ordBuckets[ord] = bk
+	return bk
+}
+
+func (a *termsAggregator) collect(docID uint32) {
+	for _, ord := range a.src.docOrds(docID) {
+		a.bucketFor(ord).collect(docID)
+	}
+}
+
+// partial returns every term's bucket; size and min_doc_count are applied
+// only once all shards are reduced, so that counts stay exact.
+func (a *termsAggregator) partial() *Partial {
+	p := &Partial{Type: TypeTerms, Buckets: make([]*PartialBucket, 0, len(a.byTerm))}
+	for term, bk := range a.byTerm {
+		p.Buckets = append(p.Buckets, bk.partial(term))
+	}
+	sort.Slice(p.Buckets, func(i, j int) bool {
+		return p.Buckets[i].Key.(string) < p.Buckets[j].Key.(string)
+	})
+	return p
+}
+
+func finalizeTerms(req Request, p *Partial) (*Result, error) {
+	o, _ := parseTermsOptions(*req.Terms)
+	kept := make([]*PartialBucket, 0, len(p.Buckets))
+	for _, b := range p.Buckets {
+		if b.DocCount >= o.minDocCount {
+			kept = append(kept, b)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		ki, kj := fmt.Sprint(kept[i].Key), fmt.Sprint(kept[j].Key)
+		if !o.byKey && kept[i].DocCount != kept[j].DocCount {
+			if o.ascending {
+				return kept[i].DocCount < kept[j].DocCount
+			}
+			return kept[i].DocCount > kept[j].DocCount
+		}
+		if o.byKey && !o.ascending {
+			return ki > kj
+		}
+		return ki < kj
+	})
+
+	res := &Result{Type: TypeTerms, Buckets: []Bucket{}}
+	if len(kept) > o.size {
+		for _, b := range kept[o.size:] {
+			res.SumOtherDocCount += b.DocCount
+		}
+		kept = kept[:o.size]
+	}
+	for _, b := range kept {
+		out, err := finalizeBucket(req, b, b.Key)
+		if err != nil {
+			return nil, err
+		}
+		res.Buckets = append(res.Buckets, out)
+	}
+	return res, nil
+}
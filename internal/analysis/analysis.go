@@ -6,6 +6,10 @@ type Token struct {
 	Position  int
 	StartByte int
 	EndByte   int
+
+	// PositionLength is the number of positions the token spans in a token
+	// graph, as when "ny" stands for "new york". Zero means one.
+	PositionLength int
 }
 
 // Analyzer processes text into a stream of tokens.
@@ -1,7 +1,11 @@
 package analysis
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestStandardAnalyzer(t *testing.T) {
@@ -186,8 +190,8 @@ func TestRegistry_RegisterDuplicate(t *testing.T) {
 func TestRegistry_Names(t *testing.T) {
 	r := NewRegistry()
 	names := r.Names()
-	if len(names) != 3 {
-		t.Errorf("expected 3 names, got %d", len(names))
+	if len(names) != 4 {
+		t.Errorf("expected 4 names, got %d", len(names))
 	}
 }
 
@@ -216,3 +220,986 @@ func stringSliceEqual(a, b []string) bool {
 	}
 	return true
 }
+
+func TestPipeline_MatchesStandardAnalyzer(t *testing.T) {
+	p, err := NewPipeline(AnalyzerDef{Tokenizer: "standard", Filters: []string{"lowercase"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "The Quick-Brown fox_2 jumps, Ünïcode!"
+	got := p.Analyze("body", text)
+	want := NewStandardAnalyzer().Analyze("body", text)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPipeline_TokenizerOnly(t *testing.T) {
+	p, err := NewPipeline(AnalyzerDef{Tokenizer: "standard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tokenTerms(p.Analyze("body", "Hello World"))
+	if !reflect.DeepEqual(got, []string{"Hello", "World"}) {
+		t.Errorf("got %v, want [Hello World]", got)
+	}
+}
+
+// dashCharFilter deletes "--" sequences, recording offset corrections.
+type dashCharFilter struct{}
+
+func (dashCharFilter) Filter(text string) (string, []OffsetCorrection) {
+	var b strings.Builder
+	var corrections []OffsetCorrection
+	removed := 0
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], "--") {
+			i += 2
+			removed += 2
+			corrections = append(corrections, OffsetCorrection{Offset: b.Len(), Delta: removed})
+			continue
+		}
+		b.WriteByte(text[i])
+		i++
+	}
+	return b.String(), corrections
+}
+
+func TestPipeline_CharFilterOffsets(t *testing.T) {
+	p := &Pipeline{
+		CharFilters: []CharFilter{dashCharFilter{}, dashCharFilter{}},
+		Tokenizer:   WhitespaceTokenizer{},
+	}
+	text := "ab--c d----ef g"
+	tokens := p.Analyze("body", text)
+	if got := tokenTerms(tokens); !reflect.DeepEqual(got, []string{"abc", "def", "g"}) {
+		t.Fatalf("terms = %v, want [abc def g]", got)
+	}
+	wantSpans := []string{"ab--c", "d----ef", "g"}
+	for i, tok := range tokens {
+		if span := text[tok.StartByte:tok.EndByte]; span != wantSpans[i] {
+			t.Errorf("token %q spans %q, want %q", tok.Term, span, wantSpans[i])
+		}
+	}
+}
+
+func TestNewPipeline_Invalid(t *testing.T) {
+	tests := []AnalyzerDef{
+		{},
+		{Tokenizer: "nope"},
+		{Tokenizer: "standard", Filters: []string{"lowercase", "nope"}},
+		{CharFilters: []string{"nope"}, Tokenizer: "standard"},
+	}
+	for _, def := range tests {
+		if _, err := NewPipeline(def); !errors.Is(err, ErrInvalidAnalyzer) {
+			t.Errorf("NewPipeline(%+v) = %v, want ErrInvalidAnalyzer", def, err)
+		}
+	}
+}
+
+func TestRegistry_Define(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Define("lower_ws", AnalyzerDef{Tokenizer: "whitespace", Filters: []string{"lowercase"}}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := r.Get("lower_ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(a.Analyze("body", "Foo-Bar BAZ")); !reflect.DeepEqual(got, []string{"foo-bar", "baz"}) {
+		t.Errorf("got %v, want [foo-bar baz]", got)
+	}
+	if err := r.Define("standard", AnalyzerDef{Tokenizer: "keyword"}); err == nil {
+		t.Error("expected error redefining a built-in analyzer")
+	}
+}
+
+func TestStopFilter_KeepsPositionGaps(t *testing.T) {
+	p, err := NewPipeline(AnalyzerDef{Tokenizer: "standard", Filters: []string{"lowercase", "stop"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := p.Analyze("body", "The quick fox is in the den")
+	want := []Token{
+		{Term: "quick", Position: 1, StartByte: 4, EndByte: 9},
+		{Term: "fox", Position: 2, StartByte: 10, EndByte: 13},
+		{Term: "den", Position: 6, StartByte: 24, EndByte: 27},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("got %+v, want %+v", tokens, want)
+	}
+}
+
+func TestNewTokenFilter_Stop(t *testing.T) {
+	tests := []struct {
+		def  TokenFilterDef
+		text string
+		want []string
+	}{
+		{TokenFilterDef{Type: "stop"}, "the cat and the hat", []string{"cat", "hat"}},
+		{TokenFilterDef{Type: "stop", Stopwords: []string{"cat"}}, "the cat and the hat", []string{"the", "and", "the", "hat"}},
+		{TokenFilterDef{Type: "stop", Language: "english", Stopwords: []string{"cat"}}, "the cat and the hat", []string{"hat"}},
+		{TokenFilterDef{Type: "stop", Language: "french"}, "le chat et la souris", []string{"chat", "souris"}},
+		{TokenFilterDef{Type: "stop", IgnoreCase: true}, "The Cat", []string{"Cat"}},
+		{TokenFilterDef{Type: "stop"}, "The Cat", []string{"The", "Cat"}},
+	}
+	for _, tt := range tests {
+		f, err := NewTokenFilter(tt.def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := tokenTerms(f.Filter(WhitespaceTokenizer{}.Tokenize(tt.text)))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v on %q: got %v, want %v", tt.def, tt.text, got, tt.want)
+		}
+	}
+
+	for _, def := range []TokenFilterDef{{Type: "nope"}, {Type: "stop", Language: "klingon"}} {
+		if _, err := NewTokenFilter(def); !errors.Is(err, ErrInvalidAnalyzer) {
+			t.Errorf("NewTokenFilter(%+v) = %v, want ErrInvalidAnalyzer", def, err)
+		}
+	}
+}
+
+func TestPorter2Stem(t *testing.T) {
+	tests := map[string]string{
+		"running": "run", "runs": "run", "ran": "ran", "caresses": "caress",
+		"ponies": "poni", "ties": "tie", "cats": "cat", "hopping": "hop",
+		"hoping": "hope", "agreed": "agre", "feed": "feed", "fizzed": "fizz",
+		"generously": "generous", "skies": "sky", "dying": "die", "news": "news",
+		"succeeding": "succeed", "exceed": "exceed", "a": "a", "is": "is",
+		"consign": "consign", "consigned": "consign", "consigning": "consign",
+		"consignment": "consign", "consistency": "consist", "consistent": "consist",
+		"consolation": "consol", "consolatory": "consolatori", "conspiracy": "conspiraci",
+		"conspirator": "conspir", "constable": "constabl", "constancy": "constanc",
+		"knackeries": "knackeri", "knightly": "knight", "knives": "knive",
+		"knitting": "knit", "kneeling": "kneel", "knocker": "knocker",
+		"happiness": "happi", "relational": "relat", "hopefulness": "hope",
+		"café": "café",
+	}
+	for word, want := range tests {
+		if got := Porter2Stem(word); got != want {
+			t.Errorf("Porter2Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestRegistry_DefineTokenFilter(t *testing.T) {
+	r := NewRegistry()
+	if err := r.DefineTokenFilter("no_via", TokenFilterDef{Type: "stop", Stopwords: []string{"via"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Define("my_en", AnalyzerDef{Tokenizer: "standard", Filters: []string{"lowercase", "no_via", "porter2"}}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := r.Get("my_en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(a.Analyze("body", "Running via the Trains")); !reflect.DeepEqual(got, []string{"run", "the", "train"}) {
+		t.Errorf("got %v, want [run the train]", got)
+	}
+
+	if err := r.DefineTokenFilter("stop", TokenFilterDef{Type: "stop"}); err == nil {
+		t.Error("expected error redefining a built-in token filter")
+	}
+	if err := r.DefineTokenFilter("no_via", TokenFilterDef{Type: "stop"}); err == nil {
+		t.Error("expected error redefining a token filter")
+	}
+}
+
+func TestASCIIFold(t *testing.T) {
+	tests := map[string]string{
+		"cafe":           "cafe",
+		"café":           "cafe",
+		"Ærøskøbing":     "AEroskobing",
+		"straße":         "strasse",
+		"Łódź":           "Lodz",
+		"ＡＢＣ１２３":         "ABC123",
+		"ﬁnancial":       "financial",
+		"“quoted”—dash":  `"quoted"-dash`,
+		"日本":             "日本",
+		"naïve résumé":   "naive resume",
+	}
+	for in, want := range tests {
+		if got := ASCIIFold(in); got != want {
+			t.Errorf("ASCIIFold(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNFKC(t *testing.T) {
+	tests := []struct {
+		in, nfkc, caseFolded string
+	}{
+		{"Hello", "Hello", "hello"},
+		{"café", "café", "café"},
+		{"ＡＢＣ", "ABC", "abc"},
+		{"ﬁ", "fi", "fi"},
+		{"Straße", "Straße", "strasse"},
+		{"ΣΊΣΥΦΟΣ", "ΣΊΣΥΦΟΣ", "σίσυφοσ"},
+		{"\u212B", "\u00C5", "\u00E5"},
+		{"\u1100\u1161\u11A8", "\uAC01", "\uAC01"},
+		{"x\u0307\u0323", "\u1E8B\u0323", "\u1E8B\u0323"},
+		{"q\u0307\u0323", "q\u0323\u0307", "q\u0323\u0307"},
+		{"\u0345\u0308", "\u0308\u0345", "\u0308\u03B9"},
+		{"ｶﾞ", "ガ", "ガ"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := NFKC(tt.in); got != tt.nfkc {
+			t.Errorf("NFKC(%+q) = %+q, want %+q", tt.in, got, tt.nfkc)
+		}
+		if got := NFKCCaseFold(tt.in); got != tt.caseFolded {
+			t.Errorf("NFKCCaseFold(%+q) = %+q, want %+q", tt.in, got, tt.caseFolded)
+		}
+	}
+}
+
+func TestASCIIFoldingFilter_PreserveOriginal(t *testing.T) {
+	f, err := NewTokenFilter(TokenFilterDef{Type: "asciifolding", PreserveOriginal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.Filter(WhitespaceTokenizer{}.Tokenize("café au lait"))
+	want := []Token{
+		{Term: "cafe", Position: 0, StartByte: 0, EndByte: 5},
+		{Term: "café", Position: 0, StartByte: 0, EndByte: 5},
+		{Term: "au", Position: 1, StartByte: 6, EndByte: 8},
+		{Term: "lait", Position: 2, StartByte: 9, EndByte: 13},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPipeline_FoldingMatchesAcrossForms(t *testing.T) {
+	p, err := NewPipeline(AnalyzerDef{Tokenizer: "standard", Filters: []string{"nfkc_cf", "asciifolding"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := tokenTerms(p.Analyze("body", "CAFÉ Ｎａïｖｅ"))
+	b := tokenTerms(p.Analyze("body", "café naive"))
+	want := []string{"cafe", "naive"}
+	if !reflect.DeepEqual(a, want) || !reflect.DeepEqual(b, want) {
+		t.Errorf("got %v and %v, want %v", a, b, want)
+	}
+}
+
+func TestNGramTokenizer(t *testing.T) {
+	tok, err := NewNGramTokenizer(2, 3, false, []string{TokenCharLetter, TokenCharDigit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "ab-12c"
+	tokens := tok.Tokenize(text)
+	if got := tokenTerms(tokens); !reflect.DeepEqual(got, []string{"ab", "12", "12c", "2c"}) {
+		t.Fatalf("got %v, want [ab 12 12c 2c]", got)
+	}
+	for i, tk := range tokens {
+		if tk.Position != i {
+			t.Errorf("token %q position = %d, want %d", tk.Term, tk.Position, i)
+		}
+		if span := text[tk.StartByte:tk.EndByte]; span != tk.Term {
+			t.Errorf("token %q spans %q", tk.Term, span)
+		}
+	}
+}
+
+func TestNGramTokenizer_Edge(t *testing.T) {
+	tok, err := NewNGramTokenizer(1, 4, true, []string{TokenCharLetter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tokenTerms(tok.Tokenize("Zoë ok"))
+	if !reflect.DeepEqual(got, []string{"Z", "Zo", "Zoë", "o", "ok"}) {
+		t.Errorf("got %v, want [Z Zo Zoë o ok]", got)
+	}
+
+	// Without token_chars the whole text is one run.
+	tok, err = NewNGramTokenizer(2, 3, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(tok.Tokenize("a b")); !reflect.DeepEqual(got, []string{"a ", "a b"}) {
+		t.Errorf("got %q, want [\"a \" \"a b\"]", got)
+	}
+}
+
+func TestNGramTokenizer_TokenLimit(t *testing.T) {
+	tok, err := NewNGramTokenizer(1, 3, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tok.Tokenize(strings.Repeat("x", MaxNGramTokens))); got != MaxNGramTokens {
+		t.Errorf("got %d tokens, want %d", got, MaxNGramTokens)
+	}
+}
+
+func TestNGramFilter(t *testing.T) {
+	f, err := NewNGramFilter(2, 3, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.Filter(WhitespaceTokenizer{}.Tokenize("a sku42"))
+	want := []Token{
+		{Term: "sk", Position: 1, StartByte: 2, EndByte: 7},
+		{Term: "sku", Position: 1, StartByte: 2, EndByte: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	f, err = NewNGramFilter(2, 2, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(f.Filter(WhitespaceTokenizer{}.Tokenize("a abc"))); !reflect.DeepEqual(got, []string{"a", "ab", "bc", "abc"}) {
+		t.Errorf("got %v, want [a ab bc abc]", got)
+	}
+}
+
+func TestNGram_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		min, max   int
+		edge       bool
+		tokenChars []string
+	}{
+		{min: 3, max: 2},
+		{min: -1, max: 2},
+		{min: 1, max: MaxGram + 1, edge: true},
+		{min: 1, max: 2 + MaxNGramDiff},
+		{min: 1, max: 2, tokenChars: []string{"emoji"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewNGramTokenizer(tt.min, tt.max, tt.edge, tt.tokenChars); !errors.Is(err, ErrInvalidAnalyzer) {
+			t.Errorf("NewNGramTokenizer(%+v) = %v, want ErrInvalidAnalyzer", tt, err)
+		}
+	}
+	if _, err := NewNGramTokenizer(1, 20, true, nil); err != nil {
+		t.Errorf("edge n-grams are not limited by MaxNGramDiff: %v", err)
+	}
+}
+
+func TestRegistry_DefineTokenizer(t *testing.T) {
+	r := NewRegistry()
+	if err := r.DefineTokenizer("sku", TokenizerDef{Type: "ngram", MinGram: 3, MaxGram: 3, TokenChars: []string{"letter", "digit"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Define("sku_search", AnalyzerDef{Tokenizer: "sku", Filters: []string{"lowercase"}}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := r.Get("sku_search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(a.Analyze("sku", "AB-1234")); !reflect.DeepEqual(got, []string{"123", "234"}) {
+		t.Errorf("got %v, want [123 234]", got)
+	}
+	if err := r.DefineTokenizer("ngram", TokenizerDef{Type: "ngram"}); err == nil {
+		t.Error("expected error redefining a built-in tokenizer")
+	}
+	if _, err := NewTokenizer(TokenizerDef{Type: "nope"}); !errors.Is(err, ErrInvalidAnalyzer) {
+		t.Errorf("NewTokenizer(nope) = %v, want ErrInvalidAnalyzer", err)
+	}
+}
+
+func mustSynonyms(t *testing.T, ignoreCase bool, rules ...string) *SynonymGraphFilter {
+	t.Helper()
+	f, err := ParseSynonyms(rules, ignoreCase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestSynonymGraphFilter_MultiWord(t *testing.T) {
+	f := mustSynonyms(t, false, "ny, new york, big apple")
+	got := f.Filter(WhitespaceTokenizer{}.Tokenize("i love ny today"))
+	want := []Token{
+		{Term: "i", Position: 0, StartByte: 0, EndByte: 1},
+		{Term: "love", Position: 1, StartByte: 2, EndByte: 6},
+		{Term: "ny", Position: 2, PositionLength: 3, StartByte: 7, EndByte: 9},
+		{Term: "new", Position: 2, StartByte: 7, EndByte: 9},
+		{Term: "big", Position: 2, PositionLength: 2, StartByte: 7, EndByte: 9},
+		{Term: "york", Position: 3, PositionLength: 2, StartByte: 7, EndByte: 9},
+		{Term: "apple", Position: 4, StartByte: 7, EndByte: 9},
+		{Term: "today", Position: 5, StartByte: 10, EndByte: 15},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	var phrases []string
+	for _, path := range GraphPaths(got, 10) {
+		for i, tok := range path {
+			if tok.Position != i {
+				t.Errorf("path %v: token %q at position %d, want %d", tokenTerms(path), tok.Term, tok.Position, i)
+			}
+		}
+		phrases = append(phrases, strings.Join(tokenTerms(path), " "))
+	}
+	wantPhrases := []string{"i love ny today", "i love new york today", "i love big apple today"}
+	if !reflect.DeepEqual(phrases, wantPhrases) {
+		t.Errorf("paths = %q, want %q", phrases, wantPhrases)
+	}
+	if n := len(GraphPaths(got, 2)); n != 2 {
+		t.Errorf("GraphPaths limit 2 returned %d paths", n)
+	}
+
+	flat := FlattenGraph(got)
+	positions := make(map[string]int)
+	for _, tok := range flat {
+		positions[tok.Term] = tok.Position
+	}
+	wantPositions := map[string]int{"i": 0, "love": 1, "ny": 2, "new": 2, "big": 2, "york": 3, "apple": 3, "today": 4}
+	if !reflect.DeepEqual(positions, wantPositions) {
+		t.Errorf("flattened positions = %v, want %v", positions, wantPositions)
+	}
+}
+
+func TestSynonymGraphFilter_MatchesMultiWordInput(t *testing.T) {
+	f := mustSynonyms(t, false, "ny, new york")
+	got := f.Filter(WhitespaceTokenizer{}.Tokenize("new york pizza"))
+	want := []Token{
+		{Term: "ny", Position: 0, PositionLength: 2, StartByte: 0, EndByte: 8},
+		{Term: "new", Position: 0, StartByte: 0, EndByte: 3},
+		{Term: "york", Position: 1, StartByte: 4, EndByte: 8},
+		{Term: "pizza", Position: 2, StartByte: 9, EndByte: 14},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSynonymGraphFilter_Rules(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []string
+		ignoreCase bool
+		input      string
+		want       []string
+	}{
+		{"explicit mapping drops input", []string{"colour => color"}, false, "colour chart", []string{"color", "chart"}},
+		{"explicit mapping keeps listed input", []string{"tv => tv, television"}, false, "tv", []string{"tv", "television"}},
+		{"rules with a shared input merge", []string{"car, auto", "car => vehicle"}, false, "car", []string{"car", "auto", "vehicle"}},
+		{"longest match wins", []string{"new => fresh", "new york => ny"}, false, "new york new", []string{"ny", "fresh"}},
+		{"case sensitive", []string{"NY, new york"}, false, "ny", []string{"ny"}},
+		{"ignore case", []string{"NY, new york"}, true, "Ny", []string{"Ny", "new", "york"}},
+		{"comments and blank lines", []string{"# cities", "", "ny, nyc"}, false, "nyc", []string{"ny", "nyc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := mustSynonyms(t, tt.ignoreCase, tt.rules...)
+			if got := tokenTerms(f.Filter(WhitespaceTokenizer{}.Tokenize(tt.input))); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSynonyms_Invalid(t *testing.T) {
+	for _, rule := range []string{
+		"a, , b",
+		"=> b",
+		"a =>",
+		"a, " + strings.Repeat("w ", MaxSynonymWords+1),
+	} {
+		if _, err := ParseSynonyms([]string{rule}, false); !errors.Is(err, ErrInvalidAnalyzer) {
+			t.Errorf("ParseSynonyms(%q) = %v, want ErrInvalidAnalyzer", rule, err)
+		}
+	}
+}
+
+func TestRegistry_SynonymsFromResources(t *testing.T) {
+	fsys := fstest.MapFS{"cities.txt": {Data: []byte("# cities\nny, new york\r\n")}}
+	r := NewRegistryWithResources(fsys)
+	def := TokenFilterDef{Type: "synonym_graph", SynonymsPath: "cities.txt", Synonyms: []string{"la, los angeles"}}
+	if err := r.DefineTokenFilter("cities", def); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Define("search", AnalyzerDef{Tokenizer: "standard", Filters: []string{"lowercase", "cities"}}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := r.Get("search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(a.Analyze("f", "NY LA")); !reflect.DeepEqual(got, []string{"ny", "new", "york", "la", "los", "angeles"}) {
+		t.Errorf("got %v", got)
+	}
+
+	// A missing file contributes no rules.
+	missing := TokenFilterDef{Type: "synonym_graph", SynonymsPath: "missing.txt"}
+	if err := r.DefineTokenFilter("missing", missing); err != nil {
+		t.Errorf("missing synonyms file: %v", err)
+	}
+	for _, path := range []string{"../cities.txt", "/cities.txt"} {
+		bad := TokenFilterDef{Type: "synonym_graph", SynonymsPath: path}
+		if _, err := NewTokenFilter(bad); !errors.Is(err, ErrInvalidAnalyzer) {
+			t.Errorf("synonyms_path %q: got %v, want ErrInvalidAnalyzer", path, err)
+		}
+	}
+}
+
+func TestCJKTokenizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"chinese", "我爱北京", []string{"我爱", "爱北", "北京"}},
+		{"japanese mixed scripts", "東京タワー", []string{"東京", "京タ", "タワ", "ワー"}},
+		{"korean", "한국어 검색", []string{"한국", "국어", "검색"}},
+		{"isolated character", "a 字 b", []string{"a", "字", "b"}},
+		{"latin and cjk adjacent", "iPhone手机2", []string{"iPhone", "手机", "2"}},
+		{"punctuation splits runs", "日本、中国。", []string{"日本", "中国"}},
+		{"latin only", "hello_world 42", []string{"hello_world", "42"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenTerms(CJKTokenizer{}.Tokenize(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCJKTokenizer_PositionsAndOffsets(t *testing.T) {
+	text := "go 日本語"
+	got := CJKTokenizer{}.Tokenize(text)
+	want := []Token{
+		{Term: "go", Position: 0, StartByte: 0, EndByte: 2},
+		{Term: "日本", Position: 1, StartByte: 3, EndByte: 9},
+		{Term: "本語", Position: 2, StartByte: 6, EndByte: 12},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for _, tok := range got {
+		if text[tok.StartByte:tok.EndByte] != tok.Term {
+			t.Errorf("token %q has offsets of %q", tok.Term, text[tok.StartByte:tok.EndByte])
+		}
+	}
+}
+
+func TestCJKAnalyzer(t *testing.T) {
+	got := tokenTerms(NewCJKAnalyzer().Analyze("body", "ＧＯ言語 ｶﾀｶﾅ"))
+	want := []string{"go", "言語", "カタ", "タカ", "カナ"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// tokenSpans returns the original text each token's offsets point at.
+func tokenSpans(text string, tokens []Token) []string {
+	spans := make([]string, len(tokens))
+	for i, tok := range tokens {
+		spans[i] = text[tok.StartByte:tok.EndByte]
+	}
+	return spans
+}
+
+func TestHTMLStripCharFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"inline tags removed", "<b>wor</b>ld", "world"},
+		{"block tags separate words", "<li>one</li><li>two</li>", "\none\n\ntwo\n"},
+		{"line breaks", "a<br/>b<BR>c", "a\nb\nc"},
+		{"entities decoded", "caf&eacute; &lt;div&gt; &#65;&#x42; &amp;", "café <div> AB &"},
+		{"unknown entity kept", "&bogus; & &;", "&bogus; & &;"},
+		{"comments removed", "a<!-- <p>b</p> -->c", "ac"},
+		{"script and style dropped", "a<script type=\"x\">if (a<b) {}</script>b<style>p{}</style>c", "abc"},
+		{"quoted attributes", `<a href="x>y" title='>'>link</a>`, "link"},
+		{"stray angle brackets kept", "a < b > c <3", "a < b > c <3"},
+		{"unterminated tag kept", "a <b c", "a <b c"},
+		{"declaration removed", "<!DOCTYPE html><p>x", "\nx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := (HTMLStripCharFilter{}).Filter(tt.input); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLStripCharFilter_Offsets(t *testing.T) {
+	p, err := NewPipeline(AnalyzerDef{CharFilters: []string{"html_strip"}, Tokenizer: "standard", Filters: []string{"lowercase"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := `<div class="post"><p>Hello <b>wor</b>ld</p>caf&eacute; &lt;div&gt;</div>`
+	tokens := p.Analyze("body", text)
+	if got, want := tokenTerms(tokens), []string{"hello", "world", "café", "div"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("terms = %v, want %v", got, want)
+	}
+	if got, want := tokenSpans(text, tokens), []string{"Hello", "wor</b>ld", "caf&eacute;", "div"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+}
+
+func TestPatternReplaceCharFilter(t *testing.T) {
+	f, err := NewPatternReplaceCharFilter(`(\d+)-(\d+)`, "$1$2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Pipeline{CharFilters: []CharFilter{f}, Tokenizer: StandardTokenizer{}}
+	text := "call 555-1234 now"
+	tokens := p.Analyze("body", text)
+	if got, want := tokenTerms(tokens), []string{"call", "5551234", "now"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("terms = %v, want %v", got, want)
+	}
+	if got, want := tokenSpans(text, tokens), []string{"call", "555-1234", "now"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+
+	// Inserted text spans all of the match it replaced.
+	f, err = NewPatternReplaceCharFilter(`&`, " and ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = &Pipeline{CharFilters: []CharFilter{f}, Tokenizer: WhitespaceTokenizer{}}
+	text = "R&D dept"
+	tokens = p.Analyze("body", text)
+	if got, want := tokenTerms(tokens), []string{"R", "and", "D", "dept"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("terms = %v, want %v", got, want)
+	}
+	if got, want := tokenSpans(text, tokens), []string{"R", "&", "D", "dept"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+}
+
+func TestPipeline_ChainedCharFilterOffsets(t *testing.T) {
+	f, err := NewPatternReplaceCharFilter(`\s*-\s*`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Pipeline{CharFilters: []CharFilter{HTMLStripCharFilter{}, f}, Tokenizer: StandardTokenizer{}}
+	text := "<em>e</em> - mail &amp; more"
+	tokens := p.Analyze("body", text)
+	if got, want := tokenTerms(tokens), []string{"email", "more"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("terms = %v, want %v", got, want)
+	}
+	if got, want := tokenSpans(text, tokens), []string{"e</em> - mail", "more"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+}
+
+func TestPipeline_ChainedCharFilterInsertedText(t *testing.T) {
+	f, err := NewPatternReplaceCharFilter(`&`, " and ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Pipeline{CharFilters: []CharFilter{HTMLStripCharFilter{}, f}, Tokenizer: StandardTokenizer{}}
+	text := "<i>tom</i>&amp;jerry caf&eacute;&amp;"
+	tokens := p.Analyze("body", text)
+	if got, want := tokenTerms(tokens), []string{"tom", "and", "jerry", "café", "and"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("terms = %v, want %v", got, want)
+	}
+	if got, want := tokenSpans(text, tokens), []string{"tom", "&amp;", "jerry", "caf&eacute;", "&amp;"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+}
+
+func TestNewCharFilter_Invalid(t *testing.T) {
+	for _, def := range []CharFilterDef{
+		{Type: "nope"},
+		{Type: "pattern_replace"},
+		{Type: "pattern_replace", Pattern: "("},
+		{Type: "pattern_replace", Pattern: strings.Repeat("a", MaxPatternLength+1)},
+	} {
+		if _, err := NewCharFilter(def); !errors.Is(err, ErrInvalidAnalyzer) {
+			t.Errorf("NewCharFilter(%+v) = %v, want ErrInvalidAnalyzer", def, err)
+		}
+	}
+
+	r := NewRegistry()
+	if err := r.DefineCharFilter("html_strip", CharFilterDef{Type: "html_strip"}); err == nil {
+		t.Error("expected error redefining a built-in char filter")
+	}
+	if err := r.DefineCharFilter("digits", CharFilterDef{Type: "pattern_replace", Pattern: `\d`, Replacement: "#"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Define("masked", AnalyzerDef{CharFilters: []string{"digits"}, Tokenizer: "whitespace"}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := r.Get("masked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(a.Analyze("f", "pin 1234")); !reflect.DeepEqual(got, []string{"pin", "####"}) {
+		t.Errorf("got %v, want [pin ####]", got)
+	}
+}
+
+func TestWordDelimiterFilter_Split(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"getUserName", []string{"get", "User", "Name"}},
+		{"foo_bar", []string{"foo", "bar"}},
+		{"wi-fi", []string{"wi", "fi"}},
+		{"X-1000", []string{"X", "1000"}},
+		{"SD500X", []string{"SD", "500", "X"}},
+		{"XMLHttpRequest", []string{"XML", "Http", "Request"}},
+		{"iPhone", []string{"i", "Phone"}},
+		{"O'Neil's", []string{"O", "Neil"}},
+		{"__init__", []string{"init"}},
+		{"plain", []string{"plain"}},
+		{"--", nil},
+	}
+	f := NewWordDelimiterFilter(DefaultWordDelimiterOptions())
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := tokenTerms(f.Filter(WhitespaceTokenizer{}.Tokenize(tt.input))); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	opts := DefaultWordDelimiterOptions()
+	opts.SplitOnCaseChange, opts.SplitOnNumerics = false, false
+	if got := tokenTerms(NewWordDelimiterFilter(opts).Filter(WhitespaceTokenizer{}.Tokenize("getUser-X1000"))); !reflect.DeepEqual(got, []string{"getUser", "X1000"}) {
+		t.Errorf("without case and numeric splits: got %v", got)
+	}
+}
+
+func TestWordDelimiterFilter_Graph(t *testing.T) {
+	opts := DefaultWordDelimiterOptions()
+	opts.CatenateWords, opts.CatenateAll, opts.PreserveOriginal = true, true, true
+	f := NewWordDelimiterFilter(opts)
+	text := "buy wi-fi-6 router"
+	got := f.Filter(WhitespaceTokenizer{}.Tokenize(text))
+	want := []Token{
+		{Term: "buy", Position: 0, StartByte: 0, EndByte: 3},
+		{Term: "wi-fi-6", Position: 1, PositionLength: 3, StartByte: 4, EndByte: 11},
+		{Term: "wifi6", Position: 1, PositionLength: 3, StartByte: 4, EndByte: 11},
+		{Term: "wifi", Position: 1, PositionLength: 2, StartByte: 4, EndByte: 9},
+		{Term: "wi", Position: 1, StartByte: 4, EndByte: 6},
+		{Term: "fi", Position: 2, StartByte: 7, EndByte: 9},
+		{Term: "6", Position: 3, StartByte: 10, EndByte: 11},
+		{Term: "router", Position: 4, StartByte: 12, EndByte: 18},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	var phrases []string
+	for _, path := range GraphPaths(got, 10) {
+		phrases = append(phrases, strings.Join(tokenTerms(path), " "))
+	}
+	wantPhrases := []string{"buy wi-fi-6 router", "buy wifi6 router", "buy wifi 6 router", "buy wi fi 6 router"}
+	if !reflect.DeepEqual(phrases, wantPhrases) {
+		t.Errorf("paths = %q, want %q", phrases, wantPhrases)
+	}
+}
+
+func TestNewTokenFilter_WordDelimiter(t *testing.T) {
+	no := false
+	f, err := NewTokenFilter(TokenFilterDef{Type: "word_delimiter_graph", SplitOnCaseChange: &no, CatenateNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tokenTerms(f.Filter(WhitespaceTokenizer{}.Tokenize("getUser 555-12-34")))
+	want := []string{"getUser", "5551234", "555", "12", "34"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSoundex(t *testing.T) {
+	tests := map[string]string{
+		"Robert":   "R163",
+		"Rupert":   "R163",
+		"Ashcraft": "A261",
+		"Tymczak":  "T522",
+		"Pfister":  "P236",
+		"Lee":      "L000",
+		"Smith":    "S530",
+		"Smyth":    "S530",
+		"Müller":   "M460",
+		"1234":     "",
+	}
+	for input, want := range tests {
+		if got := Soundex(input); got != want {
+			t.Errorf("Soundex(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestMetaphone(t *testing.T) {
+	tests := map[string]string{
+		"Smith":   "SM0",
+		"Smyth":   "SM0",
+		"Schmidt": "SKMT",
+		"Knight":  "NT",
+		"Wright":  "RT",
+		"Xavier":  "SFR",
+		"Phone":   "FN",
+		"Thumb":   "0M",
+		"Science": "SNS",
+		"Judge":   "JJ",
+		"Michael": "MXL",
+		"Charles": "XRLS",
+		"A":       "A",
+		"":        "",
+	}
+	for input, want := range tests {
+		if got := Metaphone(input, DefaultMaxCodeLength); got != want {
+			t.Errorf("Metaphone(%q) = %q, want %q", input, got, want)
+		}
+	}
+	if got := Metaphone("Christopher", 8); got != "KRSTFR" {
+		t.Errorf("Metaphone(Christopher, 8) = %q, want KRSTFR", got)
+	}
+}
+
+func TestDoubleMetaphone(t *testing.T) {
+	tests := []struct {
+		input              string
+		primary, alternate string
+	}{
+		{"Smith", "SM0", "XMT"},
+		{"Smyth", "SM0", "XMT"},
+		{"Schmidt", "XMT", "SMT"},
+		{"Michael", "MKL", "MXL"},
+		{"Thomas", "TMS", "TMS"},
+		{"Jose", "HS", "HS"},
+		{"Czerny", "SRN", "XRN"},
+		{"Gallegos", "KLKS", "KKS"},
+		{"Wasserman", "ASRM", "FSRM"},
+		{"Arnow", "ARN", "ARNF"},
+		{"Filipowicz", "FLPT", "FLPF"},
+		{"Schenker", "XNKR", "SKNK"},
+		{"Laugh", "LF", "LF"},
+		{"Edge", "AJ", "AJ"},
+		{"Accident", "AKST", "AKST"},
+		{"Zhao", "J", "J"},
+		{"Françoise", "FRNS", "FRNS"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		p, a := DoubleMetaphone(tt.input, DefaultMaxCodeLength)
+		if p != tt.primary || a != tt.alternate {
+			t.Errorf("DoubleMetaphone(%q) = %q, %q, want %q, %q", tt.input, p, a, tt.primary, tt.alternate)
+		}
+	}
+}
+
+func TestPhoneticFilter(t *testing.T) {
+	tokens := WhitespaceTokenizer{}.Tokenize("Smyth 42")
+
+	f, err := NewPhoneticFilter(EncoderDoubleMetaphone, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.Filter(tokens)
+	want := []Token{
+		{Term: "SM0", Position: 0, StartByte: 0, EndByte: 5},
+		{Term: "XMT", Position: 0, StartByte: 0, EndByte: 5},
+		{Term: "42", Position: 1, StartByte: 6, EndByte: 8},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replace: got %+v, want %+v", got, want)
+	}
+
+	f, err = NewPhoneticFilter(EncoderSoundex, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokenTerms(f.Filter(tokens)); !reflect.DeepEqual(got, []string{"Smyth", "S530", "42"}) {
+		t.Errorf("preserve original: got %v", got)
+	}
+
+	for _, tt := range []struct {
+		encoder string
+		length  int
+	}{{"caverphone", 0}, {EncoderMetaphone, -1}, {EncoderMetaphone, MaxCodeLength + 1}} {
+		if _, err := NewPhoneticFilter(tt.encoder, tt.length, false); !errors.Is(err, ErrInvalidAnalyzer) {
+			t.Errorf("NewPhoneticFilter(%q, %d) = %v, want ErrInvalidAnalyzer", tt.encoder, tt.length, err)
+		}
+	}
+}
+
+func TestRegistry_Phonetic(t *testing.T) {
+	r := NewRegistry()
+	if err := r.DefineTokenFilter("names_dm", TokenFilterDef{Type: "phonetic", Encoder: "double_metaphone", PreserveOriginal: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Define("names", AnalyzerDef{Tokenizer: "standard", Filters: []string{"lowercase", "names_dm"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Define("soundex", AnalyzerDef{Tokenizer: "standard", Filters: []string{"soundex"}}); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := r.Get("names")
+	if got, want := tokenTerms(names.Analyze("f", "John Smith")), []string{"john", "JN", "AN", "smith", "SM0", "XMT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("names: got %v, want %v", got, want)
+	}
+	soundex, _ := r.Get("soundex")
+	if got, want := tokenTerms(soundex.Analyze("f", "Smith Smyth")), []string{"S530", "S530"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("soundex: got %v, want %v", got, want)
+	}
+
+	if _, err := NewTokenFilter(TokenFilterDef{Type: "phonetic", Encoder: "nysiis"}); !errors.Is(err, ErrInvalidAnalyzer) {
+		t.Errorf("unknown encoder: got %v, want ErrInvalidAnalyzer", err)
+	}
+}
+
+func TestPipeline_AnalyzeStages(t *testing.T) {
+	r := NewRegistry()
+	if err := r.DefineTokenFilter("names_dm", TokenFilterDef{Type: "phonetic", Encoder: "double_metaphone"}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := r.NewPipeline(AnalyzerDef{CharFilters: []string{"html_strip"}, Tokenizer: "standard", Filters: []string{"lowercase", "names_dm"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := r.Names(); len(names) != 4 {
+		t.Errorf("NewPipeline registered an analyzer: %v", names)
+	}
+
+	text := "<b>Jane</b> SMYTH"
+	tokens, stages := p.AnalyzeStages(text)
+	if want := p.Analyze("f", text); !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokens = %+v, want %+v as from Analyze", tokens, want)
+	}
+
+	type stage struct {
+		kind, name, text string
+		terms            []string
+	}
+	var got []stage
+	for _, s := range stages {
+		got = append(got, stage{s.Kind, s.Name, s.Text, tokenTerms(s.Tokens)})
+	}
+	want := []stage{
+		{StageCharFilter, "html_strip", "Jane SMYTH", nil},
+		{StageTokenizer, "standard", "", []string{"Jane", "SMYTH"}},
+		{StageTokenFilter, "lowercase", "", []string{"jane", "smyth"}},
+		{StageTokenFilter, "names_dm", "", []string{"JN", "AN", "SM0", "XMT"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("stages = %+v, want %+v", got, want)
+	}
+
+	// Every stage's offsets refer to the original text.
+	for _, s := range stages[1:] {
+		last := s.Tokens[len(s.Tokens)-1]
+		if got := text[last.StartByte:last.EndByte]; got != "SMYTH" {
+			t.Errorf("%s: last token covers %q, want SMYTH", s.Name, got)
+		}
+	}
+
+	direct := &Pipeline{Tokenizer: WhitespaceTokenizer{}, Filters: []TokenFilter{LowercaseFilter{}}}
+	_, stages = direct.AnalyzeStages("A B")
+	if len(stages) != 2 || stages[0].Name != "analysis.WhitespaceTokenizer" || stages[1].Name != "analysis.LowercaseFilter" {
+		t.Errorf("direct pipeline stages = %+v", stages)
+	}
+}
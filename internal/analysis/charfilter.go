@@ -0,0 +1,264 @@
+package analysis
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// MaxPatternLength bounds the pattern of a pattern_replace char filter.
+const MaxPatternLength = 1024
+
+// correctingBuilder builds filtered text along with the corrections that map
+// its offsets back to the input.
+type correctingBuilder struct {
+	out         strings.Builder
+	corrections []OffsetCorrection
+	// delta is the number of input bytes consumed minus the number of
+	// bytes written.
+	delta int
+}
+
+// keep writes input text unchanged.
+func (b *correctingBuilder) keep(s string) {
+	b.out.WriteString(s)
+}
+
+// replace writes repl in place of n bytes of input. Offsets within repl map
+// to the start of the replaced input, and token ends within it or at its end
+// to the end of the replaced input; offsets after repl map past it.
+func (b *correctingBuilder) replace(n int, repl string) {
+	p := b.out.Len()
+	b.out.WriteString(repl)
+	if len(repl) > 0 {
+		b.correct(OffsetCorrection{Offset: p, Delta: b.delta, Inserted: len(repl), Replaced: n})
+	}
+	b.delta += n - len(repl)
+	b.correct(OffsetCorrection{Offset: p + len(repl), Delta: b.delta})
+}
+
+func (b *correctingBuilder) correct(c OffsetCorrection) {
+	if n := len(b.corrections); n > 0 {
+		last := &b.corrections[n-1]
+		if last.Offset == c.Offset {
+			*last = c
+			return
+		}
+		if last.Delta == c.Delta && last.Inserted == 0 && c.Inserted == 0 {
+			return
+		}
+	} else if c.Delta == 0 && c.Inserted == 0 {
+		return
+	}
+	b.corrections = append(b.corrections, c)
+}
+
+func (b *correctingBuilder) result() (string, []OffsetCorrection) {
+	return b.out.String(), b.corrections
+}
+
+// HTMLStripCharFilter removes HTML markup: tags and comments are dropped,
+// the contents of script and style elements are dropped, block-level tags
+// become a newline so that the words they separate stay apart, and
+// character references such as &amp; or &#233; are decoded. A < that does
+// not start a tag is kept.
+type HTMLStripCharFilter struct{}
+
+// htmlBlockTags are replaced by a newline rather than removed.
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "caption": true, "dd": true, "div": true, "dl": true,
+	"dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"li": true, "main": true, "nav": true, "ol": true, "option": true,
+	"p": true, "pre": true, "section": true, "table": true, "tbody": true,
+	"td": true, "tfoot": true, "th": true, "thead": true, "title": true,
+	"tr": true, "ul": true,
+}
+
+// Filter returns text without markup.
+func (HTMLStripCharFilter) Filter(text string) (string, []OffsetCorrection) {
+	var b correctingBuilder
+	b.out.Grow(len(text))
+	for i := 0; i < len(text); {
+		j := i + strings.IndexAny(text[i:], "<&")
+		if j < i {
+			b.keep(text[i:])
+			break
+		}
+		b.keep(text[i:j])
+		i = j
+
+		if text[i] == '&' {
+			n, decoded := htmlReference(text[i:])
+			if n == 0 {
+				b.keep("&")
+				i++
+				continue
+			}
+			b.replace(n, decoded)
+			i += n
+			continue
+		}
+
+		n, name, closing := htmlTag(text[i:])
+		if n == 0 {
+			b.keep("<")
+			i++
+			continue
+		}
+		if (name == "script" || name == "style") && !closing && !strings.HasSuffix(text[i:i+n], "/>") {
+			// Skip the element's content up to its end tag.
+			end := indexFold(text[i+n:], "</"+name)
+			if end < 0 {
+				n = len(text) - i
+			} else {
+				n += end
+				if m, _, _ := htmlTag(text[i+n:]); m > 0 {
+					n += m
+				}
+			}
+		}
+		if htmlBlockTags[name] {
+			b.replace(n, "\n")
+		} else {
+			b.replace(n, "")
+		}
+		i += n
+	}
+	return b.result()
+}
+
+// htmlTag returns the length of the tag, comment or declaration that s
+// starts with, and the lowercase name of a tag, or 0 if s does not start
+// with one.
+func htmlTag(s string) (n int, name string, closing bool) {
+	if strings.HasPrefix(s, "<!--") {
+		end := strings.Index(s[4:], "-->")
+		if end < 0 {
+			return len(s), "", false
+		}
+		return 4 + end + 3, "", false
+	}
+	if len(s) < 2 {
+		return 0, "", false
+	}
+	i := 1
+	switch c := s[1]; {
+	case c == '/':
+		closing = true
+		i++
+	case c == '!' || c == '?':
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return 0, "", false
+		}
+		return end + 1, "", false
+	}
+	start := i
+	for i < len(s) && isASCIILetterOrDigit(s[i]) {
+		i++
+	}
+	if i == start || !isASCIILetter(s[start]) {
+		return 0, "", false
+	}
+	name = strings.ToLower(s[start:i])
+
+	// Find the closing >, skipping quoted attribute values.
+	var quote byte
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1, name, closing
+		}
+	}
+	return 0, "", false
+}
+
+// htmlReference returns the length of the character reference that s starts
+// with and its decoded text, or 0 if s does not start with one.
+func htmlReference(s string) (int, string) {
+	// The longest named references, such as &CounterClockwiseContourIntegral;,
+	// have 31 characters between & and ;.
+	end := strings.IndexByte(s[:min(len(s), 40)], ';')
+	if end < 2 {
+		return 0, ""
+	}
+	for i := 1; i < end; i++ {
+		if !isASCIILetterOrDigit(s[i]) && !(i == 1 && s[i] == '#') {
+			return 0, ""
+		}
+	}
+	decoded := html.UnescapeString(s[:end+1])
+	if decoded == s[:end+1] {
+		return 0, ""
+	}
+	return end + 1, decoded
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isASCIILetterOrDigit(c byte) bool {
+	return isASCIILetter(c) || '0' <= c && c <= '9'
+}
+
+// indexFold is strings.Index for an ASCII substr, ignoring case.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// PatternReplaceCharFilter replaces every match of a regular expression.
+type PatternReplaceCharFilter struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// NewPatternReplaceCharFilter creates a filter replacing matches of pattern
+// (RE2 syntax) by replacement, in which $1 or ${name} stand for submatches.
+func NewPatternReplaceCharFilter(pattern, replacement string) (*PatternReplaceCharFilter, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: pattern is required", ErrInvalidAnalyzer)
+	}
+	if len(pattern) > MaxPatternLength {
+		return nil, fmt.Errorf("%w: pattern longer than %d bytes", ErrInvalidAnalyzer, MaxPatternLength)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: pattern: %v", ErrInvalidAnalyzer, err)
+	}
+	return &PatternReplaceCharFilter{pattern: re, replacement: replacement}, nil
+}
+
+// Filter returns text with every match replaced.
+func (f *PatternReplaceCharFilter) Filter(text string) (string, []OffsetCorrection) {
+	matches := f.pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, nil
+	}
+	var b correctingBuilder
+	var repl []byte
+	prev := 0
+	for _, m := range matches {
+		b.keep(text[prev:m[0]])
+		repl = f.pattern.ExpandString(repl[:0], f.replacement, text, m)
+		b.replace(m[1]-m[0], string(repl))
+		prev = m[1]
+	}
+	b.keep(text[prev:])
+	return b.result()
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// CJKAnalyzer splits Chinese, Japanese and Korean text into overlapping
+// bigrams and other text like StandardAnalyzer, then applies NFKC case
+// folding so that full-width and half-width forms match.
+type CJKAnalyzer struct{}
+
+// NewCJKAnalyzer creates a new CJKAnalyzer.
+func NewCJKAnalyzer() *CJKAnalyzer {
+	return &CJKAnalyzer{}
+}
+
+// Analyze tokenizes the input with CJKTokenizer and normalizes the tokens.
+func (a *CJKAnalyzer) Analyze(_ string, text string) []Token {
+	return NormalizeFilter{CaseFold: true}.Filter(CJKTokenizer{}.Tokenize(text))
+}
+
+// CJKTokenizer emits overlapping bigrams for runs of Han, Hiragana,
+// Katakana and Hangul characters, which are written without spaces between
+// words, and a unigram for a character standing alone. Other text is split
+// into word runs as by StandardTokenizer. Case is preserved.
+//
+// "東京都に住む" yields 東京, 京都, 都に, に住, 住む at consecutive positions,
+// so a search for any two adjacent characters of the text matches.
+type CJKTokenizer struct{}
+
+// Tokenize returns the bigrams of CJK runs and the words of other runs.
+func (CJKTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	pos := 0
+	i := 0
+
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		cjk := isCJKRune(r)
+		if !cjk && !isWordRune(r) {
+			i += size
+			continue
+		}
+
+		// Collect a run of CJK characters or of other word characters,
+		// remembering where each character starts.
+		start := i
+		var starts []int
+		for i < len(text) {
+			r, size = utf8.DecodeRuneInString(text[i:])
+			if isCJKRune(r) != cjk || (!cjk && !isWordRune(r)) {
+				break
+			}
+			if cjk {
+				starts = append(starts, i)
+			}
+			i += size
+		}
+
+		if !cjk || len(starts) == 1 {
+			tokens = append(tokens, Token{Term: text[start:i], Position: pos, StartByte: start, EndByte: i})
+			pos++
+			continue
+		}
+		starts = append(starts, i)
+		for j := 0; j+2 < len(starts); j++ {
+			tokens = append(tokens, Token{
+				Term:      text[starts[j]:starts[j+2]],
+				Position:  pos,
+				StartByte: starts[j],
+				EndByte:   starts[j+2],
+			})
+			pos++
+		}
+	}
+
+	return tokens
+}
+
+// isCJKRune reports whether r belongs to a script written without spaces
+// between words. The prolonged sound mark ー is common to both kana scripts
+// and is counted with them.
+func isCJKRune(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) ||
+		r == 'ー' || r == 'ｰ'
+}
@@ -0,0 +1,538 @@
+package analysis
+
+import (
+	"strings"
+)
+
+// DoubleMetaphone returns the primary and alternate Double Metaphone codes
+// of s, each at most maxLen characters long. The alternate code accounts
+// for other pronunciations, mostly of names of foreign origin, and equals
+// the primary code when there is none. Both are "" if s has no letters.
+//
+// The rules follow Lawrence Philips' original implementation.
+func DoubleMetaphone(s string, maxLen int) (primary, alternate string) {
+	e := dmEncoder{w: []rune(strings.ToUpper(strings.TrimSpace(s))), maxLen: maxLen}
+	e.encode()
+	return string(e.primary), string(e.alternate)
+}
+
+type dmEncoder struct {
+	w                  []rune
+	maxLen             int
+	slavoGermanic      bool
+	primary, alternate []byte
+}
+
+func (e *dmEncoder) at(i int) rune {
+	if i < 0 || i >= len(e.w) {
+		return 0
+	}
+	return e.w[i]
+}
+
+// matches reports whether the text at i is one of candidates, which all
+// have the same length.
+func (e *dmEncoder) matches(i int, candidates ...string) bool {
+	n := len(candidates[0])
+	if i < 0 || i+n > len(e.w) {
+		return false
+	}
+	s := string(e.w[i : i+n])
+	for _, c := range candidates {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *dmEncoder) isVowel(i int) bool {
+	return strings.ContainsRune("AEIOUY", e.at(i))
+}
+
+func (e *dmEncoder) isLast(i int) bool {
+	return i == len(e.w)-1
+}
+
+// add appends p to the primary code and a to the alternate one.
+func (e *dmEncoder) add(p, a string) {
+	e.primary = appendCode(e.primary, p, e.maxLen)
+	e.alternate = appendCode(e.alternate, a, e.maxLen)
+}
+
+// add1 appends c to both codes.
+func (e *dmEncoder) add1(c string) {
+	e.add(c, c)
+}
+
+func appendCode(code []byte, s string, maxLen int) []byte {
+	if n := maxLen - len(code); len(s) > n {
+		s = s[:max(n, 0)]
+	}
+	return append(code, s...)
+}
+
+// skip returns the index after i, past a doubled letter at i+1.
+func (e *dmEncoder) skip(i int, same ...string) int {
+	if e.matches(i+1, same...) {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (e *dmEncoder) encode() {
+	if len(e.w) == 0 {
+		return
+	}
+	s := string(e.w)
+	e.slavoGermanic = strings.ContainsAny(s, "WK") || strings.Contains(s, "CZ") || strings.Contains(s, "WITZ")
+
+	i := 0
+	if e.matches(0, "GN", "KN", "PN", "WR", "PS") {
+		i = 1
+	}
+	for i < len(e.w) && (len(e.primary) < e.maxLen || len(e.alternate) < e.maxLen) {
+		switch e.w[i] {
+		case 'A', 'E', 'I', 'O', 'U', 'Y':
+			if i == 0 {
+				e.add1("A")
+			}
+			i++
+		case 'B':
+			e.add1("P")
+			i = e.skip(i, "B")
+		case 'Ç':
+			e.add1("S")
+			i++
+		case 'C':
+			i = e.c(i)
+		case 'D':
+			i = e.d(i)
+		case 'F':
+			e.add1("F")
+			i = e.skip(i, "F")
+		case 'G':
+			i = e.g(i)
+		case 'H':
+			// Keep H only when first or between vowels.
+			if (i == 0 || e.isVowel(i-1)) && e.isVowel(i+1) {
+				e.add1("H")
+				i += 2
+			} else {
+				i++
+			}
+		case 'J':
+			i = e.j(i)
+		case 'K':
+			e.add1("K")
+			i = e.skip(i, "K")
+		case 'L':
+			i = e.l(i)
+		case 'M':
+			e.add1("M")
+			if e.at(i+1) == 'M' || e.matches(i-1, "UMB") && (e.isLast(i+1) || e.matches(i+2, "ER")) {
+				// "dumb", "thumb"
+				i += 2
+			} else {
+				i++
+			}
+		case 'N':
+			e.add1("N")
+			i = e.skip(i, "N")
+		case 'Ñ':
+			e.add1("N")
+			i++
+		case 'P':
+			if e.at(i+1) == 'H' {
+				e.add1("F")
+				i += 2
+			} else {
+				e.add1("P")
+				i = e.skip(i, "P", "B")
+			}
+		case 'Q':
+			e.add1("K")
+			i = e.skip(i, "Q")
+		case 'R':
+			// French "Rogier": the final R is silent.
+			if e.isLast(i) && !e.slavoGermanic && e.matches(i-2, "IE") && !e.matches(i-4, "ME", "MA") {
+				e.add("", "R")
+			} else {
+				e.add1("R")
+			}
+			i = e.skip(i, "R")
+		case 'S':
+			i = e.s(i)
+		case 'T':
+			i = e.t(i)
+		case 'V':
+			e.add1("F")
+			i = e.skip(i, "V")
+		case 'W':
+			i = e.wRule(i)
+		case 'X':
+			i = e.x(i)
+		case 'Z':
+			i = e.z(i)
+		default:
+			i++
+		}
+	}
+}
+
+func (e *dmEncoder) germanic() bool {
+	return e.matches(0, "VAN ", "VON ") || e.matches(0, "SCH")
+}
+
+func (e *dmEncoder) c(i int) int {
+	switch {
+	case e.chAsK(i):
+		// Various Germanic: "Bacher", "Macher".
+		e.add1("K")
+		return i + 2
+	case i == 0 && e.matches(i, "CAESAR"):
+		e.add1("S")
+		return i + 2
+	case e.matches(i, "CH"):
+		return e.ch(i)
+	case e.matches(i, "CZ") && !e.matches(i-2, "WICZ"):
+		// "Czerny"
+		e.add("S", "X")
+		return i + 2
+	case e.matches(i+1, "CIA"):
+		// "focaccia"
+		e.add1("X")
+		return i + 3
+	case e.matches(i, "CC") && !(i == 1 && e.at(0) == 'M'):
+		// Double C, but not "McClelland".
+		if e.matches(i+2, "I", "E", "H") && !e.matches(i+2, "HU") {
+			if i == 1 && e.at(0) == 'A' || e.matches(i-1, "UCCEE", "UCCES") {
+				// "accident", "accede", "succeed"
+				e.add1("KS")
+			} else {
+				// "bacci", "bertucci"
+				e.add1("X")
+			}
+			return i + 3
+		}
+		e.add1("K")
+		return i + 2
+	case e.matches(i, "CK", "CG", "CQ"):
+		e.add1("K")
+		return i + 2
+	case e.matches(i, "CI", "CE", "CY"):
+		if e.matches(i, "CIO", "CIE", "CIA") {
+			e.add("S", "X")
+		} else {
+			e.add1("S")
+		}
+		return i + 2
+	}
+	e.add1("K")
+	switch {
+	case e.matches(i+1, " C", " Q", " G"):
+		// "Mac Caffrey", "Mac Gregor"
+		return i + 3
+	case e.matches(i+1, "C", "K", "Q") && !e.matches(i+1, "CE", "CI"):
+		return i + 2
+	}
+	return i + 1
+}
+
+// chAsK reports whether the C at i is a Germanic -ACH- sounding K.
+func (e *dmEncoder) chAsK(i int) bool {
+	if e.matches(i, "CHIA") {
+		return true
+	}
+	if i <= 1 || e.isVowel(i-2) || !e.matches(i-1, "ACH") {
+		return false
+	}
+	c := e.at(i + 2)
+	return c != 'I' && c != 'E' || e.matches(i-2, "BACHER", "MACHER")
+}
+
+func (e *dmEncoder) ch(i int) int {
+	switch {
+	case i > 0 && e.matches(i, "CHAE"):
+		// "Michael"
+		e.add("K", "X")
+	case i == 0 && (e.matches(i+1, "HARAC", "HARIS") || e.matches(i+1, "HOR", "HYM", "HIA", "HEM")) &&
+		!e.matches(0, "CHORE"):
+		// Greek roots: "chemistry", "chorus".
+		e.add1("K")
+	case e.germanic() || e.matches(i-2, "ORCHES", "ARCHIT", "ORCHID") || e.matches(i+2, "T", "S") ||
+		(i == 0 || e.matches(i-1, "A", "O", "U", "E")) &&
+			(e.matches(i+2, "L", "R", "N", "M", "B", "H", "F", "V", "W", " ") || i+1 == len(e.w)-1):
+		// Germanic, Greek or otherwise CH sounding KH: "Bach", "orchestra".
+		e.add1("K")
+	case i == 0:
+		e.add1("X")
+	case e.matches(0, "MC"):
+		e.add1("K")
+	default:
+		e.add("X", "K")
+	}
+	return i + 2
+}
+
+func (e *dmEncoder) d(i int) int {
+	switch {
+	case e.matches(i, "DG"):
+		if e.matches(i+2, "I", "E", "Y") {
+			// "edge"
+			e.add1("J")
+			return i + 3
+		}
+		// "Edgar"
+		e.add1("TK")
+		return i + 2
+	case e.matches(i, "DT", "DD"):
+		e.add1("T")
+		return i + 2
+	}
+	e.add1("T")
+	return i + 1
+}
+
+func (e *dmEncoder) g(i int) int {
+	switch next := e.at(i + 1); {
+	case next == 'H':
+		return e.gh(i)
+	case next == 'N':
+		switch {
+		case i == 1 && e.isVowel(0) && !e.slavoGermanic:
+			e.add("KN", "N")
+		case !e.matches(i+2, "EY") && !e.slavoGermanic:
+			// "Cagney" keeps its G.
+			e.add("N", "KN")
+		default:
+			e.add1("KN")
+		}
+		return i + 2
+	case e.matches(i+1, "LI") && !e.slavoGermanic:
+		// "tagliaro"
+		e.add("KL", "L")
+		return i + 2
+	case i == 0 && (next == 'Y' || e.matches(i+1, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")):
+		// -GES-, -GEP-, -GEL-, -GIE- at the start.
+		e.add("K", "J")
+		return i + 2
+	case (e.matches(i+1, "ER") || next == 'Y') && !e.matches(0, "DANGER", "RANGER", "MANGER") &&
+		!e.matches(i-1, "E", "I") && !e.matches(i-1, "RGY", "OGY"):
+		// -GER-, -GY-
+		e.add("K", "J")
+		return i + 2
+	case e.matches(i+1, "E", "I", "Y") || e.matches(i-1, "AGGI", "OGGI"):
+		switch {
+		case e.germanic() || e.matches(i+1, "ET"):
+			e.add1("K")
+		case e.matches(i+1, "IER"):
+			e.add1("J")
+		default:
+			// Italian "biaggi"
+			e.add("J", "K")
+		}
+		return i + 2
+	case next == 'G':
+		e.add1("K")
+		return i + 2
+	}
+	e.add1("K")
+	return i + 1
+}
+
+func (e *dmEncoder) gh(i int) int {
+	switch {
+	case i > 0 && !e.isVowel(i-1):
+		e.add1("K")
+	case i == 0:
+		// "ghislane", "ghiradelli"
+		if e.at(i+2) == 'I' {
+			e.add1("J")
+		} else {
+			e.add1("K")
+		}
+	case i > 1 && e.matches(i-2, "B", "H", "D") || i > 2 && e.matches(i-3, "B", "H", "D") ||
+		i > 3 && e.matches(i-4, "B", "H"):
+		// Parker's rule: "Hugh", "bough", "broughton".
+	case i > 2 && e.at(i-1) == 'U' && e.matches(i-3, "C", "G", "L", "R", "T"):
+		// "laugh", "McLaughlin", "cough", "rough"
+		e.add1("F")
+	case e.at(i-1) != 'I':
+		e.add1("K")
+	}
+	return i + 2
+}
+
+func (e *dmEncoder) j(i int) int {
+	if e.matches(i, "JOSE") || e.matches(0, "SAN ") {
+		// Spanish: "Jose", "San Jacinto".
+		if i == 0 && e.at(i+4) == ' ' || len(e.w) == 4 || e.matches(0, "SAN ") {
+			e.add1("H")
+		} else {
+			e.add("J", "H")
+		}
+		return i + 1
+	}
+	switch {
+	case i == 0:
+		// "Yankelovich", "Jankelowicz"
+		e.add("J", "A")
+	case e.isVowel(i-1) && !e.slavoGermanic && (e.at(i+1) == 'A' || e.at(i+1) == 'O'):
+		// Spanish "bajador"
+		e.add("J", "H")
+	case e.isLast(i):
+		// The original adds a space as the alternate; it is left out so
+		// that codes stay single words.
+		e.add("J", "")
+	case !e.matches(i+1, "L", "T", "K", "S", "N", "M", "B", "Z") && !e.matches(i-1, "S", "K", "L"):
+		e.add1("J")
+	}
+	return e.skip(i, "J")
+}
+
+func (e *dmEncoder) l(i int) int {
+	if e.at(i+1) != 'L' {
+		e.add1("L")
+		return i + 1
+	}
+	n := len(e.w)
+	if i == n-3 && e.matches(i-1, "ILLO", "ILLA", "ALLE") ||
+		(e.matches(n-2, "AS", "OS") || e.matches(n-1, "A", "O")) && e.matches(i-1, "ALLE") {
+		// Spanish: "cabrillo", "gallegos".
+		e.add("L", "")
+	} else {
+		e.add1("L")
+	}
+	return i + 2
+}
+
+func (e *dmEncoder) s(i int) int {
+	switch {
+	case e.matches(i-1, "ISL", "YSL"):
+		// "island", "isle", "carlisle"
+		return i + 1
+	case i == 0 && e.matches(i, "SUGAR"):
+		e.add("X", "S")
+		return i + 1
+	case e.matches(i, "SH"):
+		if e.matches(i+1, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			// Germanic
+			e.add1("S")
+		} else {
+			e.add1("X")
+		}
+		return i + 2
+	case e.matches(i, "SIO", "SIA") || e.matches(i, "SIAN"):
+		// Italian and Armenian
+		if e.slavoGermanic {
+			e.add1("S")
+		} else {
+			e.add("S", "X")
+		}
+		return i + 3
+	case i == 0 && e.matches(i+1, "M", "N", "L", "W") || e.matches(i+1, "Z"):
+		// German and anglicisations: "Smith" matches "Schmidt", "Snider"
+		// matches "Schneider"; Slavic -SZ-.
+		e.add("S", "X")
+		return e.skip(i, "Z")
+	case e.matches(i, "SC"):
+		return e.sc(i)
+	case e.isLast(i) && e.matches(i-2, "AI", "OI"):
+		// French "Resnais", "Artois"
+		e.add("", "S")
+	default:
+		e.add1("S")
+	}
+	return e.skip(i, "S", "Z")
+}
+
+func (e *dmEncoder) sc(i int) int {
+	switch {
+	case e.at(i+2) == 'H':
+		// Schlesinger's rule
+		switch {
+		case e.matches(i+3, "ER", "EN"):
+			// "Schermerhorn", "Schenker"
+			e.add("X", "SK")
+		case e.matches(i+3, "OO", "UY", "ED", "EM"):
+			// Dutch: "school", "schooner"
+			e.add1("SK")
+		case i == 0 && !e.isVowel(3) && e.at(3) != 'W':
+			e.add("X", "S")
+		default:
+			e.add1("X")
+		}
+	case e.matches(i+2, "I", "E", "Y"):
+		e.add1("S")
+	default:
+		e.add1("SK")
+	}
+	return i + 3
+}
+
+func (e *dmEncoder) t(i int) int {
+	switch {
+	case e.matches(i, "TION"), e.matches(i, "TIA", "TCH"):
+		e.add1("X")
+		return i + 3
+	case e.matches(i, "TH") || e.matches(i, "TTH"):
+		if e.matches(i+2, "OM", "AM") || e.germanic() {
+			// "Thomas", "Thames"
+			e.add1("T")
+		} else {
+			e.add("0", "T")
+		}
+		return i + 2
+	}
+	e.add1("T")
+	return e.skip(i, "T", "D")
+}
+
+func (e *dmEncoder) wRule(i int) int {
+	switch {
+	case e.matches(i, "WR"):
+		e.add1("R")
+		return i + 2
+	case i == 0 && e.isVowel(i+1):
+		// "Wasserman" matches "Vasserman".
+		e.add("A", "F")
+	case i == 0 && e.at(i+1) == 'H':
+		// "Womo" matches "Uomo".
+		e.add1("A")
+	case e.isLast(i) && e.isVowel(i-1) || e.matches(i-1, "EWSKI", "EWSKY", "OWSKI", "OWSKY") || e.matches(0, "SCH"):
+		// "Arnow" matches "Arnoff".
+		e.add("", "F")
+	case e.matches(i, "WICZ", "WITZ"):
+		// Polish "Filipowicz"
+		e.add("TS", "FX")
+		return i + 4
+	}
+	return i + 1
+}
+
+func (e *dmEncoder) x(i int) int {
+	if i == 0 {
+		e.add1("S")
+		return i + 1
+	}
+	if !(e.isLast(i) && (e.matches(i-3, "IAU", "EAU") || e.matches(i-2, "AU", "OU"))) {
+		// Not French "breaux"
+		e.add1("KS")
+	}
+	return e.skip(i, "C", "X")
+}
+
+func (e *dmEncoder) z(i int) int {
+	if e.at(i+1) == 'H' {
+		// Chinese pinyin "Zhao"
+		e.add1("J")
+		return i + 2
+	}
+	if e.matches(i+1, "ZO", "ZI", "ZA") || e.slavoGermanic && i > 0 && e.at(i-1) != 'T' {
+		e.add("S", "TS")
+	} else {
+		e.add1("S")
+	}
+	return e.skip(i, "Z")
+}
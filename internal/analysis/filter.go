@@ -0,0 +1,59 @@
+package analysis
+
+import "strings"
+
+// LowercaseFilter lowercases every token.
+type LowercaseFilter struct{}
+
+// Filter lowercases tokens in place.
+func (LowercaseFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = strings.ToLower(tokens[i].Term)
+	}
+	return tokens
+}
+
+// ASCIIFoldingFilter replaces characters that have an ASCII equivalent,
+// so that "café" and "cafe" index the same term. With PreserveOriginal, a
+// token that changes is followed by its original form at the same position.
+type ASCIIFoldingFilter struct {
+	PreserveOriginal bool
+}
+
+// Filter folds tokens.
+func (f ASCIIFoldingFilter) Filter(tokens []Token) []Token {
+	if !f.PreserveOriginal {
+		for i := range tokens {
+			tokens[i].Term = ASCIIFold(tokens[i].Term)
+		}
+		return tokens
+	}
+	out := make([]Token, 0, len(tokens))
+	for _, tok := range tokens {
+		folded := tok
+		folded.Term = ASCIIFold(tok.Term)
+		out = append(out, folded)
+		if folded.Term != tok.Term {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// NormalizeFilter applies Unicode NFKC normalization to every token, with
+// full case folding when CaseFold is set.
+type NormalizeFilter struct {
+	CaseFold bool
+}
+
+// Filter normalizes tokens in place.
+func (f NormalizeFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		if f.CaseFold {
+			tokens[i].Term = NFKCCaseFold(tokens[i].Term)
+		} else {
+			tokens[i].Term = NFKC(tokens[i].Term)
+		}
+	}
+	return tokens
+}
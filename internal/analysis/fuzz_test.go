@@ -2,6 +2,7 @@ package analysis
 
 import (
 	"testing"
+	"unicode/utf8"
 )
 
 func FuzzStandardAnalyzer(f *testing.F) {
@@ -50,3 +51,138 @@ func FuzzWhitespaceAnalyzer(f *testing.F) {
 		}
 	})
 }
+
+func FuzzCJKTokenizer(f *testing.F) {
+	f.Add("我爱北京天安门")
+	f.Add("東京タワー iPhone手机")
+	f.Add("한국어 a 字")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		tokens := CJKTokenizer{}.Tokenize(input)
+
+		for i, tok := range tokens {
+			if tok.Position != i {
+				t.Errorf("token %d position = %d, want %d", i, tok.Position, i)
+			}
+			if tok.StartByte < 0 || tok.EndByte > len(input) || tok.StartByte >= tok.EndByte {
+				t.Fatalf("invalid byte offsets: start=%d end=%d input_len=%d", tok.StartByte, tok.EndByte, len(input))
+			}
+			if input[tok.StartByte:tok.EndByte] != tok.Term {
+				t.Errorf("token %q has offsets of %q", tok.Term, input[tok.StartByte:tok.EndByte])
+			}
+		}
+	})
+}
+
+func FuzzHTMLStripCharFilter(f *testing.F) {
+	f.Add(`<p class="a">Hello <b>wor</b>ld</p>`)
+	f.Add("caf&eacute; &lt;&#x42;&gt; &amp")
+	f.Add("<script>a<b</script>c<!-- d")
+	f.Add("a < b <3")
+
+	p := &Pipeline{CharFilters: []CharFilter{HTMLStripCharFilter{}}, Tokenizer: StandardTokenizer{}}
+	f.Fuzz(func(t *testing.T, input string) {
+		out, corrections := HTMLStripCharFilter{}.Filter(input)
+		if len(out) > 4*len(input) {
+			t.Errorf("output of %d bytes for %d bytes of input", len(out), len(input))
+		}
+		for i := 1; i < len(corrections); i++ {
+			if corrections[i].Offset <= corrections[i-1].Offset {
+				t.Fatalf("corrections out of order: %+v", corrections)
+			}
+		}
+		for _, tok := range p.Analyze("field", input) {
+			if tok.StartByte < 0 || tok.EndByte > len(input) || tok.StartByte > tok.EndByte {
+				t.Fatalf("invalid byte offsets: start=%d end=%d input_len=%d", tok.StartByte, tok.EndByte, len(input))
+			}
+		}
+	})
+}
+
+func FuzzChainedCharFilters(f *testing.F) {
+	f.Add("<i>tom</i>&amp;jerry", "&", " and ")
+	f.Add("<em>e</em> - mail &amp; more", `\s*-\s*`, "")
+	f.Add("caf&eacute; 555-1234", `(\d+)-(\d+)`, "$2$1")
+	f.Add("a<b>b</b>c", "b", "")
+
+	f.Fuzz(func(t *testing.T, input, pattern, replacement string) {
+		replace, err := NewPatternReplaceCharFilter(pattern, replacement)
+		if err != nil {
+			return
+		}
+		for _, filters := range [][]CharFilter{
+			{HTMLStripCharFilter{}, replace},
+			{replace, HTMLStripCharFilter{}},
+			{replace, replace},
+		} {
+			p := &Pipeline{CharFilters: filters, Tokenizer: StandardTokenizer{}}
+			for _, tok := range p.Analyze("field", input) {
+				if tok.StartByte < 0 || tok.EndByte > len(input) || tok.StartByte > tok.EndByte {
+					t.Fatalf("invalid byte offsets: start=%d end=%d input_len=%d", tok.StartByte, tok.EndByte, len(input))
+				}
+			}
+		}
+	})
+}
+
+func FuzzPorter2Stem(f *testing.F) {
+	f.Add("running")
+	f.Add("'s'")
+	f.Add("s's'")
+	f.Add("yyy")
+	f.Add("generously")
+	f.Add("ied")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		// Should not panic.
+		stem := Porter2Stem(input)
+		if len(stem) > len(input)+1 {
+			t.Errorf("stem %q of %q is longer than the input", stem, input)
+		}
+	})
+}
+
+func FuzzNFKC(f *testing.F) {
+	f.Add("café")
+	f.Add("ＡＢＣ ﬁ")
+	f.Add("ẋ̣")
+	f.Add("각")
+	f.Add("̈ͅΣ")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		if !utf8.ValidString(input) {
+			return
+		}
+		n := NFKC(input)
+		if again := NFKC(n); again != n {
+			t.Errorf("NFKC not idempotent: %+q -> %+q -> %+q", input, n, again)
+		}
+		if !utf8.ValidString(NFKCCaseFold(input)) || !utf8.ValidString(ASCIIFold(input)) {
+			t.Errorf("invalid UTF-8 output for %+q", input)
+		}
+	})
+}
+
+func FuzzPhoneticEncoders(f *testing.F) {
+	f.Add("Smith")
+	f.Add("Schmidt")
+	f.Add("McClelland")
+	f.Add("San Jose")
+	f.Add("Mac Caffrey")
+	f.Add("ach")
+	f.Add("Ç")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		if s := Soundex(input); s != "" && len(s) != 4 {
+			t.Errorf("Soundex(%q) = %q", input, s)
+		}
+		if m := Metaphone(input, DefaultMaxCodeLength); len(m) > DefaultMaxCodeLength {
+			t.Errorf("Metaphone(%q) = %q, longer than %d", input, m, DefaultMaxCodeLength)
+		}
+		p, a := DoubleMetaphone(input, DefaultMaxCodeLength)
+		if len(p) > DefaultMaxCodeLength || len(a) > DefaultMaxCodeLength {
+			t.Errorf("DoubleMetaphone(%q) = %q, %q, longer than %d", input, p, a, DefaultMaxCodeLength)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package analysis
+
+import "sort"
+
+// GraphPaths returns the paths through a token graph, such as the output
+// of SynonymGraphFilter, as flat token streams: each path takes one token at
+// every position it reaches and continues after the positions that token
+// spans. Positions are renumbered so each token of a path follows the
+// previous one, keeping gaps left by removed tokens, which makes every path
+// usable as a phrase. At most limit paths are returned.
+func GraphPaths(tokens []Token, limit int) [][]Token {
+	if len(tokens) == 0 || limit <= 0 {
+		return nil
+	}
+	starts := make(map[int][]Token)
+	var positions []int
+	for _, tok := range tokens {
+		if _, ok := starts[tok.Position]; !ok {
+			positions = append(positions, tok.Position)
+		}
+		starts[tok.Position] = append(starts[tok.Position], tok)
+	}
+	sort.Ints(positions)
+
+	var paths [][]Token
+	var path []Token
+	// walk extends path from the first position at or after pos. next is
+	// the position the following token takes in the path.
+	var walk func(pos, next int)
+	walk = func(pos, next int) {
+		if len(paths) >= limit {
+			return
+		}
+		i := sort.SearchInts(positions, pos)
+		if i == len(positions) {
+			paths = append(paths, append([]Token(nil), path...))
+			return
+		}
+		at := positions[i]
+		next += at - pos
+		for _, tok := range starts[at] {
+			span := max(tok.PositionLength, 1)
+			renumbered := tok
+			renumbered.Position = next
+			renumbered.PositionLength = 0
+			path = append(path, renumbered)
+			walk(at+span, next+1)
+			path = path[:len(path)-1]
+		}
+	}
+	walk(positions[0], positions[0])
+	return paths
+}
+
+// FlattenGraph renumbers the nodes of a token graph as consecutive
+// positions, so that it can be indexed like an ordinary token stream. Each
+// node takes the position after the furthest node with a token leading to
+// it; tokens of shorter alternatives then share positions with those of the
+// longest. Gaps between tokens are kept. Streams without multi-position
+// tokens are returned unchanged.
+func FlattenGraph(tokens []Token) []Token {
+	graph := false
+	for _, tok := range tokens {
+		if tok.PositionLength > 1 {
+			graph = true
+			break
+		}
+	}
+	if !graph {
+		return tokens
+	}
+
+	incoming := make(map[int][]int)
+	var nodes []int
+	seen := make(map[int]bool)
+	for _, tok := range tokens {
+		to := tok.Position + max(tok.PositionLength, 1)
+		incoming[to] = append(incoming[to], tok.Position)
+		for _, n := range [2]int{tok.Position, to} {
+			if !seen[n] {
+				seen[n] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.Ints(nodes)
+
+	// Every token leads to a later node, so nodes in ascending order are
+	// in topological order.
+	positions := make(map[int]int, len(nodes))
+	for i, n := range nodes {
+		from, ok := incoming[n]
+		switch {
+		case i == 0:
+			positions[n] = n
+		case !ok:
+			positions[n] = positions[nodes[i-1]] + n - nodes[i-1]
+		default:
+			for _, f := range from {
+				positions[n] = max(positions[n], positions[f]+1)
+			}
+		}
+	}
+
+	out := make([]Token, len(tokens))
+	for i, tok := range tokens {
+		to := positions[tok.Position+max(tok.PositionLength, 1)]
+		tok.Position = positions[tok.Position]
+		tok.PositionLength = to - tok.Position
+		if tok.PositionLength == 1 {
+			tok.PositionLength = 0
+		}
+		out[i] = tok
+	}
+	return out
+}
@@ -10,6 +10,14 @@ func NewKeywordAnalyzer() *KeywordAnalyzer {
 
 // Analyze returns the entire input as a single token.
 func (a *KeywordAnalyzer) Analyze(_ string, text string) []Token {
+	return KeywordTokenizer{}.Tokenize(text)
+}
+
+// KeywordTokenizer emits the entire input as a single token.
+type KeywordTokenizer struct{}
+
+// Tokenize returns text as one token, or nothing for empty text.
+func (KeywordTokenizer) Tokenize(text string) []Token {
 	if text == "" {
 		return nil
 	}
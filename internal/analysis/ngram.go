@@ -0,0 +1,218 @@
+package analysis
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// N-gram limits.
+const (
+	DefaultMinGram = 1
+	DefaultMaxGram = 2
+
+	// MaxGram bounds the length of a gram in characters.
+	MaxGram = 64
+
+	// MaxNGramDiff bounds max_gram - min_gram for ngram components, which
+	// emit that many grams per character of input.
+	MaxNGramDiff = 8
+
+	// MaxNGramTokens bounds the tokens an n-gram component produces from
+	// one field value. Grams past the limit are dropped.
+	MaxNGramTokens = 10_000
+)
+
+// Character classes for TokenizerDef.TokenChars.
+const (
+	TokenCharLetter      = "letter"
+	TokenCharDigit       = "digit"
+	TokenCharWhitespace  = "whitespace"
+	TokenCharPunctuation = "punctuation"
+	TokenCharSymbol      = "symbol"
+)
+
+var tokenCharClasses = map[string]func(rune) bool{
+	TokenCharLetter:      unicode.IsLetter,
+	TokenCharDigit:       unicode.IsDigit,
+	TokenCharWhitespace:  unicode.IsSpace,
+	TokenCharPunctuation: unicode.IsPunct,
+	TokenCharSymbol:      unicode.IsSymbol,
+}
+
+// gramRange is a validated pair of gram lengths.
+type gramRange struct {
+	min, max int
+}
+
+func newGramRange(minGram, maxGram int, edge bool) (gramRange, error) {
+	g := gramRange{min: minGram, max: maxGram}
+	if g.min == 0 {
+		g.min = DefaultMinGram
+	}
+	if g.max == 0 {
+		g.max = max(DefaultMaxGram, g.min)
+	}
+	switch {
+	case g.min < 1 || g.max < g.min:
+		return g, fmt.Errorf("%w: min_gram must be at least 1 and at most max_gram", ErrInvalidAnalyzer)
+	case g.max > MaxGram:
+		return g, fmt.Errorf("%w: max_gram must be at most %d", ErrInvalidAnalyzer, MaxGram)
+	case !edge && g.max-g.min > MaxNGramDiff:
+		return g, fmt.Errorf("%w: max_gram - min_gram must be at most %d", ErrInvalidAnalyzer, MaxNGramDiff)
+	}
+	return g, nil
+}
+
+// NGramTokenizer splits text into runs of token characters and emits every
+// gram of each run, ordered by start and then by length. Each gram has its
+// own position and the offsets of its characters.
+type NGramTokenizer struct {
+	grams gramRange
+	edge  bool
+	// isTokenChar reports whether a rune belongs in a token; nil keeps
+	// every rune, so the whole text is one run.
+	isTokenChar func(rune) bool
+}
+
+// NewNGramTokenizer creates a tokenizer emitting grams of minGram to
+// maxGram characters. With edge set, only grams starting at the beginning
+// of a run are emitted. tokenChars lists the character classes that make up
+// tokens; other characters separate runs. An empty list keeps all
+// characters.
+func NewNGramTokenizer(minGram, maxGram int, edge bool, tokenChars []string) (*NGramTokenizer, error) {
+	g, err := newGramRange(minGram, maxGram, edge)
+	if err != nil {
+		return nil, err
+	}
+	t := &NGramTokenizer{grams: g, edge: edge}
+	if len(tokenChars) > 0 {
+		var classes []func(rune) bool
+		for _, name := range tokenChars {
+			class, ok := tokenCharClasses[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown token_chars class %q", ErrInvalidAnalyzer, name)
+			}
+			classes = append(classes, class)
+		}
+		t.isTokenChar = func(r rune) bool {
+			for _, class := range classes {
+				if class(r) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return t, nil
+}
+
+// Tokenize returns the grams of each run of token characters.
+func (t *NGramTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	// starts holds the byte offset of each rune of the current run, plus
+	// the offset just past it.
+	var starts []int
+	flush := func() {
+		tokens = appendGrams(tokens, text, starts, t.grams, t.edge, -1)
+		starts = starts[:0]
+	}
+	for i, r := range text {
+		if t.isTokenChar != nil && !t.isTokenChar(r) {
+			if len(starts) > 0 {
+				starts = append(starts, i)
+				flush()
+			}
+			continue
+		}
+		starts = append(starts, i)
+	}
+	if len(starts) > 0 {
+		starts = append(starts, len(text))
+		flush()
+	}
+	return tokens
+}
+
+// appendGrams appends the grams of a run whose rune boundaries are starts.
+// With position < 0 each gram takes the next position; otherwise all grams
+// share it.
+func appendGrams(tokens []Token, text string, starts []int, g gramRange, edge bool, position int) []Token {
+	runes := len(starts) - 1
+	last := runes - g.min
+	if edge {
+		last = min(last, 0)
+	}
+	for i := 0; i <= last; i++ {
+		for n := g.min; n <= g.max && i+n <= runes; n++ {
+			if len(tokens) >= MaxNGramTokens {
+				return tokens
+			}
+			tok := Token{Term: text[starts[i]:starts[i+n]], StartByte: starts[i], EndByte: starts[i+n]}
+			if position < 0 {
+				tok.Position = len(tokens)
+			} else {
+				tok.Position = position
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
+
+// NGramFilter replaces each token by its grams. Grams keep the position
+// and offsets of the token they came from, so highlighting marks the whole
+// token. Tokens shorter than the minimum gram are dropped; with
+// preserveOriginal every token is also kept alongside its grams.
+type NGramFilter struct {
+	grams            gramRange
+	edge             bool
+	preserveOriginal bool
+}
+
+// NewNGramFilter creates an n-gram filter; see NewNGramTokenizer.
+func NewNGramFilter(minGram, maxGram int, edge, preserveOriginal bool) (*NGramFilter, error) {
+	g, err := newGramRange(minGram, maxGram, edge)
+	if err != nil {
+		return nil, err
+	}
+	return &NGramFilter{grams: g, edge: edge, preserveOriginal: preserveOriginal}, nil
+}
+
+// Filter returns the grams of every token.
+func (f *NGramFilter) Filter(tokens []Token) []Token {
+	out := make([]Token, 0, len(tokens))
+	var starts []int
+	for _, tok := range tokens {
+		if len(out) >= MaxNGramTokens {
+			break
+		}
+		starts = starts[:0]
+		for i := range tok.Term {
+			starts = append(starts, i)
+		}
+		starts = append(starts, len(tok.Term))
+
+		before := len(out)
+		grams := appendGrams(nil, tok.Term, starts, f.grams, f.edge, tok.Position)
+		for _, gram := range grams {
+			if len(out) >= MaxNGramTokens {
+				break
+			}
+			gram.StartByte, gram.EndByte = tok.StartByte, tok.EndByte
+			out = append(out, gram)
+		}
+		if f.preserveOriginal && len(out) < MaxNGramTokens && !containsTerm(out[before:], tok.Term) {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+func containsTerm(tokens []Token, term string) bool {
+	for _, tok := range tokens {
+		if tok.Term == term {
+			return true
+		}
+	}
+	return false
+}
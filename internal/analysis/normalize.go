@@ -0,0 +1,168 @@
+package analysis
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Hangul syllable constants from the Unicode standard, section 3.12.
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// NFKC returns text in Unicode normalization form KC: compatibility
+// characters such as full-width letters and ligatures are replaced by their
+// plain equivalents and canonical sequences are composed.
+func NFKC(text string) string {
+	if isASCII(text) {
+		return text
+	}
+	return string(compose(decompose([]rune(text), false)))
+}
+
+// NFKCCaseFold returns text in NFKC with full Unicode case folding applied,
+// so that strings differing only in case or compatibility form compare
+// equal.
+func NFKCCaseFold(text string) string {
+	if isASCII(text) {
+		return strings.ToLower(text)
+	}
+	return string(compose(decompose([]rune(text), true)))
+}
+
+// ASCIIFold replaces letters, digits and punctuation that have an ASCII
+// equivalent, such as "é" or full-width "Ａ", by that equivalent. Other
+// characters are left unchanged.
+func ASCIIFold(text string) string {
+	if isASCII(text) {
+		return text
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, r := range text {
+		if folded, ok := asciiFolds[r]; ok {
+			b.WriteString(folded)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// decompose returns the full compatibility decomposition of runes in
+// canonical order. With fold set, the decomposed characters are then case
+// folded and decomposed again; folding follows reordering because some
+// combining marks, such as U+0345, fold to starters.
+func decompose(runes []rune, fold bool) []rune {
+	out := make([]rune, 0, len(runes))
+	for _, r := range runes {
+		out = appendDecomposed(out, r)
+	}
+	reorder(out)
+	if !fold {
+		return out
+	}
+	folded := make([]rune, 0, len(out))
+	for _, r := range out {
+		f, ok := caseFolds[r]
+		if !ok {
+			folded = append(folded, r)
+			continue
+		}
+		for _, fr := range f {
+			folded = appendDecomposed(folded, fr)
+		}
+	}
+	reorder(folded)
+	return folded
+}
+
+func appendDecomposed(out []rune, r rune) []rune {
+	if r >= hangulSBase && r < hangulSBase+hangulSCount {
+		s := r - hangulSBase
+		out = append(out, hangulLBase+s/hangulNCount, hangulVBase+(s%hangulNCount)/hangulTCount)
+		if t := s % hangulTCount; t != 0 {
+			out = append(out, hangulTBase+t)
+		}
+		return out
+	}
+	if d, ok := decompositions[r]; ok {
+		return append(out, []rune(d)...)
+	}
+	return append(out, r)
+}
+
+// reorder sorts each run of combining marks by combining class, keeping
+// marks of equal class in order.
+func reorder(runes []rune) {
+	for i := 1; i < len(runes); i++ {
+		c := combiningClasses[runes[i]]
+		if c == 0 {
+			continue
+		}
+		for j := i; j > 0; j-- {
+			prev := combiningClasses[runes[j-1]]
+			if prev == 0 || prev <= c {
+				break
+			}
+			runes[j-1], runes[j] = runes[j], runes[j-1]
+		}
+	}
+}
+
+// compose applies canonical composition to decomposed runes in place.
+func compose(runes []rune) []rune {
+	if len(runes) == 0 {
+		return runes
+	}
+	starter := 0
+	lastClass := int(combiningClasses[runes[0]])
+	if lastClass != 0 {
+		// A leading mark blocks composition with any later character.
+		lastClass = 256
+	}
+	n := 1
+	for _, r := range runes[1:] {
+		class := int(combiningClasses[r])
+		if composite, ok := composePair(runes[starter], r); ok && (lastClass < class || lastClass == 0) {
+			runes[starter] = composite
+			continue
+		}
+		if class == 0 {
+			starter = n
+		}
+		lastClass = class
+		runes[n] = r
+		n++
+	}
+	return runes[:n]
+}
+
+func composePair(a, b rune) (rune, bool) {
+	if a >= hangulLBase && a < hangulLBase+hangulLCount && b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+(b-hangulVBase))*hangulTCount, true
+	}
+	if a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + (b - hangulTBase), true
+	}
+	r, ok := compositions[[2]rune{a, b}]
+	return r, ok
+}
@@ -0,0 +1,284 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Phonetic encoders for PhoneticFilter.
+const (
+	EncoderSoundex         = "soundex"
+	EncoderMetaphone       = "metaphone"
+	EncoderDoubleMetaphone = "double_metaphone"
+)
+
+// DefaultMaxCodeLength is the code length of the Metaphone encoders.
+const DefaultMaxCodeLength = 4
+
+// MaxCodeLength bounds the configurable code length.
+const MaxCodeLength = 32
+
+// PhoneticFilter replaces each token by codes for how it sounds, so that
+// names spelled differently but pronounced alike, such as "Smith" and
+// "Smyth", index the same term. Codes share the position and offsets of
+// their token. Double Metaphone emits its alternate code too when it
+// differs. Tokens without letters to encode are kept unchanged; with
+// preserveOriginal every token is kept alongside its codes.
+type PhoneticFilter struct {
+	encode           func(string) []string
+	preserveOriginal bool
+}
+
+// NewPhoneticFilter creates a phonetic filter using encoder, one of
+// EncoderSoundex, EncoderMetaphone and EncoderDoubleMetaphone. A
+// maxCodeLength of zero uses DefaultMaxCodeLength; Soundex codes always
+// have four characters.
+func NewPhoneticFilter(encoder string, maxCodeLength int, preserveOriginal bool) (*PhoneticFilter, error) {
+	if maxCodeLength == 0 {
+		maxCodeLength = DefaultMaxCodeLength
+	}
+	if maxCodeLength < 1 || maxCodeLength > MaxCodeLength {
+		return nil, fmt.Errorf("%w: max_code_length must be between 1 and %d", ErrInvalidAnalyzer, MaxCodeLength)
+	}
+	f := &PhoneticFilter{preserveOriginal: preserveOriginal}
+	switch encoder {
+	case EncoderSoundex:
+		f.encode = func(s string) []string { return []string{Soundex(s)} }
+	case EncoderMetaphone:
+		f.encode = func(s string) []string { return []string{Metaphone(s, maxCodeLength)} }
+	case EncoderDoubleMetaphone:
+		f.encode = func(s string) []string {
+			primary, alternate := DoubleMetaphone(s, maxCodeLength)
+			return []string{primary, alternate}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown phonetic encoder %q", ErrInvalidAnalyzer, encoder)
+	}
+	return f, nil
+}
+
+// Filter replaces tokens by their codes.
+func (f *PhoneticFilter) Filter(tokens []Token) []Token {
+	out := make([]Token, 0, len(tokens))
+	for _, tok := range tokens {
+		before := len(out)
+		if f.preserveOriginal {
+			out = append(out, tok)
+		}
+		for _, code := range f.encode(tok.Term) {
+			if code == "" || containsTerm(out[before:], code) {
+				continue
+			}
+			c := tok
+			c.Term = code
+			out = append(out, c)
+		}
+		if len(out) == before {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// asciiLetters returns the letters of s folded to ASCII and uppercased,
+// dropping everything else.
+func asciiLetters(s string) []byte {
+	s = ASCIIFold(s)
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if 'A' <= c && c <= 'Z' {
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// soundexCodes maps letters A to Z to their Soundex digits, 0 for vowels
+// and for H and W.
+const soundexCodes = "01230120022455012623010202"
+
+// Soundex returns the American Soundex code of s: its first letter and
+// three digits, such as "R163" for "Robert". It returns "" if s has no
+// letters.
+func Soundex(s string) string {
+	letters := asciiLetters(s)
+	if len(letters) == 0 {
+		return ""
+	}
+	code := []byte{letters[0]}
+	last := soundexCodes[letters[0]-'A']
+	for _, c := range letters[1:] {
+		d := soundexCodes[c-'A']
+		switch {
+		case c == 'H' || c == 'W':
+			// Unlike vowels, H and W do not separate letters of the same
+			// code: "Ashcraft" is A261.
+			continue
+		case d == '0':
+			last = d
+		case d != last:
+			code = append(code, d)
+			last = d
+		}
+		if len(code) == 4 {
+			break
+		}
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+// Metaphone returns the original Metaphone code of s, at most maxLen
+// characters long. It returns "" if s has no letters.
+func Metaphone(s string, maxLen int) string {
+	w := asciiLetters(s)
+	switch len(w) {
+	case 0:
+		return ""
+	case 1:
+		return string(w)
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(w) {
+			return 0
+		}
+		return w[i]
+	}
+	isVowel := func(i int) bool { return strings.IndexByte("AEIOU", at(i)) >= 0 }
+	isFrontVowel := func(i int) bool { return strings.IndexByte("EIY", at(i)) >= 0 }
+	isLast := func(i int) bool { return i == len(w)-1 }
+	matches := func(i int, s string) bool { return i+len(s) <= len(w) && string(w[i:i+len(s)]) == s }
+
+	var code []byte
+	n := 0
+	switch w[0] {
+	case 'K', 'G', 'P':
+		if w[1] == 'N' {
+			code = append(code, 'N')
+			n = 2
+		}
+	case 'A':
+		if w[1] == 'E' {
+			code = append(code, 'E')
+			n = 2
+		}
+	case 'W':
+		if w[1] == 'R' {
+			code = append(code, 'R')
+			n = 2
+		} else if w[1] == 'H' {
+			code = append(code, 'W')
+			n = 2
+		}
+	case 'X':
+		code = append(code, 'S')
+		n = 1
+	}
+
+	for ; n < len(w) && len(code) < maxLen; n++ {
+		c := w[n]
+		if c != 'C' && at(n-1) == c {
+			continue
+		}
+		switch c {
+		case 'A', 'E', 'I', 'O', 'U':
+			if n == 0 {
+				code = append(code, c)
+			}
+		case 'B':
+			if !(at(n-1) == 'M' && isLast(n)) {
+				code = append(code, 'B')
+			}
+		case 'C':
+			switch {
+			case at(n-1) == 'S' && isFrontVowel(n+1):
+				// SCI, SCE and SCY are silent.
+			case matches(n, "CIA"):
+				code = append(code, 'X')
+			case isFrontVowel(n + 1):
+				code = append(code, 'S')
+			case at(n-1) == 'S' && at(n+1) == 'H':
+				code = append(code, 'K')
+			case n == 0 && matches(0, "CHR"):
+				// "Christopher", "Chris"
+				code = append(code, 'K')
+			case at(n+1) == 'H':
+				code = append(code, 'X')
+			default:
+				code = append(code, 'K')
+			}
+		case 'D':
+			if at(n+1) == 'G' && isFrontVowel(n+2) {
+				code = append(code, 'J')
+				n += 2
+			} else {
+				code = append(code, 'T')
+			}
+		case 'G':
+			switch {
+			case isLast(n+1) && at(n+1) == 'H':
+			case at(n+1) == 'H' && !isLast(n+1) && !isVowel(n+2):
+			case n > 0 && (matches(n, "GN") || matches(n, "GNED")):
+			case isFrontVowel(n+1) && at(n-1) != 'G':
+				code = append(code, 'J')
+			default:
+				code = append(code, 'K')
+			}
+		case 'H':
+			if !isLast(n) && strings.IndexByte("CSPTG", at(n-1)) < 0 && isVowel(n+1) {
+				code = append(code, 'H')
+			}
+		case 'F', 'J', 'L', 'M', 'N', 'R':
+			code = append(code, c)
+		case 'K':
+			if at(n-1) != 'C' {
+				code = append(code, 'K')
+			}
+		case 'P':
+			if at(n+1) == 'H' {
+				code = append(code, 'F')
+			} else {
+				code = append(code, 'P')
+			}
+		case 'Q':
+			code = append(code, 'K')
+		case 'S':
+			if matches(n, "SH") || matches(n, "SIO") || matches(n, "SIA") {
+				code = append(code, 'X')
+			} else {
+				code = append(code, 'S')
+			}
+		case 'T':
+			switch {
+			case matches(n, "TIA") || matches(n, "TIO"):
+				code = append(code, 'X')
+			case matches(n, "TCH"):
+			case matches(n, "TH"):
+				code = append(code, '0')
+			default:
+				code = append(code, 'T')
+			}
+		case 'V':
+			code = append(code, 'F')
+		case 'W', 'Y':
+			if isVowel(n + 1) {
+				code = append(code, c)
+			}
+		case 'X':
+			code = append(code, 'K', 'S')
+		case 'Z':
+			code = append(code, 'S')
+		}
+	}
+	if len(code) > maxLen {
+		code = code[:maxLen]
+	}
+	return string(code)
+}
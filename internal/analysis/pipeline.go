@@ -0,0 +1,426 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+var ErrInvalidAnalyzer = errors.New("invalid analyzer definition")
+
+// CharFilter rewrites text before it is tokenized.
+type CharFilter interface {
+	// Filter returns the rewritten text and the corrections that map byte
+	// offsets in it back to the input, in ascending Offset order. Filters
+	// that keep every byte in place return no corrections.
+	Filter(text string) (string, []OffsetCorrection)
+}
+
+// OffsetCorrection records that offsets from Offset onward in filtered text
+// lie Delta bytes later in the text that was filtered. When the filter wrote
+// Inserted bytes at Offset in place of Replaced bytes of input, offsets
+// within them map to the start of that input and token ends within them or
+// at their end to its end, so a token spans all of the input its text
+// replaced.
+type OffsetCorrection struct {
+	Offset   int
+	Delta    int
+	Inserted int
+	Replaced int
+}
+
+// Tokenizer splits text into tokens with positions and byte offsets.
+type Tokenizer interface {
+	Tokenize(text string) []Token
+}
+
+// TokenFilter transforms a token stream. Filters may rewrite, drop or add
+// tokens; a dropped token leaves a gap in positions.
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// AnalyzerDef declares an analyzer by the names of its components.
+//
+//	{"char_filters": [], "tokenizer": "standard", "filters": ["lowercase"]}
+type AnalyzerDef struct {
+	CharFilters []string `json:"char_filters,omitempty"`
+	Tokenizer   string   `json:"tokenizer"`
+	Filters     []string `json:"filters,omitempty"`
+}
+
+// TokenFilterDef declares a configured token filter. Type names the filter
+// kind; the remaining fields are its options.
+//
+//	{"type": "stop", "language": "english", "stopwords": ["via"]}
+type TokenFilterDef struct {
+	Type string `json:"type"`
+
+	// Stop options. Stopwords extends the built-in list of Language.
+	Language   string   `json:"language,omitempty"`
+	Stopwords  []string `json:"stopwords,omitempty"`
+	IgnoreCase bool     `json:"ignore_case,omitempty"`
+
+	// N-gram options. PreserveOriginal also applies to ASCII folding.
+	MinGram          int  `json:"min_gram,omitempty"`
+	MaxGram          int  `json:"max_gram,omitempty"`
+	PreserveOriginal bool `json:"preserve_original,omitempty"`
+
+	// Synonym graph options. Rules from Synonyms and the file at
+	// SynonymsPath, relative to the index's synonyms directory, are merged;
+	// IgnoreCase also applies.
+	Synonyms     []string `json:"synonyms,omitempty"`
+	SynonymsPath string   `json:"synonyms_path,omitempty"`
+
+	// Word delimiter options. Unset splitting options default to true;
+	// PreserveOriginal also applies.
+	SplitOnCaseChange     *bool `json:"split_on_case_change,omitempty"`
+	SplitOnNumerics       *bool `json:"split_on_numerics,omitempty"`
+	StemEnglishPossessive *bool `json:"stem_english_possessive,omitempty"`
+	CatenateWords         bool  `json:"catenate_words,omitempty"`
+	CatenateNumbers       bool  `json:"catenate_numbers,omitempty"`
+	CatenateAll           bool  `json:"catenate_all,omitempty"`
+
+	// Phonetic options. Encoder defaults to metaphone; PreserveOriginal
+	// injects codes alongside tokens instead of replacing them.
+	Encoder       string `json:"encoder,omitempty"`
+	MaxCodeLength int    `json:"max_code_length,omitempty"`
+}
+
+// CharFilterDef declares a configured char filter.
+//
+//	{"type": "pattern_replace", "pattern": "(\\d+)-(\\d+)", "replacement": "$1$2"}
+type CharFilterDef struct {
+	Type string `json:"type"`
+
+	// Pattern replace options.
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// TokenizerDef declares a configured tokenizer.
+//
+//	{"type": "ngram", "min_gram": 2, "max_gram": 3, "token_chars": ["letter", "digit"]}
+type TokenizerDef struct {
+	Type string `json:"type"`
+
+	// N-gram options.
+	MinGram    int      `json:"min_gram,omitempty"`
+	MaxGram    int      `json:"max_gram,omitempty"`
+	TokenChars []string `json:"token_chars,omitempty"`
+}
+
+// Built-in components by name.
+var (
+	builtinCharFilters = map[string]func() CharFilter{
+		"html_strip": func() CharFilter { return HTMLStripCharFilter{} },
+	}
+
+	// charFilterTypes build configured char filters by CharFilterDef.Type.
+	charFilterTypes = map[string]func(CharFilterDef) (CharFilter, error){
+		"html_strip": func(CharFilterDef) (CharFilter, error) { return HTMLStripCharFilter{}, nil },
+		"pattern_replace": func(def CharFilterDef) (CharFilter, error) {
+			return NewPatternReplaceCharFilter(def.Pattern, def.Replacement)
+		},
+	}
+
+	builtinTokenizers = map[string]func() Tokenizer{
+		"standard":   func() Tokenizer { return StandardTokenizer{} },
+		"whitespace": func() Tokenizer { return WhitespaceTokenizer{} },
+		"keyword":    func() Tokenizer { return KeywordTokenizer{} },
+		"cjk":        func() Tokenizer { return CJKTokenizer{} },
+		"ngram":      func() Tokenizer { return mustNGramTokenizer(false) },
+		"edge_ngram": func() Tokenizer { return mustNGramTokenizer(true) },
+	}
+
+	// tokenizerTypes build configured tokenizers by TokenizerDef.Type.
+	tokenizerTypes = map[string]func(TokenizerDef) (Tokenizer, error){
+		"ngram": func(def TokenizerDef) (Tokenizer, error) {
+			return NewNGramTokenizer(def.MinGram, def.MaxGram, false, def.TokenChars)
+		},
+		"edge_ngram": func(def TokenizerDef) (Tokenizer, error) {
+			return NewNGramTokenizer(def.MinGram, def.MaxGram, true, def.TokenChars)
+		},
+	}
+
+	tokenFilters = map[string]func() TokenFilter{
+		"lowercase": func() TokenFilter { return LowercaseFilter{} },
+		"stop":      func() TokenFilter { return NewStopFilter(stopwordLists["english"], false) },
+		"porter2":   func() TokenFilter { return Porter2Filter{} },
+		"porter":    func() TokenFilter { return Porter2Filter{} }, // alias of porter2
+
+		"asciifolding": func() TokenFilter { return ASCIIFoldingFilter{} },
+		"nfkc":         func() TokenFilter { return NormalizeFilter{} },
+		"nfkc_cf":      func() TokenFilter { return NormalizeFilter{CaseFold: true} },
+		"ngram":        func() TokenFilter { return mustNGramFilter(false) },
+		"edge_ngram":   func() TokenFilter { return mustNGramFilter(true) },
+
+		"word_delimiter_graph": func() TokenFilter { return NewWordDelimiterFilter(DefaultWordDelimiterOptions()) },
+
+		"soundex":          func() TokenFilter { return mustPhoneticFilter(EncoderSoundex) },
+		"metaphone":        func() TokenFilter { return mustPhoneticFilter(EncoderMetaphone) },
+		"double_metaphone": func() TokenFilter { return mustPhoneticFilter(EncoderDoubleMetaphone) },
+	}
+
+	// tokenFilterTypes build configured token filters by TokenFilterDef.Type.
+	// Filters that load files read them from resources, which may be nil.
+	tokenFilterTypes = map[string]func(TokenFilterDef, fs.FS) (TokenFilter, error){
+		"stop": func(def TokenFilterDef, _ fs.FS) (TokenFilter, error) {
+			return newStopFilterFromDef(def)
+		},
+		"asciifolding": func(def TokenFilterDef, _ fs.FS) (TokenFilter, error) {
+			return ASCIIFoldingFilter{PreserveOriginal: def.PreserveOriginal}, nil
+		},
+		"ngram": func(def TokenFilterDef, _ fs.FS) (TokenFilter, error) {
+			return NewNGramFilter(def.MinGram, def.MaxGram, false, def.PreserveOriginal)
+		},
+		"edge_ngram": func(def TokenFilterDef, _ fs.FS) (TokenFilter, error) {
+			return NewNGramFilter(def.MinGram, def.MaxGram, true, def.PreserveOriginal)
+		},
+		"synonym_graph": newSynonymFilterFromDef,
+		"word_delimiter_graph": func(def TokenFilterDef, _ fs.FS) (TokenFilter, error) {
+			return newWordDelimiterFilterFromDef(def), nil
+		},
+		"phonetic": func(def TokenFilterDef, _ fs.FS) (TokenFilter, error) {
+			encoder := def.Encoder
+			if encoder == "" {
+				encoder = EncoderMetaphone
+			}
+			return NewPhoneticFilter(encoder, def.MaxCodeLength, def.PreserveOriginal)
+		},
+	}
+)
+
+// Pipeline is an Analyzer that runs char filters, a tokenizer and token
+// filters in turn. Token offsets refer to the original text.
+type Pipeline struct {
+	CharFilters []CharFilter
+	Tokenizer   Tokenizer
+	Filters     []TokenFilter
+
+	// def names the components of a pipeline built from a definition.
+	def AnalyzerDef
+}
+
+// Kinds of pipeline stages.
+const (
+	StageCharFilter  = "char_filter"
+	StageTokenizer   = "tokenizer"
+	StageTokenFilter = "token_filter"
+)
+
+// Stage is the output of one component of a Pipeline.
+type Stage struct {
+	Kind string
+	// Name is the component's name in the analyzer definition, or its Go
+	// type for pipelines assembled directly.
+	Name string
+	// Text is the output of a char filter.
+	Text string
+	// Tokens is the output of a tokenizer or token filter. Offsets refer to
+	// the original text.
+	Tokens []Token
+}
+
+// NewPipeline builds the analyzer a definition describes from built-in
+// components.
+func NewPipeline(def AnalyzerDef) (*Pipeline, error) {
+	return newPipeline(def, nil, nil, nil)
+}
+
+// NewCharFilter builds a configured char filter.
+func NewCharFilter(def CharFilterDef) (CharFilter, error) {
+	newFilter, ok := charFilterTypes[def.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown char filter type %q", ErrInvalidAnalyzer, def.Type)
+	}
+	return newFilter(def)
+}
+
+// NewTokenizer builds a configured tokenizer.
+func NewTokenizer(def TokenizerDef) (Tokenizer, error) {
+	newTokenizer, ok := tokenizerTypes[def.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown tokenizer type %q", ErrInvalidAnalyzer, def.Type)
+	}
+	return newTokenizer(def)
+}
+
+// NewTokenFilter builds a configured token filter. Files it names are not
+// read; see Registry.DefineTokenFilter.
+func NewTokenFilter(def TokenFilterDef) (TokenFilter, error) {
+	return newTokenFilter(def, nil)
+}
+
+func newTokenFilter(def TokenFilterDef, resources fs.FS) (TokenFilter, error) {
+	newFilter, ok := tokenFilterTypes[def.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown token filter type %q", ErrInvalidAnalyzer, def.Type)
+	}
+	return newFilter(def, resources)
+}
+
+// newPipeline builds a pipeline, resolving component names against
+// charFilters, tokenizers and filters before the built-ins.
+func newPipeline(def AnalyzerDef, charFilters map[string]CharFilter, tokenizers map[string]Tokenizer, filters map[string]TokenFilter) (*Pipeline, error) {
+	p := &Pipeline{def: def}
+	for _, name := range def.CharFilters {
+		if f, ok := charFilters[name]; ok {
+			p.CharFilters = append(p.CharFilters, f)
+			continue
+		}
+		newFilter, ok := builtinCharFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown char filter %q", ErrInvalidAnalyzer, name)
+		}
+		p.CharFilters = append(p.CharFilters, newFilter())
+	}
+	if def.Tokenizer == "" {
+		return nil, fmt.Errorf("%w: tokenizer is required", ErrInvalidAnalyzer)
+	}
+	if t, ok := tokenizers[def.Tokenizer]; ok {
+		p.Tokenizer = t
+	} else if newTokenizer, ok := builtinTokenizers[def.Tokenizer]; ok {
+		p.Tokenizer = newTokenizer()
+	} else {
+		return nil, fmt.Errorf("%w: unknown tokenizer %q", ErrInvalidAnalyzer, def.Tokenizer)
+	}
+	for _, name := range def.Filters {
+		if f, ok := filters[name]; ok {
+			p.Filters = append(p.Filters, f)
+			continue
+		}
+		newFilter, ok := tokenFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown token filter %q", ErrInvalidAnalyzer, name)
+		}
+		p.Filters = append(p.Filters, newFilter())
+	}
+	return p, nil
+}
+
+// Analyze runs the pipeline over text.
+func (p *Pipeline) Analyze(_ string, text string) []Token {
+	return p.analyze(text, nil)
+}
+
+// AnalyzeStages runs the pipeline over text like Analyze and also returns
+// the output of each char filter, the tokenizer and each token filter, in
+// order.
+func (p *Pipeline) AnalyzeStages(text string) ([]Token, []Stage) {
+	var stages []Stage
+	tokens := p.analyze(text, &stages)
+	return tokens, stages
+}
+
+// analyze runs the pipeline, appending the output of every component to
+// stages unless it is nil.
+func (p *Pipeline) analyze(text string, stages *[]Stage) []Token {
+	var corrections [][]OffsetCorrection
+	for i, f := range p.CharFilters {
+		var c []OffsetCorrection
+		text, c = f.Filter(text)
+		corrections = append(corrections, c)
+		if stages != nil {
+			*stages = append(*stages, Stage{Kind: StageCharFilter, Name: componentName(p.def.CharFilters, i, f), Text: text})
+		}
+	}
+	tokens := p.Tokenizer.Tokenize(text)
+	if stages != nil {
+		name := p.def.Tokenizer
+		if name == "" {
+			name = fmt.Sprintf("%T", p.Tokenizer)
+		}
+		*stages = append(*stages, Stage{Kind: StageTokenizer, Name: name, Tokens: append([]Token(nil), tokens...)})
+	}
+	for i, f := range p.Filters {
+		tokens = f.Filter(tokens)
+		if stages != nil {
+			*stages = append(*stages, Stage{Kind: StageTokenFilter, Name: componentName(p.def.Filters, i, f), Tokens: append([]Token(nil), tokens...)})
+		}
+	}
+
+	correct := func(tokens []Token) {
+		for i := len(corrections) - 1; i >= 0; i-- {
+			if len(corrections[i]) == 0 {
+				continue
+			}
+			for j := range tokens {
+				tokens[j].StartByte = correctOffset(corrections[i], tokens[j].StartByte)
+				tokens[j].EndByte = max(correctEndOffset(corrections[i], tokens[j].EndByte), tokens[j].StartByte)
+			}
+		}
+	}
+	correct(tokens)
+	if stages != nil {
+		for _, stage := range *stages {
+			correct(stage.Tokens)
+		}
+	}
+	return tokens
+}
+
+// componentName returns names[i], the name component was built from, or
+// its type if the pipeline was not built from a definition.
+func componentName(names []string, i int, component interface{}) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("%T", component)
+}
+
+// correctOffset maps an offset in filtered text back to the text before
+// filtering.
+func correctOffset(corrections []OffsetCorrection, offset int) int {
+	i := sort.Search(len(corrections), func(i int) bool { return corrections[i].Offset > offset })
+	if i == 0 {
+		return offset
+	}
+	c := corrections[i-1]
+	if offset < c.Offset+c.Inserted {
+		return c.Offset + c.Delta
+	}
+	return offset + c.Delta
+}
+
+// correctEndOffset maps the end offset of a token in filtered text back to
+// the text before filtering. The end follows the token's last byte, so that
+// markup removed after a token, such as a closing tag, is not counted as
+// part of it, and a token ending in inserted text ends with the input that
+// text replaced.
+func correctEndOffset(corrections []OffsetCorrection, end int) int {
+	i := sort.Search(len(corrections), func(i int) bool { return corrections[i].Offset >= end })
+	if i == 0 {
+		return end
+	}
+	c := corrections[i-1]
+	if end <= c.Offset+c.Inserted {
+		return c.Offset + c.Delta + c.Replaced
+	}
+	return end + c.Delta
+}
+
+func mustNGramTokenizer(edge bool) Tokenizer {
+	t, err := NewNGramTokenizer(DefaultMinGram, DefaultMaxGram, edge, nil)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func mustNGramFilter(edge bool) TokenFilter {
+	f, err := NewNGramFilter(DefaultMinGram, DefaultMaxGram, edge, false)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func mustPhoneticFilter(encoder string) TokenFilter {
+	f, err := NewPhoneticFilter(encoder, DefaultMaxCodeLength, false)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
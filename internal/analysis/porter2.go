@@ -0,0 +1,329 @@
+package analysis
+
+import "strings"
+
+// Porter2Filter stems English terms with the Porter2 (Snowball English)
+// algorithm. It expects lowercase input and leaves terms containing
+// non-ASCII bytes unchanged.
+type Porter2Filter struct{}
+
+// Filter stems tokens in place.
+func (Porter2Filter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = Porter2Stem(tokens[i].Term)
+	}
+	return tokens
+}
+
+// porter2Exceptions are stemmed to fixed forms before any rule applies.
+var porter2Exceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie",
+	"tying": "tie", "idly": "idl", "gently": "gentl", "ugly": "ugli",
+	"early": "earli", "only": "onli", "singly": "singl",
+	"sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas",
+	"cosmos": "cosmos", "bias": "bias", "andes": "andes",
+}
+
+// porter2Step1aExceptions are left alone once step 1a has run.
+var porter2Step1aExceptions = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+// Porter2Stem returns the Porter2 stem of a lowercase English word.
+func Porter2Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] >= 0x80 {
+			return word
+		}
+	}
+	if stem, ok := porter2Exceptions[word]; ok {
+		return stem
+	}
+
+	s := &stemmer{b: []byte(strings.TrimPrefix(word, "'"))}
+	if len(s.b) <= 2 {
+		return string(s.b)
+	}
+	s.markConsonantY()
+	s.markRegions()
+
+	s.step0()
+	s.step1a()
+	if porter2Step1aExceptions[string(s.b)] {
+		return string(s.b)
+	}
+	s.step1b()
+	s.step1c()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+
+	for i, c := range s.b {
+		if c == 'Y' {
+			s.b[i] = 'y'
+		}
+	}
+	return string(s.b)
+}
+
+// stemmer holds a word being stemmed and the starts of its R1 and R2
+// regions. Consonant y is marked as 'Y' while stemming.
+type stemmer struct {
+	b      []byte
+	r1, r2 int
+}
+
+func isVowel(c byte) bool {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+func (s *stemmer) markConsonantY() {
+	for i, c := range s.b {
+		if c == 'y' && (i == 0 || isVowel(s.b[i-1])) {
+			s.b[i] = 'Y'
+		}
+	}
+}
+
+// markRegions sets R1 after the first non-vowel following a vowel, and R2
+// likewise within R1.
+func (s *stemmer) markRegions() {
+	s.r1 = len(s.b)
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(s.b), prefix) {
+			s.r1 = len(prefix)
+			break
+		}
+	}
+	if s.r1 == len(s.b) {
+		s.r1 = regionAfter(s.b, 0)
+	}
+	s.r2 = regionAfter(s.b, s.r1)
+}
+
+func regionAfter(b []byte, from int) int {
+	for i := from + 1; i < len(b); i++ {
+		if !isVowel(b[i]) && isVowel(b[i-1]) {
+			return i + 1
+		}
+	}
+	return len(b)
+}
+
+func (s *stemmer) hasSuffix(suffix string) bool {
+	return strings.HasSuffix(string(s.b), suffix)
+}
+
+// longestSuffix returns the longest of suffixes that ends the word.
+func (s *stemmer) longestSuffix(suffixes ...string) string {
+	longest := ""
+	for _, suffix := range suffixes {
+		if len(suffix) > len(longest) && s.hasSuffix(suffix) {
+			longest = suffix
+		}
+	}
+	return longest
+}
+
+// inR1 and inR2 report whether a suffix of length n lies in the region.
+func (s *stemmer) inR1(n int) bool { return len(s.b)-n >= s.r1 }
+func (s *stemmer) inR2(n int) bool { return len(s.b)-n >= s.r2 }
+
+func (s *stemmer) replace(n int, with string) {
+	s.b = append(s.b[:len(s.b)-n], with...)
+}
+
+// containsVowel reports whether b[:end] contains a vowel.
+func (s *stemmer) containsVowel(end int) bool {
+	if end <= 0 {
+		return false
+	}
+	for _, c := range s.b[:end] {
+		if isVowel(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsShortSyllable reports whether b[:end] ends in a short syllable: a
+// non-vowel, a vowel and a non-vowel other than w, x or Y, or a vowel at the
+// start of the word followed by a non-vowel.
+func (s *stemmer) endsShortSyllable(end int) bool {
+	b := s.b[:end]
+	switch {
+	case len(b) >= 3:
+		c := b[len(b)-1]
+		return !isVowel(b[len(b)-3]) && isVowel(b[len(b)-2]) &&
+			!isVowel(c) && c != 'w' && c != 'x' && c != 'Y'
+	case len(b) == 2:
+		return isVowel(b[0]) && !isVowel(b[1])
+	}
+	return false
+}
+
+// isShort reports whether the word ends in a short syllable and R1 is empty.
+func (s *stemmer) isShort() bool {
+	return s.r1 >= len(s.b) && s.endsShortSyllable(len(s.b))
+}
+
+func (s *stemmer) step0() {
+	if suffix := s.longestSuffix("'", "'s", "'s'"); suffix != "" {
+		s.replace(len(suffix), "")
+	}
+}
+
+func (s *stemmer) step1a() {
+	switch suffix := s.longestSuffix("sses", "ied", "ies", "us", "ss", "s"); suffix {
+	case "sses":
+		s.replace(4, "ss")
+	case "ied", "ies":
+		if len(s.b) > 4 {
+			s.replace(3, "i")
+		} else {
+			s.replace(3, "ie")
+		}
+	case "s":
+		if s.containsVowel(len(s.b) - 2) {
+			s.replace(1, "")
+		}
+	}
+}
+
+func (s *stemmer) step1b() {
+	suffix := s.longestSuffix("eed", "eedly", "ed", "edly", "ing", "ingly")
+	switch suffix {
+	case "":
+		return
+	case "eed", "eedly":
+		if s.inR1(len(suffix)) {
+			s.replace(len(suffix), "ee")
+		}
+		return
+	}
+	if !s.containsVowel(len(s.b) - len(suffix)) {
+		return
+	}
+	s.replace(len(suffix), "")
+	switch {
+	case s.hasSuffix("at"), s.hasSuffix("bl"), s.hasSuffix("iz"):
+		s.b = append(s.b, 'e')
+	case s.endsDouble():
+		s.b = s.b[:len(s.b)-1]
+	case s.isShort():
+		s.b = append(s.b, 'e')
+	}
+}
+
+func (s *stemmer) endsDouble() bool {
+	n := len(s.b)
+	if n < 2 || s.b[n-1] != s.b[n-2] {
+		return false
+	}
+	switch s.b[n-1] {
+	case 'b', 'd', 'f', 'g', 'm', 'n', 'p', 'r', 't':
+		return true
+	}
+	return false
+}
+
+func (s *stemmer) step1c() {
+	n := len(s.b)
+	if n > 2 && (s.b[n-1] == 'y' || s.b[n-1] == 'Y') && !isVowel(s.b[n-2]) {
+		s.b[n-1] = 'i'
+	}
+}
+
+var step2Suffixes = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able",
+	"entli": "ent", "izer": "ize", "ization": "ize", "ational": "ate",
+	"ation": "ate", "ator": "ate", "alism": "al", "aliti": "al",
+	"alli": "al", "fulness": "ful", "ousli": "ous", "ousness": "ous",
+	"iveness": "ive", "iviti": "ive", "biliti": "ble", "bli": "ble",
+	"fulli": "ful", "lessli": "less", "ogi": "og", "li": "",
+}
+
+func (s *stemmer) step2() {
+	suffix := s.longestMapped(step2Suffixes)
+	if suffix == "" || !s.inR1(len(suffix)) {
+		return
+	}
+	preceding := len(s.b) - len(suffix) - 1
+	switch suffix {
+	case "ogi":
+		if preceding < 0 || s.b[preceding] != 'l' {
+			return
+		}
+	case "li":
+		if preceding < 0 || !strings.ContainsRune("cdeghkmnrt", rune(s.b[preceding])) {
+			return
+		}
+	}
+	s.replace(len(suffix), step2Suffixes[suffix])
+}
+
+var step3Suffixes = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic",
+	"iciti": "ic", "ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+func (s *stemmer) step3() {
+	suffix := s.longestMapped(step3Suffixes)
+	if suffix == "" || !s.inR1(len(suffix)) {
+		return
+	}
+	if suffix == "ative" && !s.inR2(len(suffix)) {
+		return
+	}
+	s.replace(len(suffix), step3Suffixes[suffix])
+}
+
+func (s *stemmer) step4() {
+	suffix := s.longestSuffix("al", "ance", "ence", "er", "ic", "able",
+		"ible", "ant", "ement", "ment", "ent", "ism", "ate", "iti", "ous",
+		"ive", "ize", "ion")
+	if suffix == "" || !s.inR2(len(suffix)) {
+		return
+	}
+	if suffix == "ion" {
+		preceding := len(s.b) - 4
+		if preceding < 0 || (s.b[preceding] != 's' && s.b[preceding] != 't') {
+			return
+		}
+	}
+	s.replace(len(suffix), "")
+}
+
+func (s *stemmer) step5() {
+	n := len(s.b)
+	switch {
+	case s.hasSuffix("e"):
+		if s.inR2(1) || (s.inR1(1) && !s.endsShortSyllable(n-1)) {
+			s.replace(1, "")
+		}
+	case s.hasSuffix("l"):
+		if s.inR2(1) && n >= 2 && s.b[n-2] == 'l' {
+			s.replace(1, "")
+		}
+	}
+}
+
+// longestMapped returns the longest key of suffixes that ends the word.
+func (s *stemmer) longestMapped(suffixes map[string]string) string {
+	longest := ""
+	for suffix := range suffixes {
+		if len(suffix) > len(longest) && s.hasSuffix(suffix) {
+			longest = suffix
+		}
+	}
+	return longest
+}
@@ -2,24 +2,41 @@ package analysis
 
 import (
 	"fmt"
+	"io/fs"
 	"sync"
 )
 
 // Registry manages analyzer instances by name.
 // Analyzer instances are reused via sync.Pool to avoid allocations.
 type Registry struct {
-	analyzers map[string]Analyzer
-	mu        sync.RWMutex
+	analyzers   map[string]Analyzer
+	charFilters map[string]CharFilter
+	tokenizers  map[string]Tokenizer
+	filters     map[string]TokenFilter
+	resources   fs.FS
+	mu          sync.RWMutex
 }
 
 // NewRegistry creates a Registry with the built-in analyzers registered.
 func NewRegistry() *Registry {
 	r := &Registry{
-		analyzers: make(map[string]Analyzer),
+		analyzers:   make(map[string]Analyzer),
+		charFilters: make(map[string]CharFilter),
+		tokenizers:  make(map[string]Tokenizer),
+		filters:     make(map[string]TokenFilter),
 	}
 	r.analyzers["standard"] = NewStandardAnalyzer()
 	r.analyzers["whitespace"] = NewWhitespaceAnalyzer()
 	r.analyzers["keyword"] = NewKeywordAnalyzer()
+	r.analyzers["cjk"] = NewCJKAnalyzer()
+	return r
+}
+
+// NewRegistryWithResources creates a Registry whose configured components
+// read files, such as synonym lists, from resources.
+func NewRegistryWithResources(resources fs.FS) *Registry {
+	r := NewRegistry()
+	r.resources = resources
 	return r
 }
 
@@ -45,6 +62,83 @@ func (r *Registry) Register(name string, a Analyzer) error {
 	return nil
 }
 
+// Define builds the analyzer a definition describes and registers it. It
+// may name char filters, tokenizers and token filters added with
+// DefineCharFilter, DefineTokenizer and DefineTokenFilter.
+func (r *Registry) Define(name string, def AnalyzerDef) error {
+	p, err := r.NewPipeline(def)
+	if err != nil {
+		return err
+	}
+	return r.Register(name, p)
+}
+
+// NewPipeline builds the analyzer a definition describes without
+// registering it. Like Define, it may name components added with
+// DefineCharFilter, DefineTokenizer and DefineTokenFilter.
+func (r *Registry) NewPipeline(def AnalyzerDef) (*Pipeline, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return newPipeline(def, r.charFilters, r.tokenizers, r.filters)
+}
+
+// DefineCharFilter builds a configured char filter and makes it available
+// to later Define calls under name.
+func (r *Registry) DefineCharFilter(name string, def CharFilterDef) error {
+	f, err := NewCharFilter(def)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, builtin := builtinCharFilters[name]; builtin {
+		return fmt.Errorf("char filter already registered: %q", name)
+	}
+	if _, exists := r.charFilters[name]; exists {
+		return fmt.Errorf("char filter already registered: %q", name)
+	}
+	r.charFilters[name] = f
+	return nil
+}
+
+// DefineTokenizer builds a configured tokenizer and makes it available to
+// later Define calls under name.
+func (r *Registry) DefineTokenizer(name string, def TokenizerDef) error {
+	t, err := NewTokenizer(def)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, builtin := builtinTokenizers[name]; builtin {
+		return fmt.Errorf("tokenizer already registered: %q", name)
+	}
+	if _, exists := r.tokenizers[name]; exists {
+		return fmt.Errorf("tokenizer already registered: %q", name)
+	}
+	r.tokenizers[name] = t
+	return nil
+}
+
+// DefineTokenFilter builds a configured token filter and makes it available
+// to later Define calls under name.
+func (r *Registry) DefineTokenFilter(name string, def TokenFilterDef) error {
+	f, err := newTokenFilter(def, r.resources)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, builtin := tokenFilters[name]; builtin {
+		return fmt.Errorf("token filter already registered: %q", name)
+	}
+	if _, exists := r.filters[name]; exists {
+		return fmt.Errorf("token filter already registered: %q", name)
+	}
+	r.filters[name] = f
+	return nil
+}
+
 // Names returns the names of all registered analyzers.
 func (r *Registry) Names() []string {
 	r.mu.RLock()
@@ -1,7 +1,6 @@
 package analysis
 
 import (
-	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -16,6 +15,15 @@ func NewStandardAnalyzer() *StandardAnalyzer {
 
 // Analyze tokenizes the input using Unicode word boundary detection and lowercasing.
 func (a *StandardAnalyzer) Analyze(_ string, text string) []Token {
+	return LowercaseFilter{}.Filter(StandardTokenizer{}.Tokenize(text))
+}
+
+// StandardTokenizer splits text into runs of letters, digits and
+// underscores, preserving case.
+type StandardTokenizer struct{}
+
+// Tokenize returns the word runs of text.
+func (StandardTokenizer) Tokenize(text string) []Token {
 	var tokens []Token
 	pos := 0
 	i := 0
@@ -38,16 +46,13 @@ func (a *StandardAnalyzer) Analyze(_ string, text string) []Token {
 			i += size
 		}
 
-		term := strings.ToLower(text[start:i])
-		if term != "" {
-			tokens = append(tokens, Token{
-				Term:      term,
-				Position:  pos,
-				StartByte: start,
-				EndByte:   i,
-			})
-			pos++
-		}
+		tokens = append(tokens, Token{
+			Term:      text[start:i],
+			Position:  pos,
+			StartByte: start,
+			EndByte:   i,
+		})
+		pos++
 	}
 
 	return tokens
@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// stopwordLists are the built-in stop word lists by language.
+var stopwordLists = map[string][]string{
+	"english": {
+		"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if",
+		"in", "into", "is", "it", "no", "not", "of", "on", "or", "such",
+		"that", "the", "their", "then", "there", "these", "they", "this",
+		"to", "was", "will", "with",
+	},
+	"french": {
+		"au", "aux", "avec", "ce", "ces", "dans", "de", "des", "du", "elle",
+		"en", "et", "eux", "il", "je", "la", "le", "les", "leur", "lui", "ma",
+		"mais", "me", "mes", "moi", "mon", "ne", "nos", "notre", "nous", "on",
+		"ou", "par", "pas", "pour", "qu", "que", "qui", "sa", "se", "ses",
+		"son", "sur", "ta", "te", "tes", "toi", "ton", "tu", "un", "une",
+		"vos", "votre", "vous",
+	},
+	"german": {
+		"aber", "als", "am", "an", "auch", "auf", "aus", "bei", "bin", "bis",
+		"das", "dass", "dem", "den", "der", "des", "die", "doch", "du", "ein",
+		"eine", "einem", "einen", "einer", "eines", "er", "es", "für", "hat",
+		"ich", "ihr", "im", "in", "ist", "mit", "nach", "nicht", "noch", "nur",
+		"oder", "sich", "sie", "sind", "so", "um", "und", "uns", "von", "vor",
+		"war", "wie", "wir", "zu", "zum", "zur",
+	},
+	"spanish": {
+		"a", "al", "como", "con", "de", "del", "el", "en", "es", "esta",
+		"este", "ha", "la", "las", "le", "lo", "los", "mas", "me", "mi", "muy",
+		"no", "nos", "o", "para", "pero", "por", "que", "se", "si", "sin",
+		"sobre", "su", "sus", "también", "te", "tu", "un", "una", "uno",
+		"y", "ya", "yo",
+	},
+}
+
+// StopwordLanguages returns the languages with a built-in stop word list.
+func StopwordLanguages() []string {
+	langs := make([]string, 0, len(stopwordLists))
+	for lang := range stopwordLists {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// StopFilter removes stop words from a token stream. Remaining tokens keep
+// their positions, so phrase queries do not match across a removed word.
+type StopFilter struct {
+	words      map[string]bool
+	ignoreCase bool
+}
+
+// NewStopFilter creates a StopFilter for the given words. With ignoreCase,
+// words and terms are compared lowercased.
+func NewStopFilter(words []string, ignoreCase bool) *StopFilter {
+	f := &StopFilter{words: make(map[string]bool, len(words)), ignoreCase: ignoreCase}
+	for _, w := range words {
+		if ignoreCase {
+			w = strings.ToLower(w)
+		}
+		f.words[w] = true
+	}
+	return f
+}
+
+// Filter drops stop words in place.
+func (f *StopFilter) Filter(tokens []Token) []Token {
+	out := tokens[:0]
+	for _, tok := range tokens {
+		term := tok.Term
+		if f.ignoreCase {
+			term = strings.ToLower(term)
+		}
+		if !f.words[term] {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// newStopFilterFromDef builds a stop filter from the built-in list of
+// def.Language plus def.Stopwords. Without either, the English list is used.
+func newStopFilterFromDef(def TokenFilterDef) (TokenFilter, error) {
+	words := append([]string(nil), def.Stopwords...)
+	lang := def.Language
+	if lang == "" && len(words) == 0 {
+		lang = "english"
+	}
+	if lang != "" {
+		list, ok := stopwordLists[lang]
+		if !ok {
+			return nil, fmt.Errorf("%w: no stop words for language %q", ErrInvalidAnalyzer, lang)
+		}
+		words = append(words, list...)
+	}
+	return NewStopFilter(words, def.IgnoreCase), nil
+}
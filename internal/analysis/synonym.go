@@ -0,0 +1,258 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// Synonym limits.
+const (
+	MaxSynonymRules = 10_000
+	MaxSynonymWords = 8
+)
+
+// SynonymGraphFilter replaces word sequences matching a synonym rule with
+// all of the rule's alternatives. The alternatives form a token graph whose
+// nodes are positions: each token runs from its Position to Position plus
+// PositionLength, and the words of each multi-word alternative get nodes of
+// their own, so later tokens move back to make room. GraphPaths lists the
+// phrases such a graph stands for and FlattenGraph turns it back into
+// ordinary positions. Synonyms carry the offsets of the matched text.
+type SynonymGraphFilter struct {
+	rules      map[string][]synonymRule
+	count      int
+	ignoreCase bool
+}
+
+// synonymRule maps a word sequence to its alternatives. An alternative
+// equal to input keeps the original tokens.
+type synonymRule struct {
+	input  []string
+	output [][]string
+}
+
+// ParseSynonyms parses synonym rules, one per line. Blank lines and lines
+// starting with # are ignored.
+//
+//	ny, new york, big apple      all three are interchangeable
+//	colour, color => color       the left side is replaced by the right
+func ParseSynonyms(lines []string, ignoreCase bool) (*SynonymGraphFilter, error) {
+	f := &SynonymGraphFilter{rules: make(map[string][]synonymRule), ignoreCase: ignoreCase}
+	if err := f.parse(lines, "synonym rule"); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parse adds rules from lines; source names a line in errors.
+func (f *SynonymGraphFilter) parse(lines []string, source string) error {
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if f.count++; f.count > MaxSynonymRules {
+			return fmt.Errorf("%w: more than %d synonym rules", ErrInvalidAnalyzer, MaxSynonymRules)
+		}
+		inputs, outputs := line, line
+		if lhs, rhs, ok := strings.Cut(line, "=>"); ok {
+			inputs, outputs = lhs, rhs
+		}
+		in, err := f.parsePhrases(inputs)
+		if err != nil {
+			return fmt.Errorf("%w: %s %d: %v", ErrInvalidAnalyzer, source, i+1, err)
+		}
+		out, err := f.parsePhrases(outputs)
+		if err != nil {
+			return fmt.Errorf("%w: %s %d: %v", ErrInvalidAnalyzer, source, i+1, err)
+		}
+		for _, words := range in {
+			f.add(words, out)
+		}
+	}
+	return nil
+}
+
+func (f *SynonymGraphFilter) parsePhrases(list string) ([][]string, error) {
+	var phrases [][]string
+	for _, phrase := range strings.Split(list, ",") {
+		if f.ignoreCase {
+			phrase = strings.ToLower(phrase)
+		}
+		words := strings.Fields(phrase)
+		if len(words) == 0 {
+			return nil, errors.New("empty synonym")
+		}
+		if len(words) > MaxSynonymWords {
+			return nil, fmt.Errorf("synonym %q has more than %d words", strings.TrimSpace(phrase), MaxSynonymWords)
+		}
+		phrases = append(phrases, words)
+	}
+	return phrases, nil
+}
+
+// add merges a rule into the map, so rules sharing an input combine their
+// alternatives.
+func (f *SynonymGraphFilter) add(input []string, output [][]string) {
+	rules := f.rules[input[0]]
+	for i := range rules {
+		if equalWords(rules[i].input, input) {
+			for _, o := range output {
+				if !containsWords(rules[i].output, o) {
+					rules[i].output = append(rules[i].output, o)
+				}
+			}
+			return
+		}
+	}
+	f.rules[input[0]] = append(rules, synonymRule{input: input, output: append([][]string(nil), output...)})
+}
+
+func equalWords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsWords(phrases [][]string, words []string) bool {
+	for _, p := range phrases {
+		if equalWords(p, words) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the longest rule whose input starts at tokens[0].
+func (f *SynonymGraphFilter) match(tokens []Token) *synonymRule {
+	var best *synonymRule
+	rules := f.rules[f.key(tokens[0].Term)]
+	for i := range rules {
+		r := &rules[i]
+		if len(r.input) > len(tokens) || (best != nil && len(r.input) <= len(best.input)) {
+			continue
+		}
+		matched := true
+		for j, word := range r.input {
+			if f.key(tokens[j].Term) != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			best = r
+		}
+	}
+	return best
+}
+
+func (f *SynonymGraphFilter) key(term string) string {
+	if f.ignoreCase {
+		return strings.ToLower(term)
+	}
+	return term
+}
+
+// Filter replaces rule matches with their alternatives, longest match
+// first.
+func (f *SynonymGraphFilter) Filter(tokens []Token) []Token {
+	if len(f.rules) == 0 {
+		return tokens
+	}
+	out := make([]Token, 0, len(tokens))
+	shift := 0
+	for i := 0; i < len(tokens); {
+		r := f.match(tokens[i:])
+		if r == nil {
+			tok := tokens[i]
+			tok.Position += shift
+			out = append(out, tok)
+			i++
+			continue
+		}
+
+		matched := tokens[i : i+len(r.input)]
+		first, last := matched[0], matched[len(matched)-1]
+		start := first.Position + shift
+		span := last.Position - first.Position + 1
+
+		// Every alternative runs from node start to node end through nodes
+		// of its own, so words of different alternatives never join into a
+		// path.
+		node := start
+		for _, words := range r.output {
+			node += len(words) - 1
+		}
+		end := node + 1
+		node = start
+
+		var graph []Token
+		for _, words := range r.output {
+			original := equalWords(words, r.input)
+			for j, word := range words {
+				tok := Token{Term: word, StartByte: first.StartByte, EndByte: last.EndByte}
+				if original {
+					tok = matched[j]
+				}
+				tok.Position = start
+				if j > 0 {
+					tok.Position = node
+				}
+				if j < len(words)-1 {
+					node++
+					tok.PositionLength = node - tok.Position
+				} else {
+					tok.PositionLength = end - tok.Position
+				}
+				if tok.PositionLength == 1 {
+					tok.PositionLength = 0
+				}
+				graph = append(graph, tok)
+			}
+		}
+		sort.SliceStable(graph, func(a, b int) bool { return graph[a].Position < graph[b].Position })
+		out = append(out, graph...)
+
+		shift += end - start - span
+		i += len(r.input)
+	}
+	return out
+}
+
+// newSynonymFilterFromDef builds a synonym filter from def.Synonyms and the
+// file def.SynonymsPath in resources. A missing file, or nil resources,
+// contributes no rules, so an index can be created before its synonyms
+// file exists.
+func newSynonymFilterFromDef(def TokenFilterDef, resources fs.FS) (TokenFilter, error) {
+	f, err := ParseSynonyms(def.Synonyms, def.IgnoreCase)
+	if err != nil {
+		return nil, err
+	}
+	if def.SynonymsPath != "" {
+		if !fs.ValidPath(def.SynonymsPath) {
+			return nil, fmt.Errorf("%w: invalid synonyms_path %q", ErrInvalidAnalyzer, def.SynonymsPath)
+		}
+		if resources != nil {
+			data, err := fs.ReadFile(resources, def.SynonymsPath)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+			case err != nil:
+				return nil, fmt.Errorf("read synonyms %q: %w", def.SynonymsPath, err)
+			default:
+				if err := f.parse(strings.Split(string(data), "\n"), def.SynonymsPath+" line"); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return f, nil
+}
@@ -12,6 +12,14 @@ func NewWhitespaceAnalyzer() *WhitespaceAnalyzer {
 
 // Analyze splits the input on whitespace, preserving case.
 func (a *WhitespaceAnalyzer) Analyze(_ string, text string) []Token {
+	return WhitespaceTokenizer{}.Tokenize(text)
+}
+
+// WhitespaceTokenizer splits text on whitespace.
+type WhitespaceTokenizer struct{}
+
+// Tokenize returns the whitespace-separated fields of text.
+func (WhitespaceTokenizer) Tokenize(text string) []Token {
 	fields := strings.Fields(text)
 	tokens := make([]Token, 0, len(fields))
 
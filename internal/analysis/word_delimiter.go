@@ -0,0 +1,235 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// WordDelimiterOptions configure a WordDelimiterFilter.
+type WordDelimiterOptions struct {
+	// SplitOnCaseChange splits "getUserName" into get, User, Name and
+	// "XMLParser" into XML, Parser.
+	SplitOnCaseChange bool
+	// SplitOnNumerics splits "X1000" into X, 1000.
+	SplitOnNumerics bool
+	// StemEnglishPossessive removes a trailing 's before splitting.
+	StemEnglishPossessive bool
+
+	// CatenateWords adds each run of adjacent word parts joined together,
+	// CatenateNumbers each run of adjacent number parts, and CatenateAll
+	// all parts, spanning the positions of the parts they join.
+	CatenateWords   bool
+	CatenateNumbers bool
+	CatenateAll     bool
+	// PreserveOriginal keeps the unsplit token, spanning all its parts.
+	PreserveOriginal bool
+}
+
+// DefaultWordDelimiterOptions returns the options of the built-in
+// word_delimiter_graph filter: split on delimiters, case changes and
+// letter/digit transitions, and remove possessives.
+func DefaultWordDelimiterOptions() WordDelimiterOptions {
+	return WordDelimiterOptions{SplitOnCaseChange: true, SplitOnNumerics: true, StemEnglishPossessive: true}
+}
+
+// WordDelimiterFilter splits tokens such as code identifiers and product
+// names into parts: any character other than a letter or digit delimits
+// parts, as do case changes and letter/digit transitions. Parts take
+// consecutive positions and later tokens move back to make room, so
+// "wi-fi router" matches the phrase "wi fi router". Catenated and original
+// forms span their parts through PositionLength, forming a token graph as
+// SynonymGraphFilter does. Parts keep their own offsets when the token's
+// offsets cover exactly its text.
+type WordDelimiterFilter struct {
+	opts WordDelimiterOptions
+}
+
+// NewWordDelimiterFilter creates a word delimiter filter.
+func NewWordDelimiterFilter(opts WordDelimiterOptions) *WordDelimiterFilter {
+	return &WordDelimiterFilter{opts: opts}
+}
+
+func newWordDelimiterFilterFromDef(def TokenFilterDef) *WordDelimiterFilter {
+	opts := DefaultWordDelimiterOptions()
+	if def.SplitOnCaseChange != nil {
+		opts.SplitOnCaseChange = *def.SplitOnCaseChange
+	}
+	if def.SplitOnNumerics != nil {
+		opts.SplitOnNumerics = *def.SplitOnNumerics
+	}
+	if def.StemEnglishPossessive != nil {
+		opts.StemEnglishPossessive = *def.StemEnglishPossessive
+	}
+	opts.CatenateWords = def.CatenateWords
+	opts.CatenateNumbers = def.CatenateNumbers
+	opts.CatenateAll = def.CatenateAll
+	opts.PreserveOriginal = def.PreserveOriginal
+	return NewWordDelimiterFilter(opts)
+}
+
+// wordPart is a part of a term, by byte range.
+type wordPart struct {
+	start, end int
+	number     bool
+}
+
+// Character classes for splitting.
+const (
+	classDelim = iota
+	classLower
+	classUpper
+	classLetter // letters without case
+	classDigit
+)
+
+func wordClass(r rune) int {
+	switch {
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r), unicode.IsTitle(r):
+		return classUpper
+	case unicode.IsLetter(r):
+		return classLetter
+	case unicode.IsDigit(r):
+		return classDigit
+	}
+	return classDelim
+}
+
+// split returns the parts of term.
+func (f *WordDelimiterFilter) split(term string) []wordPart {
+	if f.opts.StemEnglishPossessive {
+		for _, suffix := range []string{"'s", "'S", "’s", "’S"} {
+			if strings.HasSuffix(term, suffix) {
+				term = term[:len(term)-len(suffix)]
+				break
+			}
+		}
+	}
+
+	var parts []wordPart
+	start := -1
+	// prevStart is the byte offset of the previous rune.
+	prev, prevStart := classDelim, 0
+	number := true
+	flush := func(end int) {
+		if start >= 0 && end > start {
+			parts = append(parts, wordPart{start: start, end: end, number: number})
+		}
+		start, number = -1, true
+	}
+	for i, r := range term {
+		class := wordClass(r)
+		switch {
+		case class == classDelim:
+			flush(i)
+		case start < 0:
+			start = i
+		case f.opts.SplitOnNumerics && (class == classDigit) != (prev == classDigit):
+			flush(i)
+			start = i
+		case f.opts.SplitOnCaseChange && prev == classLower && class == classUpper:
+			flush(i)
+			start = i
+		case f.opts.SplitOnCaseChange && prev == classUpper && class == classLower && prevStart > start:
+			// The last of a run of capitals starts the next word.
+			flush(prevStart)
+			start = prevStart
+		}
+		if class != classDelim && class != classDigit {
+			number = false
+		}
+		prev, prevStart = class, i
+	}
+	flush(len(term))
+	return parts
+}
+
+// Filter splits every token into its parts.
+func (f *WordDelimiterFilter) Filter(tokens []Token) []Token {
+	out := make([]Token, 0, len(tokens))
+	shift := 0
+	for _, tok := range tokens {
+		parts := f.split(tok.Term)
+		start := tok.Position + shift
+		if len(parts) == 1 && parts[0].start == 0 && parts[0].end == len(tok.Term) {
+			tok.Position = start
+			out = append(out, tok)
+			continue
+		}
+		if len(parts) == 0 {
+			if f.opts.PreserveOriginal {
+				tok.Position = start
+				out = append(out, tok)
+			}
+			continue
+		}
+
+		exact := tok.EndByte-tok.StartByte == len(tok.Term)
+		span := func(term string, first, last int) Token {
+			t := Token{Term: term, Position: start + first, StartByte: tok.StartByte, EndByte: tok.EndByte}
+			if exact {
+				t.StartByte, t.EndByte = tok.StartByte+parts[first].start, tok.StartByte+parts[last].end
+			}
+			if n := last - first + 1; n > 1 {
+				t.PositionLength = n
+			}
+			return t
+		}
+
+		var graph []Token
+		if f.opts.PreserveOriginal {
+			original := tok
+			original.Position = start
+			if len(parts) > 1 {
+				original.PositionLength = len(parts)
+			}
+			graph = append(graph, original)
+		}
+		catenate := func(first, last int) {
+			if last == first {
+				return
+			}
+			var b strings.Builder
+			for _, p := range parts[first : last+1] {
+				b.WriteString(tok.Term[p.start:p.end])
+			}
+			graph = appendUniqueToken(graph, span(b.String(), first, last))
+		}
+		if f.opts.CatenateAll {
+			catenate(0, len(parts)-1)
+		}
+		if f.opts.CatenateWords || f.opts.CatenateNumbers {
+			for i := 0; i < len(parts); {
+				j := i
+				for j+1 < len(parts) && parts[j+1].number == parts[i].number {
+					j++
+				}
+				if parts[i].number && f.opts.CatenateNumbers || !parts[i].number && f.opts.CatenateWords {
+					catenate(i, j)
+				}
+				i = j + 1
+			}
+		}
+		for i, p := range parts {
+			graph = appendUniqueToken(graph, span(tok.Term[p.start:p.end], i, i))
+		}
+
+		sort.SliceStable(graph, func(a, b int) bool { return graph[a].Position < graph[b].Position })
+		out = append(out, graph...)
+		shift += len(parts) - 1
+	}
+	return out
+}
+
+// appendUniqueToken appends tok unless tokens holds one with the same term
+// and span.
+func appendUniqueToken(tokens []Token, tok Token) []Token {
+	for _, t := range tokens {
+		if t.Term == tok.Term && t.Position == tok.Position && t.PositionLength == tok.PositionLength {
+			return tokens
+		}
+	}
+	return append(tokens, tok)
+}
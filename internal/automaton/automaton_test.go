@@ -1,6 +1,9 @@
 package automaton
 
 import (
+	"errors"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -270,3 +273,171 @@ func TestLevenshteinAutomaton_CanMatch(t *testing.T) {
 		t.Error("dead state should not CanMatch")
 	}
 }
+
+// --- Fuzzy Prefix Automaton Tests ---
+
+func TestFuzzyPrefixAutomaton(t *testing.T) {
+	a, err := NewFuzzyPrefixAutomaton([]byte("sear"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"sear", true},
+		{"search", true},
+		{"searching", true},
+		{"sea", true},     // deletion
+		{"saerch", false}, // transposition is two edits
+		{"sxar", true},    // substitution
+		{"sxarch", true},
+		{"seaxr", true}, // insertion
+		{"se", false},
+		{"xyz", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := runAutomaton(a, tt.input); got != tt.want {
+			t.Errorf("FuzzyPrefixAutomaton(sear, 1) on %q = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyPrefixAutomaton_Distance0(t *testing.T) {
+	a, err := NewFuzzyPrefixAutomaton([]byte("ab"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"ab", "abc", "abzzz"} {
+		if !runAutomaton(a, s) {
+			t.Errorf("distance 0 should accept %q", s)
+		}
+	}
+	for _, s := range []string{"a", "ba", "xab"} {
+		if runAutomaton(a, s) {
+			t.Errorf("distance 0 should reject %q", s)
+		}
+	}
+}
+
+func TestFuzzyPrefixAutomaton_MinTermLength(t *testing.T) {
+	if _, err := NewFuzzyPrefixAutomaton([]byte("ab"), 1); err != ErrTermTooShort {
+		t.Errorf("expected ErrTermTooShort, got %v", err)
+	}
+}
+
+func TestLevenshteinAutomaton_MiddleEdits(t *testing.T) {
+	a, err := NewLevenshteinAutomaton([]byte("search"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"serch", "seearch", "sxarch", "earch", "searc"} {
+		if !runAutomaton(a, s) {
+			t.Errorf("Levenshtein(search, 1) should accept %q", s)
+		}
+	}
+	for _, s := range []string{"saerch", "srch", "searchxx"} {
+		if runAutomaton(a, s) {
+			t.Errorf("Levenshtein(search, 1) should reject %q", s)
+		}
+	}
+}
+
+// TestLevenshteinAutomaton_MatchesEditDistance checks the automaton against
+// the edit distance of every string up to length 5 over a small alphabet.
+func TestLevenshteinAutomaton_MatchesEditDistance(t *testing.T) {
+	distance := func(a, b string) int {
+		prev := make([]int, len(b)+1)
+		for j := range prev {
+			prev[j] = j
+		}
+		for i := 1; i <= len(a); i++ {
+			cur := make([]int, len(b)+1)
+			cur[0] = i
+			for j := 1; j <= len(b); j++ {
+				cost := 1
+				if a[i-1] == b[j-1] {
+					cost = 0
+				}
+				cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			}
+			prev = cur
+		}
+		return prev[len(b)]
+	}
+
+	var inputs []string
+	var gen func(prefix string)
+	gen = func(prefix string) {
+		inputs = append(inputs, prefix)
+		if len(prefix) < 5 {
+			for _, c := range "abx" {
+				gen(prefix + string(c))
+			}
+		}
+	}
+	gen("")
+
+	for _, target := range []string{"aba", "abba", "bab"} {
+		for maxDist := 0; maxDist <= MaxEditDistance; maxDist++ {
+			a, err := NewLevenshteinAutomaton([]byte(target), maxDist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, in := range inputs {
+				want := distance(target, in) <= maxDist
+				if got := runAutomaton(a, in); got != want {
+					t.Errorf("Levenshtein(%q, %d) on %q = %v, want %v", target, maxDist, in, got, want)
+				}
+			}
+		}
+	}
+}
+
+// --- Regex Automaton Tests ---
+
+func TestRegexAutomaton_MatchesRegexp(t *testing.T) {
+	patterns := []string{
+		"colou?r", "se[a-c]rch", "a.c", "(foo|ba[rz])+", "x*y*", "[^a-z]+", "ab{2,3}c",
+		"(?i)Hello", "caf[éè]", "[α-ω]{2}", "\\d+-\\w+", "(a|)b", "",
+	}
+	inputs := []string{
+		"", "color", "colour", "colouur", "search", "serch", "sedrch", "abc", "a\nc", "aXc",
+		"foo", "foobar", "baz", "barbazfoo", "fo", "xxyy", "yx", "123", "ABC", "a1",
+		"abbc", "abbbc", "abc", "abbbbc", "hello", "HeLLo", "café", "cafè", "cafe",
+		"αβ", "αω", "αa", "12-ab", "-ab", "b", "ab", "aab", "日本",
+	}
+	for _, p := range patterns {
+		a, err := NewRegexAutomaton([]byte(p))
+		if err != nil {
+			t.Fatalf("NewRegexAutomaton(%q): %v", p, err)
+		}
+		re := regexp.MustCompile("^(?:" + p + ")$")
+		for _, in := range inputs {
+			if got, want := runAutomaton(a, in), re.MatchString(in); got != want {
+				t.Errorf("regex %q on %q: got %v, want %v", p, in, got, want)
+			}
+		}
+	}
+}
+
+func TestRegexAutomaton_Rejects(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    error
+	}{
+		{"[a-", ErrInvalidRegex},
+		{"^abc", ErrInvalidRegex},
+		{"abc$", ErrInvalidRegex},
+		{"\\bword", ErrInvalidRegex},
+		{strings.Repeat("a", MaxRegexPatternLength+1), ErrRegexPatternTooLong},
+		{"\\pL{20}", ErrNFAStateLimitExceeded},
+	}
+	for _, tt := range tests {
+		if _, err := NewRegexAutomaton([]byte(tt.pattern)); !errors.Is(err, tt.want) {
+			t.Errorf("NewRegexAutomaton(%.20q): expected %v, got %v", tt.pattern, tt.want, err)
+		}
+	}
+}
@@ -14,14 +14,21 @@ var (
 )
 
 // LevenshteinAutomaton accepts strings within edit distance ≤ maxDist of the target.
-// Uses parametric state representation: (position, edit_budget).
+// Edits are insertions, deletions and substitutions of single bytes.
+//
+// Construction builds the full DFA. Each state is a Levenshtein edit
+// vector: for every target prefix, the fewest edits that turn the input
+// read so far into that prefix, capped at maxDist+1. Bytes that do not occur
+// in the target all behave alike and share one transition column.
 //
 // Supports edit distance ≤ 2 only. Higher distances produce exponential state counts.
 type LevenshteinAutomaton struct {
-	target  []byte
-	maxDist int
-	// State encoding: state = position*(maxDist+1) + editsUsed + 1
-	// DeadState (0) is reserved.
+	// classes maps a byte to its transition column; column 0 is for bytes
+	// absent from the target.
+	classes [256]uint8
+	// transitions[state][class] = next state
+	transitions [][]State
+	accepting   []bool
 }
 
 // NewLevenshteinAutomaton creates an automaton accepting strings within
@@ -36,115 +43,145 @@ func NewLevenshteinAutomaton(target []byte, maxDist int) (*LevenshteinAutomaton,
 	if maxDist > 0 && len(target) < MinFuzzyTermLength {
 		return nil, ErrTermTooShort
 	}
-	return &LevenshteinAutomaton{
-		target:  target,
-		maxDist: maxDist,
-	}, nil
-}
-
-func (a *LevenshteinAutomaton) Start() State {
-	// Start state: position=0, editsUsed=0
-	return a.encodeState(0, 0)
-}
 
-func (a *LevenshteinAutomaton) Step(state State, b byte) State {
-	if state == DeadState {
-		return DeadState
+	a := &LevenshteinAutomaton{}
+	// One representative byte per column: column 0 stands for any byte
+	// absent from the target, so it never matches.
+	reps := []int{-1}
+	for _, b := range target {
+		if a.classes[b] == 0 {
+			a.classes[b] = uint8(len(reps))
+			reps = append(reps, int(b))
+		}
 	}
 
-	pos, editsUsed := a.decodeState(state)
+	inf := byte(maxDist + 1)
+	start := make([]byte, len(target)+1)
+	for i := range start {
+		start[i] = byte(min(i, int(inf)))
+	}
 
-	// If we've consumed the entire target, any additional byte is an insertion.
-	if pos >= len(a.target) {
-		newEdits := editsUsed + 1
-		if newEdits > a.maxDist {
-			return DeadState
+	// State 0 is dead, state 1 is start.
+	a.transitions = [][]State{make([]State, len(reps))}
+	a.accepting = []bool{false}
+	ids := map[string]State{}
+	queue := [][]byte{}
+	add := func(vec []byte) (State, error) {
+		if id, ok := ids[string(vec)]; ok {
+			return id, nil
 		}
-		return a.encodeState(pos, newEdits)
+		id := State(len(a.transitions))
+		if int(id) >= MaxDFAStates {
+			return DeadState, ErrDFAStateLimitExceeded
+		}
+		ids[string(vec)] = id
+		a.transitions = append(a.transitions, make([]State, len(reps)))
+		a.accepting = append(a.accepting, vec[len(target)] < inf)
+		queue = append(queue, vec)
+		return id, nil
 	}
-
-	// Match: advance position, same edit budget.
-	if b == a.target[pos] {
-		return a.encodeState(pos+1, editsUsed)
+	if _, err := add(start); err != nil {
+		return nil, err
 	}
 
-	// No match: try edit operations.
-	if editsUsed >= a.maxDist {
-		return DeadState
+	for id := State(1); len(queue) > 0; id++ {
+		vec := queue[0]
+		queue = queue[1:]
+		for class, rep := range reps {
+			next := make([]byte, len(vec))
+			live := false
+			for i := range next {
+				// Insert the input byte, match or substitute it against
+				// target[i-1], or delete target[i-1].
+				v := vec[i] + 1
+				if i > 0 {
+					cost := byte(1)
+					if int(target[i-1]) == rep {
+						cost = 0
+					}
+					v = min(v, vec[i-1]+cost, next[i-1]+1)
+				}
+				next[i] = min(v, inf)
+				live = live || next[i] < inf
+			}
+			if !live {
+				continue
+			}
+			nextID, err := add(next)
+			if err != nil {
+				return nil, err
+			}
+			a.transitions[id][class] = nextID
+		}
 	}
+	return a, nil
+}
 
-	// We return the best (lowest edit cost) reachable state.
-	// Substitution: advance position, use one edit.
-	// This is the simplest single-step transition.
-	// For insertion and deletion, we need multi-step handling.
-	//
-	// In a true Levenshtein DFA, each state encodes the full edit vector.
-	// For simplicity, we use substitution as the primary mismatch transition.
-	// Insertion (extra char in input) = stay at position, use one edit.
-	// Deletion (missing char in input) is handled by checking if skipping
-	// the target char leads to a match.
-
-	// Try substitution: advance both.
-	substState := a.encodeState(pos+1, editsUsed+1)
-
-	// Try insertion: consume input byte, stay at same target position.
-	insertState := a.encodeState(pos, editsUsed+1)
-
-	// Try deletion: skip target char, don't consume input.
-	// We check if the byte matches the next target char.
-	if pos+1 < len(a.target) && b == a.target[pos+1] {
-		// Deletion of target[pos] + match at target[pos+1]
-		delMatchState := a.encodeState(pos+2, editsUsed+1)
-		// Return the state that advances furthest.
-		return a.bestState(substState, insertState, delMatchState)
-	}
+func (a *LevenshteinAutomaton) Start() State {
+	return 1
+}
 
-	return a.bestState(substState, insertState, DeadState)
+func (a *LevenshteinAutomaton) Step(state State, b byte) State {
+	if state == DeadState || int(state) >= len(a.transitions) {
+		return DeadState
+	}
+	return a.transitions[state][a.classes[b]]
 }
 
 func (a *LevenshteinAutomaton) IsAccept(state State) bool {
-	if state == DeadState {
+	if state == DeadState || int(state) >= len(a.accepting) {
 		return false
 	}
-	pos, editsUsed := a.decodeState(state)
-	// Accept if remaining target chars can be covered by remaining edit budget.
-	remaining := len(a.target) - pos
-	return remaining <= (a.maxDist - editsUsed)
+	return a.accepting[state]
 }
 
 func (a *LevenshteinAutomaton) CanMatch(state State) bool {
 	return state != DeadState
 }
 
-func (a *LevenshteinAutomaton) encodeState(pos, editsUsed int) State {
-	if editsUsed > a.maxDist {
-		return DeadState
+// FuzzyPrefixAutomaton accepts strings that begin with a prefix within edit
+// distance ≤ maxDist of the target, for type-ahead that tolerates typos.
+type FuzzyPrefixAutomaton struct {
+	lev *LevenshteinAutomaton
+}
+
+// fuzzyPrefixAccept is the state entered once a prefix of the input has
+// matched the target. It accepts every continuation.
+const fuzzyPrefixAccept = ^State(0)
+
+// NewFuzzyPrefixAutomaton creates an automaton accepting strings whose
+// prefix is within the given edit distance of the target.
+func NewFuzzyPrefixAutomaton(target []byte, maxDist int) (*FuzzyPrefixAutomaton, error) {
+	lev, err := NewLevenshteinAutomaton(target, maxDist)
+	if err != nil {
+		return nil, err
 	}
-	if pos > len(a.target)+a.maxDist {
-		return DeadState
+	return &FuzzyPrefixAutomaton{lev: lev}, nil
+}
+
+func (a *FuzzyPrefixAutomaton) Start() State {
+	return a.settle(a.lev.Start())
+}
+
+func (a *FuzzyPrefixAutomaton) Step(state State, b byte) State {
+	if state == fuzzyPrefixAccept {
+		return state
 	}
-	return State(pos*(a.maxDist+1) + editsUsed + 1)
+	return a.settle(a.lev.Step(state, b))
 }
 
-func (a *LevenshteinAutomaton) decodeState(state State) (pos, editsUsed int) {
-	v := int(state) - 1
-	editsUsed = v % (a.maxDist + 1)
-	pos = v / (a.maxDist + 1)
-	return
+func (a *FuzzyPrefixAutomaton) IsAccept(state State) bool {
+	return state == fuzzyPrefixAccept
 }
 
-func (a *LevenshteinAutomaton) bestState(states ...State) State {
-	best := DeadState
-	bestPos := -1
-	for _, s := range states {
-		if s == DeadState {
-			continue
-		}
-		pos, _ := a.decodeState(s)
-		if pos > bestPos {
-			bestPos = pos
-			best = s
-		}
+func (a *FuzzyPrefixAutomaton) CanMatch(state State) bool {
+	return state != DeadState
+}
+
+// settle moves an accepting Levenshtein state to the sticky accept state.
+func (a *FuzzyPrefixAutomaton) settle(state State) State {
+	if a.lev.IsAccept(state) {
+		return fuzzyPrefixAccept
 	}
-	return best
+	return state
 }
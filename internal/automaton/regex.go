@@ -0,0 +1,246 @@
+package automaton
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Regex pattern limits.
+const MaxRegexPatternLength = 256
+
+var (
+	ErrRegexPatternTooLong   = errors.New("regex pattern exceeds maximum length")
+	ErrInvalidRegex          = errors.New("invalid regex pattern")
+	ErrNFAStateLimitExceeded = errors.New("NFA state limit exceeded during construction")
+)
+
+// RegexAutomaton accepts terms matched in full by a regular expression in
+// RE2 syntax. Patterns are implicitly anchored at both ends, so anchors
+// and word boundaries are not supported.
+//
+// Construction compiles the pattern to a byte-level NFA, with character
+// classes expanded to their UTF-8 encodings, and converts it to a DFA via
+// subset construction.
+type RegexAutomaton struct {
+	*WildcardAutomaton
+}
+
+// NewRegexAutomaton compiles a regular expression into a DFA.
+func NewRegexAutomaton(pattern []byte) (*RegexAutomaton, error) {
+	if len(pattern) > MaxRegexPatternLength {
+		return nil, ErrRegexPatternTooLong
+	}
+	re, err := syntax.Parse(string(pattern), syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRegex, err)
+	}
+
+	c := &regexCompiler{n: &nfa{states: []*nfaState{newNFAState()}}}
+	end, err := c.compile(re.Simplify(), 0)
+	if err != nil {
+		return nil, err
+	}
+	c.n.states[end].accepting = true
+	dfa, err := subsetConstruct(c.n)
+	if err != nil {
+		return nil, err
+	}
+	return &RegexAutomaton{dfa}, nil
+}
+
+// regexCompiler builds a Thompson NFA from a parsed regular expression.
+type regexCompiler struct {
+	n *nfa
+}
+
+func (c *regexCompiler) newState() (int, error) {
+	if len(c.n.states) >= MaxNFAStates {
+		return 0, ErrNFAStateLimitExceeded
+	}
+	c.n.states = append(c.n.states, newNFAState())
+	return len(c.n.states) - 1, nil
+}
+
+func (c *regexCompiler) epsilon(from, to int) {
+	c.n.states[from].epsilon = append(c.n.states[from].epsilon, to)
+}
+
+// compile adds the NFA of re starting at state from and returns the state
+// it ends in.
+func (c *regexCompiler) compile(re *syntax.Regexp, from int) (int, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return from, nil
+	case syntax.OpNoMatch:
+		// A state with no way in.
+		return c.newState()
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			ranges := []rune{r, r}
+			if re.Flags&syntax.FoldCase != 0 {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					ranges = append(ranges, f, f)
+				}
+			}
+			var err error
+			if from, err = c.class(from, ranges); err != nil {
+				return 0, err
+			}
+		}
+		return from, nil
+	case syntax.OpCharClass:
+		return c.class(from, re.Rune)
+	case syntax.OpAnyCharNotNL:
+		return c.class(from, []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune})
+	case syntax.OpAnyChar:
+		return c.class(from, []rune{0, unicode.MaxRune})
+	case syntax.OpCapture:
+		return c.compile(re.Sub[0], from)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			var err error
+			if from, err = c.compile(sub, from); err != nil {
+				return 0, err
+			}
+		}
+		return from, nil
+	case syntax.OpAlternate:
+		out, err := c.newState()
+		if err != nil {
+			return 0, err
+		}
+		for _, sub := range re.Sub {
+			entry, err := c.newState()
+			if err != nil {
+				return 0, err
+			}
+			c.epsilon(from, entry)
+			end, err := c.compile(sub, entry)
+			if err != nil {
+				return 0, err
+			}
+			c.epsilon(end, out)
+		}
+		return out, nil
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest:
+		entry, err := c.newState()
+		if err != nil {
+			return 0, err
+		}
+		out, err := c.newState()
+		if err != nil {
+			return 0, err
+		}
+		c.epsilon(from, entry)
+		end, err := c.compile(re.Sub[0], entry)
+		if err != nil {
+			return 0, err
+		}
+		c.epsilon(end, out)
+		if re.Op != syntax.OpPlus {
+			c.epsilon(entry, out) // zero occurrences
+		}
+		if re.Op != syntax.OpQuest {
+			c.epsilon(end, entry) // further occurrences
+		}
+		return out, nil
+	default:
+		// Anchors and word boundaries; Simplify has expanded repeats.
+		return 0, fmt.Errorf("%w: %s is not supported, patterns match whole terms", ErrInvalidRegex, re)
+	}
+}
+
+// class adds transitions from state from on the UTF-8 encoding of every
+// rune in ranges, given as lo, hi pairs, and returns the state they end in.
+func (c *regexCompiler) class(from int, ranges []rune) (int, error) {
+	to, err := c.newState()
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i+1 < len(ranges); i += 2 {
+		err := utf8Sequences(ranges[i], ranges[i+1], func(seq [][2]byte) error {
+			cur := from
+			for j, r := range seq {
+				next := to
+				if j < len(seq)-1 {
+					var err error
+					if next, err = c.newState(); err != nil {
+						return err
+					}
+				}
+				for b := int(r[0]); b <= int(r[1]); b++ {
+					c.n.states[cur].transitions[b] = append(c.n.states[cur].transitions[b], next)
+				}
+				cur = next
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return to, nil
+}
+
+// utf8Sequences calls emit with byte-range sequences whose UTF-8 encodings
+// together are exactly the runes in [lo, hi]. Each sequence gives the
+// range of every byte of an encoding of one length.
+func utf8Sequences(lo, hi rune, emit func(seq [][2]byte) error) error {
+	if lo > hi {
+		return nil
+	}
+	// Surrogates have no encoding.
+	if lo < 0xD800 && hi >= 0xD800 {
+		if err := utf8Sequences(lo, 0xD7FF, emit); err != nil {
+			return err
+		}
+		return utf8Sequences(0xD800, hi, emit)
+	}
+	if lo <= 0xDFFF && hi >= 0xD800 {
+		return utf8Sequences(0xE000, hi, emit)
+	}
+	// Split where the encoding length changes.
+	for _, max := range []rune{0x7F, 0x7FF, 0xFFFF} {
+		if lo <= max && hi > max {
+			if err := utf8Sequences(lo, max, emit); err != nil {
+				return err
+			}
+			return utf8Sequences(max+1, hi, emit)
+		}
+	}
+	if hi < utf8.RuneSelf {
+		return emit([][2]byte{{byte(lo), byte(hi)}})
+	}
+	// Split until every continuation byte spans its full range wherever a
+	// leading byte varies.
+	n := utf8.RuneLen(lo)
+	for i := 1; i < n; i++ {
+		m := rune(1)<<(6*i) - 1
+		if lo&^m == hi&^m {
+			continue
+		}
+		if lo&m != 0 {
+			if err := utf8Sequences(lo, lo|m, emit); err != nil {
+				return err
+			}
+			return utf8Sequences((lo|m)+1, hi, emit)
+		}
+		if hi&m != m {
+			if err := utf8Sequences(lo, hi&^m-1, emit); err != nil {
+				return err
+			}
+			return utf8Sequences(hi&^m, hi, emit)
+		}
+	}
+	var a, b [utf8.UTFMax]byte
+	utf8.EncodeRune(a[:], lo)
+	utf8.EncodeRune(b[:], hi)
+	seq := make([][2]byte, n)
+	for i := range seq {
+		seq[i] = [2]byte{a[i], b[i]}
+	}
+	return emit(seq)
+}
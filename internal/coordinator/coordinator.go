@@ -10,6 +10,8 @@ import (
 	"log/slog"
 	"sync"
 	"time"
+
+	"GoSearch/internal/aggregation"
 )
 
 var (
@@ -63,6 +65,9 @@ type QueryResult struct {
 	TookMs           int64           `json:"took_ms"`
 	SuccessfulShards []string        `json:"successful_shards"`
 	Errors           []ShardError    `json:"errors,omitempty"`
+
+	// Aggregations are reduced over the successful shards only.
+	Aggregations map[string]*aggregation.Result `json:"aggregations,omitempty"`
 }
 
 // ShardError describes an error from a specific shard.
@@ -131,7 +136,7 @@ func (c *Coordinator) Search(ctx context.Context, query QueryClause, opts QueryO
 	}
 
 	// Step 6: MERGE — merge shard top-K into global top-K.
-	merged := mergeTopK(successful, opts.TopK)
+	merged := mergeTopK(successful, opts.TopK, opts.Offset)
 
 	// Aggregate total hits.
 	var totalHits uint64
@@ -139,6 +144,19 @@ func (c *Coordinator) Search(ctx context.Context, query QueryClause, opts QueryO
 		totalHits += resp.Stats.TotalHits
 	}
 
+	// Reduce shard aggregation partials.
+	var aggs map[string]*aggregation.Result
+	if len(opts.Aggregations) > 0 {
+		partials := make([]map[string]*aggregation.Partial, 0, len(successful))
+		for _, resp := range successful {
+			partials = append(partials, resp.Aggregations)
+		}
+		var err error
+		if aggs, err = aggregation.Reduce(opts.Aggregations, partials...); err != nil {
+			return nil, err
+		}
+	}
+
 	// Step 7: RESPOND.
 	status := "success"
 	if len(shardErrors) > 0 {
@@ -152,6 +170,7 @@ func (c *Coordinator) Search(ctx context.Context, query QueryClause, opts QueryO
 		TookMs:           time.Since(start).Milliseconds(),
 		SuccessfulShards: successfulShardIDs,
 		Errors:           shardErrors,
+		Aggregations:     aggs,
 	}, nil
 }
 
@@ -188,7 +207,16 @@ func (c *Coordinator) fanOut(ctx context.Context, plan *QueryPlan) []shardResult
 }
 
 // buildQueryPlan creates a canonical QueryPlan from the query and options.
+// Any shard may hold the hits of the requested page, so each shard returns
+// its top Offset+TopK hits and the coordinator applies the offset.
 func (c *Coordinator) buildQueryPlan(query QueryClause, opts QueryOptions) *QueryPlan {
+	if opts.Offset > 0 {
+		if opts.TopK <= 0 {
+			opts.TopK = 10
+		}
+		opts.TopK += opts.Offset
+		opts.Offset = 0
+	}
 	return &QueryPlan{
 		PlanID:    generatePlanID(),
 		TimeoutMs: c.config.PerShardTimeout.Milliseconds(),
@@ -244,21 +272,26 @@ func (c *Coordinator) HealthyShardCount() int {
 	return count
 }
 
-// mergeTopK merges shard-local top-K results into a global top-K.
-// Uses a min-heap of size K.
-func mergeTopK(responses []ShardResponse, k int) []ShardHit {
+// mergeTopK merges shard-local top-K results into a global top-K, skipping
+// the first offset hits. Uses a min-heap of size offset+K; hits with equal
+// scores are ordered by doc ID so pages do not overlap.
+func mergeTopK(responses []ShardResponse, k, offset int) []ShardHit {
 	if k <= 0 {
 		k = 10 // Default.
 	}
+	if offset < 0 {
+		offset = 0
+	}
+	n := offset + k
 
 	h := &hitHeap{}
 	heap.Init(h)
 
 	for _, resp := range responses {
 		for _, hit := range resp.Hits {
-			if h.Len() < k {
+			if h.Len() < n {
 				heap.Push(h, hit)
-			} else if hit.Score > (*h)[0].Score {
+			} else if hitBefore(hit, (*h)[0]) {
 				(*h)[0] = hit
 				heap.Fix(h, 0)
 			}
@@ -270,14 +303,29 @@ func mergeTopK(responses []ShardResponse, k int) []ShardHit {
 	for i := len(result) - 1; i >= 0; i-- {
 		result[i] = heap.Pop(h).(ShardHit)
 	}
-	return result
+	if offset >= len(result) {
+		return []ShardHit{}
+	}
+	return result[offset:]
+}
+
+// hitBefore reports whether a ranks ahead of b: higher scores first, then
+// doc IDs in ascending order.
+func hitBefore(a, b ShardHit) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	if a.DocID != b.DocID {
+		return a.DocID < b.DocID
+	}
+	return a.LocalDocID < b.LocalDocID
 }
 
-// hitHeap is a min-heap of ShardHit ordered by score.
+// hitHeap is a heap of ShardHit with the lowest-ranked hit on top.
 type hitHeap []ShardHit
 
 func (h hitHeap) Len() int            { return len(h) }
-func (h hitHeap) Less(i, j int) bool   { return h[i].Score < h[j].Score }
+func (h hitHeap) Less(i, j int) bool   { return hitBefore(h[j], h[i]) }
 func (h hitHeap) Swap(i, j int)        { h[i], h[j] = h[j], h[i] }
 func (h *hitHeap) Push(x any)          { *h = append(*h, x.(ShardHit)) }
 func (h *hitHeap) Pop() any {
@@ -3,8 +3,11 @@ package coordinator
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 	"time"
+
+	"GoSearch/internal/aggregation"
 )
 
 // mockShardClient implements ShardClient for testing.
@@ -193,6 +196,55 @@ func TestSearch_PartialFailure(t *testing.T) {
 	}
 }
 
+func TestSearch_ReducesAggregations(t *testing.T) {
+	shard := func(partials map[string]*aggregation.Partial) ShardClient {
+		return &mockShardClient{
+			executeFunc: func(ctx context.Context, plan *QueryPlan) (*ShardResponse, error) {
+				if _, ok := plan.Options.Aggregations["tags"]; !ok {
+					t.Error("plan is missing aggregations")
+				}
+				return &ShardResponse{PlanID: plan.PlanID, Status: "success", Aggregations: partials}, nil
+			},
+		}
+	}
+	clients := map[string]ShardClient{
+		"shard_0": shard(map[string]*aggregation.Partial{
+			"tags": {Type: aggregation.TypeTerms, Buckets: []*aggregation.PartialBucket{
+				{Key: "go", DocCount: 2}, {Key: "rust", DocCount: 1},
+			}},
+			"avg_price": {Type: aggregation.TypeAvg, Count: 2, Sum: 30, Min: 10, Max: 20},
+		}),
+		"shard_1": shard(map[string]*aggregation.Partial{
+			"tags": {Type: aggregation.TypeTerms, Buckets: []*aggregation.PartialBucket{
+				{Key: "rust", DocCount: 3},
+			}},
+			"avg_price": {Type: aggregation.TypeAvg, Count: 1, Sum: 60, Min: 60, Max: 60},
+		}),
+		"shard_2": &mockShardClient{
+			executeFunc: func(ctx context.Context, plan *QueryPlan) (*ShardResponse, error) {
+				return nil, errors.New("connection refused")
+			},
+		},
+	}
+	c := newTestCoordinator(clients)
+
+	opts := QueryOptions{TopK: 10, Aggregations: map[string]aggregation.Request{
+		"tags":      {Terms: &aggregation.TermsRequest{Field: "tags"}},
+		"avg_price": {Avg: &aggregation.MetricRequest{Field: "price"}},
+	}}
+	result, err := c.Search(context.Background(), QueryClause{Type: "term"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := result.Aggregations["tags"]
+	if len(tags.Buckets) != 2 || tags.Buckets[0].Key != "rust" || tags.Buckets[0].DocCount != 4 {
+		t.Errorf("tags buckets = %+v, want rust:4 first", tags.Buckets)
+	}
+	if avg := result.Aggregations["avg_price"].Value; avg == nil || *avg != 30 {
+		t.Errorf("avg_price = %v, want 30", avg)
+	}
+}
+
 func TestSearch_AllShardsFail(t *testing.T) {
 	clients := map[string]ShardClient{
 		"shard_0": &mockShardClient{
@@ -235,7 +287,7 @@ func TestSearch_ShardReturnsError(t *testing.T) {
 }
 
 func TestMergeTopK_Empty(t *testing.T) {
-	result := mergeTopK(nil, 10)
+	result := mergeTopK(nil, 10, 0)
 	if len(result) != 0 {
 		t.Errorf("expected 0 hits, got %d", len(result))
 	}
@@ -245,7 +297,7 @@ func TestMergeTopK_LessThanK(t *testing.T) {
 	responses := []ShardResponse{
 		{Hits: []ShardHit{{DocID: "a", Score: 1.0}, {DocID: "b", Score: 2.0}}},
 	}
-	result := mergeTopK(responses, 10)
+	result := mergeTopK(responses, 10, 0)
 	if len(result) != 2 {
 		t.Fatalf("expected 2 hits, got %d", len(result))
 	}
@@ -259,7 +311,7 @@ func TestMergeTopK_ExactlyK(t *testing.T) {
 		{Hits: []ShardHit{{DocID: "a", Score: 3.0}, {DocID: "b", Score: 1.0}}},
 		{Hits: []ShardHit{{DocID: "c", Score: 2.0}}},
 	}
-	result := mergeTopK(responses, 3)
+	result := mergeTopK(responses, 3, 0)
 	if len(result) != 3 {
 		t.Fatalf("expected 3 hits, got %d", len(result))
 	}
@@ -281,7 +333,7 @@ func TestMergeTopK_MoreThanK(t *testing.T) {
 			{DocID: "e", Score: 2.0},
 		}},
 	}
-	result := mergeTopK(responses, 3)
+	result := mergeTopK(responses, 3, 0)
 	if len(result) != 3 {
 		t.Fatalf("expected 3 hits, got %d", len(result))
 	}
@@ -295,12 +347,65 @@ func TestMergeTopK_DefaultK(t *testing.T) {
 	responses := []ShardResponse{
 		{Hits: []ShardHit{{DocID: "a", Score: 1.0}}},
 	}
-	result := mergeTopK(responses, 0)
+	result := mergeTopK(responses, 0, 0)
 	if len(result) != 1 {
 		t.Errorf("expected 1 hit with default K, got %d", len(result))
 	}
 }
 
+func TestMergeTopK_Offset(t *testing.T) {
+	responses := []ShardResponse{
+		{Hits: []ShardHit{{DocID: "a", Score: 5.0}, {DocID: "c", Score: 2.0}, {DocID: "e", Score: 1.0}}},
+		{Hits: []ShardHit{{DocID: "d", Score: 2.0}, {DocID: "b", Score: 2.0}}},
+	}
+	tests := []struct {
+		k, offset int
+		want      []string
+	}{
+		{2, 0, []string{"a", "b"}},
+		{2, 2, []string{"c", "d"}},
+		{2, 4, []string{"e"}},
+		{2, 5, []string{}},
+		{10, 1, []string{"b", "c", "d", "e"}},
+	}
+	for _, tt := range tests {
+		result := mergeTopK(responses, tt.k, tt.offset)
+		got := make([]string, len(result))
+		for i, hit := range result {
+			got[i] = hit.DocID
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("k=%d offset=%d: got %v, want %v", tt.k, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestSearch_OffsetRequestsDeeperShardPages(t *testing.T) {
+	var sent QueryOptions
+	clients := map[string]ShardClient{
+		"shard_0": &mockShardClient{
+			executeFunc: func(ctx context.Context, plan *QueryPlan) (*ShardResponse, error) {
+				sent = plan.Options
+				return &ShardResponse{
+					Status: "success",
+					Stats:  ShardStats{TotalHits: 3},
+					Hits:   []ShardHit{{DocID: "a", Score: 3}, {DocID: "b", Score: 2}, {DocID: "c", Score: 1}},
+				}, nil
+			},
+		},
+	}
+	result, err := newTestCoordinator(clients).Search(context.Background(), QueryClause{Type: "term"}, QueryOptions{TopK: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.TopK != 3 || sent.Offset != 0 {
+		t.Errorf("shard options top_k=%d offset=%d, want 3 and 0", sent.TopK, sent.Offset)
+	}
+	if len(result.Hits) != 2 || result.Hits[0].DocID != "b" || result.Hits[1].DocID != "c" {
+		t.Errorf("hits = %+v", result.Hits)
+	}
+}
+
 func TestCheckHealth(t *testing.T) {
 	clients := map[string]ShardClient{
 		"shard_0": &mockShardClient{},
@@ -1,5 +1,7 @@
 package coordinator
 
+import "GoSearch/internal/aggregation"
+
 // QueryClause represents a single clause in a query plan.
 type QueryClause struct {
 	Type     string        `json:"type"`
@@ -17,6 +19,10 @@ type QueryOptions struct {
 	Offset        int      `json:"offset"`
 	IncludeScores bool     `json:"include_scores"`
 	IncludeStored []string `json:"include_stored,omitempty"`
+
+	// Aggregations are computed by every shard and reduced by the
+	// coordinator.
+	Aggregations map[string]aggregation.Request `json:"aggregations,omitempty"`
 }
 
 // QueryPlan is the canonical query representation sent to shard nodes.
@@ -54,6 +60,10 @@ type ShardResponse struct {
 	Error      string     `json:"error,omitempty"`
 	Stats      ShardStats `json:"stats"`
 	Hits       []ShardHit `json:"hits"`
+
+	// Aggregations holds the shard's mergeable partial results for the
+	// plan's aggregations.
+	Aggregations map[string]*aggregation.Partial `json:"aggregations,omitempty"`
 }
 
 // ShardHealth represents the health status of a shard node.
@@ -0,0 +1,139 @@
+package docvalues
+
+import "sort"
+
+// Builder accumulates doc values in memory while a segment is being built.
+// Documents may be added in any order; Build produces the columnar form.
+// A Builder is not safe for concurrent use.
+type Builder struct {
+	sortedSet map[string]map[uint32][]string
+	numeric   map[string]map[uint32][]int64
+
+	memoryUsed int64
+}
+
+// NewBuilder creates an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{
+		sortedSet: make(map[string]map[uint32][]string),
+		numeric:   make(map[string]map[uint32][]int64),
+	}
+}
+
+// AddSortedSet records a keyword value for a document.
+// Duplicate values for the same document are collapsed at build time.
+func (b *Builder) AddSortedSet(field string, docID uint32, value string) {
+	docs, ok := b.sortedSet[field]
+	if !ok {
+		docs = make(map[uint32][]string)
+		b.sortedSet[field] = docs
+	}
+	docs[docID] = append(docs[docID], value)
+	b.memoryUsed += int64(len(value) + 16)
+}
+
+// AddNumeric records a numeric value for a document.
+func (b *Builder) AddNumeric(field string, docID uint32, value int64) {
+	docs, ok := b.numeric[field]
+	if !ok {
+		docs = make(map[uint32][]int64)
+		b.numeric[field] = docs
+	}
+	docs[docID] = append(docs[docID], value)
+	b.memoryUsed += 8
+}
+
+// MemoryUsed returns the approximate memory held by the builder.
+func (b *Builder) MemoryUsed() int64 {
+	return b.memoryUsed
+}
+
+// Build converts the accumulated values into an immutable Segment covering
+// doc IDs [0, maxDoc). Values recorded for doc IDs >= maxDoc are dropped.
+func (b *Builder) Build(maxDoc uint32) *Segment {
+	seg := &Segment{
+		maxDoc:    maxDoc,
+		sortedSet: make(map[string]*SortedSetField, len(b.sortedSet)),
+		numeric:   make(map[string]*NumericField, len(b.numeric)),
+	}
+	for field, docs := range b.sortedSet {
+		seg.sortedSet[field] = buildSortedSet(docs, maxDoc)
+	}
+	for field, docs := range b.numeric {
+		seg.numeric[field] = buildNumeric(docs, maxDoc)
+	}
+	return seg
+}
+
+// Reset clears the builder for reuse.
+func (b *Builder) Reset() {
+	b.sortedSet = make(map[string]map[uint32][]string)
+	b.numeric = make(map[string]map[uint32][]int64)
+	b.memoryUsed = 0
+}
+
+func buildSortedSet(docs map[uint32][]string, maxDoc uint32) *SortedSetField {
+	// Build the sorted term dictionary.
+	unique := make(map[string]struct{})
+	for docID, values := range docs {
+		if docID >= maxDoc {
+			continue
+		}
+		for _, v := range values {
+			unique[v] = struct{}{}
+		}
+	}
+	terms := make([]string, 0, len(unique))
+	for t := range unique {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+	ordOf := make(map[string]uint32, len(terms))
+	for i, t := range terms {
+		ordOf[t] = uint32(i)
+	}
+
+	f := &SortedSetField{
+		terms:    terms,
+		docStart: make([]uint32, maxDoc+1),
+	}
+	for d := uint32(0); d < maxDoc; d++ {
+		f.docStart[d] = uint32(len(f.ords))
+		values := docs[d]
+		if len(values) == 0 {
+			continue
+		}
+		ords := make([]uint32, 0, len(values))
+		for _, v := range values {
+			ords = append(ords, ordOf[v])
+		}
+		sort.Slice(ords, func(i, j int) bool { return ords[i] < ords[j] })
+		for i, o := range ords {
+			if i > 0 && o == ords[i-1] {
+				continue
+			}
+			f.ords = append(f.ords, o)
+		}
+	}
+	f.docStart[maxDoc] = uint32(len(f.ords))
+	return f
+}
+
+func buildNumeric(docs map[uint32][]int64, maxDoc uint32) *NumericField {
+	f := &NumericField{
+		docStart: make([]uint32, maxDoc+1),
+	}
+	for d := uint32(0); d < maxDoc; d++ {
+		f.docStart[d] = uint32(len(f.values))
+		values := docs[d]
+		if len(values) == 0 {
+			continue
+		}
+		start := len(f.values)
+		f.values = append(f.values, values...)
+		sorted := f.values[start:]
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	}
+	f.docStart[maxDoc] = uint32(len(f.values))
+	return f
+}
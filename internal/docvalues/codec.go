@@ -0,0 +1,229 @@
+package docvalues
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// File format constants. Magic matches index.MagicDocValues.
+const (
+	Magic         = "GTSRDVL\x00"
+	FormatVersion = uint32(1)
+)
+
+// Encode serializes a Segment into the doc-values file format:
+//
+//	magic[8] | version uint32 | maxDoc uvarint | fieldCount uvarint | field*
+//
+// Each field is written as name, kind and a per-document column. Sorted-set
+// fields carry the sorted term dictionary followed by, for every document,
+// the ordinal count and delta-coded ordinals. Numeric fields carry, for every
+// document, the value count, the first value zig-zag encoded and the
+// remaining values delta-coded.
+func Encode(s *Segment) []byte {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, Magic...)
+	buf = binary.LittleEndian.AppendUint32(buf, FormatVersion)
+	buf = binary.AppendUvarint(buf, uint64(s.maxDoc))
+
+	names := make([]string, 0, len(s.sortedSet)+len(s.numeric))
+	for name := range s.sortedSet {
+		names = append(names, name)
+	}
+	for name := range s.numeric {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+
+	for _, name := range names {
+		buf = appendString(buf, name)
+		if f, ok := s.sortedSet[name]; ok {
+			buf = append(buf, KindSortedSet)
+			buf = binary.AppendUvarint(buf, uint64(len(f.terms)))
+			for _, t := range f.terms {
+				buf = appendString(buf, t)
+			}
+			for d := uint32(0); d < s.maxDoc; d++ {
+				ords := f.Ords(d)
+				buf = binary.AppendUvarint(buf, uint64(len(ords)))
+				var prev uint32
+				for _, o := range ords {
+					buf = binary.AppendUvarint(buf, uint64(o-prev))
+					prev = o
+				}
+			}
+			continue
+		}
+		f := s.numeric[name]
+		buf = append(buf, KindNumeric)
+		for d := uint32(0); d < s.maxDoc; d++ {
+			values := f.Values(d)
+			buf = binary.AppendUvarint(buf, uint64(len(values)))
+			for i, v := range values {
+				if i == 0 {
+					buf = binary.AppendVarint(buf, v)
+					continue
+				}
+				buf = binary.AppendUvarint(buf, uint64(v-values[i-1]))
+			}
+		}
+	}
+	return buf
+}
+
+// Decode parses a doc-values file produced by Encode.
+func Decode(data []byte) (*Segment, error) {
+	if len(data) < len(Magic)+4 || string(data[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("%w: bad magic", ErrCorrupt)
+	}
+	if v := binary.LittleEndian.Uint32(data[len(Magic):]); v != FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, v)
+	}
+	r := &reader{data: data, pos: len(Magic) + 4}
+
+	maxDoc := uint32(r.uvarint())
+	fieldCount := r.uvarint()
+	seg := &Segment{
+		maxDoc:    maxDoc,
+		sortedSet: make(map[string]*SortedSetField),
+		numeric:   make(map[string]*NumericField),
+	}
+	for i := uint64(0); i < fieldCount && r.err == nil; i++ {
+		name := r.string()
+		// Every document costs at least one count byte per field.
+		if uint64(maxDoc) > uint64(len(data)-r.pos) {
+			return nil, fmt.Errorf("%w: field %q max doc %d exceeds data", ErrCorrupt, name, maxDoc)
+		}
+		switch kind := r.byte(); kind {
+		case KindSortedSet:
+			f := &SortedSetField{docStart: make([]uint32, maxDoc+1)}
+			termCount := r.uvarint()
+			if termCount > uint64(len(data)) {
+				return nil, fmt.Errorf("%w: field %q term count %d", ErrCorrupt, name, termCount)
+			}
+			f.terms = make([]string, 0, termCount)
+			for j := uint64(0); j < termCount && r.err == nil; j++ {
+				f.terms = append(f.terms, r.string())
+			}
+			for d := uint32(0); d < maxDoc && r.err == nil; d++ {
+				f.docStart[d] = uint32(len(f.ords))
+				n := r.uvarint()
+				var ord uint32
+				for j := uint64(0); j < n && r.err == nil; j++ {
+					ord += uint32(r.uvarint())
+					if int(ord) >= len(f.terms) {
+						return nil, fmt.Errorf("%w: field %q ordinal %d out of range", ErrCorrupt, name, ord)
+					}
+					f.ords = append(f.ords, ord)
+				}
+			}
+			f.docStart[maxDoc] = uint32(len(f.ords))
+			seg.sortedSet[name] = f
+		case KindNumeric:
+			f := &NumericField{docStart: make([]uint32, maxDoc+1)}
+			for d := uint32(0); d < maxDoc && r.err == nil; d++ {
+				f.docStart[d] = uint32(len(f.values))
+				n := r.uvarint()
+				var v int64
+				for j := uint64(0); j < n && r.err == nil; j++ {
+					if j == 0 {
+						v = r.varint()
+					} else {
+						v += int64(r.uvarint())
+					}
+					f.values = append(f.values, v)
+				}
+			}
+			f.docStart[maxDoc] = uint32(len(f.values))
+			seg.numeric[name] = f
+		default:
+			if r.err == nil {
+				return nil, fmt.Errorf("%w: field %q has unknown kind %d", ErrCorrupt, name, kind)
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, len(data)-r.pos)
+	}
+	return seg, nil
+}
+
+// ReadFile loads and decodes a doc-values file from disk.
+func ReadFile(path string) (*Segment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read doc values: %w", err)
+	}
+	return Decode(data)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// reader is a sticky-error cursor over an encoded doc-values file.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad uvarint at offset %d", ErrCorrupt, r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *reader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad varint at offset %d", ErrCorrupt, r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.err = fmt.Errorf("%w: unexpected end of data", ErrCorrupt)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *reader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("%w: string length %d exceeds data", ErrCorrupt, n)
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+int(n)])
+	r.pos += int(n)
+	return s
+}
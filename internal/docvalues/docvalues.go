@@ -0,0 +1,141 @@
+package docvalues
+
+import (
+	"errors"
+	"sort"
+)
+
+// Value kinds stored in a doc-values file.
+const (
+	KindSortedSet byte = 1
+	KindNumeric   byte = 2
+)
+
+var (
+	ErrCorrupt            = errors.New("doc values data is corrupt")
+	ErrUnsupportedVersion = errors.New("unsupported doc values format version")
+)
+
+// Segment holds the column-oriented doc values of a single segment.
+// It is immutable once built or decoded and safe for concurrent readers;
+// iterators returned from it are not.
+type Segment struct {
+	maxDoc    uint32
+	sortedSet map[string]*SortedSetField
+	numeric   map[string]*NumericField
+}
+
+// SortedSetField stores a keyword field as per-document ordinal sets.
+// Ordinals index into terms, which is sorted, so ordinal order is term order.
+type SortedSetField struct {
+	terms []string
+	// docStart[d]..docStart[d+1] is the range of ords belonging to doc d.
+	docStart []uint32
+	ords     []uint32
+}
+
+// NumericField stores a numeric field as per-document sorted int64 values.
+type NumericField struct {
+	// docStart[d]..docStart[d+1] is the range of values belonging to doc d.
+	docStart []uint32
+	values   []int64
+}
+
+// MaxDoc returns one greater than the largest doc ID covered by the segment.
+func (s *Segment) MaxDoc() uint32 {
+	return s.maxDoc
+}
+
+// Fields returns the names of all doc-values fields in the segment, sorted.
+func (s *Segment) Fields() []string {
+	names := make([]string, 0, len(s.sortedSet)+len(s.numeric))
+	for name := range s.sortedSet {
+		names = append(names, name)
+	}
+	for name := range s.numeric {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortedSetField returns the sorted-set column for a field, or nil if absent.
+func (s *Segment) SortedSetField(field string) *SortedSetField {
+	return s.sortedSet[field]
+}
+
+// NumericField returns the numeric column for a field, or nil if absent.
+func (s *Segment) NumericField(field string) *NumericField {
+	return s.numeric[field]
+}
+
+// SortedSet returns a new iterator over a sorted-set field, or nil if absent.
+func (s *Segment) SortedSet(field string) *SortedSetIterator {
+	f := s.sortedSet[field]
+	if f == nil {
+		return nil
+	}
+	return f.Iterator()
+}
+
+// Numeric returns a new iterator over a numeric field, or nil if absent.
+func (s *Segment) Numeric(field string) *NumericIterator {
+	f := s.numeric[field]
+	if f == nil {
+		return nil
+	}
+	return f.Iterator()
+}
+
+// ValueCount returns the number of unique terms in the field.
+func (f *SortedSetField) ValueCount() int {
+	return len(f.terms)
+}
+
+// LookupOrd returns the term for an ordinal.
+func (f *SortedSetField) LookupOrd(ord uint32) string {
+	return f.terms[ord]
+}
+
+// LookupTerm returns the ordinal of a term and whether it exists.
+func (f *SortedSetField) LookupTerm(term string) (uint32, bool) {
+	i := sort.SearchStrings(f.terms, term)
+	if i < len(f.terms) && f.terms[i] == term {
+		return uint32(i), true
+	}
+	return 0, false
+}
+
+// Ords returns the ordinals of a document in ascending order.
+func (f *SortedSetField) Ords(docID uint32) []uint32 {
+	if int(docID)+1 >= len(f.docStart) {
+		return nil
+	}
+	return f.ords[f.docStart[docID]:f.docStart[docID+1]]
+}
+
+// Iterator returns a new iterator over the field.
+func (f *SortedSetField) Iterator() *SortedSetIterator {
+	return &SortedSetIterator{field: f, doc: -1}
+}
+
+// Values returns the values of a document in ascending order.
+func (f *NumericField) Values(docID uint32) []int64 {
+	if int(docID)+1 >= len(f.docStart) {
+		return nil
+	}
+	return f.values[f.docStart[docID]:f.docStart[docID+1]]
+}
+
+// Iterator returns a new iterator over the field.
+func (f *NumericField) Iterator() *NumericIterator {
+	return &NumericIterator{field: f, doc: -1}
+}
+
+// tableMaxDoc returns the number of documents covered by a docStart table.
+func tableMaxDoc(docStart []uint32) int {
+	if len(docStart) == 0 {
+		return 0
+	}
+	return len(docStart) - 1
+}
@@ -0,0 +1,194 @@
+package docvalues
+
+import (
+	"errors"
+	"testing"
+)
+
+func testSegment() *Segment {
+	b := NewBuilder()
+	b.AddSortedSet("tags", 0, "search")
+	b.AddSortedSet("tags", 0, "tutorial")
+	b.AddSortedSet("tags", 0, "search") // duplicate collapses
+	b.AddSortedSet("tags", 2, "engineering")
+	b.AddSortedSet("tags", 3, "search")
+	b.AddNumeric("views", 1, 42)
+	b.AddNumeric("views", 3, -7)
+	b.AddNumeric("views", 3, 100)
+	return b.Build(4)
+}
+
+func TestBuilder_SortedSetOrdinals(t *testing.T) {
+	seg := testSegment()
+	f := seg.SortedSetField("tags")
+	if f == nil {
+		t.Fatal("tags field missing")
+	}
+	if f.ValueCount() != 3 {
+		t.Fatalf("ValueCount = %d, want 3", f.ValueCount())
+	}
+	// Ordinals follow term order.
+	want := []string{"engineering", "search", "tutorial"}
+	for i, term := range want {
+		if got := f.LookupOrd(uint32(i)); got != term {
+			t.Errorf("LookupOrd(%d) = %q, want %q", i, got, term)
+		}
+	}
+	if ords := f.Ords(0); len(ords) != 2 || ords[0] != 1 || ords[1] != 2 {
+		t.Errorf("Ords(0) = %v, want [1 2]", ords)
+	}
+	if ords := f.Ords(1); len(ords) != 0 {
+		t.Errorf("Ords(1) = %v, want []", ords)
+	}
+	if ord, ok := f.LookupTerm("search"); !ok || ord != 1 {
+		t.Errorf("LookupTerm(search) = %d, %v", ord, ok)
+	}
+	if _, ok := f.LookupTerm("missing"); ok {
+		t.Error("LookupTerm(missing) should not exist")
+	}
+}
+
+func TestBuilder_NumericSorted(t *testing.T) {
+	seg := testSegment()
+	f := seg.NumericField("views")
+	if f == nil {
+		t.Fatal("views field missing")
+	}
+	if v := f.Values(3); len(v) != 2 || v[0] != -7 || v[1] != 100 {
+		t.Errorf("Values(3) = %v, want [-7 100]", v)
+	}
+	if v := f.Values(0); len(v) != 0 {
+		t.Errorf("Values(0) = %v, want []", v)
+	}
+}
+
+func TestBuilder_DropsDocsPastMaxDoc(t *testing.T) {
+	b := NewBuilder()
+	b.AddSortedSet("tags", 5, "late")
+	seg := b.Build(2)
+	if seg.SortedSetField("tags").ValueCount() != 0 {
+		t.Error("values past maxDoc should be dropped")
+	}
+}
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	seg := testSegment()
+	decoded, err := Decode(Encode(seg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.MaxDoc() != 4 {
+		t.Errorf("MaxDoc = %d, want 4", decoded.MaxDoc())
+	}
+	fields := decoded.Fields()
+	if len(fields) != 2 || fields[0] != "tags" || fields[1] != "views" {
+		t.Errorf("Fields = %v", fields)
+	}
+	for d := uint32(0); d < 4; d++ {
+		want := seg.SortedSetField("tags").Ords(d)
+		got := decoded.SortedSetField("tags").Ords(d)
+		if len(got) != len(want) {
+			t.Fatalf("doc %d ords = %v, want %v", d, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("doc %d ords = %v, want %v", d, got, want)
+			}
+		}
+		wantV := seg.NumericField("views").Values(d)
+		gotV := decoded.NumericField("views").Values(d)
+		if len(gotV) != len(wantV) {
+			t.Fatalf("doc %d values = %v, want %v", d, gotV, wantV)
+		}
+		for i := range gotV {
+			if gotV[i] != wantV[i] {
+				t.Errorf("doc %d values = %v, want %v", d, gotV, wantV)
+			}
+		}
+	}
+}
+
+func TestEncodeDecode_Empty(t *testing.T) {
+	decoded, err := Decode(Encode(NewBuilder().Build(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Fields()) != 0 {
+		t.Errorf("expected no fields, got %v", decoded.Fields())
+	}
+}
+
+func TestDecode_Corrupt(t *testing.T) {
+	data := Encode(testSegment())
+
+	if _, err := Decode([]byte("nope")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("short input: expected ErrCorrupt, got %v", err)
+	}
+	if _, err := Decode(data[:len(data)-3]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("truncated input: expected ErrCorrupt, got %v", err)
+	}
+
+	badVersion := append([]byte(nil), data...)
+	badVersion[len(Magic)] = 99
+	if _, err := Decode(badVersion); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestSortedSetIterator(t *testing.T) {
+	it := testSegment().SortedSet("tags")
+
+	var docs []uint32
+	for it.Next() {
+		docs = append(docs, it.DocID())
+		if it.Freq() != uint32(len(it.Ords())) {
+			t.Errorf("doc %d: Freq = %d, ords = %v", it.DocID(), it.Freq(), it.Ords())
+		}
+	}
+	if len(docs) != 3 || docs[0] != 0 || docs[1] != 2 || docs[2] != 3 {
+		t.Errorf("docs = %v, want [0 2 3]", docs)
+	}
+
+	it = testSegment().SortedSet("tags")
+	if !it.Advance(1) || it.DocID() != 2 {
+		t.Errorf("Advance(1) landed on %d, want 2", it.DocID())
+	}
+	if it.LookupOrd(it.Ords()[0]) != "engineering" {
+		t.Errorf("doc 2 term = %q", it.LookupOrd(it.Ords()[0]))
+	}
+	if it.Advance(4) {
+		t.Error("Advance(4) should be exhausted")
+	}
+}
+
+func TestIterator_AdvanceExact(t *testing.T) {
+	seg := testSegment()
+	ss := seg.SortedSet("tags")
+	if ss.AdvanceExact(1) {
+		t.Error("doc 1 has no tags")
+	}
+	if !ss.AdvanceExact(3) || len(ss.Ords()) != 1 {
+		t.Errorf("doc 3 ords = %v", ss.Ords())
+	}
+
+	num := seg.Numeric("views")
+	if !num.AdvanceExact(3) || num.Value() != -7 {
+		t.Errorf("doc 3 value = %v", num.Values())
+	}
+	if num.AdvanceExact(2) {
+		t.Error("doc 2 has no views")
+	}
+	if num.AdvanceExact(10) {
+		t.Error("doc past maxDoc has no values")
+	}
+}
+
+func TestSegment_MissingField(t *testing.T) {
+	seg := testSegment()
+	if seg.SortedSet("missing") != nil {
+		t.Error("expected nil iterator for missing sorted-set field")
+	}
+	if seg.Numeric("tags") != nil {
+		t.Error("expected nil numeric iterator for sorted-set field")
+	}
+}
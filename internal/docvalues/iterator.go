@@ -0,0 +1,154 @@
+package docvalues
+
+// The iterators in this file follow the engine.PostingsIterator contract
+// (Next/DocID/Freq/Advance/Cost) so they can be combined with postings
+// iterators, e.g. as an "exists" clause inside a conjunction. Freq reports
+// the number of values the current document has.
+//
+// AdvanceExact is the random-access form used by collectors that already
+// know which document they are on: it positions the iterator on target and
+// reports whether target has any values.
+
+// SortedSetIterator iterates the documents of a sorted-set field in doc ID order.
+type SortedSetIterator struct {
+	field *SortedSetField
+	doc   int
+}
+
+// Next advances to the next document that has at least one value.
+func (it *SortedSetIterator) Next() bool {
+	return it.seek(it.doc + 1)
+}
+
+// DocID returns the current document ID.
+func (it *SortedSetIterator) DocID() uint32 {
+	return uint32(it.doc)
+}
+
+// Freq returns the number of ordinals of the current document.
+func (it *SortedSetIterator) Freq() uint32 {
+	return uint32(len(it.Ords()))
+}
+
+// Advance moves to the first document >= target that has a value.
+func (it *SortedSetIterator) Advance(target uint32) bool {
+	if it.doc >= int(target) && it.doc < tableMaxDoc(it.field.docStart) {
+		return true
+	}
+	return it.seek(int(target))
+}
+
+// AdvanceExact positions the iterator on target and reports whether it has values.
+func (it *SortedSetIterator) AdvanceExact(target uint32) bool {
+	it.doc = int(target)
+	return len(it.field.Ords(target)) > 0
+}
+
+// Cost returns an upper bound of the remaining documents.
+func (it *SortedSetIterator) Cost() int64 {
+	remaining := tableMaxDoc(it.field.docStart) - it.doc - 1
+	if remaining < 0 {
+		return 0
+	}
+	return int64(remaining)
+}
+
+// Ords returns the ordinals of the current document in ascending order.
+func (it *SortedSetIterator) Ords() []uint32 {
+	if it.doc < 0 {
+		return nil
+	}
+	return it.field.Ords(uint32(it.doc))
+}
+
+// LookupOrd returns the term for an ordinal.
+func (it *SortedSetIterator) LookupOrd(ord uint32) string {
+	return it.field.LookupOrd(ord)
+}
+
+// ValueCount returns the number of unique terms in the field.
+func (it *SortedSetIterator) ValueCount() int {
+	return it.field.ValueCount()
+}
+
+func (it *SortedSetIterator) seek(from int) bool {
+	n := tableMaxDoc(it.field.docStart)
+	for d := from; d < n; d++ {
+		if it.field.docStart[d+1] > it.field.docStart[d] {
+			it.doc = d
+			return true
+		}
+	}
+	it.doc = n
+	return false
+}
+
+// NumericIterator iterates the documents of a numeric field in doc ID order.
+type NumericIterator struct {
+	field *NumericField
+	doc   int
+}
+
+// Next advances to the next document that has at least one value.
+func (it *NumericIterator) Next() bool {
+	return it.seek(it.doc + 1)
+}
+
+// DocID returns the current document ID.
+func (it *NumericIterator) DocID() uint32 {
+	return uint32(it.doc)
+}
+
+// Freq returns the number of values of the current document.
+func (it *NumericIterator) Freq() uint32 {
+	return uint32(len(it.Values()))
+}
+
+// Advance moves to the first document >= target that has a value.
+func (it *NumericIterator) Advance(target uint32) bool {
+	if it.doc >= int(target) && it.doc < tableMaxDoc(it.field.docStart) {
+		return true
+	}
+	return it.seek(int(target))
+}
+
+// AdvanceExact positions the iterator on target and reports whether it has values.
+func (it *NumericIterator) AdvanceExact(target uint32) bool {
+	it.doc = int(target)
+	return len(it.field.Values(target)) > 0
+}
+
+// Cost returns an upper bound of the remaining documents.
+func (it *NumericIterator) Cost() int64 {
+	remaining := tableMaxDoc(it.field.docStart) - it.doc - 1
+	if remaining < 0 {
+		return 0
+	}
+	return int64(remaining)
+}
+
+// Values returns the values of the current document in ascending order.
+func (it *NumericIterator) Values() []int64 {
+	if it.doc < 0 {
+		return nil
+	}
+	return it.field.Values(uint32(it.doc))
+}
+
+// Value returns the smallest value of the current document.
+// It must only be called when the current document has values.
+func (it *NumericIterator) Value() int64 {
+	return it.Values()[0]
+}
+
+func (it *NumericIterator) seek(from int) bool {
+	n := tableMaxDoc(it.field.docStart)
+	for d := from; d < n; d++ {
+		if it.field.docStart[d+1] > it.field.docStart[d] {
+			it.doc = d
+			return true
+		}
+	}
+	it.doc = n
+	return false
+}
@@ -4,8 +4,21 @@ import "container/heap"
 
 // ScoredDoc represents a document with its score.
 type ScoredDoc struct {
-	DocID uint32
-	Score float32
+	DocID   uint32
+	Score   float32
+	Segment int // Ordinal of the segment DocID belongs to.
+}
+
+// Before reports whether d ranks ahead of o: higher scores first, then
+// lower segment ordinals and doc IDs, so that ties have a stable order.
+func (d ScoredDoc) Before(o ScoredDoc) bool {
+	if d.Score != o.Score {
+		return d.Score > o.Score
+	}
+	if d.Segment != o.Segment {
+		return d.Segment < o.Segment
+	}
+	return d.DocID < o.DocID
 }
 
 // TopKCollector collects the top-K scoring documents using a min-heap.
@@ -13,6 +26,8 @@ type TopKCollector struct {
 	k        int
 	h        scoreHeap
 	minScore float32
+	segment  int
+	after    *ScoredDoc
 }
 
 // NewTopKCollector creates a collector for the top K documents.
@@ -26,15 +41,34 @@ func NewTopKCollector(k int) *TopKCollector {
 	}
 }
 
+// NewTopKCollectorAfter creates a collector for the top K documents that
+// rank after the given document, for paging with search_after cursors.
+func NewTopKCollectorAfter(k int, after ScoredDoc) *TopKCollector {
+	c := NewTopKCollector(k)
+	c.after = &after
+	return c
+}
+
+// SetSegment sets the segment ordinal recorded with subsequently collected
+// documents. Doc IDs are segment-local, so multi-segment searches must call
+// this before collecting from each segment.
+func (c *TopKCollector) SetSegment(ord int) {
+	c.segment = ord
+}
+
 // Collect adds a document to the collector if it qualifies for top-K.
 func (c *TopKCollector) Collect(docID uint32, score float32) {
+	doc := ScoredDoc{DocID: docID, Score: score, Segment: c.segment}
+	if c.after != nil && !c.after.Before(doc) {
+		return
+	}
 	if c.h.Len() < c.k {
-		heap.Push(&c.h, ScoredDoc{DocID: docID, Score: score})
+		heap.Push(&c.h, doc)
 		if c.h.Len() == c.k {
 			c.minScore = c.h[0].Score
 		}
-	} else if score > c.minScore {
-		c.h[0] = ScoredDoc{DocID: docID, Score: score}
+	} else if doc.Before(c.h[0]) {
+		c.h[0] = doc
 		heap.Fix(&c.h, 0)
 		c.minScore = c.h[0].Score
 	}
@@ -51,7 +85,8 @@ func (c *TopKCollector) Len() int {
 	return c.h.Len()
 }
 
-// Results returns the collected documents sorted descending by score.
+// Results returns the collected documents sorted descending by score, with
+// ties in segment and doc ID order.
 func (c *TopKCollector) Results() []ScoredDoc {
 	result := make([]ScoredDoc, c.h.Len())
 	for i := len(result) - 1; i >= 0; i-- {
@@ -60,11 +95,11 @@ func (c *TopKCollector) Results() []ScoredDoc {
 	return result
 }
 
-// scoreHeap is a min-heap of ScoredDoc ordered by score.
+// scoreHeap is a heap of ScoredDoc with the lowest-ranked document on top.
 type scoreHeap []ScoredDoc
 
 func (h scoreHeap) Len() int            { return len(h) }
-func (h scoreHeap) Less(i, j int) bool   { return h[i].Score < h[j].Score }
+func (h scoreHeap) Less(i, j int) bool   { return h[j].Before(h[i]) }
 func (h scoreHeap) Swap(i, j int)        { h[i], h[j] = h[j], h[i] }
 func (h *scoreHeap) Push(x any)          { *h = append(*h, x.(ScoredDoc)) }
 func (h *scoreHeap) Pop() any {
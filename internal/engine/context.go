@@ -11,6 +11,9 @@ var (
 	ErrMatchLimitExceeded = errors.New("term match limit exceeded")
 )
 
+// DefaultQueryTimeout is the query deadline used when none is configured.
+const DefaultQueryTimeout = 30 * time.Second
+
 // ExecutionContext tracks execution limits and timeout for a query.
 type ExecutionContext struct {
 	Deadline time.Time
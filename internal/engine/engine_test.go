@@ -1,8 +1,20 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"GoSearch/internal/automaton"
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+	"GoSearch/internal/query"
 )
 
 // --- PostingsIterator Tests ---
@@ -265,6 +277,35 @@ func TestTopKCollector_MinScore(t *testing.T) {
 	}
 }
 
+func TestTopKCollector_TieBreak(t *testing.T) {
+	c := NewTopKCollector(3)
+	c.SetSegment(1)
+	c.Collect(4, 1.0)
+	c.Collect(2, 1.0)
+	c.SetSegment(0)
+	c.Collect(9, 1.0)
+	c.Collect(7, 1.0)
+
+	want := []ScoredDoc{{DocID: 7, Score: 1}, {DocID: 9, Score: 1}, {DocID: 2, Score: 1, Segment: 1}}
+	if got := c.Results(); !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %v, want %v", got, want)
+	}
+}
+
+func TestTopKCollector_After(t *testing.T) {
+	c := NewTopKCollectorAfter(10, ScoredDoc{DocID: 2, Score: 2.0})
+	for doc, score := range []float32{3.0, 2.0, 2.0, 2.0, 1.0} {
+		c.Collect(uint32(doc), score)
+	}
+	var docs []uint32
+	for _, r := range c.Results() {
+		docs = append(docs, r.DocID)
+	}
+	if want := []uint32{3, 4}; !reflect.DeepEqual(docs, want) {
+		t.Errorf("docs = %v, want %v", docs, want)
+	}
+}
+
 // --- ExecutionContext Tests ---
 
 func TestExecutionContext_StateLimitExceeded(t *testing.T) {
@@ -305,3 +346,960 @@ func TestExecutionContext_Timeout(t *testing.T) {
 		t.Errorf("expected ErrQueryTimeout, got %v", err)
 	}
 }
+
+// --- Searcher Tests ---
+
+// memSegment is an in-memory Segment for searcher tests.
+type memSegment struct {
+	maxDoc   uint32
+	postings map[string]map[string]*Postings
+}
+
+func newMemSegment() *memSegment {
+	return &memSegment{postings: make(map[string]map[string]*Postings)}
+}
+
+func (s *memSegment) add(field, term string, doc uint32) {
+	if s.postings[field] == nil {
+		s.postings[field] = make(map[string]*Postings)
+	}
+	p := s.postings[field][term]
+	if p == nil {
+		p = &Postings{}
+		s.postings[field][term] = p
+	}
+	if n := len(p.DocIDs); n > 0 && p.DocIDs[n-1] == doc {
+		p.Freqs[n-1]++
+	} else {
+		p.DocIDs = append(p.DocIDs, doc)
+		p.Freqs = append(p.Freqs, 1)
+	}
+	if doc >= s.maxDoc {
+		s.maxDoc = doc + 1
+	}
+}
+
+// addText indexes the words of text along with their positions.
+func (s *memSegment) addText(field string, doc uint32, text string) {
+	for pos, term := range strings.Fields(text) {
+		s.add(field, term, doc)
+		p := s.postings[field][term]
+		for len(p.Positions) < len(p.DocIDs) {
+			p.Positions = append(p.Positions, nil)
+		}
+		last := len(p.DocIDs) - 1
+		p.Positions[last] = append(p.Positions[last], uint32(pos))
+	}
+}
+
+func (s *memSegment) addNumber(field string, doc uint32, v int64) {
+	for _, term := range numeric.Terms(v) {
+		s.add(field, term, doc)
+	}
+}
+
+func (s *memSegment) MaxDoc() uint32        { return s.maxDoc }
+func (s *memSegment) DocCount() int         { return int(s.maxDoc) }
+func (s *memSegment) AvgDocLength() float32 { return 100 }
+
+func (s *memSegment) Terms(field string) []string {
+	var terms []string
+	for term := range s.postings[field] {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+func (s *memSegment) Postings(field, term string) *Postings {
+	return s.postings[field][term]
+}
+
+func (s *memSegment) DocValues() *docvalues.Segment { return nil }
+
+func searcherSchema() *index.Schema {
+	return &index.Schema{Fields: []index.FieldDef{
+		{Name: "title", Type: index.FieldTypeText, Indexed: true},
+		{Name: "tag", Type: index.FieldTypeKeyword, Indexed: true},
+		{Name: "price", Type: index.FieldTypeLong, Indexed: true},
+	}}
+}
+
+func testSegmentForSearch() *memSegment {
+	seg := newMemSegment()
+	titles := []string{"search engine", "search tutorial search", "database", "searching", "engine"}
+	tags := []string{"go", "rust", "go", "java", "c"}
+	prices := []int64{10, 25, 50, -5, 100}
+	for doc, title := range titles {
+		for _, term := range strings.Fields(title) {
+			seg.add("title", term, uint32(doc))
+		}
+		seg.add("tag", tags[doc], uint32(doc))
+		seg.addNumber("price", uint32(doc), prices[doc])
+	}
+	return seg
+}
+
+func searchDocs(t *testing.T, q query.Query) []uint32 {
+	t.Helper()
+	s := NewSearcher(searcherSchema(), []Segment{testSegmentForSearch()}, nil)
+	top, err := s.Search(q, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.TotalHits != len(top.Docs) {
+		t.Errorf("TotalHits = %d, collected %d", top.TotalHits, len(top.Docs))
+	}
+	docs := make([]uint32, len(top.Docs))
+	for i, d := range top.Docs {
+		docs[i] = d.DocID
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i] < docs[j] })
+	return docs
+}
+
+func TestSearcher_Queries(t *testing.T) {
+	term := func(field, value string) query.Query { return &query.TermQuery{Field: field, Term: value} }
+	tests := []struct {
+		name string
+		q    query.Query
+		want []uint32
+	}{
+		{"term", term("title", "search"), []uint32{0, 1}},
+		{"term missing", term("title", "nothing"), []uint32{}},
+		{"numeric term", term("price", "25"), []uint32{1}},
+		{"prefix", &query.PrefixQuery{Field: "title", Prefix: "search"}, []uint32{0, 1, 3}},
+		{"wildcard", &query.WildcardQuery{Field: "title", Pattern: "*ine"}, []uint32{0, 4}},
+		{"regex", &query.RegexQuery{Field: "title", Pattern: "search(ing)?"}, []uint32{0, 1, 3}},
+		{"regex whole term", &query.RegexQuery{Field: "title", Pattern: "eng"}, []uint32{}},
+		{"fuzzy", &query.FuzzyQuery{Field: "title", Term: "engin", MaxDistance: 1}, []uint32{0, 4}},
+		{"range inclusive", &query.RangeQuery{Field: "price", Lower: float64(10), Upper: float64(50), IncludeLower: true, IncludeUpper: true}, []uint32{0, 1, 2}},
+		{"range exclusive", &query.RangeQuery{Field: "price", Lower: float64(10), Upper: float64(50)}, []uint32{1}},
+		{"range unbounded", &query.RangeQuery{Field: "price", Upper: float64(0), IncludeUpper: true}, []uint32{3}},
+		{"keyword range", &query.RangeQuery{Field: "tag", Lower: "go", Upper: "java", IncludeLower: true}, []uint32{0, 2}},
+		{"match all", &query.MatchAllQuery{}, []uint32{0, 1, 2, 3, 4}},
+		{"match none", &query.MatchNoneQuery{}, []uint32{}},
+		{"must", &query.BooleanQuery{Clauses: []query.BooleanClause{
+			{Occur: query.BooleanMust, Query: term("title", "search")},
+			{Occur: query.BooleanMust, Query: term("tag", "go")},
+		}}, []uint32{0}},
+		{"should", &query.BooleanQuery{Clauses: []query.BooleanClause{
+			{Occur: query.BooleanShould, Query: term("tag", "go")},
+			{Occur: query.BooleanShould, Query: term("tag", "java")},
+		}}, []uint32{0, 2, 3}},
+		{"minimum should match", &query.BooleanQuery{MinimumShouldMatch: 2, Clauses: []query.BooleanClause{
+			{Occur: query.BooleanShould, Query: term("title", "search")},
+			{Occur: query.BooleanShould, Query: term("title", "engine")},
+			{Occur: query.BooleanShould, Query: term("tag", "go")},
+		}}, []uint32{0}},
+		{"must with optional should", &query.BooleanQuery{Clauses: []query.BooleanClause{
+			{Occur: query.BooleanMust, Query: term("title", "search")},
+			{Occur: query.BooleanShould, Query: term("tag", "rust")},
+		}}, []uint32{0, 1}},
+		{"must not", &query.BooleanQuery{Clauses: []query.BooleanClause{
+			{Occur: query.BooleanMust, Query: &query.PrefixQuery{Field: "title", Prefix: "search"}},
+			{Occur: query.BooleanMustNot, Query: &query.RangeQuery{Field: "price", Upper: float64(20), IncludeUpper: true}},
+		}}, []uint32{1}},
+		{"pure negative", &query.BooleanQuery{Clauses: []query.BooleanClause{
+			{Occur: query.BooleanMustNot, Query: term("tag", "go")},
+		}}, []uint32{1, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := searchDocs(t, tt.q)
+			if len(got) != len(tt.want) {
+				t.Fatalf("docs = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("docs = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSearcher_ScoringAndExplain(t *testing.T) {
+	seg := testSegmentForSearch()
+	s := NewSearcher(searcherSchema(), []Segment{seg, seg}, nil)
+	q := &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanShould, Query: &query.TermQuery{Field: "title", Term: "search"}},
+		{Occur: query.BooleanShould, Query: &query.TermQuery{Field: "title", Term: "tutorial", Boost: 2}},
+	}}
+	top, err := s.Search(q, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.TotalHits != 4 {
+		t.Fatalf("TotalHits = %d, want 4 across two segments", top.TotalHits)
+	}
+	// Doc 1 matches both clauses and ranks first in either segment.
+	if top.Docs[0].DocID != 1 {
+		t.Errorf("top doc = %d, want 1", top.Docs[0].DocID)
+	}
+	segments := map[int]bool{}
+	for _, d := range top.Docs {
+		segments[d.Segment] = true
+	}
+	if len(segments) != 2 {
+		t.Errorf("hits should come from both segments, got %v", segments)
+	}
+
+	e, err := s.Explain(q, top.Docs[0].Segment, top.Docs[0].DocID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(e.Value-top.Docs[0].Score)) > 1e-6 {
+		t.Errorf("explanation value %f != score %f", e.Value, top.Docs[0].Score)
+	}
+	if len(e.Details) != 2 {
+		t.Errorf("expected 2 explanation details, got %d", len(e.Details))
+	}
+
+	e, err = s.Explain(q, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value != 0 {
+		t.Errorf("non-matching doc explanation value = %f", e.Value)
+	}
+}
+
+func TestSearcher_Phrase(t *testing.T) {
+	schema := &index.Schema{Fields: []index.FieldDef{
+		{Name: "body", Type: index.FieldTypeText, Indexed: true, Positions: true},
+		{Name: "title", Type: index.FieldTypeText, Indexed: true},
+	}}
+	seg := newMemSegment()
+	bodies := []string{
+		"the quick brown fox",
+		"quick fox brown",
+		"brown quick fox quick fox",
+		"fox quick",
+		"war of the worlds",
+		"to be or not to be",
+	}
+	for doc, body := range bodies {
+		seg.addText("body", uint32(doc), body)
+		seg.add("title", "x", uint32(doc))
+	}
+	s := NewSearcher(schema, []Segment{seg}, nil)
+	phrase := func(slop int, terms ...string) *query.PhraseQuery {
+		return &query.PhraseQuery{Field: "body", Terms: terms, Slop: slop}
+	}
+	proximity := func(slop int, terms ...string) *query.ProximityQuery {
+		return &query.ProximityQuery{Field: "body", Terms: terms, Slop: slop}
+	}
+
+	tests := []struct {
+		name string
+		q    query.Query
+		want []uint32
+	}{
+		{"exact", phrase(0, "quick", "fox"), []uint32{2, 1}},
+		{"three terms", phrase(0, "quick", "brown", "fox"), []uint32{0}},
+		{"missing term", phrase(0, "quick", "dog"), nil},
+		{"slop", phrase(1, "quick", "fox"), []uint32{2, 0, 1}},
+		{"slop reversed", phrase(2, "quick", "fox"), []uint32{2, 0, 1, 3}},
+		{"gaps", &query.PhraseQuery{Field: "body", Terms: []string{"war", "worlds"}, Positions: []int{0, 3}}, []uint32{4}},
+		{"repeated term", phrase(0, "to", "be"), []uint32{5}},
+		{"repeated term once", phrase(1, "fox", "fox"), []uint32{2}},
+		{"proximity", proximity(0, "fox", "quick"), []uint32{2, 1, 3}},
+		{"proximity slop", proximity(1, "fox", "quick"), []uint32{2, 0, 1, 3}},
+		{"proximity three terms", proximity(0, "fox", "brown", "quick"), []uint32{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			top, err := s.Search(tt.q, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint32
+			for _, d := range top.Docs {
+				got = append(got, d.DocID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("docs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	top, err := s.Search(phrase(0, "quick", "fox"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := s.Explain(phrase(0, "quick", "fox"), 0, top.Docs[0].DocID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(e.Value-top.Docs[0].Score)) > 1e-6 {
+		t.Errorf("explanation value %f != score %f", e.Value, top.Docs[0].Score)
+	}
+
+	e, err = s.Explain(proximity(1, "fox", "quick"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value <= 0 || !strings.Contains(e.Description, `"fox quick"~1`) {
+		t.Errorf("unexpected proximity explanation %+v", e)
+	}
+
+	for _, q := range []query.Query{
+		&query.PhraseQuery{Field: "title", Terms: []string{"x", "x"}},
+		&query.ProximityQuery{Field: "title", Terms: []string{"x", "x"}},
+	} {
+		if _, err := s.Search(q, 10); !errors.Is(err, ErrUnsupportedQuery) {
+			t.Errorf("expected ErrUnsupportedQuery for a field without positions, got %v", err)
+		}
+	}
+}
+
+func TestSearcher_DisMaxAndBlended(t *testing.T) {
+	s := NewSearcher(searcherSchema(), []Segment{testSegmentForSearch()}, nil)
+	scores := func(q query.Query) map[uint32]float32 {
+		t.Helper()
+		top, err := s.Search(q, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(map[uint32]float32)
+		for _, d := range top.Docs {
+			out[d.DocID] = d.Score
+		}
+		return out
+	}
+	search := scores(&query.TermQuery{Field: "title", Term: "search"})
+	engine := scores(&query.TermQuery{Field: "title", Term: "engine"})
+
+	dismax := &query.DisMaxQuery{Queries: []query.Query{
+		&query.TermQuery{Field: "title", Term: "search"},
+		&query.TermQuery{Field: "title", Term: "engine"},
+	}, TieBreaker: 0.5}
+	got := scores(dismax)
+	if len(got) != 3 {
+		t.Fatalf("dis_max matched %v, want docs 0, 1 and 4", got)
+	}
+	best, other := max(search[0], engine[0]), min(search[0], engine[0])
+	if math.Abs(float64(got[0]-(best+0.5*other))) > 1e-6 {
+		t.Errorf("dis_max score = %f, want %f", got[0], best+0.5*other)
+	}
+	if got[4] != engine[4] {
+		t.Errorf("single-match dis_max score = %f, want %f", got[4], engine[4])
+	}
+	e, err := s.Explain(dismax, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(e.Value-got[0])) > 1e-6 || len(e.Details) != 2 {
+		t.Errorf("explanation = %+v, want value %f with 2 details", e, got[0])
+	}
+
+	// "go" is in one doc of title and three of tag: blended, title takes
+	// the larger document frequency of tag.
+	seg := newMemSegment()
+	seg.add("title", "go", 0)
+	seg.add("tag", "go", 1)
+	seg.add("tag", "go", 2)
+	seg.add("tag", "go", 3)
+	s = NewSearcher(searcherSchema(), []Segment{seg}, nil)
+	blended := scores(&query.BlendedTermQuery{Terms: []query.TermQuery{
+		{Field: "title", Term: "go"},
+		{Field: "tag", Term: "go"},
+	}})
+	if len(blended) != 4 {
+		t.Fatalf("blended matched %v, want 4 docs", blended)
+	}
+	for doc, score := range blended {
+		if score != blended[1] {
+			t.Errorf("doc %d score = %f, want the shared score %f", doc, score, blended[1])
+		}
+	}
+	if plain := scores(&query.TermQuery{Field: "title", Term: "go"}); plain[0] <= blended[0] {
+		t.Errorf("unblended rare term score %f should exceed blended %f", plain[0], blended[0])
+	}
+}
+
+func TestSearcher_ConstantScore(t *testing.T) {
+	s := NewSearcher(searcherSchema(), []Segment{testSegmentForSearch()}, nil)
+	q := &query.ConstantScoreQuery{Filter: &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanShould, Query: &query.TermQuery{Field: "title", Term: "search"}},
+		{Occur: query.BooleanShould, Query: &query.TermQuery{Field: "tag", Term: "java"}},
+	}}, Boost: 2.5}
+	top, err := s.Search(q, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.TotalHits != 3 {
+		t.Fatalf("TotalHits = %d, want 3", top.TotalHits)
+	}
+	for _, d := range top.Docs {
+		if d.Score != 2.5 {
+			t.Errorf("doc %d score = %f, want 2.5", d.DocID, d.Score)
+		}
+	}
+
+	e, err := s.Explain(q, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value != 2.5 || len(e.Details) != 1 || e.Details[0].Value <= 0 {
+		t.Errorf("explanation = %+v, want 2.5 with the filter's explanation", e)
+	}
+
+	if docs := searchDocs(t, &query.ConstantScoreQuery{Filter: &query.TermQuery{Field: "title", Term: "missing"}}); len(docs) != 0 {
+		t.Errorf("constant score of no matches matched %v", docs)
+	}
+	if _, err := s.Search(&query.ConstantScoreQuery{Filter: &query.MatchQuery{Field: "title", Text: "x"}}, 10); !errors.Is(err, ErrUnsupportedQuery) {
+		t.Errorf("expected ErrUnsupportedQuery for an unanalyzed filter, got %v", err)
+	}
+}
+
+func TestSearcher_SearchAfterPagesThroughAllHits(t *testing.T) {
+	seg := testSegmentForSearch()
+	s := NewSearcher(searcherSchema(), []Segment{seg, seg}, nil)
+	q := &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanShould, Query: &query.PrefixQuery{Field: "title", Prefix: "search"}},
+		{Occur: query.BooleanShould, Query: &query.TermQuery{Field: "tag", Term: "go"}},
+	}}
+	all, err := s.Search(q, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paged []ScoredDoc
+	top, err := s.Search(q, 2)
+	for err == nil && len(top.Docs) > 0 {
+		if top.TotalHits != all.TotalHits {
+			t.Errorf("TotalHits = %d, want %d on every page", top.TotalHits, all.TotalHits)
+		}
+		paged = append(paged, top.Docs...)
+		top, err = s.SearchAfter(q, 2, top.Docs[len(top.Docs)-1])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paged, all.Docs) {
+		t.Errorf("paged = %v\nwant    %v", paged, all.Docs)
+	}
+}
+
+// deletingSegment hides some documents of a memSegment.
+type deletingSegment struct {
+	*memSegment
+	deleted map[uint32]bool
+}
+
+func (s deletingSegment) IsDeleted(docID uint32) bool { return s.deleted[docID] }
+
+func TestSearcher_SkipsDeletedDocs(t *testing.T) {
+	seg := deletingSegment{testSegmentForSearch(), map[uint32]bool{1: true, 4: true}}
+	s := NewSearcher(searcherSchema(), []Segment{seg}, nil)
+	top, err := s.Search(&query.MatchAllQuery{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.TotalHits != 3 || len(top.Docs) != 3 {
+		t.Fatalf("TotalHits = %d, docs = %v", top.TotalHits, top.Docs)
+	}
+	for _, d := range top.Docs {
+		if seg.deleted[d.DocID] {
+			t.Errorf("deleted doc %d matched", d.DocID)
+		}
+	}
+}
+
+// identifiedSegment gives a segment an ID, making its filters cacheable.
+type identifiedSegment struct {
+	deletingSegment
+	id string
+}
+
+func (s identifiedSegment) ID() string { return s.id }
+
+func TestSearcher_Filter(t *testing.T) {
+	s := NewSearcher(searcherSchema(), []Segment{testSegmentForSearch()}, nil)
+	search := &query.TermQuery{Field: "title", Term: "search"}
+	goTag := &query.TermQuery{Field: "tag", Term: "go"}
+	scores := func(q query.Query) map[uint32]float32 {
+		t.Helper()
+		top, err := s.Search(q, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(map[uint32]float32)
+		for _, d := range top.Docs {
+			out[d.DocID] = d.Score
+		}
+		return out
+	}
+
+	plain := scores(search)
+	filtered := scores(&query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanMust, Query: search},
+		{Occur: query.BooleanFilter, Query: goTag},
+	}})
+	if len(filtered) != 1 || filtered[0] != plain[0] {
+		t.Errorf("filtered = %v, want doc 0 scored %f as without the filter", filtered, plain[0])
+	}
+
+	// A filter makes should clauses optional, as a must clause does.
+	optional := scores(&query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanFilter, Query: goTag},
+		{Occur: query.BooleanShould, Query: search},
+	}})
+	if len(optional) != 2 || optional[0] != plain[0] || optional[2] != 0 {
+		t.Errorf("filter with should = %v, want doc 0 scored %f and doc 2 scored 0", optional, plain[0])
+	}
+
+	none := scores(&query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanMust, Query: search},
+		{Occur: query.BooleanFilter, Query: &query.TermQuery{Field: "tag", Term: "missing"}},
+	}})
+	if len(none) != 0 {
+		t.Errorf("filter without matches matched %v", none)
+	}
+}
+
+func TestSearcher_FilterCache(t *testing.T) {
+	cache := NewFilterCache(1 << 20)
+	q := &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanFilter, Query: &query.TermQuery{Field: "tag", Term: "go"}},
+	}}
+	search := func(seg Segment) []uint32 {
+		t.Helper()
+		s := NewSearcher(searcherSchema(), []Segment{seg}, nil)
+		s.SetFilterCache(cache)
+		top, err := s.Search(q, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var docs []uint32
+		for _, d := range top.Docs {
+			docs = append(docs, d.DocID)
+		}
+		sort.Slice(docs, func(i, j int) bool { return docs[i] < docs[j] })
+		return docs
+	}
+
+	seg := identifiedSegment{deletingSegment{testSegmentForSearch(), nil}, "seg_1"}
+	if docs := search(seg); !reflect.DeepEqual(docs, []uint32{0, 2}) {
+		t.Fatalf("first search = %v, want [0 2]", docs)
+	}
+	if docs := search(seg); !reflect.DeepEqual(docs, []uint32{0, 2}) {
+		t.Fatalf("cached search = %v, want [0 2]", docs)
+	}
+	if st := cache.Stats(); st.Entries != 1 || st.Hits != 1 || st.Misses != 1 {
+		t.Errorf("stats = %+v, want 1 entry, 1 hit and 1 miss", st)
+	}
+
+	// Deletions apply on top of the cached set.
+	seg.deleted = map[uint32]bool{0: true}
+	if docs := search(seg); !reflect.DeepEqual(docs, []uint32{2}) {
+		t.Errorf("search with deletion = %v, want [2]", docs)
+	}
+	if st := cache.Stats(); st.Hits != 2 {
+		t.Errorf("hits = %d, want 2", st.Hits)
+	}
+
+	// Segments without an ID are not cached.
+	search(testSegmentForSearch())
+	if st := cache.Stats(); st.Entries != 1 || st.Misses != 1 {
+		t.Errorf("stats = %+v after searching an unidentified segment", st)
+	}
+
+	cache.DropSegment("seg_1")
+	if st := cache.Stats(); st.Entries != 0 || st.MemoryBytes != 0 {
+		t.Errorf("stats = %+v after dropping the segment", st)
+	}
+}
+
+func TestFilterCache_Evicts(t *testing.T) {
+	one := &docSet{bits: make([]uint64, 1), count: 1}
+	size := one.sizeBytes() + int64(len("s")+len("a")) + filterCacheEntryOverhead
+	cache := NewFilterCache(2 * size)
+	cache.put("s", "a", one)
+	cache.put("s", "b", one)
+	cache.get("s", "a")
+	cache.put("s", "c", one)
+	if _, ok := cache.get("s", "b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if _, ok := cache.get("s", "a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+	if st := cache.Stats(); st.Entries != 2 || st.Evictions != 1 || st.MemoryBytes != 2*size {
+		t.Errorf("stats = %+v, want 2 entries of %d bytes and 1 eviction", st, size)
+	}
+
+	// A set larger than the whole cache is not cached.
+	cache.put("s", "d", &docSet{bits: make([]uint64, 64), count: 1})
+	if st := cache.Stats(); st.Entries != 2 || st.Evictions != 1 {
+		t.Errorf("stats = %+v after an oversized put", st)
+	}
+}
+
+func TestBitSetIterator(t *testing.T) {
+	b := newDocSetBuilder(300)
+	b.add([]uint32{200, 0, 64, 63, 64})
+	it := b.docSet().iterator()
+	if it.Cost() != 4 {
+		t.Errorf("Cost() = %d, want 4", it.Cost())
+	}
+	var docs []uint32
+	for it.Next() {
+		docs = append(docs, it.DocID())
+	}
+	if !reflect.DeepEqual(docs, []uint32{0, 63, 64, 200}) {
+		t.Errorf("docs = %v, want [0 63 64 200]", docs)
+	}
+
+	it = b.docSet().iterator()
+	if !it.Advance(65) || it.DocID() != 200 {
+		t.Errorf("Advance(65) = %d, want 200", it.DocID())
+	}
+	if !it.Advance(100) || it.DocID() != 200 {
+		t.Errorf("Advance(100) moved past the current document to %d", it.DocID())
+	}
+	if it.Advance(201) || it.Next() {
+		t.Error("iterator not exhausted after its last document")
+	}
+	if (&docSet{}).iterator().Next() {
+		t.Error("empty set has a document")
+	}
+}
+
+// docValuesSegment adds doc values to a test segment.
+type docValuesSegment struct {
+	*memSegment
+	dv *docvalues.Segment
+}
+
+func (s docValuesSegment) DocValues() *docvalues.Segment { return s.dv }
+
+// functionScoreSearcher searches testSegmentForSearch with doc values: likes
+// (10, 0, 100, -, 3), published (origin, origin-10d, origin+20d,
+// {origin-30d, origin+5d}, -) and the tag of each document.
+func functionScoreSearcher(t *testing.T) (*Searcher, int64) {
+	t.Helper()
+	schema := searcherSchema()
+	schema.Fields = append(schema.Fields,
+		index.FieldDef{Name: "likes", Type: index.FieldTypeLong, DocValues: true},
+		index.FieldDef{Name: "rating", Type: index.FieldTypeDouble, DocValues: true},
+		index.FieldDef{Name: "published", Type: index.FieldTypeDate, DocValues: true},
+		index.FieldDef{Name: "label", Type: index.FieldTypeKeyword, DocValues: true},
+		index.FieldDef{Name: "stock", Type: index.FieldTypeLong, Indexed: true},
+	)
+	origin, err := numeric.ParseDate("2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := int64(24 * time.Hour / time.Millisecond)
+	b := docvalues.NewBuilder()
+	for doc, v := range map[uint32]int64{0: 10, 1: 0, 2: 100, 4: 3} {
+		b.AddNumeric("likes", doc, v)
+	}
+	b.AddNumeric("rating", 0, numeric.DoubleToSortable(6.25))
+	for doc, v := range map[uint32]int64{0: origin, 1: origin - 10*day, 2: origin + 20*day, 3: origin - 30*day} {
+		b.AddNumeric("published", doc, v)
+	}
+	b.AddNumeric("published", 3, origin+5*day)
+	for doc, label := range []string{"go", "rust", "go", "java", "c"} {
+		b.AddSortedSet("label", uint32(doc), label)
+	}
+	seg := testSegmentForSearch()
+	return NewSearcher(schema, []Segment{docValuesSegment{seg, b.Build(seg.MaxDoc())}}, nil), origin
+}
+
+func searchScores(t *testing.T, s *Searcher, q query.Query) map[uint32]float32 {
+	t.Helper()
+	top, err := s.Search(q, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := make(map[uint32]float32, len(top.Docs))
+	for _, d := range top.Docs {
+		scores[d.DocID] = d.Score
+	}
+	return scores
+}
+
+func TestSearcher_FunctionScore(t *testing.T) {
+	s, origin := functionScoreSearcher(t)
+	missing := 0.0
+	replace := func(fns ...query.ScoreFunction) query.Query {
+		return &query.FunctionScoreQuery{Functions: fns, BoostMode: query.CombineReplace}
+	}
+	fvf := func(field string, factor float64, modifier string) query.ScoreFunction {
+		return query.ScoreFunction{FieldValueFactor: &query.FieldValueFactor{Field: field, Factor: factor, Modifier: modifier}}
+	}
+	decay := func(shape string, offset interface{}) query.ScoreFunction {
+		return query.ScoreFunction{Decay: &query.DecayFunction{Shape: shape, Field: "published", Origin: numeric.FormatDate(origin), Scale: "10d", Offset: offset}}
+	}
+	withFilter := func(f query.ScoreFunction, filter query.Query, weight float32) query.ScoreFunction {
+		f.Filter, f.Weight = filter, weight
+		return f
+	}
+	constant := &query.ConstantScoreQuery{Filter: &query.MatchAllQuery{}, Boost: 2}
+
+	tests := []struct {
+		name string
+		q    query.Query
+		want map[uint32]float64
+	}{
+		{"log1p", replace(fvf("likes", 1, query.ModifierLog1p)),
+			map[uint32]float64{0: math.Log10(11), 1: 0, 2: math.Log10(101), 3: 1, 4: math.Log10(4)}},
+		{"factor and missing", replace(query.ScoreFunction{FieldValueFactor: &query.FieldValueFactor{Field: "likes", Factor: 2, Missing: &missing}}),
+			map[uint32]float64{0: 20, 1: 0, 2: 200, 3: 0, 4: 6}},
+		{"ln of zero scores zero", replace(fvf("likes", 1, query.ModifierLn)),
+			map[uint32]float64{0: math.Log(10), 1: 0, 2: math.Log(100), 3: 1, 4: math.Log(3)}},
+		{"double values", replace(fvf("rating", 1, query.ModifierSqrt)),
+			map[uint32]float64{0: 2.5, 1: 1, 2: 1, 3: 1, 4: 1}},
+		{"gauss", replace(decay(query.DecayGauss, nil)),
+			map[uint32]float64{0: 1, 1: 0.5, 2: 0.0625, 3: math.Pow(0.5, 0.25), 4: 1}},
+		{"exp", replace(decay(query.DecayExp, nil)),
+			map[uint32]float64{0: 1, 1: 0.5, 2: 0.25, 3: math.Pow(0.5, 0.5), 4: 1}},
+		{"linear", replace(decay(query.DecayLinear, nil)),
+			map[uint32]float64{0: 1, 1: 0.5, 2: 0, 3: 0.75, 4: 1}},
+		{"offset", replace(decay(query.DecayLinear, "5d")),
+			map[uint32]float64{0: 1, 1: 0.75, 2: 0.25, 3: 1, 4: 1}},
+		{"filtered weight", replace(withFilter(query.ScoreFunction{}, &query.TermQuery{Field: "tag", Term: "go"}, 3)),
+			map[uint32]float64{0: 3, 1: 1, 2: 3, 3: 1, 4: 1}},
+		{"query", &query.FunctionScoreQuery{Query: &query.TermQuery{Field: "tag", Term: "go"}, Functions: []query.ScoreFunction{{Weight: 3}}, BoostMode: query.CombineReplace},
+			map[uint32]float64{0: 3, 2: 3}},
+	}
+	// Weighted values: 2 * likes where a document has them, and 4.
+	for mode, want := range map[string]map[uint32]float64{
+		query.CombineMultiply: {0: 80, 1: 0, 2: 800, 3: 4, 4: 24},
+		query.CombineSum:      {0: 24, 1: 4, 2: 204, 3: 4, 4: 10},
+		query.CombineAvg:      {0: 4, 1: 4.0 / 6, 2: 34, 3: 1, 4: 10.0 / 6},
+		query.CombineFirst:    {0: 20, 1: 0, 2: 200, 3: 4, 4: 6},
+		query.CombineMax:      {0: 20, 1: 4, 2: 200, 3: 4, 4: 6},
+		query.CombineMin:      {0: 4, 1: 0, 2: 4, 3: 4, 4: 4},
+	} {
+		q := replace(withFilter(fvf("likes", 1, ""), nil, 2), query.ScoreFunction{Weight: 4})
+		q.(*query.FunctionScoreQuery).ScoreMode = mode
+		tests = append(tests, struct {
+			name string
+			q    query.Query
+			want map[uint32]float64
+		}{"score_mode " + mode, q, want})
+	}
+	for _, mode := range []struct {
+		mode string
+		want float64
+	}{
+		{query.CombineMultiply, 12}, {query.CombineReplace, 6}, {query.CombineSum, 10},
+		{query.CombineAvg, 5}, {query.CombineMax, 6}, {query.CombineMin, 4},
+	} {
+		q := &query.FunctionScoreQuery{Query: constant, Functions: []query.ScoreFunction{{Weight: 3}}, BoostMode: mode.mode, Boost: 2}
+		tests = append(tests, struct {
+			name string
+			q    query.Query
+			want map[uint32]float64
+		}{"boost_mode " + mode.mode, q, map[uint32]float64{0: mode.want, 1: mode.want, 2: mode.want, 3: mode.want, 4: mode.want}})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores := searchScores(t, s, tt.q)
+			if len(scores) != len(tt.want) {
+				t.Fatalf("scores = %v, want %v", scores, tt.want)
+			}
+			for doc, want := range tt.want {
+				if got, ok := scores[doc]; !ok || math.Abs(float64(got)-want) > 1e-4 {
+					t.Errorf("doc %d score = %v, want %v", doc, got, want)
+				}
+				e, err := s.Explain(tt.q, 0, doc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if e.Value != scores[doc] {
+					t.Errorf("doc %d explanation = %v, want %v", doc, e.Value, scores[doc])
+				}
+			}
+		})
+	}
+}
+
+func TestSearcher_FunctionScoreRandom(t *testing.T) {
+	s, _ := functionScoreSearcher(t)
+	random := func(seed int64, field string) query.Query {
+		return &query.FunctionScoreQuery{
+			Functions: []query.ScoreFunction{{RandomScore: &query.RandomScore{Seed: seed, Field: field}}},
+			BoostMode: query.CombineReplace,
+		}
+	}
+	first := searchScores(t, s, random(42, ""))
+	if again := searchScores(t, s, random(42, "")); !reflect.DeepEqual(first, again) {
+		t.Errorf("seed 42 scored %v, then %v", first, again)
+	}
+	for doc, score := range first {
+		if score < 0 || score >= 1 {
+			t.Errorf("doc %d score = %v, want within [0, 1)", doc, score)
+		}
+	}
+	if other := searchScores(t, s, random(7, "")); reflect.DeepEqual(first, other) {
+		t.Errorf("seeds 42 and 7 both scored %v", first)
+	}
+
+	// Documents with the same label score alike.
+	byLabel := searchScores(t, s, random(42, "label"))
+	if byLabel[0] != byLabel[2] || byLabel[0] == byLabel[1] {
+		t.Errorf("random scores by label = %v, want docs 0 and 2 alike", byLabel)
+	}
+}
+
+func TestSearcher_FunctionScoreExplain(t *testing.T) {
+	s, _ := functionScoreSearcher(t)
+	q := &query.FunctionScoreQuery{
+		Query: &query.TermQuery{Field: "title", Term: "search"},
+		Functions: []query.ScoreFunction{
+			{FieldValueFactor: &query.FieldValueFactor{Field: "likes", Factor: 1, Modifier: query.ModifierLog1p}, Weight: 2},
+			{Filter: &query.TermQuery{Field: "tag", Term: "rust"}, Weight: 5},
+		},
+		ScoreMode: query.CombineSum,
+	}
+	plain, err := s.Explain(&query.TermQuery{Field: "title", Term: "search"}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := s.Explain(q, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := plain.Value * float32(2*math.Log10(11))
+	if math.Abs(float64(e.Value-want)) > 1e-4 || len(e.Details) != 2 {
+		t.Fatalf("explanation = %+v, want %v from the query and functions", e, want)
+	}
+	if e.Details[0].Value != plain.Value {
+		t.Errorf("query explanation = %v, want %v", e.Details[0].Value, plain.Value)
+	}
+	functions := e.Details[1]
+	if len(functions.Details) != 1 || !strings.Contains(functions.Details[0].Details[0].Description, "log1p(1 * likes=10)") {
+		t.Errorf("functions explanation = %+v, want the weighted field value factor only", functions)
+	}
+
+	e, err = s.Explain(q, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Details[1]; len(got.Details) != 2 || got.Value != 5 {
+		t.Errorf("functions explanation = %+v, want both functions summing to 5", got)
+	}
+}
+
+func TestSearcher_FunctionScoreErrors(t *testing.T) {
+	s, _ := functionScoreSearcher(t)
+	for _, fn := range []query.ScoreFunction{
+		{FieldValueFactor: &query.FieldValueFactor{Field: "title", Factor: 1}},
+		{FieldValueFactor: &query.FieldValueFactor{Field: "stock", Factor: 1}},
+		{FieldValueFactor: &query.FieldValueFactor{Field: "likes", Factor: 1, Modifier: "cube"}},
+		{Decay: &query.DecayFunction{Shape: query.DecayGauss, Field: "likes", Scale: 10}},
+		{Decay: &query.DecayFunction{Shape: query.DecayGauss, Field: "likes", Origin: 0, Scale: 0}},
+		{Decay: &query.DecayFunction{Shape: query.DecayGauss, Field: "published", Scale: "10y"}},
+		{Decay: &query.DecayFunction{Shape: query.DecayExp, Field: "published", Scale: "1d", Offset: -1}},
+		{Decay: &query.DecayFunction{Shape: "cosine", Field: "likes", Origin: 0, Scale: 1}},
+		{RandomScore: &query.RandomScore{Field: "missing"}},
+		{RandomScore: &query.RandomScore{Field: "tag"}},
+	} {
+		q := &query.FunctionScoreQuery{Query: &query.MatchNoneQuery{}, Functions: []query.ScoreFunction{fn}}
+		if _, err := s.Search(q, 10); !errors.Is(err, query.ErrInvalidQuery) {
+			t.Errorf("%+v: expected ErrInvalidQuery, got %v", fn, err)
+		}
+	}
+	q := &query.FunctionScoreQuery{Functions: []query.ScoreFunction{{Weight: 2}}, ScoreMode: query.CombineReplace}
+	if _, err := s.Search(q, 10); !errors.Is(err, query.ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery for score_mode replace, got %v", err)
+	}
+}
+
+func TestSearcher_Scan(t *testing.T) {
+	seg := testSegmentForSearch()
+	deleting := deletingSegment{testSegmentForSearch(), map[uint32]bool{0: true}}
+	s := NewSearcher(searcherSchema(), []Segment{seg, deleting}, nil)
+	q := &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanShould, Query: &query.PrefixQuery{Field: "title", Prefix: "search"}},
+		{Occur: query.BooleanShould, Query: &query.TermQuery{Field: "tag", Term: "c"}},
+	}}
+	scan := func(startSeg int, startDoc uint32) [][2]int {
+		var got [][2]int
+		if err := s.Scan(q, startSeg, startDoc, func(seg int, doc uint32) error {
+			got = append(got, [2]int{seg, int(doc)})
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	tests := []struct {
+		startSeg int
+		startDoc uint32
+		want     [][2]int
+	}{
+		{0, 0, [][2]int{{0, 0}, {0, 1}, {0, 3}, {0, 4}, {1, 1}, {1, 3}, {1, 4}}},
+		{0, 2, [][2]int{{0, 3}, {0, 4}, {1, 1}, {1, 3}, {1, 4}}},
+		{1, 2, [][2]int{{1, 3}, {1, 4}}},
+		{2, 0, nil},
+	}
+	for _, tt := range tests {
+		if got := scan(tt.startSeg, tt.startDoc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Scan from (%d, %d) = %v, want %v", tt.startSeg, tt.startDoc, got, tt.want)
+		}
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err := s.Scan(q, 0, 0, func(int, uint32) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("Scan returned %v after %d documents, want stop after 1", err, n)
+	}
+}
+
+func TestSearcher_Errors(t *testing.T) {
+	s := NewSearcher(searcherSchema(), []Segment{testSegmentForSearch()}, nil)
+	tests := []struct {
+		name string
+		q    query.Query
+		want error
+	}{
+		{"bad numeric term", &query.TermQuery{Field: "price", Term: "cheap"}, query.ErrInvalidQuery},
+		{"bad numeric bound", &query.RangeQuery{Field: "price", Lower: "cheap"}, query.ErrInvalidQuery},
+		{"prefix on numeric", &query.PrefixQuery{Field: "price", Prefix: "1"}, ErrUnsupportedQuery},
+		{"bad regex", &query.RegexQuery{Field: "title", Pattern: "se[a-"}, query.ErrInvalidQuery},
+		{"anchored regex", &query.RegexQuery{Field: "title", Pattern: "^se.*"}, query.ErrInvalidQuery},
+		{"regex on numeric", &query.RegexQuery{Field: "price", Pattern: "1.*"}, ErrUnsupportedQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Search(tt.q, 10); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	limited := NewSearcher(searcherSchema(), []Segment{testSegmentForSearch()}, NewExecutionContext(time.Minute, 10000, 2))
+	if _, err := limited.Search(&query.PrefixQuery{Field: "title"}, 10); !errors.Is(err, ErrMatchLimitExceeded) {
+		t.Errorf("expected ErrMatchLimitExceeded, got %v", err)
+	}
+}
+
+func TestIntersectTerms_SkipsDeadPrefixes(t *testing.T) {
+	terms := []string{"apple", "application", "apply", "banana", "band", "bandana", "can"}
+	a := automaton.NewPrefixAutomaton([]byte("band"))
+	ctx := NewExecutionContext(time.Minute, 10000, 1000)
+	matched, err := IntersectTerms(a, terms, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 2 || matched[0] != "band" || matched[1] != "bandana" {
+		t.Errorf("matched = %v", matched)
+	}
+	// "apple" dies on its first byte, so the other "a" terms are skipped.
+	if ctx.StatesVisited > 12 {
+		t.Errorf("visited %d states, expected dead prefixes to be skipped", ctx.StatesVisited)
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+
+	"GoSearch/internal/automaton"
+)
+
+// IntersectTerms returns the terms accepted by the automaton. terms must be
+// sorted: automaton states are reused across the prefix shared with the
+// previous term, and once a prefix reaches a state that cannot match, every
+// following term with that prefix is skipped without being stepped.
+func IntersectTerms(a automaton.Automaton, terms []string, ctx *ExecutionContext) ([]string, error) {
+	var matched []string
+	// states[i] is the state after the first i bytes of prev.
+	states := []automaton.State{a.Start()}
+	prev := ""
+
+	for i := 0; i < len(terms); i++ {
+		term := terms[i]
+		common := commonPrefixLen(prev, term)
+		if common > len(states)-1 {
+			common = len(states) - 1
+		}
+		states = states[:common+1]
+		prev = term
+
+		deadAt := -1
+		for j := common; j < len(term); j++ {
+			ctx.StatesVisited++
+			next := a.Step(states[j], term[j])
+			if next == automaton.DeadState || !a.CanMatch(next) {
+				deadAt = j
+				break
+			}
+			states = append(states, next)
+		}
+
+		if deadAt >= 0 {
+			dead := term[:deadAt+1]
+			rest := terms[i+1:]
+			i += sort.Search(len(rest), func(k int) bool {
+				return !strings.HasPrefix(rest[k], dead)
+			})
+		} else if a.IsAccept(states[len(term)]) {
+			matched = append(matched, term)
+			ctx.TermsMatched++
+		}
+
+		if err := ctx.CheckLimits(); err != nil {
+			return nil, err
+		}
+	}
+	return matched, nil
+}
+
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
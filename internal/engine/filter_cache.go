@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"container/list"
+	"sync"
+)
+
+// FilterCache is an LRU cache of the documents matching filter clauses,
+// per segment, bounded by the memory of their bitsets. Entries are keyed
+// by segment ID and canonical filter. Segments are immutable, so an entry
+// stays valid for as long as its segment exists; deletions are not part of
+// the cached sets but applied when matches are collected. A FilterCache is
+// safe for concurrent use.
+type FilterCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	lru      *list.List // of *filterCacheEntry, most recently used first
+	entries  map[filterCacheKey]*list.Element
+
+	hits, misses, evictions int64
+}
+
+type filterCacheKey struct {
+	segment string
+	filter  string
+}
+
+type filterCacheEntry struct {
+	key  filterCacheKey
+	docs *docSet
+	size int64
+}
+
+// filterCacheEntryOverhead approximates the memory of an entry besides its
+// bitset and key, so that empty sets are not free to cache.
+const filterCacheEntryOverhead = 128
+
+// FilterCacheStats reports the state of a FilterCache.
+type FilterCacheStats struct {
+	Entries     int   `json:"entries"`
+	MemoryBytes int64 `json:"memory_bytes"`
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`
+}
+
+// NewFilterCache creates a cache holding bitsets of up to maxBytes in all.
+func NewFilterCache(maxBytes int64) *FilterCache {
+	return &FilterCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[filterCacheKey]*list.Element),
+	}
+}
+
+func (c *FilterCache) get(segment, filter string) (*docSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[filterCacheKey{segment, filter}]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return el.Value.(*filterCacheEntry).docs, true
+}
+
+func (c *FilterCache) put(segment, filter string, docs *docSet) {
+	size := docs.sizeBytes() + int64(len(segment)+len(filter)) + filterCacheEntryOverhead
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := filterCacheKey{segment, filter}
+	if el, ok := c.entries[key]; ok {
+		// Another search computed the same set concurrently.
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&filterCacheEntry{key: key, docs: docs, size: size})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *FilterCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*filterCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// DropSegment removes the entries of a segment that no longer exists.
+func (c *FilterCache) DropSegment(segment string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*filterCacheEntry).key.segment == segment {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+// Stats returns the cache's current size and counters.
+func (c *FilterCache) Stats() FilterCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return FilterCacheStats{
+		Entries:     c.lru.Len(),
+		MemoryBytes: c.bytes,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+	}
+}
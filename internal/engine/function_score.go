@@ -0,0 +1,595 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+	"GoSearch/internal/query"
+	"GoSearch/internal/scoring"
+)
+
+// functionScoreScorer rescores the documents of a query with score
+// functions evaluated on their doc values.
+type functionScoreScorer struct {
+	Scorer
+	functions []*scoreFunction
+	scoreMode string
+	boostMode string
+	boost     float32
+}
+
+func (s *functionScoreScorer) Score() float32 {
+	value, _ := s.functionValue(s.DocID(), false)
+	return combineBoost(s.boostMode, s.Scorer.Score(), value) * s.boost
+}
+
+func (s *functionScoreScorer) Explain() scoring.Explanation {
+	sub := s.Scorer.Explain()
+	value, details := s.functionValue(s.DocID(), true)
+	functions := scoring.Explanation{
+		Description: fmt.Sprintf("functions, score_mode %s:", modeOrDefault(s.scoreMode)),
+		Value:       float32(value),
+		Details:     details,
+	}
+	if len(details) == 0 {
+		functions.Description = "no function applied, default value"
+	}
+	e := scoring.Explanation{
+		Description: fmt.Sprintf("function score, boost_mode %s:", modeOrDefault(s.boostMode)),
+		Value:       combineBoost(s.boostMode, sub.Value, value) * s.boost,
+		Details:     []scoring.Explanation{sub, functions},
+	}
+	if s.boost != 1 {
+		e.Details = append(e.Details, scoring.Explanation{Description: "boost", Value: s.boost})
+	}
+	return e
+}
+
+// functionValue combines the weighted values of the functions that apply
+// to a document by the score mode, or returns 1 if none does. With explain
+// set, it also returns an explanation of each applied function.
+func (s *functionScoreScorer) functionValue(doc uint32, explain bool) (float64, []scoring.Explanation) {
+	var details []scoring.Explanation
+	var result, weights float64
+	applied := 0
+	for _, f := range s.functions {
+		v, ok := f.value(doc)
+		if !ok {
+			continue
+		}
+		if explain {
+			details = append(details, f.explain(doc, v))
+		}
+		v *= f.weight
+		applied++
+		switch {
+		case applied == 1:
+			result = v
+		case s.scoreMode == query.CombineSum || s.scoreMode == query.CombineAvg:
+			result += v
+		case s.scoreMode == query.CombineMax:
+			result = math.Max(result, v)
+		case s.scoreMode == query.CombineMin:
+			result = math.Min(result, v)
+		default:
+			result *= v
+		}
+		weights += f.weight
+		if s.scoreMode == query.CombineFirst {
+			break
+		}
+	}
+	if applied == 0 {
+		return 1, nil
+	}
+	if s.scoreMode == query.CombineAvg {
+		result /= weights
+	}
+	return clampScore(result), details
+}
+
+// combineBoost combines a query score with a function value.
+func combineBoost(mode string, score float32, value float64) float32 {
+	q := float64(score)
+	switch mode {
+	case query.CombineReplace:
+		q = value
+	case query.CombineSum:
+		q += value
+	case query.CombineAvg:
+		q = (q + value) / 2
+	case query.CombineMax:
+		q = math.Max(q, value)
+	case query.CombineMin:
+		q = math.Min(q, value)
+	default:
+		q *= value
+	}
+	return float32(clampScore(q))
+}
+
+func modeOrDefault(mode string) string {
+	if mode == "" {
+		return query.CombineMultiply
+	}
+	return mode
+}
+
+// clampScore maps a function result onto a valid score: negative and
+// undefined values, such as the log of zero, become 0 and values too large
+// for a score become the largest one.
+func clampScore(v float64) float64 {
+	switch {
+	case !(v > 0):
+		return 0
+	case v > math.MaxFloat32:
+		return math.MaxFloat32
+	}
+	return v
+}
+
+// scoreFunction is a score function prepared for one segment.
+type scoreFunction struct {
+	filter       PostingsIterator // nil applies to every document
+	filterDone   bool
+	filterActive bool
+	weight       float64
+	source       functionSource // nil has the value 1, scaled by weight
+}
+
+// functionSource computes a score function's value from doc values.
+type functionSource interface {
+	// value returns the value for a document and whether it has one.
+	value(doc uint32) (float64, bool)
+	// explain describes how a document's value was computed.
+	explain(doc uint32, value float64) scoring.Explanation
+}
+
+// value returns the unweighted value of the function for a document and
+// whether the function applies to it. Documents must be passed in
+// ascending order.
+func (f *scoreFunction) value(doc uint32) (float64, bool) {
+	if !f.matches(doc) {
+		return 0, false
+	}
+	if f.source == nil {
+		return 1, true
+	}
+	return f.source.value(doc)
+}
+
+func (f *scoreFunction) matches(doc uint32) bool {
+	if f.filter == nil {
+		return true
+	}
+	if f.filterDone {
+		return false
+	}
+	if !f.filterActive || f.filter.DocID() < doc {
+		f.filterActive = true
+		if !f.filter.Advance(doc) {
+			f.filterDone = true
+			return false
+		}
+	}
+	return f.filter.DocID() == doc
+}
+
+func (f *scoreFunction) explain(doc uint32, value float64) scoring.Explanation {
+	if f.source == nil {
+		return scoring.Explanation{Description: "weight", Value: float32(f.weight)}
+	}
+	e := f.source.explain(doc, value)
+	if f.weight == 1 {
+		return e
+	}
+	return scoring.Explanation{
+		Description: "weighted function, product of:",
+		Value:       float32(value * f.weight),
+		Details:     []scoring.Explanation{e, {Description: "weight", Value: float32(f.weight)}},
+	}
+}
+
+func (b *scorerBuilder) functionScoreQuery(q *query.FunctionScoreQuery) (Scorer, error) {
+	switch q.ScoreMode {
+	case "", query.CombineMultiply, query.CombineSum, query.CombineAvg, query.CombineFirst, query.CombineMax, query.CombineMin:
+	default:
+		return nil, fmt.Errorf("%w: unknown score_mode %q", query.ErrInvalidQuery, q.ScoreMode)
+	}
+	switch q.BoostMode {
+	case "", query.CombineMultiply, query.CombineReplace, query.CombineSum, query.CombineAvg, query.CombineMax, query.CombineMin:
+	default:
+		return nil, fmt.Errorf("%w: unknown boost_mode %q", query.ErrInvalidQuery, q.BoostMode)
+	}
+
+	var sub Scorer
+	if q.Query == nil {
+		sub = newMatchAllScorer(b.seg.MaxDoc(), 1)
+	} else {
+		var err error
+		if sub, err = b.build(q.Query); err != nil {
+			return nil, err
+		}
+	}
+	s := &functionScoreScorer{
+		Scorer:    sub,
+		scoreMode: q.ScoreMode,
+		boostMode: q.BoostMode,
+		boost:     boostOrDefault(q.Boost),
+	}
+	// Function sources are prepared even when nothing matches, so that
+	// invalid functions are reported whatever the segment holds.
+	functions := make([]*scoreFunction, len(q.Functions))
+	for i := range q.Functions {
+		var err error
+		if functions[i], err = b.scoreFunction(&q.Functions[i]); err != nil {
+			return nil, err
+		}
+	}
+	if sub == nil {
+		return nil, nil
+	}
+	for i, fn := range q.Functions {
+		if fn.Filter != nil {
+			filter, err := b.filter(fn.Filter)
+			if err != nil {
+				return nil, err
+			}
+			if filter == nil {
+				continue
+			}
+			functions[i].filter = filter
+		}
+		s.functions = append(s.functions, functions[i])
+	}
+	return s, nil
+}
+
+// scoreFunction prepares a function for the segment, without its filter.
+func (b *scorerBuilder) scoreFunction(fn *query.ScoreFunction) (*scoreFunction, error) {
+	f := &scoreFunction{weight: float64(boostOrDefault(fn.Weight))}
+	var err error
+	switch {
+	case fn.FieldValueFactor != nil:
+		f.source, err = b.fieldValueFactor(fn.FieldValueFactor)
+	case fn.Decay != nil:
+		f.source, err = b.decayFunction(fn.Decay)
+	case fn.RandomScore != nil:
+		f.source, err = b.randomScore(fn.RandomScore)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// numericDocValues looks up the doc values of a numeric field read by a
+// score function. The column is nil if the segment has no values for it.
+func (b *scorerBuilder) numericDocValues(field string) (numeric.Kind, *docvalues.NumericField, error) {
+	kind, ok := b.numericKind(field)
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: score function field %q is not numeric", query.ErrInvalidQuery, field)
+	}
+	if !b.schema.Field(field).DocValues {
+		return 0, nil, fmt.Errorf("%w: field %q does not have doc_values enabled", query.ErrInvalidQuery, field)
+	}
+	var values *docvalues.NumericField
+	if dv := b.seg.DocValues(); dv != nil {
+		values = dv.NumericField(field)
+	}
+	return kind, values, nil
+}
+
+// docValue decodes a sortable doc value into a number.
+func docValue(kind numeric.Kind, v int64) float64 {
+	if kind == numeric.KindDouble {
+		return numeric.SortableToDouble(v)
+	}
+	return float64(v)
+}
+
+// formatValue renders a field value or origin for an explanation.
+func formatValue(kind numeric.Kind, v float64) string {
+	if kind == numeric.KindDate {
+		return numeric.FormatDate(int64(v))
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type fieldValueFactor struct {
+	field    string
+	kind     numeric.Kind
+	values   *docvalues.NumericField
+	factor   float64
+	modifier string
+	missing  *float64
+}
+
+func (b *scorerBuilder) fieldValueFactor(q *query.FieldValueFactor) (functionSource, error) {
+	kind, values, err := b.numericDocValues(q.Field)
+	if err != nil {
+		return nil, err
+	}
+	switch q.Modifier {
+	case "", query.ModifierNone, query.ModifierLog, query.ModifierLog1p, query.ModifierLog2p, query.ModifierLn,
+		query.ModifierLn1p, query.ModifierLn2p, query.ModifierSquare, query.ModifierSqrt, query.ModifierReciprocal:
+	default:
+		return nil, fmt.Errorf("%w: unknown field_value_factor modifier %q", query.ErrInvalidQuery, q.Modifier)
+	}
+	modifier := q.Modifier
+	if modifier == "" {
+		modifier = query.ModifierNone
+	}
+	return &fieldValueFactor{
+		field:    q.Field,
+		kind:     kind,
+		values:   values,
+		factor:   q.Factor,
+		modifier: modifier,
+		missing:  q.Missing,
+	}, nil
+}
+
+// fieldValue returns the first value of the document, or the missing value.
+func (f *fieldValueFactor) fieldValue(doc uint32) (float64, bool) {
+	if f.values != nil {
+		if vs := f.values.Values(doc); len(vs) > 0 {
+			return docValue(f.kind, vs[0]), true
+		}
+	}
+	if f.missing != nil {
+		return *f.missing, true
+	}
+	return 0, false
+}
+
+func (f *fieldValueFactor) value(doc uint32) (float64, bool) {
+	v, ok := f.fieldValue(doc)
+	if !ok {
+		return 0, false
+	}
+	return clampScore(applyModifier(f.modifier, f.factor*v)), true
+}
+
+func applyModifier(modifier string, v float64) float64 {
+	switch modifier {
+	case query.ModifierLog:
+		return math.Log10(v)
+	case query.ModifierLog1p:
+		return math.Log10(v + 1)
+	case query.ModifierLog2p:
+		return math.Log10(v + 2)
+	case query.ModifierLn:
+		return math.Log(v)
+	case query.ModifierLn1p:
+		return math.Log1p(v)
+	case query.ModifierLn2p:
+		return math.Log(v + 2)
+	case query.ModifierSquare:
+		return v * v
+	case query.ModifierSqrt:
+		return math.Sqrt(v)
+	case query.ModifierReciprocal:
+		return 1 / v
+	default:
+		return v
+	}
+}
+
+func (f *fieldValueFactor) explain(doc uint32, value float64) scoring.Explanation {
+	v, _ := f.fieldValue(doc)
+	source := fmt.Sprintf("%s=%s", f.field, formatValue(f.kind, v))
+	if f.values == nil || len(f.values.Values(doc)) == 0 {
+		source = fmt.Sprintf("%s missing, using %g", f.field, v)
+	}
+	return scoring.Explanation{
+		Description: fmt.Sprintf("field value factor, %s(%g * %s)", f.modifier, f.factor, source),
+		Value:       float32(value),
+	}
+}
+
+type decayFunction struct {
+	shape  string
+	field  string
+	kind   numeric.Kind
+	values *docvalues.NumericField
+	origin float64
+	scale  float64
+	offset float64
+	decay  float64
+}
+
+func (b *scorerBuilder) decayFunction(q *query.DecayFunction) (functionSource, error) {
+	switch q.Shape {
+	case query.DecayGauss, query.DecayExp, query.DecayLinear:
+	default:
+		return nil, fmt.Errorf("%w: unknown decay function %q", query.ErrInvalidQuery, q.Shape)
+	}
+	kind, values, err := b.numericDocValues(q.Field)
+	if err != nil {
+		return nil, err
+	}
+	f := &decayFunction{shape: q.Shape, field: q.Field, kind: kind, values: values, decay: q.Decay}
+	if f.decay == 0 {
+		f.decay = 0.5
+	}
+	if !(f.decay > 0 && f.decay < 1) {
+		return nil, fmt.Errorf("%w: %s function decay must be between 0 and 1", query.ErrInvalidQuery, q.Shape)
+	}
+
+	if f.origin, err = decayOrigin(kind, q.Origin); err != nil {
+		return nil, fmt.Errorf("%w: %s function on field %q: origin: %v", query.ErrInvalidQuery, q.Shape, q.Field, err)
+	}
+	if f.scale, err = decayDistance(kind, q.Scale); err != nil || !(f.scale > 0) || math.IsInf(f.scale, 0) {
+		return nil, fmt.Errorf("%w: %s function on field %q: scale must be a positive distance", query.ErrInvalidQuery, q.Shape, q.Field)
+	}
+	if q.Offset != nil {
+		if f.offset, err = decayDistance(kind, q.Offset); err != nil || f.offset < 0 || math.IsInf(f.offset, 0) {
+			return nil, fmt.Errorf("%w: %s function on field %q: offset must be a non-negative distance", query.ErrInvalidQuery, q.Shape, q.Field)
+		}
+	}
+	return f, nil
+}
+
+// decayOrigin reads the origin of a decay function. Dates accept "now",
+// which is also their default.
+func decayOrigin(kind numeric.Kind, v interface{}) (float64, error) {
+	if kind != numeric.KindDate {
+		if v == nil {
+			return 0, errors.New("required")
+		}
+		return numeric.ParseDouble(v)
+	}
+	if s, ok := v.(string); v == nil || ok && strings.TrimSpace(s) == "now" {
+		return float64(time.Now().UnixMilli()), nil
+	}
+	ms, err := numeric.ParseDate(v)
+	return float64(ms), err
+}
+
+// decayDistance reads the scale or offset of a decay function. On date
+// fields, it is a duration such as "7d" or milliseconds.
+func decayDistance(kind numeric.Kind, v interface{}) (float64, error) {
+	if s, ok := v.(string); ok && kind == numeric.KindDate {
+		if ms, err := numeric.ParseDuration(strings.TrimSpace(s)); err == nil {
+			return float64(ms), nil
+		}
+	}
+	return numeric.ParseDouble(v)
+}
+
+// closest returns the document's value nearest to the origin.
+func (f *decayFunction) closest(doc uint32) (float64, bool) {
+	if f.values == nil {
+		return 0, false
+	}
+	vs := f.values.Values(doc)
+	if len(vs) == 0 {
+		return 0, false
+	}
+	best := docValue(f.kind, vs[0])
+	for _, raw := range vs[1:] {
+		if v := docValue(f.kind, raw); math.Abs(v-f.origin) < math.Abs(best-f.origin) {
+			best = v
+		}
+	}
+	return best, true
+}
+
+func (f *decayFunction) value(doc uint32) (float64, bool) {
+	v, ok := f.closest(doc)
+	if !ok {
+		return 0, false
+	}
+	d := math.Max(0, math.Abs(v-f.origin)-f.offset)
+	switch f.shape {
+	case query.DecayGauss:
+		return math.Exp(d * d * math.Log(f.decay) / (f.scale * f.scale)), true
+	case query.DecayExp:
+		return math.Exp(d * math.Log(f.decay) / f.scale), true
+	default:
+		s := f.scale / (1 - f.decay)
+		return math.Max(0, (s-d)/s), true
+	}
+}
+
+func (f *decayFunction) explain(doc uint32, value float64) scoring.Explanation {
+	v, _ := f.closest(doc)
+	distance := func(d float64) string { return strconv.FormatFloat(d, 'g', -1, 64) }
+	if f.kind == numeric.KindDate {
+		distance = func(d float64) string { return strconv.FormatFloat(d, 'g', -1, 64) + "ms" }
+	}
+	return scoring.Explanation{
+		Description: fmt.Sprintf("%s decay, %s=%s from origin %s, scale %s, offset %s, decay %g",
+			f.shape, f.field, formatValue(f.kind, v), formatValue(f.kind, f.origin),
+			distance(f.scale), distance(f.offset), f.decay),
+		Value: float32(value),
+	}
+}
+
+type randomScore struct {
+	seed    int64
+	field   string
+	segment string
+	numbers *docvalues.NumericField
+	terms   *docvalues.SortedSetField
+}
+
+func (b *scorerBuilder) randomScore(q *query.RandomScore) (functionSource, error) {
+	r := &randomScore{seed: q.Seed, field: q.Field}
+	if q.Field == "" {
+		// Segment IDs keep values stable for a segment's documents while
+		// documents elsewhere in the index change.
+		if seg, ok := b.seg.(IdentifiedSegment); ok {
+			r.segment = seg.ID()
+		}
+		return r, nil
+	}
+	var f *index.FieldDef
+	if b.schema != nil {
+		f = b.schema.Field(q.Field)
+	}
+	switch {
+	case f == nil:
+		return nil, fmt.Errorf("%w: unknown random_score field %q", query.ErrInvalidQuery, q.Field)
+	case !f.DocValues:
+		return nil, fmt.Errorf("%w: field %q does not have doc_values enabled", query.ErrInvalidQuery, q.Field)
+	}
+	if dv := b.seg.DocValues(); dv != nil {
+		if _, ok := b.numericKind(q.Field); ok {
+			r.numbers = dv.NumericField(q.Field)
+		} else {
+			r.terms = dv.SortedSetField(q.Field)
+		}
+	}
+	return r, nil
+}
+
+func (r *randomScore) value(doc uint32) (float64, bool) {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(r.seed))
+	h.Write(buf[:])
+	switch {
+	case r.field == "":
+		h.Write([]byte(r.segment))
+		binary.LittleEndian.PutUint64(buf[:], uint64(doc))
+		h.Write(buf[:])
+	case r.numbers != nil && len(r.numbers.Values(doc)) > 0:
+		binary.LittleEndian.PutUint64(buf[:], uint64(r.numbers.Values(doc)[0]))
+		h.Write(buf[:])
+	case r.terms != nil && len(r.terms.Ords(doc)) > 0:
+		h.Write([]byte(r.terms.LookupOrd(r.terms.Ords(doc)[0])))
+	default:
+		return 0, false
+	}
+	return float64(mix64(h.Sum64())>>11) / (1 << 53), true
+}
+
+// mix64 spreads the bits of a hash, as FNV leaves its high bits poorly
+// mixed for short inputs.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (r *randomScore) explain(doc uint32, value float64) scoring.Explanation {
+	description := fmt.Sprintf("random score, seed %d", r.seed)
+	if r.field != "" {
+		description += fmt.Sprintf(", field %s", r.field)
+	}
+	return scoring.Explanation{Description: description, Value: float32(value)}
+}
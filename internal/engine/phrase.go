@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"GoSearch/internal/scoring"
+)
+
+// phraseTerm is one term of a phrase, at offset positions after the first.
+type phraseTerm struct {
+	term      string
+	offset    int
+	docFreq   int64
+	postings  *SlicePostingsIterator
+	positions [][]uint32
+
+	// current holds the positions of the term in the current document and
+	// next the index of the first one not yet consumed.
+	current []uint32
+	next    int
+}
+
+// phraseScorer matches documents in which the terms of a phrase occur at
+// their relative offsets, moved by at most slop positions in all. The
+// number of such occurrences is scored with BM25, using the sum of the
+// terms' IDFs.
+type phraseScorer struct {
+	*ConjunctionIterator
+	terms  []phraseTerm
+	slop   int
+	freq   uint32
+	field  string
+	phrase string
+	idf    float32
+	boost  float32
+	bm25   *scoring.BM25Scorer
+}
+
+func newPhraseScorer(field string, terms []phraseTerm, slop int, boost float32, bm25 *scoring.BM25Scorer) *phraseScorer {
+	children := make([]PostingsIterator, len(terms))
+	words := make([]string, len(terms))
+	var idf float32
+	for i := range terms {
+		children[i] = terms[i].postings
+		words[i] = terms[i].term
+		idf += bm25.IDF(terms[i].docFreq)
+	}
+	return &phraseScorer{
+		ConjunctionIterator: NewConjunctionIterator(children),
+		terms:               terms,
+		slop:                slop,
+		field:               field,
+		phrase:              fmt.Sprintf("%q", strings.Join(words, " ")),
+		idf:                 idf,
+		boost:               boost,
+		bm25:                bm25,
+	}
+}
+
+func (s *phraseScorer) Next() bool {
+	for s.ConjunctionIterator.Next() {
+		if s.freq = s.phraseFreq(); s.freq > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *phraseScorer) Advance(target uint32) bool {
+	if !s.ConjunctionIterator.Advance(target) {
+		return false
+	}
+	if s.freq = s.phraseFreq(); s.freq > 0 {
+		return true
+	}
+	return s.Next()
+}
+
+func (s *phraseScorer) Freq() uint32 { return s.freq }
+
+// phraseFreq counts the non-overlapping occurrences of the phrase in the
+// current document. Shifting each term's positions back by its offset, an
+// exact occurrence has every term at the same shifted position, and a
+// sloppy one has them within slop of each other.
+func (s *phraseScorer) phraseFreq() uint32 {
+	for i := range s.terms {
+		t := &s.terms[i]
+		if t.postings.pos >= len(t.positions) {
+			return 0
+		}
+		t.current, t.next = t.positions[t.postings.pos], 0
+	}
+	var freq uint32
+	for {
+		lowest, lo, hi := 0, 0, 0
+		for i := range s.terms {
+			t := &s.terms[i]
+			if t.next == len(t.current) {
+				return freq
+			}
+			p := int(t.current[t.next]) - t.offset
+			if i == 0 || p < lo {
+				lowest, lo = i, p
+			}
+			if i == 0 || p > hi {
+				hi = p
+			}
+		}
+		if hi-lo > s.slop {
+			s.terms[lowest].next++
+			continue
+		}
+		// A repeated term cannot fill two places with one occurrence.
+		if dup := s.duplicate(); dup >= 0 {
+			s.terms[dup].next++
+			continue
+		}
+		freq++
+		for i := range s.terms {
+			s.terms[i].next++
+		}
+	}
+}
+
+// duplicate returns a term that shares its current position with another
+// occurrence of the same term in the phrase, or -1.
+func (s *phraseScorer) duplicate() int {
+	for i := range s.terms {
+		for j := i + 1; j < len(s.terms); j++ {
+			a, b := &s.terms[i], &s.terms[j]
+			if a.term == b.term && a.current[a.next] == b.current[b.next] {
+				if a.offset > b.offset {
+					return i
+				}
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func (s *phraseScorer) Score() float32 {
+	return s.bm25.Score(s.freq, approxDocLength, s.idf) * s.boost
+}
+
+func (s *phraseScorer) Explain() scoring.Explanation {
+	e := s.bm25.Explain(s.field, s.phrase, s.freq, approxDocLength, 0)
+	// Replace the single-term IDF with the sum over the phrase's terms.
+	idf := scoring.Explanation{Description: "idf, sum of:", Value: s.idf}
+	for _, t := range s.terms {
+		idf.Details = append(idf.Details, scoring.Explanation{
+			Description: fmt.Sprintf("idf(%s, docFreq=%d, N=%d)", t.term, t.docFreq, s.bm25.DocCount),
+			Value:       s.bm25.IDF(t.docFreq),
+		})
+	}
+	e.Details[0] = idf
+	e.Value = s.bm25.Score(s.freq, approxDocLength, s.idf)
+	if s.boost != 1 {
+		e.Value *= s.boost
+		e.Details = append(e.Details, scoring.Explanation{Description: "boost", Value: s.boost})
+	}
+	return e
+}
@@ -0,0 +1,538 @@
+package engine
+
+import (
+	"container/heap"
+	"fmt"
+	mathbits "math/bits"
+
+	"GoSearch/internal/scoring"
+)
+
+// Scorer is a PostingsIterator that can score and explain the current document.
+type Scorer interface {
+	PostingsIterator
+
+	// Score returns the score of the current document.
+	Score() float32
+
+	// Explain returns a breakdown of the current document's score.
+	Explain() scoring.Explanation
+}
+
+// approxDocLength stands in for the field length of a document, which
+// segments do not record yet.
+const approxDocLength = 100
+
+// termScorer scores a single term's postings with BM25.
+type termScorer struct {
+	*SlicePostingsIterator
+	field   string
+	term    string
+	docFreq int64
+	idf     float32
+	boost   float32
+	bm25    *scoring.BM25Scorer
+}
+
+func newTermScorer(field, term string, p *Postings, boost float32, bm25 *scoring.BM25Scorer) *termScorer {
+	return &termScorer{
+		SlicePostingsIterator: p.Iterator(),
+		field:                 field,
+		term:                  term,
+		docFreq:               p.DocFreq(),
+		idf:                   bm25.IDF(p.DocFreq()),
+		boost:                 boost,
+		bm25:                  bm25,
+	}
+}
+
+func (s *termScorer) Score() float32 {
+	return s.bm25.Score(s.Freq(), approxDocLength, s.idf) * s.boost
+}
+
+func (s *termScorer) Explain() scoring.Explanation {
+	e := s.bm25.Explain(s.field, s.term, s.Freq(), approxDocLength, s.docFreq)
+	if s.boost != 1 {
+		e.Value *= s.boost
+		e.Details = append(e.Details, scoring.Explanation{Description: "boost", Value: s.boost})
+	}
+	return e
+}
+
+// constantScorer gives every matching document the same score.
+type constantScorer struct {
+	PostingsIterator
+	score       float32
+	description string
+}
+
+func (s *constantScorer) Score() float32 { return s.score }
+
+func (s *constantScorer) Explain() scoring.Explanation {
+	return scoring.Explanation{Description: s.description, Value: s.score}
+}
+
+// matchAllScorer matches every document in [0, maxDoc).
+type matchAllScorer struct {
+	maxDoc uint32
+	doc    int64
+	score  float32
+}
+
+func newMatchAllScorer(maxDoc uint32, score float32) *matchAllScorer {
+	return &matchAllScorer{maxDoc: maxDoc, doc: -1, score: score}
+}
+
+func (s *matchAllScorer) Next() bool {
+	s.doc++
+	return s.doc < int64(s.maxDoc)
+}
+
+func (s *matchAllScorer) DocID() uint32 { return uint32(s.doc) }
+func (s *matchAllScorer) Freq() uint32  { return 1 }
+
+func (s *matchAllScorer) Advance(target uint32) bool {
+	if s.doc < int64(target) {
+		s.doc = int64(target)
+	}
+	return s.doc < int64(s.maxDoc)
+}
+
+func (s *matchAllScorer) Cost() int64 {
+	if remaining := int64(s.maxDoc) - s.doc - 1; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (s *matchAllScorer) Score() float32 { return s.score }
+
+func (s *matchAllScorer) Explain() scoring.Explanation {
+	return scoring.Explanation{Description: "match_all", Value: s.score}
+}
+
+// conjunctionScorer matches documents matched by every sub-scorer and sums
+// their scores.
+type conjunctionScorer struct {
+	*ConjunctionIterator
+	subs []Scorer
+}
+
+func newConjunctionScorer(subs []Scorer) Scorer {
+	if len(subs) == 1 {
+		return subs[0]
+	}
+	children := make([]PostingsIterator, len(subs))
+	for i, s := range subs {
+		children[i] = s
+	}
+	return &conjunctionScorer{ConjunctionIterator: NewConjunctionIterator(children), subs: subs}
+}
+
+func (s *conjunctionScorer) Score() float32 {
+	var total float32
+	for _, sub := range s.subs {
+		total += sub.Score()
+	}
+	return total
+}
+
+func (s *conjunctionScorer) Explain() scoring.Explanation {
+	return sumExplanation(s.Score(), s.subs)
+}
+
+// disjunctionScorer matches documents matched by at least minMatch
+// sub-scorers and sums the scores of those that match. Unlike
+// DisjunctionIterator it tracks which sub-scorers are on the current
+// document, and Advance never moves past a current document >= target.
+type disjunctionScorer struct {
+	pending  scorerHeap // sub-scorers positioned after the current document
+	matching []Scorer   // sub-scorers positioned on the current document
+	current  uint32
+	minMatch int
+	cost     int64
+	started  bool
+	done     bool
+}
+
+func newDisjunctionScorer(subs []Scorer, minMatch int) Scorer {
+	if minMatch < 1 {
+		minMatch = 1
+	}
+	if len(subs) == 1 && minMatch == 1 {
+		return subs[0]
+	}
+	return newDisjunction(subs, minMatch)
+}
+
+func newDisjunction(subs []Scorer, minMatch int) *disjunctionScorer {
+	s := &disjunctionScorer{minMatch: minMatch}
+	// Unstarted sub-scorers are treated as matching so the first Next or
+	// Advance positions them.
+	s.matching = append(s.matching, subs...)
+	for _, sub := range subs {
+		s.cost += sub.Cost()
+	}
+	return s
+}
+
+func (s *disjunctionScorer) Next() bool {
+	if s.done {
+		return false
+	}
+	s.started = true
+	for _, sub := range s.matching {
+		if sub.Next() {
+			heap.Push(&s.pending, sub)
+		}
+	}
+	s.matching = s.matching[:0]
+	return s.gather()
+}
+
+func (s *disjunctionScorer) Advance(target uint32) bool {
+	if s.done {
+		return false
+	}
+	if s.started && s.current >= target {
+		return true
+	}
+	s.started = true
+	for _, sub := range s.matching {
+		if sub.Advance(target) {
+			heap.Push(&s.pending, sub)
+		}
+	}
+	s.matching = s.matching[:0]
+	for len(s.pending) > 0 && s.pending[0].DocID() < target {
+		if s.pending[0].Advance(target) {
+			heap.Fix(&s.pending, 0)
+		} else {
+			heap.Pop(&s.pending)
+		}
+	}
+	return s.gather()
+}
+
+// gather moves the sub-scorers on the lowest pending document into
+// matching, skipping documents matched by fewer than minMatch sub-scorers.
+func (s *disjunctionScorer) gather() bool {
+	for {
+		if len(s.pending) == 0 {
+			s.done = true
+			return false
+		}
+		doc := s.pending[0].DocID()
+		for len(s.pending) > 0 && s.pending[0].DocID() == doc {
+			s.matching = append(s.matching, heap.Pop(&s.pending).(Scorer))
+		}
+		if len(s.matching) >= s.minMatch {
+			s.current = doc
+			return true
+		}
+		for _, sub := range s.matching {
+			if sub.Next() {
+				heap.Push(&s.pending, sub)
+			}
+		}
+		s.matching = s.matching[:0]
+	}
+}
+
+func (s *disjunctionScorer) DocID() uint32 { return s.current }
+func (s *disjunctionScorer) Freq() uint32  { return uint32(len(s.matching)) }
+func (s *disjunctionScorer) Cost() int64   { return s.cost }
+
+func (s *disjunctionScorer) Score() float32 {
+	var total float32
+	for _, sub := range s.matching {
+		total += sub.Score()
+	}
+	return total
+}
+
+func (s *disjunctionScorer) Explain() scoring.Explanation {
+	return sumExplanation(s.Score(), s.matching)
+}
+
+// disMaxScorer matches documents matched by any sub-scorer and scores them
+// by the best sub-score plus tieBreaker times the sum of the others.
+type disMaxScorer struct {
+	*disjunctionScorer
+	tieBreaker float32
+	boost      float32
+}
+
+func newDisMaxScorer(subs []Scorer, tieBreaker, boost float32) Scorer {
+	if len(subs) == 1 && boost == 1 {
+		return subs[0]
+	}
+	return &disMaxScorer{disjunctionScorer: newDisjunction(subs, 1), tieBreaker: tieBreaker, boost: boost}
+}
+
+func (s *disMaxScorer) Score() float32 {
+	var best, total float32
+	for i, sub := range s.matching {
+		score := sub.Score()
+		total += score
+		if i == 0 || score > best {
+			best = score
+		}
+	}
+	return (best + s.tieBreaker*(total-best)) * s.boost
+}
+
+func (s *disMaxScorer) Explain() scoring.Explanation {
+	e := scoring.Explanation{
+		Description: fmt.Sprintf("max plus %g times others of:", s.tieBreaker),
+		Value:       s.Score(),
+	}
+	for _, sub := range s.matching {
+		e.Details = append(e.Details, sub.Explain())
+	}
+	if s.boost != 1 {
+		e.Details = append(e.Details, scoring.Explanation{Description: "boost", Value: s.boost})
+	}
+	return e
+}
+
+// constantScoreScorer matches the documents of its filter and gives each
+// the same score, ignoring the filter's own.
+type constantScoreScorer struct {
+	Scorer
+	score float32
+}
+
+func (s *constantScoreScorer) Score() float32 { return s.score }
+
+func (s *constantScoreScorer) Explain() scoring.Explanation {
+	filter := s.Scorer.Explain()
+	return scoring.Explanation{
+		Description: "constant score, filter matched:",
+		Value:       s.score,
+		Details:     []scoring.Explanation{filter},
+	}
+}
+
+// reqExclScorer matches documents of req that are not matched by excl.
+type reqExclScorer struct {
+	req      Scorer
+	excl     PostingsIterator
+	exclDone bool
+}
+
+func (s *reqExclScorer) Next() bool {
+	if !s.req.Next() {
+		return false
+	}
+	return s.skipExcluded()
+}
+
+func (s *reqExclScorer) Advance(target uint32) bool {
+	if !s.req.Advance(target) {
+		return false
+	}
+	return s.skipExcluded()
+}
+
+func (s *reqExclScorer) skipExcluded() bool {
+	for {
+		doc := s.req.DocID()
+		if s.exclDone || !s.excl.Advance(doc) {
+			s.exclDone = true
+			return true
+		}
+		if s.excl.DocID() != doc {
+			return true
+		}
+		if !s.req.Next() {
+			return false
+		}
+	}
+}
+
+func (s *reqExclScorer) DocID() uint32                { return s.req.DocID() }
+func (s *reqExclScorer) Freq() uint32                 { return s.req.Freq() }
+func (s *reqExclScorer) Cost() int64                  { return s.req.Cost() }
+func (s *reqExclScorer) Score() float32               { return s.req.Score() }
+func (s *reqExclScorer) Explain() scoring.Explanation { return s.req.Explain() }
+
+// reqOptScorer matches the documents of req and adds the score of opt
+// when opt also matches.
+type reqOptScorer struct {
+	req     Scorer
+	opt     Scorer
+	optDone bool
+}
+
+func (s *reqOptScorer) Next() bool                 { return s.req.Next() }
+func (s *reqOptScorer) Advance(target uint32) bool { return s.req.Advance(target) }
+func (s *reqOptScorer) DocID() uint32              { return s.req.DocID() }
+func (s *reqOptScorer) Freq() uint32               { return s.req.Freq() }
+func (s *reqOptScorer) Cost() int64                { return s.req.Cost() }
+
+func (s *reqOptScorer) optMatches() bool {
+	if s.optDone {
+		return false
+	}
+	doc := s.req.DocID()
+	if !s.opt.Advance(doc) {
+		s.optDone = true
+		return false
+	}
+	return s.opt.DocID() == doc
+}
+
+func (s *reqOptScorer) Score() float32 {
+	score := s.req.Score()
+	if s.optMatches() {
+		score += s.opt.Score()
+	}
+	return score
+}
+
+func (s *reqOptScorer) Explain() scoring.Explanation {
+	subs := []Scorer{s.req}
+	if s.optMatches() {
+		subs = append(subs, s.opt)
+	}
+	return sumExplanation(s.Score(), subs)
+}
+
+func sumExplanation(value float32, subs []Scorer) scoring.Explanation {
+	e := scoring.Explanation{Description: "sum of:", Value: value}
+	for _, sub := range subs {
+		e.Details = append(e.Details, sub.Explain())
+	}
+	return e
+}
+
+// docSetBuilder accumulates the union of several postings lists as a bitset,
+// for multi-term queries whose matches are scored as a constant.
+type docSetBuilder struct {
+	bits  []uint64
+	count int
+}
+
+func newDocSetBuilder(maxDoc uint32) *docSetBuilder {
+	return &docSetBuilder{bits: make([]uint64, (maxDoc+63)/64)}
+}
+
+func (b *docSetBuilder) add(docIDs []uint32) {
+	for _, doc := range docIDs {
+		b.addDoc(doc)
+	}
+}
+
+func (b *docSetBuilder) addDoc(doc uint32) {
+	word, bit := doc/64, uint64(1)<<(doc%64)
+	if int(word) >= len(b.bits) || b.bits[word]&bit != 0 {
+		return
+	}
+	b.bits[word] |= bit
+	b.count++
+}
+
+// docSet returns the accumulated documents. The builder must not be used
+// afterwards.
+func (b *docSetBuilder) docSet() *docSet {
+	if b.count == 0 {
+		return &docSet{}
+	}
+	return &docSet{bits: b.bits, count: b.count}
+}
+
+// scorer returns a constant scorer over the accumulated documents, or nil
+// if none were added.
+func (b *docSetBuilder) scorer(score float32, description string) Scorer {
+	if b.count == 0 {
+		return nil
+	}
+	docIDs := make([]uint32, 0, b.count)
+	for word, bits := range b.bits {
+		for bits != 0 {
+			bit := uint32(mathbits.TrailingZeros64(bits))
+			docIDs = append(docIDs, uint32(word)*64+bit)
+			bits &= bits - 1
+		}
+	}
+	return &constantScorer{
+		PostingsIterator: NewSlicePostingsIterator(docIDs, nil),
+		score:            score,
+		description:      fmt.Sprintf("%s, constant score", description),
+	}
+}
+
+// docSet is an immutable set of a segment's documents.
+type docSet struct {
+	bits  []uint64
+	count int
+}
+
+func (s *docSet) sizeBytes() int64 { return int64(len(s.bits)) * 8 }
+
+func (s *docSet) iterator() *bitSetIterator {
+	return &bitSetIterator{set: s, doc: -1}
+}
+
+// bitSetIterator iterates the documents of a docSet in ascending order.
+type bitSetIterator struct {
+	set  *docSet
+	doc  int64
+	done bool
+}
+
+func (it *bitSetIterator) Next() bool {
+	return it.seek(it.doc + 1)
+}
+
+func (it *bitSetIterator) DocID() uint32 { return uint32(it.doc) }
+
+func (it *bitSetIterator) Freq() uint32 { return 1 }
+
+func (it *bitSetIterator) Advance(target uint32) bool {
+	if it.done {
+		return false
+	}
+	if it.doc >= int64(target) {
+		return true
+	}
+	return it.seek(int64(target))
+}
+
+// seek moves to the first document at or after from.
+func (it *bitSetIterator) seek(from int64) bool {
+	word := from / 64
+	if it.done || word >= int64(len(it.set.bits)) {
+		it.done = true
+		return false
+	}
+	bits := it.set.bits[word] &^ (uint64(1)<<(from%64) - 1)
+	for bits == 0 {
+		word++
+		if word >= int64(len(it.set.bits)) {
+			it.done = true
+			return false
+		}
+		bits = it.set.bits[word]
+	}
+	it.doc = word*64 + int64(mathbits.TrailingZeros64(bits))
+	return true
+}
+
+func (it *bitSetIterator) Cost() int64 { return int64(it.set.count) }
+
+// scorerHeap is a min-heap of Scorers ordered by current DocID.
+type scorerHeap []Scorer
+
+func (h scorerHeap) Len() int           { return len(h) }
+func (h scorerHeap) Less(i, j int) bool { return h[i].DocID() < h[j].DocID() }
+func (h scorerHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *scorerHeap) Push(x any)        { *h = append(*h, x.(Scorer)) }
+func (h *scorerHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,654 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"GoSearch/internal/automaton"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+	"GoSearch/internal/query"
+	"GoSearch/internal/scoring"
+)
+
+var ErrUnsupportedQuery = errors.New("unsupported query")
+
+// TopDocs is the result of a search: the total number of matching
+// documents and the best-scoring ones in descending score order.
+type TopDocs struct {
+	TotalHits int
+	Docs      []ScoredDoc
+}
+
+// Searcher executes query ASTs against a set of segments.
+// Scoring statistics are segment-local.
+type Searcher struct {
+	schema   *index.Schema
+	segments []Segment
+	ctx      *ExecutionContext
+	filters  *FilterCache
+}
+
+// NewSearcher creates a Searcher over the given segments. The schema
+// determines how each field is queried; fields it does not define are
+// treated as text. A nil ctx uses the default execution limits.
+func NewSearcher(schema *index.Schema, segments []Segment, ctx *ExecutionContext) *Searcher {
+	if ctx == nil {
+		ctx = NewExecutionContext(DefaultQueryTimeout, 0, 0)
+	}
+	return &Searcher{schema: schema, segments: segments, ctx: ctx}
+}
+
+// SetFilterCache makes the Searcher cache the matches of filter clauses on
+// segments that implement IdentifiedSegment.
+func (s *Searcher) SetFilterCache(c *FilterCache) {
+	s.filters = c
+}
+
+// Search returns the top k documents matching q. Every matching document
+// is also passed to the given collectors. If the query deadline passes
+// during collection, the documents collected so far are returned and the
+// execution context is marked as timed out.
+func (s *Searcher) Search(q query.Query, k int, collectors ...SegmentCollector) (*TopDocs, error) {
+	return s.search(q, NewTopKCollector(k), collectors)
+}
+
+// SearchAfter is like Search but returns the top k documents ranking after
+// the given one, in the order of ScoredDoc.Before. TotalHits still counts
+// every matching document, and every one is passed to the collectors.
+func (s *Searcher) SearchAfter(q query.Query, k int, after ScoredDoc, collectors ...SegmentCollector) (*TopDocs, error) {
+	return s.search(q, NewTopKCollectorAfter(k, after), collectors)
+}
+
+func (s *Searcher) search(q query.Query, collector *TopKCollector, collectors []SegmentCollector) (*TopDocs, error) {
+	total := 0
+	for ord, seg := range s.segments {
+		scorer, err := s.newBuilder(seg, s.ctx).build(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range collectors {
+			if err := c.SetSegment(ord, seg); err != nil {
+				return nil, err
+			}
+		}
+		if scorer == nil {
+			continue
+		}
+		live, _ := seg.(LiveDocs)
+		collector.SetSegment(ord)
+		for scorer.Next() {
+			if live != nil && live.IsDeleted(scorer.DocID()) {
+				continue
+			}
+			total++
+			score := scorer.Score()
+			collector.Collect(scorer.DocID(), score)
+			for _, c := range collectors {
+				c.Collect(scorer.DocID(), score)
+			}
+			if err := s.ctx.CheckLimits(); err != nil {
+				if errors.Is(err, ErrQueryTimeout) {
+					return &TopDocs{TotalHits: total, Docs: collector.Results()}, nil
+				}
+				return nil, err
+			}
+		}
+	}
+	return &TopDocs{TotalHits: total, Docs: collector.Results()}, nil
+}
+
+// Scan calls fn for every live document matching q, segment by segment and
+// in doc ID order within a segment, starting at document startDoc of
+// segment startSeg. No scores are computed and the query deadline does not
+// apply, so a scan can outlast a search. Scan stops at the first error
+// returned by fn and returns it.
+func (s *Searcher) Scan(q query.Query, startSeg int, startDoc uint32, fn func(segment int, docID uint32) error) error {
+	for ord := max(startSeg, 0); ord < len(s.segments); ord++ {
+		seg := s.segments[ord]
+		scorer, err := s.newBuilder(seg, s.ctx).build(q)
+		if err != nil {
+			return err
+		}
+		if scorer == nil {
+			continue
+		}
+		live, _ := seg.(LiveDocs)
+		var ok bool
+		if ord == startSeg && startDoc > 0 {
+			ok = scorer.Advance(startDoc)
+		} else {
+			ok = scorer.Next()
+		}
+		for ; ok; ok = scorer.Next() {
+			if live != nil && live.IsDeleted(scorer.DocID()) {
+				continue
+			}
+			if err := fn(ord, scorer.DocID()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Explain returns the score breakdown of q for a document of the given
+// segment. Expansion limits are applied afresh, so explaining every hit of
+// a search does not exhaust the search's own budget.
+func (s *Searcher) Explain(q query.Query, segment int, docID uint32) (scoring.Explanation, error) {
+	if segment < 0 || segment >= len(s.segments) {
+		return scoring.Explanation{}, fmt.Errorf("segment %d out of range", segment)
+	}
+	ctx := *s.ctx
+	ctx.StatesVisited, ctx.TermsMatched = 0, 0
+
+	scorer, err := s.newBuilder(s.segments[segment], &ctx).build(q)
+	if err != nil {
+		return scoring.Explanation{}, err
+	}
+	if scorer == nil || !scorer.Advance(docID) || scorer.DocID() != docID {
+		return scoring.Explanation{Description: "no matching clause", Value: 0}, nil
+	}
+	return scorer.Explain(), nil
+}
+
+func (s *Searcher) newBuilder(seg Segment, ctx *ExecutionContext) *scorerBuilder {
+	avgDocLen := seg.AvgDocLength()
+	if avgDocLen <= 0 {
+		avgDocLen = 1
+	}
+	return &scorerBuilder{
+		schema:  s.schema,
+		seg:     seg,
+		ctx:     ctx,
+		bm25:    scoring.NewBM25Scorer(int64(seg.DocCount()), avgDocLen),
+		filters: s.filters,
+	}
+}
+
+// scorerBuilder turns a query AST into a Scorer tree for one segment.
+// A nil Scorer means the query matches nothing in the segment.
+type scorerBuilder struct {
+	schema  *index.Schema
+	seg     Segment
+	ctx     *ExecutionContext
+	bm25    *scoring.BM25Scorer
+	filters *FilterCache
+}
+
+func (b *scorerBuilder) build(q query.Query) (Scorer, error) {
+	switch v := q.(type) {
+	case *query.TermQuery:
+		return b.termQuery(v)
+	case *query.PrefixQuery:
+		if err := b.requireTerms(v.Field, "prefix"); err != nil {
+			return nil, err
+		}
+		a := automaton.NewPrefixAutomaton([]byte(v.Prefix))
+		return b.expand(v.Field, a, v.Prefix, v.Boost)
+	case *query.WildcardQuery:
+		if err := b.requireTerms(v.Field, "wildcard"); err != nil {
+			return nil, err
+		}
+		a, err := automaton.NewWildcardAutomaton([]byte(v.Pattern))
+		if err != nil {
+			return nil, fmt.Errorf("%w: wildcard %q: %v", query.ErrInvalidQuery, v.Pattern, err)
+		}
+		return b.expand(v.Field, a, "", v.Boost)
+	case *query.RegexQuery:
+		if err := b.requireTerms(v.Field, "regex"); err != nil {
+			return nil, err
+		}
+		a, err := automaton.NewRegexAutomaton([]byte(v.Pattern))
+		if err != nil {
+			return nil, fmt.Errorf("%w: regex %q: %v", query.ErrInvalidQuery, v.Pattern, err)
+		}
+		return b.expand(v.Field, a, "", v.Boost)
+	case *query.FuzzyQuery:
+		return b.fuzzyQuery(v)
+	case *query.PhraseQuery:
+		return b.phraseQuery(v)
+	case *query.ProximityQuery:
+		return b.proximityQuery(v)
+	case *query.RangeQuery:
+		return b.rangeQuery(v)
+	case *query.BooleanQuery:
+		return b.booleanQuery(v)
+	case *query.DisMaxQuery:
+		return b.disMaxQuery(v)
+	case *query.BlendedTermQuery:
+		return b.blendedTermQuery(v)
+	case *query.ConstantScoreQuery:
+		return b.constantScoreQuery(v)
+	case *query.FunctionScoreQuery:
+		return b.functionScoreQuery(v)
+	case *query.MatchAllQuery:
+		return newMatchAllScorer(b.seg.MaxDoc(), boostOrDefault(v.Boost)), nil
+	case *query.MatchNoneQuery:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedQuery, q)
+	}
+}
+
+// numericKind returns the numeric encoding of a field, if it has one.
+func (b *scorerBuilder) numericKind(field string) (numeric.Kind, bool) {
+	if b.schema == nil {
+		return 0, false
+	}
+	if f := b.schema.Field(field); f != nil {
+		return index.NumericKind(f.Type)
+	}
+	return 0, false
+}
+
+// requireTerms rejects term-expanding queries on numeric fields, whose
+// indexed terms are binary trie encodings.
+func (b *scorerBuilder) requireTerms(field, queryType string) error {
+	if _, ok := b.numericKind(field); ok {
+		return fmt.Errorf("%w: %s query on numeric field %q", ErrUnsupportedQuery, queryType, field)
+	}
+	return nil
+}
+
+func (b *scorerBuilder) termQuery(q *query.TermQuery) (Scorer, error) {
+	boost := boostOrDefault(q.Boost)
+	if kind, ok := b.numericKind(q.Field); ok {
+		v, err := kind.Encode(q.Term)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", query.ErrInvalidQuery, q.Field, err)
+		}
+		p := b.seg.Postings(q.Field, numeric.EncodeTerm(v, 0))
+		if p == nil {
+			return nil, nil
+		}
+		return &constantScorer{
+			PostingsIterator: p.Iterator(),
+			score:            boost,
+			description:      fmt.Sprintf("%s:%s, constant score", q.Field, q.Term),
+		}, nil
+	}
+	p := b.seg.Postings(q.Field, q.Term)
+	if p == nil {
+		return nil, nil
+	}
+	return newTermScorer(q.Field, q.Term, p, boost, b.bm25), nil
+}
+
+// blendedTermQuery scores the term in each field with the largest document
+// frequency it has in any of them, so that a term rare in one field but
+// common in another does not rank as rare.
+func (b *scorerBuilder) blendedTermQuery(q *query.BlendedTermQuery) (Scorer, error) {
+	var docFreq int64
+	postings := make([]*Postings, len(q.Terms))
+	for i, t := range q.Terms {
+		if _, ok := b.numericKind(t.Field); ok {
+			continue
+		}
+		if postings[i] = b.seg.Postings(t.Field, t.Term); postings[i] != nil {
+			docFreq = max(docFreq, postings[i].DocFreq())
+		}
+	}
+	var subs []Scorer
+	for i := range q.Terms {
+		t := &q.Terms[i]
+		if _, ok := b.numericKind(t.Field); ok {
+			sub, err := b.termQuery(t)
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil {
+				subs = append(subs, sub)
+			}
+			continue
+		}
+		if postings[i] == nil {
+			continue
+		}
+		ts := newTermScorer(t.Field, t.Term, postings[i], boostOrDefault(t.Boost), b.bm25)
+		ts.docFreq, ts.idf = docFreq, b.bm25.IDF(docFreq)
+		subs = append(subs, ts)
+	}
+	if len(subs) == 0 {
+		return nil, nil
+	}
+	return newDisMaxScorer(subs, q.TieBreaker, 1), nil
+}
+
+func (b *scorerBuilder) fuzzyQuery(q *query.FuzzyQuery) (Scorer, error) {
+	if err := b.requireTerms(q.Field, "fuzzy"); err != nil {
+		return nil, err
+	}
+	if q.MaxDistance == 0 {
+		return b.termQuery(&query.TermQuery{Field: q.Field, Term: q.Term, Boost: q.Boost})
+	}
+	a, err := automaton.NewLevenshteinAutomaton([]byte(q.Term), q.MaxDistance)
+	if err != nil {
+		return nil, fmt.Errorf("%w: fuzzy %q: %v", query.ErrInvalidQuery, q.Term, err)
+	}
+	prefix := q.Term
+	if q.PrefixLength < len(prefix) {
+		prefix = prefix[:q.PrefixLength]
+	}
+	return b.expand(q.Field, a, prefix, q.Boost)
+}
+
+func (b *scorerBuilder) phraseQuery(q *query.PhraseQuery) (Scorer, error) {
+	if len(q.Terms) == 0 || (q.Positions != nil && len(q.Positions) != len(q.Terms)) {
+		return nil, fmt.Errorf("%w: phrase needs terms and a position for each", query.ErrInvalidQuery)
+	}
+	terms, err := b.phraseTerms(q.Field, q.Terms, q.Positions, "phrase")
+	if terms == nil || err != nil {
+		return nil, err
+	}
+	return newPhraseScorer(q.Field, terms, q.Slop, boostOrDefault(q.Boost), b.bm25), nil
+}
+
+// proximityQuery matches the terms in any order within a window of
+// len(terms)-1+slop positions, as the highlighter does. With every term at
+// offset 0, a phrase scorer's slop is that window.
+func (b *scorerBuilder) proximityQuery(q *query.ProximityQuery) (Scorer, error) {
+	if len(q.Terms) == 0 {
+		return nil, fmt.Errorf("%w: proximity query needs terms", query.ErrInvalidQuery)
+	}
+	terms, err := b.phraseTerms(q.Field, q.Terms, make([]int, len(q.Terms)), "proximity")
+	if terms == nil || err != nil {
+		return nil, err
+	}
+	s := newPhraseScorer(q.Field, terms, len(q.Terms)-1+q.Slop, boostOrDefault(q.Boost), b.bm25)
+	s.phrase = fmt.Sprintf("%q~%d", strings.Join(q.Terms, " "), q.Slop)
+	return s, nil
+}
+
+// phraseTerms returns the positional postings of terms at the given
+// offsets, or consecutive ones if offsets is nil. It returns nil if a term
+// is missing from the segment.
+func (b *scorerBuilder) phraseTerms(field string, words []string, offsets []int, queryType string) ([]phraseTerm, error) {
+	if err := b.requireTerms(field, queryType); err != nil {
+		return nil, err
+	}
+	if b.schema != nil {
+		if f := b.schema.Field(field); f != nil && !f.Positions {
+			return nil, fmt.Errorf("%w: %s query on field %q without positions", ErrUnsupportedQuery, queryType, field)
+		}
+	}
+	terms := make([]phraseTerm, len(words))
+	for i, term := range words {
+		p := b.seg.Postings(field, term)
+		if p == nil {
+			return nil, nil
+		}
+		if p.Positions == nil {
+			return nil, fmt.Errorf("%w: %s query on field %q without positions", ErrUnsupportedQuery, queryType, field)
+		}
+		offset := i
+		if offsets != nil {
+			offset = offsets[i]
+		}
+		terms[i] = phraseTerm{term: term, offset: offset, docFreq: p.DocFreq(), postings: p.Iterator(), positions: p.Positions}
+	}
+	return terms, nil
+}
+
+// expand intersects the automaton with the field's terms (restricted to
+// those starting with prefix) and scores the union of the matching terms.
+func (b *scorerBuilder) expand(field string, a automaton.Automaton, prefix string, boost float32) (Scorer, error) {
+	terms := b.seg.Terms(field)
+	if prefix != "" {
+		start := sort.SearchStrings(terms, prefix)
+		end := start
+		for end < len(terms) && strings.HasPrefix(terms[end], prefix) {
+			end++
+		}
+		terms = terms[start:end]
+	}
+	matched, err := IntersectTerms(a, terms, b.ctx)
+	if err != nil {
+		return nil, err
+	}
+	boost = boostOrDefault(boost)
+	subs := make([]Scorer, 0, len(matched))
+	for _, term := range matched {
+		if p := b.seg.Postings(field, term); p != nil {
+			subs = append(subs, newTermScorer(field, term, p, boost, b.bm25))
+		}
+	}
+	if len(subs) == 0 {
+		return nil, nil
+	}
+	return newDisjunctionScorer(subs, 1), nil
+}
+
+func (b *scorerBuilder) rangeQuery(q *query.RangeQuery) (Scorer, error) {
+	docs := newDocSetBuilder(b.seg.MaxDoc())
+	if kind, ok := b.numericKind(q.Field); ok {
+		lo, hi, err := kind.RangeBounds(q.Lower, q.Upper, q.IncludeLower, q.IncludeUpper)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", query.ErrInvalidQuery, q.Field, err)
+		}
+		numeric.SplitRange(lo, hi, func(term string) {
+			if p := b.seg.Postings(q.Field, term); p != nil {
+				docs.add(p.DocIDs)
+			}
+		})
+	} else if err := b.termRange(q, docs); err != nil {
+		return nil, err
+	}
+	return docs.scorer(boostOrDefault(q.Boost), rangeDescription(q)), nil
+}
+
+// termRange adds the documents of every term of the field that falls
+// lexicographically within the query bounds.
+func (b *scorerBuilder) termRange(q *query.RangeQuery, docs *docSetBuilder) error {
+	var lower, upper string
+	var err error
+	if q.Lower != nil {
+		if lower, err = termBound(q.Lower); err != nil {
+			return err
+		}
+	}
+	if q.Upper != nil {
+		if upper, err = termBound(q.Upper); err != nil {
+			return err
+		}
+	}
+
+	terms := b.seg.Terms(q.Field)
+	i := sort.SearchStrings(terms, lower)
+	if q.Lower != nil && !q.IncludeLower && i < len(terms) && terms[i] == lower {
+		i++
+	}
+	for ; i < len(terms); i++ {
+		term := terms[i]
+		if q.Upper != nil && (term > upper || (term == upper && !q.IncludeUpper)) {
+			break
+		}
+		b.ctx.TermsMatched++
+		if err := b.ctx.CheckLimits(); err != nil {
+			return err
+		}
+		if p := b.seg.Postings(q.Field, term); p != nil {
+			docs.add(p.DocIDs)
+		}
+	}
+	return nil
+}
+
+func termBound(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case fmt.Stringer:
+		return x.String(), nil
+	default:
+		return "", fmt.Errorf("%w: range bound %v must be a string", query.ErrInvalidQuery, v)
+	}
+}
+
+func rangeDescription(q *query.RangeQuery) string {
+	lo, hi := "*", "*"
+	if q.Lower != nil {
+		lo = fmt.Sprint(q.Lower)
+	}
+	if q.Upper != nil {
+		hi = fmt.Sprint(q.Upper)
+	}
+	open, close := "{", "}"
+	if q.IncludeLower || q.Lower == nil {
+		open = "["
+	}
+	if q.IncludeUpper || q.Upper == nil {
+		close = "]"
+	}
+	return fmt.Sprintf("%s:%s%s TO %s%s", q.Field, open, lo, hi, close)
+}
+
+func (b *scorerBuilder) booleanQuery(q *query.BooleanQuery) (Scorer, error) {
+	var must, should, mustNot []Scorer
+	mustMissing := false
+	for _, c := range q.Clauses {
+		if c.Occur == query.BooleanFilter {
+			filter, err := b.filter(c.Query)
+			if err != nil {
+				return nil, err
+			}
+			if filter == nil {
+				mustMissing = true
+			}
+			must = append(must, filter)
+			continue
+		}
+		sub, err := b.build(c.Query)
+		if err != nil {
+			return nil, err
+		}
+		switch c.Occur {
+		case query.BooleanMust:
+			if sub == nil {
+				mustMissing = true
+			}
+			must = append(must, sub)
+		case query.BooleanShould:
+			if sub != nil {
+				should = append(should, sub)
+			}
+		case query.BooleanMustNot:
+			if sub != nil {
+				mustNot = append(mustNot, sub)
+			}
+		}
+	}
+	if mustMissing {
+		return nil, nil
+	}
+
+	hasShould := false
+	for _, c := range q.Clauses {
+		if c.Occur == query.BooleanShould {
+			hasShould = true
+			break
+		}
+	}
+	minShould := q.MinimumShouldMatch
+	if len(must) == 0 && hasShould && minShould == 0 {
+		minShould = 1
+	}
+	if len(should) < minShould {
+		return nil, nil
+	}
+
+	var req Scorer
+	if len(must) > 0 {
+		req = newConjunctionScorer(must)
+	}
+	switch {
+	case minShould > 0:
+		required := newDisjunctionScorer(should, minShould)
+		if req == nil {
+			req = required
+		} else {
+			req = newConjunctionScorer([]Scorer{req, required})
+		}
+	case len(should) > 0:
+		req = &reqOptScorer{req: req, opt: newDisjunctionScorer(should, 1)}
+	}
+	if req == nil {
+		// Only must_not clauses: exclude from all documents, unscored.
+		req = newMatchAllScorer(b.seg.MaxDoc(), 0)
+	}
+	if len(mustNot) > 0 {
+		req = &reqExclScorer{req: req, excl: newDisjunctionScorer(mustNot, 1)}
+	}
+	return req, nil
+}
+
+// filter returns an unscored iterator over the documents matching q, or
+// nil if there are none. The documents are evaluated into a bitset, which
+// is cached when the segment has an ID. Deleted documents are left in the
+// set, for the search to skip.
+func (b *scorerBuilder) filter(q query.Query) (Scorer, error) {
+	key := query.Canonical(q)
+	id := ""
+	if seg, ok := b.seg.(IdentifiedSegment); ok && b.filters != nil {
+		id = seg.ID()
+	}
+	var docs *docSet
+	if id != "" {
+		docs, _ = b.filters.get(id, key)
+	}
+	if docs == nil {
+		sub, err := b.build(q)
+		if err != nil {
+			return nil, err
+		}
+		builder := newDocSetBuilder(b.seg.MaxDoc())
+		for sub != nil && sub.Next() {
+			builder.addDoc(sub.DocID())
+		}
+		docs = builder.docSet()
+		if id != "" {
+			b.filters.put(id, key, docs)
+		}
+	}
+	if docs.count == 0 {
+		return nil, nil
+	}
+	return &constantScorer{
+		PostingsIterator: docs.iterator(),
+		description:      fmt.Sprintf("filter %s, not scored", key),
+	}, nil
+}
+
+func (b *scorerBuilder) disMaxQuery(q *query.DisMaxQuery) (Scorer, error) {
+	var subs []Scorer
+	for _, sub := range q.Queries {
+		s, err := b.build(sub)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			subs = append(subs, s)
+		}
+	}
+	if len(subs) == 0 {
+		return nil, nil
+	}
+	return newDisMaxScorer(subs, q.TieBreaker, boostOrDefault(q.Boost)), nil
+}
+
+func (b *scorerBuilder) constantScoreQuery(q *query.ConstantScoreQuery) (Scorer, error) {
+	filter, err := b.build(q.Filter)
+	if err != nil || filter == nil {
+		return nil, err
+	}
+	return &constantScoreScorer{Scorer: filter, score: boostOrDefault(q.Boost)}, nil
+}
+
+func boostOrDefault(boost float32) float32 {
+	if boost == 0 {
+		return 1
+	}
+	return boost
+}
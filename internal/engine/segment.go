@@ -0,0 +1,67 @@
+package engine
+
+import "GoSearch/internal/docvalues"
+
+// Segment is a read-only view of one index segment as seen by the Searcher.
+// Document IDs are segment-local and dense in [0, MaxDoc).
+type Segment interface {
+	// MaxDoc returns one more than the largest document ID in the segment.
+	MaxDoc() uint32
+
+	// DocCount returns the number of documents used for scoring statistics.
+	DocCount() int
+
+	// AvgDocLength returns the average document length used by BM25.
+	AvgDocLength() float32
+
+	// Terms returns the indexed terms of a field in ascending byte order.
+	Terms(field string) []string
+
+	// Postings returns the postings for a term, or nil if the term is absent.
+	Postings(field, term string) *Postings
+
+	// DocValues returns the segment's column-oriented field values, or nil
+	// if it has none.
+	DocValues() *docvalues.Segment
+}
+
+// LiveDocs is implemented by segments that have deleted documents. The
+// Searcher never matches a document for which IsDeleted reports true.
+type LiveDocs interface {
+	IsDeleted(docID uint32) bool
+}
+
+// IdentifiedSegment is implemented by immutable segments. Results computed
+// for a segment, such as the matches of filters, may be cached under its
+// ID, which must therefore never be reused for different contents.
+type IdentifiedSegment interface {
+	ID() string
+}
+
+// SegmentCollector receives every document matched by a search, in
+// addition to the top-K collector. SetSegment is called before the first
+// document of each segment is collected.
+type SegmentCollector interface {
+	SetSegment(ord int, seg Segment) error
+	Collect(docID uint32, score float32)
+}
+
+// Postings is an in-memory postings list. DocIDs are sorted ascending and
+// Freqs, when present, is parallel to DocIDs. So is Positions, which holds
+// the ascending positions of the term in each document of a field that
+// indexes positions.
+type Postings struct {
+	DocIDs    []uint32
+	Freqs     []uint32
+	Positions [][]uint32
+}
+
+// DocFreq returns the number of documents containing the term.
+func (p *Postings) DocFreq() int64 {
+	return int64(len(p.DocIDs))
+}
+
+// Iterator returns a fresh iterator over the postings.
+func (p *Postings) Iterator() *SlicePostingsIterator {
+	return NewSlicePostingsIterator(p.DocIDs, p.Freqs)
+}
@@ -0,0 +1,329 @@
+package highlight
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/index"
+	"GoSearch/internal/query"
+)
+
+// Highlighting defaults and limits.
+const (
+	DefaultPreTag            = "<em>"
+	DefaultPostTag           = "</em>"
+	DefaultFragmentSize      = 100
+	DefaultNumberOfFragments = 5
+	MaxFragmentSize          = 10_000
+	MaxNumberOfFragments     = 100
+)
+
+// EncoderHTML escapes field text, but not the tags, before highlighting.
+const EncoderHTML = "html"
+
+var ErrInvalidHighlight = errors.New("invalid highlight")
+
+// Options control how a field is highlighted. Zero values take the
+// defaults, or the request-level option for per-field options.
+type Options struct {
+	PreTag  string `json:"pre_tag,omitempty"`
+	PostTag string `json:"post_tag,omitempty"`
+
+	// FragmentSize is the approximate fragment length in bytes. Fragments
+	// start and end on token boundaries.
+	FragmentSize int `json:"fragment_size,omitempty"`
+
+	// NumberOfFragments is the maximum number of fragments per field. With
+	// 0, the whole value is returned as a single highlighted fragment.
+	NumberOfFragments *int `json:"number_of_fragments,omitempty"`
+
+	// Encoder is "html" to escape the field text, or empty for none.
+	Encoder string `json:"encoder,omitempty"`
+}
+
+// Request is the JSON form of the search request's highlight option.
+//
+//	{"pre_tag": "<b>", "post_tag": "</b>",
+//	 "fields": {"title": {"number_of_fragments": 0}, "body": {"fragment_size": 150}}}
+type Request struct {
+	Options
+	Fields map[string]Options `json:"fields"`
+}
+
+// Highlighter highlights the stored fields of search hits for one query.
+type Highlighter struct {
+	fields []*fieldHighlighter
+}
+
+type fieldHighlighter struct {
+	name        string
+	multiValued bool
+	analyzer    analysis.Analyzer
+	matchers    []matcher
+	opts        Options
+	numFrags    int
+}
+
+// New validates the request against the schema and prepares a highlighter
+// for q. Requested fields must be stored text or keyword fields.
+func New(schema *index.Schema, registry *analysis.Registry, q query.Query, req Request) (*Highlighter, error) {
+	if len(req.Fields) == 0 {
+		return nil, fmt.Errorf("%w: fields is required", ErrInvalidHighlight)
+	}
+	matchers := make(map[string][]matcher)
+	collectMatchers(q, matchers)
+
+	names := make([]string, 0, len(req.Fields))
+	for name := range req.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := &Highlighter{}
+	for _, name := range names {
+		f := schema.Field(name)
+		if f == nil {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidHighlight, name)
+		}
+		if !f.Stored {
+			return nil, fmt.Errorf("%w: field %q is not stored", ErrInvalidHighlight, name)
+		}
+		fh := &fieldHighlighter{name: name, multiValued: f.MultiValued, matchers: matchers[name]}
+		switch f.Type {
+		case index.FieldTypeText:
+			a, err := registry.Get(f.Analyzer)
+			if err != nil {
+				return nil, fmt.Errorf("%w: field %q: %v", ErrInvalidHighlight, name, err)
+			}
+			fh.analyzer = a
+		case index.FieldTypeKeyword:
+			fh.analyzer = analysis.NewKeywordAnalyzer()
+		default:
+			return nil, fmt.Errorf("%w: field %q has unsupported type %q", ErrInvalidHighlight, name, f.Type)
+		}
+		var err error
+		if fh.opts, fh.numFrags, err = resolveOptions(req.Options, req.Fields[name]); err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", ErrInvalidHighlight, name, err)
+		}
+		h.fields = append(h.fields, fh)
+	}
+	return h, nil
+}
+
+// resolveOptions applies field options over request options over defaults.
+func resolveOptions(global, field Options) (Options, int, error) {
+	o := Options{
+		PreTag:       firstNonEmpty(field.PreTag, global.PreTag, DefaultPreTag),
+		PostTag:      firstNonEmpty(field.PostTag, global.PostTag, DefaultPostTag),
+		FragmentSize: field.FragmentSize,
+		Encoder:      firstNonEmpty(field.Encoder, global.Encoder),
+	}
+	if o.FragmentSize == 0 {
+		o.FragmentSize = global.FragmentSize
+	}
+	if o.FragmentSize == 0 {
+		o.FragmentSize = DefaultFragmentSize
+	}
+	if o.FragmentSize < 0 || o.FragmentSize > MaxFragmentSize {
+		return o, 0, fmt.Errorf("fragment_size must be between 1 and %d", MaxFragmentSize)
+	}
+	numFrags := DefaultNumberOfFragments
+	switch {
+	case field.NumberOfFragments != nil:
+		numFrags = *field.NumberOfFragments
+	case global.NumberOfFragments != nil:
+		numFrags = *global.NumberOfFragments
+	}
+	if numFrags < 0 || numFrags > MaxNumberOfFragments {
+		return o, 0, fmt.Errorf("number_of_fragments must be between 0 and %d", MaxNumberOfFragments)
+	}
+	if o.Encoder != "" && o.Encoder != EncoderHTML {
+		return o, 0, fmt.Errorf("unknown encoder %q", o.Encoder)
+	}
+	return o, numFrags, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Highlight returns the highlighted fragments of a hit's stored fields,
+// keyed by field name. Fields without matches are omitted.
+func (h *Highlighter) Highlight(stored map[string][]byte) map[string][]string {
+	var out map[string][]string
+	for _, f := range h.fields {
+		data, ok := stored[f.name]
+		if !ok || len(f.matchers) == 0 {
+			continue
+		}
+		if frags := f.highlight(storedValues(data, f.multiValued)); len(frags) > 0 {
+			if out == nil {
+				out = make(map[string][]string)
+			}
+			out[f.name] = frags
+		}
+	}
+	return out
+}
+
+// storedValues splits a stored value into its field values. Multi-valued
+// fields store arrays as JSON.
+func storedValues(data []byte, multiValued bool) []string {
+	if multiValued && len(data) > 0 && data[0] == '[' {
+		var values []string
+		if err := json.Unmarshal(data, &values); err == nil {
+			return values
+		}
+	}
+	return []string{string(data)}
+}
+
+func (f *fieldHighlighter) highlight(values []string) []string {
+	var frags []fragment
+	for _, text := range values {
+		tokens := f.analyzer.Analyze(f.name, text)
+		hit := make([]bool, len(tokens))
+		for _, m := range f.matchers {
+			m.mark(tokens, hit)
+		}
+		var matched []analysis.Token
+		for i, tok := range tokens {
+			if hit[i] {
+				matched = append(matched, tok)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if f.numFrags == 0 {
+			frags = append(frags, fragment{text: text, end: len(text), matches: matched})
+			continue
+		}
+		frags = append(frags, bestFragments(text, tokens, matched, f.opts.FragmentSize, f.numFrags)...)
+	}
+	if len(frags) == 0 {
+		return nil
+	}
+
+	// Best fragments first, across all values of the field.
+	sort.SliceStable(frags, func(i, j int) bool { return frags[i].score > frags[j].score })
+	if f.numFrags > 0 && len(frags) > f.numFrags {
+		frags = frags[:f.numFrags]
+	}
+	out := make([]string, len(frags))
+	for i, fr := range frags {
+		out[i] = fr.render(f.opts)
+	}
+	return out
+}
+
+// fragment is a byte range of a field value with the matched tokens in it.
+type fragment struct {
+	text       string
+	start, end int
+	matches    []analysis.Token
+	score      float64
+}
+
+// bestFragments picks up to n non-overlapping fragments of about size
+// bytes, each centred on a matched token, preferring fragments with more
+// distinct and more total matches.
+func bestFragments(text string, tokens, matched []analysis.Token, size, n int) []fragment {
+	var candidates []fragment
+	for _, m := range matched {
+		// Centre the window on the match, then snap it to token boundaries.
+		lo := m.StartByte - (size-(m.EndByte-m.StartByte))/2
+		start, end := m.StartByte, m.EndByte
+		for _, tok := range tokens {
+			if tok.StartByte >= lo && tok.StartByte < start {
+				start = tok.StartByte
+				break
+			}
+		}
+		for _, tok := range tokens {
+			if tok.EndByte > end && tok.EndByte <= start+size {
+				end = tok.EndByte
+			}
+		}
+		// Keep leading and trailing punctuation when the window reaches the
+		// first or last token.
+		if start == tokens[0].StartByte {
+			start = 0
+		}
+		if end == tokens[len(tokens)-1].EndByte {
+			end = len(text)
+		}
+		fr := fragment{text: text, start: start, end: end}
+		distinct := make(map[string]bool)
+		for _, mm := range matched {
+			if mm.StartByte >= start && mm.EndByte <= end {
+				fr.matches = append(fr.matches, mm)
+				distinct[mm.Term] = true
+			}
+		}
+		fr.score = float64(len(distinct)) + 0.1*float64(len(fr.matches))
+		candidates = append(candidates, fr)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	var picked []fragment
+	for _, c := range candidates {
+		if len(picked) == n {
+			break
+		}
+		overlaps := false
+		for _, p := range picked {
+			if c.start < p.end && p.start < c.end {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			picked = append(picked, c)
+		}
+	}
+	return picked
+}
+
+// render wraps the fragment's matches in tags.
+func (fr fragment) render(o Options) string {
+	encode := func(s string) string {
+		if o.Encoder == EncoderHTML {
+			return html.EscapeString(s)
+		}
+		return s
+	}
+	var b strings.Builder
+	pos := fr.start
+	for i := 0; i < len(fr.matches); i++ {
+		m := fr.matches[i]
+		if m.StartByte < pos {
+			continue
+		}
+		// Overlapping matches, such as n-grams of one word, share a tag.
+		end := m.EndByte
+		for i+1 < len(fr.matches) && fr.matches[i+1].StartByte < end {
+			i++
+			end = max(end, fr.matches[i].EndByte)
+		}
+		b.WriteString(encode(fr.text[pos:m.StartByte]))
+		b.WriteString(o.PreTag)
+		b.WriteString(encode(fr.text[m.StartByte:end]))
+		b.WriteString(o.PostTag)
+		pos = end
+	}
+	b.WriteString(encode(fr.text[pos:fr.end]))
+	return b.String()
+}
@@ -0,0 +1,194 @@
+package highlight
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/index"
+	"GoSearch/internal/query"
+)
+
+func testSchema() *index.Schema {
+	return &index.Schema{Fields: []index.FieldDef{
+		{Name: "title", Type: index.FieldTypeText, Indexed: true, Stored: true, Analyzer: "standard"},
+		{Name: "body", Type: index.FieldTypeText, Indexed: true, Stored: true, Analyzer: "standard"},
+		{Name: "notes", Type: index.FieldTypeText, Indexed: true, Stored: true, Analyzer: "standard", MultiValued: true},
+		{Name: "status", Type: index.FieldTypeKeyword, Indexed: true, Stored: true},
+		{Name: "secret", Type: index.FieldTypeText, Indexed: true, Analyzer: "standard"},
+		{Name: "price", Type: index.FieldTypeLong, Indexed: true, Stored: true},
+	}}
+}
+
+func intPtr(n int) *int { return &n }
+
+func highlight(t *testing.T, q query.Query, req Request, stored map[string]string) map[string][]string {
+	t.Helper()
+	h, err := New(testSchema(), analysis.NewRegistry(), q, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(map[string][]byte, len(stored))
+	for k, v := range stored {
+		data[k] = []byte(v)
+	}
+	return h.Highlight(data)
+}
+
+func term(field, t string) *query.TermQuery { return &query.TermQuery{Field: field, Term: t} }
+
+func TestHighlight_Queries(t *testing.T) {
+	whole := Request{Fields: map[string]Options{"title": {NumberOfFragments: intPtr(0)}}}
+	tests := []struct {
+		name  string
+		q     query.Query
+		title string
+		want  []string
+	}{
+		{"term", term("title", "fox"), "The quick Fox jumps", []string{"The quick <em>Fox</em> jumps"}},
+		{"prefix", &query.PrefixQuery{Field: "title", Prefix: "jump"}, "jumps and jumped", []string{"<em>jumps</em> and <em>jumped</em>"}},
+		{"wildcard", &query.WildcardQuery{Field: "title", Pattern: "qu?ck"}, "quick quack quickly", []string{"<em>quick</em> <em>quack</em> quickly"}},
+		{"fuzzy", &query.FuzzyQuery{Field: "title", Term: "fax", MaxDistance: 1, PrefixLength: 1}, "fox fix box", []string{"<em>fox</em> <em>fix</em> box"}},
+		{
+			"phrase only where adjacent",
+			&query.PhraseQuery{Field: "title", Terms: []string{"quick", "fox"}},
+			"quick brown fox, quick fox",
+			[]string{"quick brown fox, <em>quick</em> <em>fox</em>"},
+		},
+		{
+			"phrase with slop",
+			&query.PhraseQuery{Field: "title", Terms: []string{"quick", "fox"}, Slop: 1},
+			"quick brown fox",
+			[]string{"<em>quick</em> brown <em>fox</em>"},
+		},
+		{
+			"proximity is unordered",
+			&query.ProximityQuery{Field: "title", Terms: []string{"fox", "quick"}, Slop: 1},
+			"quick brown fox",
+			[]string{"<em>quick</em> brown <em>fox</em>"},
+		},
+		{
+			"bool skips must_not and other fields",
+			&query.BooleanQuery{Clauses: []query.BooleanClause{
+				{Occur: query.BooleanMust, Query: term("title", "fox")},
+				{Occur: query.BooleanShould, Query: term("body", "quick")},
+				{Occur: query.BooleanMustNot, Query: term("title", "lazy")},
+			}},
+			"quick lazy fox",
+			[]string{"quick lazy <em>fox</em>"},
+		},
+		{"no match", term("title", "cat"), "quick fox", nil},
+		{"match all", &query.MatchAllQuery{}, "quick fox", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := highlight(t, tt.q, whole, map[string]string{"title": tt.title})["title"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight_Fragments(t *testing.T) {
+	body := "Go is a language. Search engines index documents. " +
+		"An inverted index maps terms to documents. Nothing else here at all. " +
+		"Search and index, index and search."
+	q := &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanShould, Query: term("body", "search")},
+		{Occur: query.BooleanShould, Query: term("body", "index")},
+	}}
+
+	got := highlight(t, q, Request{Fields: map[string]Options{
+		"body": {FragmentSize: 40, NumberOfFragments: intPtr(2)},
+	}}, map[string]string{"body": body})["body"]
+	want := []string{
+		"all. <em>Search</em> and <em>index</em>, <em>index</em> and <em>search</em>.",
+		"is a language. <em>Search</em> engines <em>index</em>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestHighlight_Options(t *testing.T) {
+	q := term("title", "fox")
+	stored := map[string]string{
+		"title":  "<b>fox</b> & friends",
+		"notes":  `["a fox", "no match", "fox again"]`,
+		"status": "fox",
+	}
+	got := highlight(t, &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanShould, Query: q},
+		{Occur: query.BooleanShould, Query: term("notes", "fox")},
+		{Occur: query.BooleanShould, Query: term("status", "fox")},
+	}}, Request{
+		Options: Options{PreTag: "[", PostTag: "]"},
+		Fields: map[string]Options{
+			"title":  {Encoder: EncoderHTML},
+			"notes":  {},
+			"status": {PreTag: "<mark>", PostTag: "</mark>"},
+		},
+	}, stored)
+	want := map[string][]string{
+		"title":  {"&lt;b&gt;[fox]&lt;/b&gt; &amp; friends"},
+		"notes":  {"a [fox]", "[fox] again"},
+		"status": {"<mark>fox</mark>"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestHighlight_NGrams(t *testing.T) {
+	schema := &index.Schema{
+		Fields: []index.FieldDef{{Name: "sku", Type: index.FieldTypeText, Indexed: true, Stored: true, Analyzer: "sku"}},
+		Tokenizers: map[string]analysis.TokenizerDef{
+			"trigram": {Type: "ngram", MinGram: 3, MaxGram: 3, TokenChars: []string{"letter", "digit"}},
+		},
+		Analyzers: map[string]analysis.AnalyzerDef{
+			"sku": {Tokenizer: "trigram", Filters: []string{"lowercase"}},
+		},
+	}
+	registry, err := schema.NewRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := &query.BooleanQuery{Clauses: []query.BooleanClause{
+		{Occur: query.BooleanShould, Query: term("sku", "x12")},
+		{Occur: query.BooleanShould, Query: term("sku", "123")},
+	}}
+	h, err := New(schema, registry, q, Request{Fields: map[string]Options{"sku": {NumberOfFragments: intPtr(0)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := h.Highlight(map[string][]byte{"sku": []byte("AB-X1234")})
+	want := map[string][]string{"sku": {"AB-<em>X123</em>4"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{"no fields", Request{}},
+		{"unknown field", Request{Fields: map[string]Options{"missing": {}}}},
+		{"not stored", Request{Fields: map[string]Options{"secret": {}}}},
+		{"numeric field", Request{Fields: map[string]Options{"price": {}}}},
+		{"fragment size", Request{Fields: map[string]Options{"title": {FragmentSize: -1}}}},
+		{"number of fragments", Request{Options: Options{NumberOfFragments: intPtr(MaxNumberOfFragments + 1)}, Fields: map[string]Options{"title": {}}}},
+		{"encoder", Request{Fields: map[string]Options{"title": {Encoder: "base64"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(testSchema(), analysis.NewRegistry(), term("title", "x"), tt.req)
+			if !errors.Is(err, ErrInvalidHighlight) {
+				t.Errorf("expected ErrInvalidHighlight, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package highlight
+
+import (
+	"strings"
+
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/automaton"
+	"GoSearch/internal/query"
+)
+
+// matcher marks the tokens of a field value that a query clause matched.
+type matcher interface {
+	mark(tokens []analysis.Token, hit []bool)
+}
+
+// termMatcher matches single tokens, as for term, prefix, wildcard, fuzzy
+// and range queries.
+type termMatcher func(term string) bool
+
+func (m termMatcher) mark(tokens []analysis.Token, hit []bool) {
+	for i, tok := range tokens {
+		if m(tok.Term) {
+			hit[i] = true
+		}
+	}
+}
+
+// phraseMatcher matches runs of terms whose positions span at most
+// len(terms)-1+slop. Phrase terms must also appear in order.
+type phraseMatcher struct {
+	terms   []string
+	slop    int
+	ordered bool
+}
+
+func (m *phraseMatcher) mark(tokens []analysis.Token, hit []bool) {
+	if len(m.terms) == 0 {
+		return
+	}
+	window := len(m.terms) - 1 + m.slop
+	for i := range tokens {
+		if idx := m.match(tokens, i, window); idx != nil {
+			for _, j := range idx {
+				hit[j] = true
+			}
+		}
+	}
+}
+
+// match returns the token indexes of an occurrence starting at token i,
+// or nil if there is none within the window.
+func (m *phraseMatcher) match(tokens []analysis.Token, i, window int) []int {
+	if !m.starts(tokens[i].Term) {
+		return nil
+	}
+	start := tokens[i].Position
+	idx := make([]int, len(m.terms))
+	found := make([]bool, len(m.terms))
+	n := 0
+	for j := i; j < len(tokens) && tokens[j].Position-start <= window && n < len(m.terms); j++ {
+		if m.ordered {
+			if tokens[j].Term == m.terms[n] && (n == 0 || tokens[j].Position > tokens[idx[n-1]].Position) {
+				idx[n] = j
+				n++
+			}
+			continue
+		}
+		for k, term := range m.terms {
+			if !found[k] && tokens[j].Term == term {
+				found[k] = true
+				idx[k] = j
+				n++
+				break
+			}
+		}
+	}
+	if n < len(m.terms) {
+		return nil
+	}
+	return idx
+}
+
+// starts reports whether an occurrence can begin with term.
+func (m *phraseMatcher) starts(term string) bool {
+	if m.ordered {
+		return term == m.terms[0]
+	}
+	for _, t := range m.terms {
+		if t == term {
+			return true
+		}
+	}
+	return false
+}
+
+// collectMatchers gathers the matchers of q's positive clauses by field.
+// Clauses under must_not never contribute highlights.
+func collectMatchers(q query.Query, out map[string][]matcher) {
+	switch v := q.(type) {
+	case *query.TermQuery:
+		term := v.Term
+		add(out, v.Field, termMatcher(func(t string) bool { return t == term }))
+	case *query.PrefixQuery:
+		prefix := v.Prefix
+		add(out, v.Field, termMatcher(func(t string) bool { return strings.HasPrefix(t, prefix) }))
+	case *query.WildcardQuery:
+		if a, err := automaton.NewWildcardAutomaton([]byte(v.Pattern)); err == nil {
+			add(out, v.Field, automatonMatcher(a, ""))
+		}
+	case *query.RegexQuery:
+		if a, err := automaton.NewRegexAutomaton([]byte(v.Pattern)); err == nil {
+			add(out, v.Field, automatonMatcher(a, ""))
+		}
+	case *query.FuzzyQuery:
+		if a, err := automaton.NewLevenshteinAutomaton([]byte(v.Term), v.MaxDistance); err == nil {
+			prefix := v.Term[:min(v.PrefixLength, len(v.Term))]
+			add(out, v.Field, automatonMatcher(a, prefix))
+		}
+	case *query.RangeQuery:
+		if m, ok := rangeMatcher(v); ok {
+			add(out, v.Field, m)
+		}
+	case *query.PhraseQuery:
+		// Gaps between the phrase's positions widen its window like slop.
+		slop := v.Slop
+		if n := len(v.Positions); n > 0 {
+			slop += v.Positions[n-1] - (n - 1)
+		}
+		add(out, v.Field, &phraseMatcher{terms: v.Terms, slop: slop, ordered: true})
+	case *query.ProximityQuery:
+		add(out, v.Field, &phraseMatcher{terms: v.Terms, slop: v.Slop})
+	case *query.DisMaxQuery:
+		for _, sub := range v.Queries {
+			collectMatchers(sub, out)
+		}
+	case *query.ConstantScoreQuery:
+		collectMatchers(v.Filter, out)
+	case *query.FunctionScoreQuery:
+		// Function filters only affect scores, not which documents match.
+		collectMatchers(v.Query, out)
+	case *query.BlendedTermQuery:
+		for i := range v.Terms {
+			collectMatchers(&v.Terms[i], out)
+		}
+	case *query.BooleanQuery:
+		for _, c := range v.Clauses {
+			if c.Occur != query.BooleanMustNot {
+				collectMatchers(c.Query, out)
+			}
+		}
+	}
+}
+
+func add(out map[string][]matcher, field string, m matcher) {
+	out[field] = append(out[field], m)
+}
+
+// automatonMatcher accepts terms with the given prefix that a runs to an
+// accepting state.
+func automatonMatcher(a automaton.Automaton, prefix string) termMatcher {
+	return func(term string) bool {
+		if !strings.HasPrefix(term, prefix) {
+			return false
+		}
+		s := a.Start()
+		for i := 0; i < len(term) && s != automaton.DeadState; i++ {
+			s = a.Step(s, term[i])
+		}
+		return a.IsAccept(s)
+	}
+}
+
+// rangeMatcher compares terms lexicographically against string bounds.
+// Numeric bounds never match text tokens.
+func rangeMatcher(q *query.RangeQuery) (termMatcher, bool) {
+	lo, loOK := q.Lower.(string)
+	hi, hiOK := q.Upper.(string)
+	if (q.Lower != nil && !loOK) || (q.Upper != nil && !hiOK) {
+		return nil, false
+	}
+	return func(t string) bool {
+		if q.Lower != nil && (t < lo || (t == lo && !q.IncludeLower)) {
+			return false
+		}
+		if q.Upper != nil && (t > hi || (t == hi && !q.IncludeUpper)) {
+			return false
+		}
+		return true
+	}, true
+}
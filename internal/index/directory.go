@@ -33,6 +33,12 @@ func (d *IndexDir) TmpDir() string {
 	return filepath.Join(d.Root, "tmp")
 }
 
+// SynonymsDir returns the path to the synonyms/ directory, which holds the
+// files named by synonyms_path in the schema.
+func (d *IndexDir) SynonymsDir() string {
+	return filepath.Join(d.Root, "synonyms")
+}
+
 // ManifestCurrentPath returns the path to manifest.current.
 func (d *IndexDir) ManifestCurrentPath() string {
 	return filepath.Join(d.Root, "manifest.current")
@@ -75,7 +81,7 @@ func (d *IndexDir) ManifestNextPath() string {
 
 // EnsureDirectories creates all required subdirectories if they do not exist.
 func (d *IndexDir) EnsureDirectories() error {
-	for _, dir := range []string{d.SegmentsDir(), d.ManifestsDir(), d.TmpDir()} {
+	for _, dir := range []string{d.SegmentsDir(), d.ManifestsDir(), d.TmpDir(), d.SynonymsDir()} {
 		if err := storage.EnsureDir(dir); err != nil {
 			return fmt.Errorf("ensure directory %s: %w", dir, err)
 		}
@@ -92,5 +98,6 @@ func SegmentFileNames() []string {
 		"positions.bin",
 		"stored.bin",
 		"deletions.bin",
+		"docvalues.bin",
 	}
 }
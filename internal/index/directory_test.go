@@ -18,6 +18,7 @@ func TestIndexDir_Paths(t *testing.T) {
 		{"SegmentsDir", dir.SegmentsDir(), "/data/indexes/myindex/segments"},
 		{"ManifestsDir", dir.ManifestsDir(), "/data/indexes/myindex/manifests"},
 		{"TmpDir", dir.TmpDir(), "/data/indexes/myindex/tmp"},
+		{"SynonymsDir", dir.SynonymsDir(), "/data/indexes/myindex/synonyms"},
 		{"ManifestCurrentPath", dir.ManifestCurrentPath(), "/data/indexes/myindex/manifest.current"},
 		{"SchemaPath", dir.SchemaPath(), "/data/indexes/myindex/schema.json"},
 		{"SegmentDir", dir.SegmentDir("seg_gen_1_abc"), "/data/indexes/myindex/segments/seg_gen_1_abc"},
@@ -45,7 +46,7 @@ func TestIndexDir_EnsureDirectories(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	for _, subdir := range []string{dir.SegmentsDir(), dir.ManifestsDir(), dir.TmpDir()} {
+	for _, subdir := range []string{dir.SegmentsDir(), dir.ManifestsDir(), dir.TmpDir(), dir.SynonymsDir()} {
 		if !storage.DirExists(subdir) {
 			t.Errorf("directory not created: %s", subdir)
 		}
@@ -74,6 +75,7 @@ func TestSegmentFileNames(t *testing.T) {
 		"positions.bin": true,
 		"stored.bin":    true,
 		"deletions.bin": true,
+		"docvalues.bin": true,
 	}
 
 	if len(names) != len(expected) {
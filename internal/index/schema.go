@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"sort"
 	"time"
 
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/numeric"
 	"GoSearch/internal/storage"
 )
 
@@ -15,6 +19,10 @@ const (
 	FieldTypeText       = "text"
 	FieldTypeKeyword    = "keyword"
 	FieldTypeStoredOnly = "stored_only"
+	FieldTypeLong       = "long"
+	FieldTypeDouble     = "double"
+	FieldTypeDate       = "date"
+	FieldTypeBoolean    = "boolean"
 )
 
 // Analyzer constants.
@@ -22,6 +30,7 @@ const (
 	AnalyzerStandard   = "standard"
 	AnalyzerWhitespace = "whitespace"
 	AnalyzerKeyword    = "keyword"
+	AnalyzerCJK        = "cjk"
 )
 
 // Schema limits.
@@ -29,6 +38,9 @@ const (
 	MaxFieldsPerSchema  = 256
 	MaxFieldNameLength  = 255
 	MaxAnalyzerCount    = 64
+	MaxTokenizerCount   = 64
+	MaxTokenFilterCount = 64
+	MaxCharFilterCount  = 64
 )
 
 // Reserved field names that cannot be used in user schemas.
@@ -47,26 +59,42 @@ var (
 	ErrSchemaInvalidAnalyzer  = errors.New("invalid analyzer")
 	ErrSchemaFieldNameTooLong = errors.New("field name exceeds maximum length")
 	ErrSchemaMissingAnalyzer  = errors.New("text field requires an analyzer")
+	ErrSchemaDocValuesUnsupported = errors.New("doc values not supported for field type")
 )
 
 // Schema represents the immutable schema definition for an index.
 type Schema struct {
-	Version         uint32           `json:"version"`
-	CreatedAt       time.Time        `json:"created_at"`
-	Fields          []FieldDef       `json:"fields"`
-	DefaultAnalyzer string           `json:"default_analyzer"`
-	Checksum        storage.Checksum `json:"checksum"`
+	Version         uint32                             `json:"version"`
+	CreatedAt       time.Time                          `json:"created_at"`
+	Fields          []FieldDef                         `json:"fields"`
+	DefaultAnalyzer string                             `json:"default_analyzer"`
+	Analyzers       map[string]analysis.AnalyzerDef    `json:"analyzers,omitempty"`
+	CharFilters     map[string]analysis.CharFilterDef  `json:"char_filters,omitempty"`
+	Tokenizers      map[string]analysis.TokenizerDef   `json:"tokenizers,omitempty"`
+	TokenFilters    map[string]analysis.TokenFilterDef `json:"token_filters,omitempty"`
+	Checksum        storage.Checksum                   `json:"checksum"`
 }
 
 // FieldDef defines a single field in the schema.
 type FieldDef struct {
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Analyzer    string `json:"analyzer,omitempty"`
-	Stored      bool   `json:"stored"`
-	Indexed     bool   `json:"indexed"`
-	Positions   bool   `json:"positions,omitempty"`
-	MultiValued bool   `json:"multi_valued,omitempty"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Analyzer       string `json:"analyzer,omitempty"`
+	SearchAnalyzer string `json:"search_analyzer,omitempty"`
+	Stored         bool   `json:"stored"`
+	Indexed        bool   `json:"indexed"`
+	Positions      bool   `json:"positions,omitempty"`
+	MultiValued    bool   `json:"multi_valued,omitempty"`
+	DocValues      bool   `json:"doc_values,omitempty"`
+}
+
+// SearchAnalyzerName returns the analyzer for query text on the field: its
+// search analyzer if set, or else the analyzer it is indexed with.
+func (f *FieldDef) SearchAnalyzerName() string {
+	if f.SearchAnalyzer != "" {
+		return f.SearchAnalyzer
+	}
+	return f.Analyzer
 }
 
 // FieldID returns the uint8 field ID for the given field name.
@@ -80,12 +108,27 @@ func (s *Schema) FieldID(name string) int {
 	return -1
 }
 
+// Field returns the definition of the named field, or nil if not found.
+func (s *Schema) Field(name string) *FieldDef {
+	if i := s.FieldID(name); i >= 0 {
+		return &s.Fields[i]
+	}
+	return nil
+}
+
 // Validate checks the schema for correctness.
 func (s *Schema) Validate() error {
 	if len(s.Fields) > MaxFieldsPerSchema {
 		return fmt.Errorf("%w: %d fields (max %d)", ErrSchemaFieldLimit, len(s.Fields), MaxFieldsPerSchema)
 	}
 
+	// Files named by the schema, such as synonym lists, are loaded when
+	// the index opens; only their paths are checked here.
+	registry, err := s.NewRegistry(nil)
+	if err != nil {
+		return err
+	}
+
 	seen := make(map[string]bool, len(s.Fields))
 	for _, f := range s.Fields {
 		if reservedFieldNames[f.Name] {
@@ -103,16 +146,27 @@ func (s *Schema) Validate() error {
 			return fmt.Errorf("field %q: %w", f.Name, err)
 		}
 		if f.Analyzer != "" {
-			if err := validateAnalyzer(f.Analyzer); err != nil {
+			if err := validateAnalyzer(registry, f.Analyzer); err != nil {
 				return fmt.Errorf("field %q: %w", f.Name, err)
 			}
 		}
 		if f.Type == FieldTypeText && f.Analyzer == "" {
 			return fmt.Errorf("field %q: %w", f.Name, ErrSchemaMissingAnalyzer)
 		}
+		if f.SearchAnalyzer != "" {
+			if f.Type != FieldTypeText {
+				return fmt.Errorf("field %q: search_analyzer only allowed on text fields", f.Name)
+			}
+			if err := validateAnalyzer(registry, f.SearchAnalyzer); err != nil {
+				return fmt.Errorf("field %q: search_analyzer: %w", f.Name, err)
+			}
+		}
 		if f.Positions && f.Type != FieldTypeText {
 			return fmt.Errorf("field %q: positions only allowed on text fields", f.Name)
 		}
+		if f.DocValues && !supportsDocValues(f.Type) {
+			return fmt.Errorf("field %q: %w: %q", f.Name, ErrSchemaDocValuesUnsupported, f.Type)
+		}
 		if f.Type == FieldTypeStoredOnly {
 			if f.Indexed {
 				return fmt.Errorf("field %q: stored_only fields cannot be indexed", f.Name)
@@ -124,7 +178,7 @@ func (s *Schema) Validate() error {
 	}
 
 	if s.DefaultAnalyzer != "" {
-		if err := validateAnalyzer(s.DefaultAnalyzer); err != nil {
+		if err := validateAnalyzer(registry, s.DefaultAnalyzer); err != nil {
 			return fmt.Errorf("default_analyzer: %w", err)
 		}
 	}
@@ -132,6 +186,68 @@ func (s *Schema) Validate() error {
 	return nil
 }
 
+// NewRegistry returns a registry with the built-in analyzers and the char
+// filters, tokenizers, token filters and analyzers defined by the schema. Files the
+// definitions name are read from resources, which may be nil.
+func (s *Schema) NewRegistry(resources fs.FS) (*analysis.Registry, error) {
+	if len(s.Analyzers) > MaxAnalyzerCount {
+		return nil, fmt.Errorf("%w: %d analyzers (max %d)", ErrSchemaInvalidAnalyzer, len(s.Analyzers), MaxAnalyzerCount)
+	}
+	if len(s.CharFilters) > MaxCharFilterCount {
+		return nil, fmt.Errorf("%w: %d char filters (max %d)", ErrSchemaInvalidAnalyzer, len(s.CharFilters), MaxCharFilterCount)
+	}
+	if len(s.Tokenizers) > MaxTokenizerCount {
+		return nil, fmt.Errorf("%w: %d tokenizers (max %d)", ErrSchemaInvalidAnalyzer, len(s.Tokenizers), MaxTokenizerCount)
+	}
+	if len(s.TokenFilters) > MaxTokenFilterCount {
+		return nil, fmt.Errorf("%w: %d token filters (max %d)", ErrSchemaInvalidAnalyzer, len(s.TokenFilters), MaxTokenFilterCount)
+	}
+
+	registry := analysis.NewRegistryWithResources(resources)
+	for _, name := range sortedKeys(s.CharFilters) {
+		if name == "" {
+			return nil, fmt.Errorf("%w: char filter name is required", ErrSchemaInvalidAnalyzer)
+		}
+		if err := registry.DefineCharFilter(name, s.CharFilters[name]); err != nil {
+			return nil, fmt.Errorf("%w: char filter %q: %v", ErrSchemaInvalidAnalyzer, name, err)
+		}
+	}
+	for _, name := range sortedKeys(s.Tokenizers) {
+		if name == "" {
+			return nil, fmt.Errorf("%w: tokenizer name is required", ErrSchemaInvalidAnalyzer)
+		}
+		if err := registry.DefineTokenizer(name, s.Tokenizers[name]); err != nil {
+			return nil, fmt.Errorf("%w: tokenizer %q: %v", ErrSchemaInvalidAnalyzer, name, err)
+		}
+	}
+	for _, name := range sortedKeys(s.TokenFilters) {
+		if name == "" {
+			return nil, fmt.Errorf("%w: token filter name is required", ErrSchemaInvalidAnalyzer)
+		}
+		if err := registry.DefineTokenFilter(name, s.TokenFilters[name]); err != nil {
+			return nil, fmt.Errorf("%w: token filter %q: %v", ErrSchemaInvalidAnalyzer, name, err)
+		}
+	}
+	for _, name := range sortedKeys(s.Analyzers) {
+		if name == "" {
+			return nil, fmt.Errorf("%w: analyzer name is required", ErrSchemaInvalidAnalyzer)
+		}
+		if err := registry.Define(name, s.Analyzers[name]); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrSchemaInvalidAnalyzer, name, err)
+		}
+	}
+	return registry, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // MarshalSchema serializes a schema to JSON and computes its checksum.
 func MarshalSchema(s *Schema) ([]byte, error) {
 	checksum, err := computeSchemaChecksum(s)
@@ -214,18 +330,44 @@ func computeSchemaChecksum(s *Schema) (storage.Checksum, error) {
 
 func validateFieldType(t string) error {
 	switch t {
-	case FieldTypeText, FieldTypeKeyword, FieldTypeStoredOnly:
+	case FieldTypeText, FieldTypeKeyword, FieldTypeStoredOnly,
+		FieldTypeLong, FieldTypeDouble, FieldTypeDate, FieldTypeBoolean:
 		return nil
 	default:
 		return fmt.Errorf("%w: %q", ErrSchemaInvalidType, t)
 	}
 }
 
-func validateAnalyzer(a string) error {
-	switch a {
-	case AnalyzerStandard, AnalyzerWhitespace, AnalyzerKeyword:
-		return nil
+// NumericKind returns the numeric encoding for a field type, and false for
+// field types that are not indexed as numbers.
+func NumericKind(fieldType string) (numeric.Kind, bool) {
+	switch fieldType {
+	case FieldTypeLong:
+		return numeric.KindLong, true
+	case FieldTypeDouble:
+		return numeric.KindDouble, true
+	case FieldTypeDate:
+		return numeric.KindDate, true
+	case FieldTypeBoolean:
+		return numeric.KindBoolean, true
 	default:
+		return 0, false
+	}
+}
+
+// supportsDocValues reports whether a field type can be stored as doc values.
+// Keyword fields are stored as sorted-set ordinals and numeric, date and
+// boolean fields as sortable int64 values.
+func supportsDocValues(t string) bool {
+	if _, ok := NumericKind(t); ok {
+		return true
+	}
+	return t == FieldTypeKeyword
+}
+
+func validateAnalyzer(registry *analysis.Registry, a string) error {
+	if _, err := registry.Get(a); err != nil {
 		return fmt.Errorf("%w: %q", ErrSchemaInvalidAnalyzer, a)
 	}
+	return nil
 }
@@ -1,10 +1,13 @@
 package index
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
 	"time"
+
+	"GoSearch/internal/analysis"
 )
 
 func testSchema() *Schema {
@@ -102,6 +105,37 @@ func TestSchema_Validate_PositionsOnNonText(t *testing.T) {
 	}
 }
 
+func TestSchema_Validate_SearchAnalyzer(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   FieldDef
+		wantErr bool
+	}{
+		{"text", FieldDef{Name: "f", Type: FieldTypeText, Analyzer: "standard", SearchAnalyzer: "whitespace", Indexed: true}, false},
+		{"unknown", FieldDef{Name: "f", Type: FieldTypeText, Analyzer: "standard", SearchAnalyzer: "bad_analyzer", Indexed: true}, true},
+		{"keyword", FieldDef{Name: "f", Type: FieldTypeKeyword, SearchAnalyzer: "standard", Indexed: true}, true},
+	}
+	for _, tt := range tests {
+		s := &Schema{Version: 1, Fields: []FieldDef{tt.field}}
+		err := s.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if tt.name == "unknown" && !errors.Is(err, ErrSchemaInvalidAnalyzer) {
+			t.Errorf("%s: expected ErrSchemaInvalidAnalyzer, got: %v", tt.name, err)
+		}
+	}
+
+	f := FieldDef{Analyzer: "standard"}
+	if got := f.SearchAnalyzerName(); got != "standard" {
+		t.Errorf("SearchAnalyzerName() = %q, want standard", got)
+	}
+	f.SearchAnalyzer = "whitespace"
+	if got := f.SearchAnalyzerName(); got != "whitespace" {
+		t.Errorf("SearchAnalyzerName() = %q, want whitespace", got)
+	}
+}
+
 func TestSchema_Validate_StoredOnlyIndexed(t *testing.T) {
 	s := &Schema{
 		Version: 1,
@@ -124,6 +158,27 @@ func TestSchema_Validate_StoredOnlyNotStored(t *testing.T) {
 	}
 }
 
+func TestSchema_Validate_DocValues(t *testing.T) {
+	s := &Schema{
+		Version: 1,
+		Fields:  []FieldDef{{Name: "tags", Type: FieldTypeKeyword, Indexed: true, MultiValued: true, DocValues: true}},
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("doc values on keyword field should be valid: %v", err)
+	}
+
+	for _, typ := range []string{FieldTypeText, FieldTypeStoredOnly} {
+		s := &Schema{
+			Version: 1,
+			Fields:  []FieldDef{{Name: "f", Type: typ, Analyzer: AnalyzerStandard, Stored: true, DocValues: true}},
+		}
+		err := s.Validate()
+		if !errors.Is(err, ErrSchemaDocValuesUnsupported) {
+			t.Errorf("type %q: expected ErrSchemaDocValuesUnsupported, got: %v", typ, err)
+		}
+	}
+}
+
 func TestSchema_Validate_InvalidDefaultAnalyzer(t *testing.T) {
 	s := &Schema{
 		Version:         1,
@@ -136,6 +191,187 @@ func TestSchema_Validate_InvalidDefaultAnalyzer(t *testing.T) {
 	}
 }
 
+func TestSchema_Validate_CustomAnalyzers(t *testing.T) {
+	s := &Schema{
+		Version: 1,
+		Fields: []FieldDef{
+			{Name: "title", Type: FieldTypeText, Analyzer: "my_en", Indexed: true},
+			{Name: "code", Type: FieldTypeText, Analyzer: "exact", Indexed: true},
+		},
+		DefaultAnalyzer: "my_en",
+		Analyzers: map[string]analysis.AnalyzerDef{
+			"my_en": {Tokenizer: "standard", Filters: []string{"lowercase"}},
+			"exact": {Tokenizer: "keyword"},
+		},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registry, err := s.NewRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := registry.Get("my_en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens := a.Analyze("title", "Hello World"); len(tokens) != 2 || tokens[0].Term != "hello" {
+		t.Errorf("my_en tokens = %+v", tokens)
+	}
+}
+
+func TestSchema_NewRegistry_PorterAlias(t *testing.T) {
+	var s Schema
+	data := `{"version": 1,
+		"fields": [{"name": "body", "type": "text", "analyzer": "my_en", "indexed": true}],
+		"analyzers": {"my_en": {"tokenizer": "standard", "filters": ["lowercase", "stop", "porter"]}}}`
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registry, err := s.NewRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := registry.Get("my_en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var terms []string
+	for _, tok := range a.Analyze("body", "The Running Foxes") {
+		terms = append(terms, tok.Term)
+	}
+	if fmt.Sprint(terms) != "[run fox]" {
+		t.Errorf("my_en terms = %v, want [run fox]", terms)
+	}
+}
+
+func TestSchema_Validate_InvalidCustomAnalyzer(t *testing.T) {
+	tests := map[string]map[string]analysis.AnalyzerDef{
+		"unknown tokenizer": {"a": {Tokenizer: "nope"}},
+		"unknown filter":    {"a": {Tokenizer: "standard", Filters: []string{"nope"}}},
+		"missing tokenizer": {"a": {Filters: []string{"lowercase"}}},
+		"builtin name":      {"standard": {Tokenizer: "keyword"}},
+		"empty name":        {"": {Tokenizer: "keyword"}},
+		"undefined filter":  {"a": {Tokenizer: "standard", Filters: []string{"my_stop"}}},
+	}
+	for name, analyzers := range tests {
+		s := &Schema{
+			Version:   1,
+			Fields:    []FieldDef{{Name: "f", Type: FieldTypeKeyword, Indexed: true}},
+			Analyzers: analyzers,
+		}
+		if err := s.Validate(); !errors.Is(err, ErrSchemaInvalidAnalyzer) {
+			t.Errorf("%s: expected ErrSchemaInvalidAnalyzer, got: %v", name, err)
+		}
+	}
+
+	s := &Schema{Version: 1, Analyzers: make(map[string]analysis.AnalyzerDef)}
+	for i := 0; i <= MaxAnalyzerCount; i++ {
+		s.Analyzers[fmt.Sprintf("a%d", i)] = analysis.AnalyzerDef{Tokenizer: "keyword"}
+	}
+	if err := s.Validate(); !errors.Is(err, ErrSchemaInvalidAnalyzer) {
+		t.Errorf("too many analyzers: expected ErrSchemaInvalidAnalyzer, got: %v", err)
+	}
+}
+
+func TestSchema_Validate_TokenFilters(t *testing.T) {
+	s := &Schema{
+		Version: 1,
+		Fields:  []FieldDef{{Name: "body", Type: FieldTypeText, Analyzer: "my_en", Indexed: true}},
+		TokenFilters: map[string]analysis.TokenFilterDef{
+			"my_stop":     {Type: "stop", Stopwords: []string{"via"}},
+			"my_synonyms": {Type: "synonym_graph", Synonyms: []string{"ny, new york"}, SynonymsPath: "cities.txt"},
+			"my_phonetic": {Type: "phonetic", Encoder: "double_metaphone", PreserveOriginal: true},
+		},
+		Analyzers: map[string]analysis.AnalyzerDef{
+			"my_en": {Tokenizer: "standard", Filters: []string{"lowercase", "my_synonyms", "my_stop", "porter2"}},
+		},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, def := range map[string]analysis.TokenFilterDef{
+		"stop":    {Type: "stop"},
+		"bad":     {Type: "nope"},
+		"unknown": {Type: "stop", Language: "klingon"},
+		"escape":  {Type: "synonym_graph", SynonymsPath: "../synonyms.txt"},
+		"syntax":  {Type: "synonym_graph", Synonyms: []string{"a, , b"}},
+		"encoder": {Type: "phonetic", Encoder: "nysiis"},
+	} {
+		s.TokenFilters = map[string]analysis.TokenFilterDef{name: def}
+		s.Analyzers = nil
+		s.Fields = nil
+		if err := s.Validate(); !errors.Is(err, ErrSchemaInvalidAnalyzer) {
+			t.Errorf("token filter %q: expected ErrSchemaInvalidAnalyzer, got: %v", name, err)
+		}
+	}
+}
+
+func TestSchema_Validate_Tokenizers(t *testing.T) {
+	s := &Schema{
+		Version: 1,
+		Fields:  []FieldDef{{Name: "sku", Type: FieldTypeText, Analyzer: "sku", Indexed: true}},
+		Tokenizers: map[string]analysis.TokenizerDef{
+			"trigram": {Type: "ngram", MinGram: 3, MaxGram: 3, TokenChars: []string{"letter", "digit"}},
+		},
+		Analyzers: map[string]analysis.AnalyzerDef{
+			"sku": {Tokenizer: "trigram", Filters: []string{"lowercase"}},
+		},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, def := range map[string]analysis.TokenizerDef{
+		"ngram":    {Type: "ngram"},
+		"bad":      {Type: "nope"},
+		"too_wide": {Type: "ngram", MinGram: 1, MaxGram: 20},
+		"classes":  {Type: "edge_ngram", TokenChars: []string{"emoji"}},
+	} {
+		s.Tokenizers = map[string]analysis.TokenizerDef{name: def}
+		s.Analyzers = nil
+		s.Fields = nil
+		if err := s.Validate(); !errors.Is(err, ErrSchemaInvalidAnalyzer) {
+			t.Errorf("tokenizer %q: expected ErrSchemaInvalidAnalyzer, got: %v", name, err)
+		}
+	}
+}
+
+func TestSchema_Validate_CharFilters(t *testing.T) {
+	s := &Schema{
+		Version: 1,
+		Fields:  []FieldDef{{Name: "body", Type: FieldTypeText, Analyzer: "html", Indexed: true}},
+		CharFilters: map[string]analysis.CharFilterDef{
+			"no_dashes": {Type: "pattern_replace", Pattern: `(\w)-(\w)`, Replacement: "$1$2"},
+		},
+		Analyzers: map[string]analysis.AnalyzerDef{
+			"html": {CharFilters: []string{"html_strip", "no_dashes"}, Tokenizer: "standard", Filters: []string{"lowercase"}},
+		},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, def := range map[string]analysis.CharFilterDef{
+		"html_strip": {Type: "html_strip"},
+		"bad":        {Type: "nope"},
+		"regex":      {Type: "pattern_replace", Pattern: "[a-"},
+	} {
+		s.CharFilters = map[string]analysis.CharFilterDef{name: def}
+		s.Analyzers = nil
+		s.Fields = nil
+		if err := s.Validate(); !errors.Is(err, ErrSchemaInvalidAnalyzer) {
+			t.Errorf("char filter %q: expected ErrSchemaInvalidAnalyzer, got: %v", name, err)
+		}
+	}
+}
+
 func TestSchema_FieldID(t *testing.T) {
 	s := testSchema()
 	if id := s.FieldID("id"); id != 0 {
@@ -16,6 +16,7 @@ const (
 	MagicPositions = "GTSRPOS\x00"
 	MagicStored    = "GTSRSTO\x00"
 	MagicDeletions = "GTSRDEL\x00"
+	MagicDocValues = "GTSRDVL\x00"
 )
 
 // Segment file format version.
@@ -116,7 +116,7 @@ func TestWriteLoadSegmentInfo_RoundTrip(t *testing.T) {
 
 func TestSegmentFormatConstants(t *testing.T) {
 	// Verify magic numbers are 8 bytes.
-	for _, magic := range []string{MagicFST, MagicPostings, MagicPositions, MagicStored, MagicDeletions} {
+	for _, magic := range []string{MagicFST, MagicPostings, MagicPositions, MagicStored, MagicDeletions, MagicDocValues} {
 		if len(magic) != 8 {
 			t.Errorf("magic number %q length = %d, want 8", magic, len(magic))
 		}
@@ -3,6 +3,8 @@ package indexing
 import (
 	"errors"
 	"sync/atomic"
+
+	"GoSearch/internal/docvalues"
 )
 
 // Buffer limits.
@@ -42,9 +44,16 @@ type WriteBuffer struct {
 	// externalToInternal maps external doc IDs to internal doc IDs.
 	ExternalToInternal map[string]uint32
 
-	// Deletions tracks external IDs marked for deletion.
+	// Deletions tracks external IDs marked for deletion. At commit they
+	// become tombstones hiding those documents in older segments.
 	Deletions map[string]bool
 
+	// DeletedDocs holds buffered documents deleted before commit.
+	DeletedDocs map[uint32]bool
+
+	// DocValues accumulates column-oriented values for doc_values fields.
+	DocValues *docvalues.Builder
+
 	NextDocID uint32
 	DocCount  int
 	TermCount int
@@ -61,6 +70,8 @@ func NewWriteBuffer() *WriteBuffer {
 		StoredFields:       make(map[uint32]map[string][]byte),
 		ExternalToInternal: make(map[string]uint32),
 		Deletions:          make(map[string]bool),
+		DeletedDocs:        make(map[uint32]bool),
+		DocValues:          docvalues.NewBuilder(),
 		MemoryLimit:        DefaultBufferMemoryLimit,
 		MaxDocs:            DefaultMaxDocsPerSegment,
 	}
@@ -118,7 +129,7 @@ func (b *WriteBuffer) AllocateDocID(externalID string) (uint32, error) {
 
 // MemoryUsed returns the approximate memory used by the buffer.
 func (b *WriteBuffer) MemoryUsed() int64 {
-	return b.memoryUsed.Load()
+	return b.memoryUsed.Load() + b.DocValues.MemoryUsed()
 }
 
 // IsFull returns true if the buffer has reached its memory or document limit.
@@ -126,15 +137,26 @@ func (b *WriteBuffer) IsFull() bool {
 	if b.DocCount >= b.MaxDocs {
 		return true
 	}
-	if b.memoryUsed.Load() >= b.MemoryLimit {
+	if b.MemoryUsed() >= b.MemoryLimit {
 		return true
 	}
 	return false
 }
 
-// MarkDeleted records an external ID for deletion at commit time.
+// MarkDeleted records an external ID for deletion at commit time. A
+// buffered document with that ID is deleted immediately, so the ID can be
+// added again.
 func (b *WriteBuffer) MarkDeleted(externalID string) {
 	b.Deletions[externalID] = true
+	if docID, ok := b.ExternalToInternal[externalID]; ok {
+		b.DeletedDocs[docID] = true
+		delete(b.ExternalToInternal, externalID)
+	}
+}
+
+// LiveDocCount returns the number of buffered documents not deleted.
+func (b *WriteBuffer) LiveDocCount() int {
+	return b.DocCount - len(b.DeletedDocs)
 }
 
 // Reset clears the buffer for reuse.
@@ -143,6 +165,8 @@ func (b *WriteBuffer) Reset() {
 	b.StoredFields = make(map[uint32]map[string][]byte)
 	b.ExternalToInternal = make(map[string]uint32)
 	b.Deletions = make(map[string]bool)
+	b.DeletedDocs = make(map[uint32]bool)
+	b.DocValues.Reset()
 	b.NextDocID = 0
 	b.DocCount = 0
 	b.TermCount = 0
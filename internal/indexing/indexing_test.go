@@ -1,10 +1,12 @@
 package indexing
 
 import (
+	"errors"
 	"testing"
 
 	"GoSearch/internal/analysis"
 	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
 )
 
 func testSchema() *index.Schema {
@@ -107,6 +109,31 @@ func TestWriteBuffer_IsFull_DocLimit(t *testing.T) {
 	}
 }
 
+func TestWriteBuffer_MarkDeleted(t *testing.T) {
+	buf := NewWriteBuffer()
+	if _, err := buf.AllocateDocID("doc-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.MarkDeleted("doc-1")
+	buf.MarkDeleted("committed")
+	if !buf.DeletedDocs[0] || !buf.Deletions["doc-1"] || !buf.Deletions["committed"] {
+		t.Errorf("DeletedDocs = %v, Deletions = %v", buf.DeletedDocs, buf.Deletions)
+	}
+	if buf.LiveDocCount() != 0 {
+		t.Errorf("LiveDocCount = %d, want 0", buf.LiveDocCount())
+	}
+
+	// A deleted ID can be added again as a new document.
+	id, err := buf.AllocateDocID("doc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || buf.DeletedDocs[1] || buf.LiveDocCount() != 1 {
+		t.Errorf("re-added doc ID = %d, LiveDocCount = %d", id, buf.LiveDocCount())
+	}
+}
+
 func TestWriteBuffer_Reset(t *testing.T) {
 	buf := NewWriteBuffer()
 	if _, err := buf.AllocateDocID("doc-1"); err != nil {
@@ -214,6 +241,40 @@ func TestWriter_AddDocument_Positions(t *testing.T) {
 	}
 }
 
+func TestWriter_AddDocument_FlattensTokenGraphs(t *testing.T) {
+	schema := testSchema()
+	schema.Fields[1].Analyzer = "cities"
+	registry := analysis.NewRegistry()
+	if err := registry.DefineTokenFilter("nyc", analysis.TokenFilterDef{Type: "synonym_graph", Synonyms: []string{"ny, new york"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Define("cities", analysis.AnalyzerDef{Tokenizer: "standard", Filters: []string{"lowercase", "nyc"}}); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(schema, registry)
+
+	doc := Document{
+		Fields: map[string]interface{}{
+			"id":    "doc-1",
+			"title": "ny pizza",
+		},
+	}
+	if err := w.AddDocument(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := w.Buffer()
+	for term, want := range map[string]uint32{"ny": 0, "new": 0, "york": 1, "pizza": 2} {
+		pl := buf.InvertedIndex["title"][term]
+		if pl == nil || len(pl.Entries) != 1 {
+			t.Fatalf("expected one entry for %q", term)
+		}
+		if got := pl.Entries[0].Positions; len(got) != 1 || got[0] != want {
+			t.Errorf("%q: expected position [%d], got %v", term, want, got)
+		}
+	}
+}
+
 func TestWriter_AddDocument_MissingID(t *testing.T) {
 	schema := testSchema()
 	registry := analysis.NewRegistry()
@@ -322,3 +383,92 @@ func TestWriter_MultipleDocuments(t *testing.T) {
 		t.Errorf("'document' entries = %d, want 3", len(pl.Entries))
 	}
 }
+
+func TestWriter_AddDocument_DocValues(t *testing.T) {
+	schema := testSchema()
+	schema.Fields = append(schema.Fields,
+		index.FieldDef{Name: "status", Type: index.FieldTypeKeyword, Indexed: true, DocValues: true},
+		index.FieldDef{Name: "labels", Type: index.FieldTypeKeyword, Indexed: true, MultiValued: true, DocValues: true},
+	)
+	w := NewWriter(schema, analysis.NewRegistry())
+
+	docs := []Document{
+		{Fields: map[string]interface{}{"id": "1", "status": "published", "labels": []interface{}{"b", "a"}}},
+		{Fields: map[string]interface{}{"id": "2", "tags": []interface{}{"search"}}},
+		{Fields: map[string]interface{}{"id": "3", "status": "draft"}},
+	}
+	if err := w.AddDocuments(docs); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := w.Buffer()
+	seg := buf.DocValues.Build(buf.NextDocID)
+
+	status := seg.SortedSetField("status")
+	if status == nil {
+		t.Fatal("status doc values missing")
+	}
+	if ords := status.Ords(0); len(ords) != 1 || status.LookupOrd(ords[0]) != "published" {
+		t.Errorf("doc 0 status ords = %v", ords)
+	}
+	if ords := status.Ords(1); len(ords) != 0 {
+		t.Errorf("doc 1 should have no status, got %v", ords)
+	}
+	if labels := seg.SortedSetField("labels"); len(labels.Ords(0)) != 2 {
+		t.Errorf("doc 0 labels ords = %v, want 2 values", labels.Ords(0))
+	}
+
+	// Fields without doc_values are not columnized.
+	if seg.SortedSetField("tags") != nil {
+		t.Error("tags has no doc_values flag and should not be stored as doc values")
+	}
+
+	w.Abort()
+	if got := w.Buffer().DocValues.Build(0).Fields(); len(got) != 0 {
+		t.Errorf("doc values should be cleared after abort, got %v", got)
+	}
+}
+
+func TestWriter_AddDocument_Numeric(t *testing.T) {
+	schema := testSchema()
+	schema.Fields = append(schema.Fields,
+		index.FieldDef{Name: "price", Type: index.FieldTypeLong, Indexed: true, DocValues: true},
+		index.FieldDef{Name: "published", Type: index.FieldTypeDate, Indexed: true, MultiValued: true},
+	)
+	w := NewWriter(schema, analysis.NewRegistry())
+
+	doc := Document{Fields: map[string]interface{}{
+		"id":        "1",
+		"price":     float64(42),
+		"published": []interface{}{"2024-01-15", "2024-01-15T00:00:00Z"},
+	}}
+	if err := w.AddDocument(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := w.Buffer()
+	if got := len(buf.InvertedIndex["price"]); got != 64/numeric.PrecisionStep {
+		t.Errorf("price terms = %d, want one per trie level", got)
+	}
+	if pl := buf.InvertedIndex["price"][numeric.EncodeTerm(42, 0)]; pl == nil || pl.Entries[0].DocID != 0 {
+		t.Error("full-precision term for 42 should be indexed")
+	}
+	// Equal dates index each trie term once.
+	for term, pl := range buf.InvertedIndex["published"] {
+		if len(pl.Entries) != 1 {
+			t.Errorf("term %q has %d postings, want 1", term, len(pl.Entries))
+		}
+	}
+	if v := buf.DocValues.Build(buf.NextDocID).NumericField("price").Values(0); len(v) != 1 || v[0] != 42 {
+		t.Errorf("price doc values = %v, want [42]", v)
+	}
+
+	bad := Document{Fields: map[string]interface{}{"id": "2", "price": "cheap"}}
+	if err := w.AddDocument(bad); !errors.Is(err, numeric.ErrInvalidLong) {
+		t.Errorf("expected ErrInvalidLong, got %v", err)
+	}
+	arr := Document{Fields: map[string]interface{}{"id": "3", "price": []interface{}{1.0, 2.0}}}
+	if err := w.AddDocument(arr); err == nil {
+		t.Error("expected error for array on single-valued numeric field")
+	}
+}
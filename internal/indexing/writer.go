@@ -8,6 +8,7 @@ import (
 
 	"GoSearch/internal/analysis"
 	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
 )
 
 var (
@@ -77,10 +78,20 @@ func (w *Writer) AddDocument(doc Document) error {
 			if err := w.indexKeywordField(fieldDef, docID, val); err != nil {
 				return err
 			}
+		case index.FieldTypeLong, index.FieldTypeDouble, index.FieldTypeDate, index.FieldTypeBoolean:
+			if err := w.indexNumericField(fieldDef, docID, val); err != nil {
+				return err
+			}
 		case index.FieldTypeStoredOnly:
 			// Store only, no indexing.
 		}
 
+		if fieldDef.DocValues {
+			if err := w.addDocValues(fieldDef, docID, val); err != nil {
+				return err
+			}
+		}
+
 		// Store field value if configured.
 		if fieldDef.Stored {
 			data, err := marshalFieldValue(val)
@@ -166,7 +177,9 @@ func (w *Writer) indexTextField(fieldDef index.FieldDef, docID uint32, val inter
 		return err
 	}
 
-	tokens := analyzer.Analyze(fieldDef.Name, text)
+	// Token graphs, such as multi-word synonyms, are indexed with flat
+	// positions.
+	tokens := analysis.FlattenGraph(analyzer.Analyze(fieldDef.Name, text))
 
 	// Build term frequencies and positions.
 	termFreqs := make(map[string]uint32)
@@ -210,6 +223,76 @@ func (w *Writer) indexKeywordField(fieldDef index.FieldDef, docID uint32, val in
 	return nil
 }
 
+// addDocValues records a field's values in the column-oriented doc values builder.
+func (w *Writer) addDocValues(fieldDef index.FieldDef, docID uint32, val interface{}) error {
+	switch fieldDef.Type {
+	case index.FieldTypeKeyword:
+		switch v := val.(type) {
+		case string:
+			w.buffer.DocValues.AddSortedSet(fieldDef.Name, docID, v)
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return errors.New("keyword array values must be strings")
+				}
+				w.buffer.DocValues.AddSortedSet(fieldDef.Name, docID, s)
+			}
+		}
+	case index.FieldTypeLong, index.FieldTypeDouble, index.FieldTypeDate, index.FieldTypeBoolean:
+		values, err := numericValues(fieldDef, val)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			w.buffer.DocValues.AddNumeric(fieldDef.Name, docID, v)
+		}
+	}
+	return nil
+}
+
+// indexNumericField indexes each value of a long, double, date or boolean
+// field as its trie terms, so range queries can be answered from a bounded
+// number of postings lists.
+func (w *Writer) indexNumericField(fieldDef index.FieldDef, docID uint32, val interface{}) error {
+	values, err := numericValues(fieldDef, val)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(values)*(64/numeric.PrecisionStep))
+	for _, v := range values {
+		for _, term := range numeric.Terms(v) {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			w.buffer.AddPosting(fieldDef.Name, term, docID, 1, nil)
+		}
+	}
+	return nil
+}
+
+// numericValues parses a numeric field value (or array of values for
+// multi-valued fields) into sortable int64 form.
+func numericValues(fieldDef index.FieldDef, val interface{}) ([]int64, error) {
+	kind, _ := index.NumericKind(fieldDef.Type)
+	items, isArray := val.([]interface{})
+	if !isArray {
+		items = []interface{}{val}
+	} else if !fieldDef.MultiValued {
+		return nil, errors.New("field is not multi-valued but received array")
+	}
+	values := make([]int64, 0, len(items))
+	for _, item := range items {
+		v, err := kind.Encode(item)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", fieldDef.Name, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
 func extractExternalID(doc Document) (string, error) {
 	idVal, ok := doc.Fields["id"]
 	if !ok {
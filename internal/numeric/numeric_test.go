@@ -0,0 +1,234 @@
+package numeric
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// matchesRange reports whether any of value's trie terms is in terms.
+func matchesRange(terms map[string]bool, value int64) bool {
+	for _, t := range Terms(value) {
+		if terms[t] {
+			return true
+		}
+	}
+	return false
+}
+
+func splitTerms(lower, upper int64) map[string]bool {
+	terms := make(map[string]bool)
+	SplitRange(lower, upper, func(term string) { terms[term] = true })
+	return terms
+}
+
+func TestEncodeTerm_SortOrder(t *testing.T) {
+	values := []int64{math.MinInt64, -1 << 40, -300, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt64}
+	var terms []string
+	for _, v := range values {
+		terms = append(terms, EncodeTerm(v, 0))
+	}
+	if !sort.StringsAreSorted(terms) {
+		t.Error("full-precision terms should sort in value order")
+	}
+	for _, v := range values {
+		got, ok := DecodeTerm(EncodeTerm(v, 0))
+		if !ok || got != v {
+			t.Errorf("DecodeTerm(EncodeTerm(%d)) = %d, %v", v, got, ok)
+		}
+	}
+	if _, ok := DecodeTerm(EncodeTerm(5, PrecisionStep)); ok {
+		t.Error("DecodeTerm should reject lower-precision terms")
+	}
+}
+
+func TestSplitRange_Exact(t *testing.T) {
+	tests := []struct{ lower, upper int64 }{
+		{0, 0},
+		{-5, 5},
+		{1, 1000},
+		{-70000, 123456},
+		{250, 260},
+		{math.MinInt64, math.MinInt64 + 10},
+		{math.MaxInt64 - 10, math.MaxInt64},
+		{math.MinInt64, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		terms := splitTerms(tt.lower, tt.upper)
+		probes := []int64{tt.lower, tt.upper, tt.lower - 1, tt.upper + 1, (tt.lower / 2) + (tt.upper / 2)}
+		for _, v := range probes {
+			want := v >= tt.lower && v <= tt.upper
+			if got := matchesRange(terms, v); got != want {
+				t.Errorf("range [%d,%d]: value %d matched=%v, want %v", tt.lower, tt.upper, v, got, want)
+			}
+		}
+	}
+}
+
+func TestSplitRange_Random(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	wide := func() int64 { return int64(rng.Uint64()) }
+	narrow := func() int64 { return rng.Int63n(1<<20) - 1<<19 }
+	for i := 0; i < 400; i++ {
+		gen := narrow
+		if i%2 == 1 {
+			gen = wide
+		}
+		a, b := gen(), gen()
+		if a > b {
+			a, b = b, a
+		}
+		terms := splitTerms(a, b)
+		for j := 0; j < 50; j++ {
+			v := gen()
+			if j%5 == 0 {
+				v = a + int64(j) - 25
+			}
+			want := v >= a && v <= b
+			if got := matchesRange(terms, v); got != want {
+				t.Fatalf("range [%d,%d]: value %d matched=%v, want %v", a, b, v, got, want)
+			}
+		}
+	}
+}
+
+func TestSplitRange_Bounded(t *testing.T) {
+	terms := splitTerms(math.MinInt64, math.MaxInt64)
+	if len(terms) > 2*255*(64/PrecisionStep) {
+		t.Errorf("full range produced %d terms", len(terms))
+	}
+	if len(splitTerms(5, 4)) != 0 {
+		t.Error("empty range should produce no terms")
+	}
+}
+
+func TestDoubleToSortable_Order(t *testing.T) {
+	values := []float64{math.Inf(-1), -1e300, -2.5, -1, 0, 1e-300, 1, 2.5, 1e300, math.Inf(1)}
+	for i := 1; i < len(values); i++ {
+		if DoubleToSortable(values[i-1]) >= DoubleToSortable(values[i]) {
+			t.Errorf("sortable(%v) >= sortable(%v)", values[i-1], values[i])
+		}
+	}
+	for _, v := range values {
+		if got := SortableToDouble(DoubleToSortable(v)); got != v {
+			t.Errorf("round trip %v = %v", v, got)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int64
+	}{
+		{"2024-01-15T10:00:00Z", 1705312800000},
+		{"2024-01-15T12:00:00+02:00", 1705312800000},
+		{"2024-01-15T10:00:00.250Z", 1705312800250},
+		{"2024-01-15", 1705276800000},
+		{"2024", 1704067200000},
+		{"1705312800000", 1705312800000},
+		{float64(1705312800000), 1705312800000},
+		{json.Number("1705312800000"), 1705312800000},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.in)
+		if err != nil {
+			t.Errorf("ParseDate(%v) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDate(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseDate("yesterday"); !errors.Is(err, ErrInvalidDate) {
+		t.Errorf("expected ErrInvalidDate, got %v", err)
+	}
+	if got := FormatDate(1705312800250); got != "2024-01-15T10:00:00.250Z" {
+		t.Errorf("FormatDate = %s", got)
+	}
+}
+
+func TestParseLong(t *testing.T) {
+	for _, in := range []interface{}{float64(42), json.Number("42"), "42", json.Number("4.2e1")} {
+		if got, err := ParseLong(in); err != nil || got != 42 {
+			t.Errorf("ParseLong(%v) = %d, %v", in, got, err)
+		}
+	}
+	for _, in := range []interface{}{1.5, "abc", true} {
+		if _, err := ParseLong(in); !errors.Is(err, ErrInvalidLong) {
+			t.Errorf("ParseLong(%v): expected ErrInvalidLong, got %v", in, err)
+		}
+	}
+}
+
+func TestParseBoolean(t *testing.T) {
+	if b, err := ParseBoolean(true); err != nil || !b {
+		t.Errorf("ParseBoolean(true) = %v, %v", b, err)
+	}
+	if b, err := ParseBoolean("false"); err != nil || b {
+		t.Errorf("ParseBoolean(\"false\") = %v, %v", b, err)
+	}
+	if _, err := ParseBoolean("yes"); !errors.Is(err, ErrInvalidBoolean) {
+		t.Errorf("expected ErrInvalidBoolean, got %v", err)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]int64{"250ms": 250, "0s": 0, "90m": 5400000, "12h": 43200000, "7d": 604800000}
+	for in, want := range tests {
+		if got, err := ParseDuration(in); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "d", "7", "7w", "-1d", "1.5h", "9999999999999999d"} {
+		if _, err := ParseDuration(in); !errors.Is(err, ErrInvalidDuration) {
+			t.Errorf("ParseDuration(%q): expected ErrInvalidDuration, got %v", in, err)
+		}
+	}
+}
+
+func TestRangeBounds(t *testing.T) {
+	tests := []struct {
+		name           string
+		kind           Kind
+		lower, upper   interface{}
+		incLo, incHi   bool
+		wantLo, wantHi int64
+	}{
+		{"inclusive", KindLong, float64(10), float64(20), true, true, 10, 20},
+		{"exclusive", KindLong, float64(10), float64(20), false, false, 11, 19},
+		{"unbounded", KindLong, nil, nil, true, true, math.MinInt64, math.MaxInt64},
+		{"fractional long", KindLong, 1.5, 3.5, false, false, 2, 3},
+		{"boolean", KindBoolean, true, true, true, true, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lo, hi, err := tt.kind.RangeBounds(tt.lower, tt.upper, tt.incLo, tt.incHi)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lo != tt.wantLo || hi != tt.wantHi {
+				t.Errorf("bounds = [%d, %d], want [%d, %d]", lo, hi, tt.wantLo, tt.wantHi)
+			}
+		})
+	}
+
+	// Exclusive double bounds exclude exactly the bound value.
+	lo, hi, err := KindDouble.RangeBounds(1.0, 2.0, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lo <= DoubleToSortable(1.0) || hi >= DoubleToSortable(2.0) {
+		t.Error("exclusive double bounds should exclude the bound values")
+	}
+	if lo > DoubleToSortable(1.0000001) {
+		t.Error("exclusive lower bound excludes values above the bound")
+	}
+
+	if _, _, err := KindDate.RangeBounds("not a date", nil, true, true); !errors.Is(err, ErrInvalidDate) {
+		t.Errorf("expected ErrInvalidDate, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package numeric
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// PrecisionStep is the number of bits dropped between successive trie levels.
+// Every value is indexed once per level (64/PrecisionStep terms), and a range
+// query expands to at most 2*(2^PrecisionStep-1) terms per level.
+const PrecisionStep = 8
+
+// TermLength is the byte length of every encoded trie term.
+const TermLength = 9
+
+// EncodeTerm returns the trie term for value at the given shift. The first
+// byte is the shift; the remaining eight bytes are the big-endian sortable
+// bits of value with the lowest shift bits dropped, so terms of one level
+// sort in value order.
+func EncodeTerm(value int64, shift uint) string {
+	return encodePrefix(toSortable(value)>>shift, shift)
+}
+
+// DecodeTerm returns the value encoded in a full-precision (shift 0) term.
+func DecodeTerm(term string) (int64, bool) {
+	if len(term) != TermLength || term[0] != 0 {
+		return 0, false
+	}
+	return fromSortable(binary.BigEndian.Uint64([]byte(term[1:]))), true
+}
+
+// Terms returns the trie terms to index for a value, one per level.
+func Terms(value int64) []string {
+	terms := make([]string, 0, 64/PrecisionStep)
+	for shift := uint(0); shift < 64; shift += PrecisionStep {
+		terms = append(terms, EncodeTerm(value, shift))
+	}
+	return terms
+}
+
+// SplitRange decomposes the inclusive range [lower, upper] into the minimal
+// set of trie terms that together match exactly the values in the range,
+// calling fn for each term. Nothing is emitted when lower > upper.
+func SplitRange(lower, upper int64, fn func(term string)) {
+	if lower > upper {
+		return
+	}
+	minBound, maxBound := toSortable(lower), toSortable(upper)
+	for shift := uint(0); ; shift += PrecisionStep {
+		nextShift := shift + PrecisionStep
+		if nextShift >= 64 {
+			emitRange(minBound, maxBound, shift, fn)
+			return
+		}
+		diff := uint64(1) << nextShift
+		mask := (uint64(1)<<PrecisionStep - 1) << shift
+		hasLower := minBound&mask != 0
+		hasUpper := maxBound&mask != mask
+
+		nextMin := minBound &^ mask
+		if hasLower {
+			nextMin += diff
+		}
+		nextMax := maxBound &^ mask
+		if hasUpper {
+			nextMax -= diff
+		}
+		lowerWrapped := nextMin < minBound
+		upperWrapped := nextMax > maxBound
+
+		if lowerWrapped || upperWrapped || nextMin > nextMax {
+			// The remaining range fits within this level.
+			emitRange(minBound, maxBound, shift, fn)
+			return
+		}
+		if hasLower {
+			emitRange(minBound, minBound|mask, shift, fn)
+		}
+		if hasUpper {
+			emitRange(maxBound&^mask, maxBound, shift, fn)
+		}
+		minBound, maxBound = nextMin, nextMax
+	}
+}
+
+// emitRange emits every term of the given level between the sortable bounds.
+func emitRange(minBound, maxBound uint64, shift uint, fn func(term string)) {
+	lo, hi := minBound>>shift, maxBound>>shift
+	for p := lo; ; p++ {
+		fn(encodePrefix(p, shift))
+		if p == hi {
+			return
+		}
+	}
+}
+
+func encodePrefix(prefix uint64, shift uint) string {
+	var b [TermLength]byte
+	b[0] = byte(shift)
+	binary.BigEndian.PutUint64(b[1:], prefix)
+	return string(b[:])
+}
+
+// toSortable flips the sign bit so that unsigned order matches signed order.
+func toSortable(v int64) uint64 {
+	return uint64(v) ^ (1 << 63)
+}
+
+func fromSortable(u uint64) int64 {
+	return int64(u ^ (1 << 63))
+}
+
+// DoubleToSortable maps a float64 to an int64 whose ordering matches the
+// ordering of the floats, so doubles can share the long trie encoding.
+func DoubleToSortable(f float64) int64 {
+	bits := int64(math.Float64bits(f))
+	if bits < 0 {
+		bits ^= math.MaxInt64
+	}
+	return bits
+}
+
+// SortableToDouble is the inverse of DoubleToSortable.
+func SortableToDouble(v int64) float64 {
+	if v < 0 {
+		v ^= math.MaxInt64
+	}
+	return math.Float64frombits(uint64(v))
+}
@@ -0,0 +1,269 @@
+package numeric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind identifies how a field's values map onto the sortable int64 space
+// shared by the trie index and doc values.
+type Kind int
+
+const (
+	KindLong Kind = iota + 1
+	KindDouble
+	KindDate
+	KindBoolean
+)
+
+var (
+	ErrInvalidLong     = errors.New("invalid long value")
+	ErrInvalidDouble   = errors.New("invalid double value")
+	ErrInvalidDate     = errors.New("invalid date value")
+	ErrInvalidBoolean  = errors.New("invalid boolean value")
+	ErrInvalidDuration = errors.New("invalid duration")
+)
+
+// dateLayouts are the ISO-8601 forms accepted for date strings, tried in order.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// Encode converts a JSON-decoded value into its sortable int64 form.
+func (k Kind) Encode(v interface{}) (int64, error) {
+	switch k {
+	case KindLong:
+		return ParseLong(v)
+	case KindDouble:
+		f, err := ParseDouble(v)
+		if err != nil {
+			return 0, err
+		}
+		return DoubleToSortable(f), nil
+	case KindDate:
+		return ParseDate(v)
+	case KindBoolean:
+		b, err := ParseBoolean(v)
+		if err != nil {
+			return 0, err
+		}
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unknown numeric kind %d", k)
+	}
+}
+
+// Decode converts a sortable int64 back into a JSON-friendly value:
+// int64 for longs, float64 for doubles, an RFC 3339 string for dates and
+// bool for booleans.
+func (k Kind) Decode(v int64) interface{} {
+	switch k {
+	case KindDouble:
+		return SortableToDouble(v)
+	case KindDate:
+		return FormatDate(v)
+	case KindBoolean:
+		return v != 0
+	default:
+		return v
+	}
+}
+
+// RangeBounds converts query bounds into an inclusive sortable range.
+// A nil bound is unbounded. The returned range is empty when lo > hi.
+func (k Kind) RangeBounds(lower, upper interface{}, includeLower, includeUpper bool) (lo, hi int64, err error) {
+	lo, hi = math.MinInt64, math.MaxInt64
+	if lower != nil {
+		var exact bool
+		lo, exact, err = k.bound(lower, true)
+		if err != nil {
+			return 0, 0, fmt.Errorf("lower bound: %w", err)
+		}
+		if !includeLower && exact {
+			if lo == math.MaxInt64 {
+				return 1, 0, nil
+			}
+			lo++
+		}
+	}
+	if upper != nil {
+		var exact bool
+		hi, exact, err = k.bound(upper, false)
+		if err != nil {
+			return 0, 0, fmt.Errorf("upper bound: %w", err)
+		}
+		if !includeUpper && exact {
+			if hi == math.MinInt64 {
+				return 1, 0, nil
+			}
+			hi--
+		}
+	}
+	return lo, hi, nil
+}
+
+// bound encodes a range bound. For longs, a fractional bound is rounded
+// inwards (ceil for lower, floor for upper) and reported as inexact, since
+// exclusivity no longer applies to a value that cannot be indexed.
+func (k Kind) bound(v interface{}, isLower bool) (int64, bool, error) {
+	if k != KindLong {
+		x, err := k.Encode(v)
+		return x, true, err
+	}
+	if x, err := ParseLong(v); err == nil {
+		return x, true, nil
+	}
+	f, err := ParseDouble(v)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: %v", ErrInvalidLong, v)
+	}
+	if isLower {
+		f = math.Ceil(f)
+	} else {
+		f = math.Floor(f)
+	}
+	switch {
+	case f >= math.MaxInt64:
+		return math.MaxInt64, false, nil
+	case f <= math.MinInt64:
+		return math.MinInt64, false, nil
+	}
+	return int64(f), false, nil
+}
+
+// ParseLong parses an integral JSON value.
+func ParseLong(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case float64:
+		if x != math.Trunc(x) || x < math.MinInt64 || x >= math.MaxInt64 {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidLong, x)
+		}
+		return int64(x), nil
+	case json.Number:
+		return ParseLong(string(x))
+	case string:
+		s := strings.TrimSpace(x)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		// Accept integral values written in float notation, e.g. "1e3".
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return ParseLong(f)
+		}
+		return 0, fmt.Errorf("%w: %q", ErrInvalidLong, x)
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrInvalidLong, v)
+	}
+}
+
+// ParseDouble parses a numeric JSON value.
+func ParseDouble(v interface{}) (float64, error) {
+	var f float64
+	switch x := v.(type) {
+	case int:
+		f = float64(x)
+	case int64:
+		f = float64(x)
+	case float64:
+		f = x
+	case json.Number:
+		return ParseDouble(string(x))
+	case string:
+		var err error
+		f, err = strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidDouble, x)
+		}
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrInvalidDouble, v)
+	}
+	if math.IsNaN(f) {
+		return 0, fmt.Errorf("%w: NaN", ErrInvalidDouble)
+	}
+	return f, nil
+}
+
+// ParseDate parses an ISO-8601 string or epoch milliseconds (as a number or
+// a string of digits) into epoch milliseconds. Strings without a zone are UTC.
+// As with ISO-8601 itself, a four-digit string is read as a year.
+func ParseDate(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case string:
+		s := strings.TrimSpace(x)
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UnixMilli(), nil
+			}
+		}
+		if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return ms, nil
+		}
+		return 0, fmt.Errorf("%w: %q", ErrInvalidDate, x)
+	default:
+		ms, err := ParseLong(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidDate, v)
+		}
+		return ms, nil
+	}
+}
+
+// FormatDate renders epoch milliseconds as an RFC 3339 UTC string.
+func FormatDate(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// durationUnits are the units of a fixed duration, in milliseconds.
+var durationUnits = map[string]int64{
+	"ms": 1,
+	"s":  1000,
+	"m":  60 * 1000,
+	"h":  60 * 60 * 1000,
+	"d":  24 * 60 * 60 * 1000,
+}
+
+// ParseDuration parses a whole number followed by a unit of ms, s, m, h or
+// d, such as "90m", into milliseconds.
+func ParseDuration(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i > 0 {
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		if unit, ok := durationUnits[s[i:]]; ok && err == nil && n <= math.MaxInt64/unit {
+			return n * unit, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, s)
+}
+
+// ParseBoolean parses a JSON boolean or its string form.
+func ParseBoolean(v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		switch strings.TrimSpace(x) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%w: %v", ErrInvalidBoolean, v)
+}
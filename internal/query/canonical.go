@@ -0,0 +1,138 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Canonical returns a string identifying the documents q matches, for use
+// as a cache key: queries with the same canonical form match the same
+// documents. Boosts and other options that only affect scores are left
+// out, and boolean clauses are sorted, so reordering them does not change
+// the key.
+func Canonical(q Query) string {
+	var sb strings.Builder
+	writeCanonical(&sb, q)
+	return sb.String()
+}
+
+func writeCanonical(sb *strings.Builder, q Query) {
+	switch v := q.(type) {
+	case *TermQuery:
+		fmt.Fprintf(sb, "term(%q:%q)", v.Field, v.Term)
+	case *PrefixQuery:
+		fmt.Fprintf(sb, "prefix(%q:%q)", v.Field, v.Prefix)
+	case *WildcardQuery:
+		fmt.Fprintf(sb, "wildcard(%q:%q)", v.Field, v.Pattern)
+	case *RegexQuery:
+		fmt.Fprintf(sb, "regex(%q:%q)", v.Field, v.Pattern)
+	case *FuzzyQuery:
+		fmt.Fprintf(sb, "fuzzy(%q:%q~%d,%d)", v.Field, v.Term, v.MaxDistance, v.PrefixLength)
+	case *PhraseQuery:
+		fmt.Fprintf(sb, "phrase(%q:%s@%v~%d)", v.Field, quoteAll(v.Terms), v.Positions, v.Slop)
+	case *ProximityQuery:
+		fmt.Fprintf(sb, "proximity(%q:%s~%d)", v.Field, quoteAll(v.Terms), v.Slop)
+	case *RangeQuery:
+		lower, upper := "[", "]"
+		if !v.IncludeLower {
+			lower = "{"
+		}
+		if !v.IncludeUpper {
+			upper = "}"
+		}
+		// Bounds keep their type: a string and a number may not compare alike.
+		fmt.Fprintf(sb, "range(%q:%s%T:%v,%T:%v%s)", v.Field, lower, v.Lower, v.Lower, v.Upper, v.Upper, upper)
+	case *MatchQuery:
+		fmt.Fprintf(sb, "match(%q:%q,%d,%d)", v.Field, v.Text, v.Operator, v.MinimumShouldMatch)
+	case *MultiMatchQuery:
+		fields := make([]string, len(v.Fields))
+		for i, f := range v.Fields {
+			fields[i] = f.Field
+		}
+		fmt.Fprintf(sb, "multi_match(%s:%q,%s,%d,%d)", quoteAll(fields), v.Text, v.Mode, v.Operator, v.MinimumShouldMatch)
+	case *BlendedTermQuery:
+		fields := make([]string, len(v.Terms))
+		for i, t := range v.Terms {
+			fields[i] = strconv.Quote(t.Field) + ":" + strconv.Quote(t.Term)
+		}
+		sort.Strings(fields)
+		sb.WriteString("blended(" + strings.Join(fields, " ") + ")")
+	case *BooleanQuery:
+		clauses := make([]string, len(v.Clauses))
+		for i, c := range v.Clauses {
+			clauses[i] = strconv.Itoa(int(c.Occur)) + Canonical(c.Query)
+		}
+		sort.Strings(clauses)
+		fmt.Fprintf(sb, "bool(%s)~%d", strings.Join(clauses, " "), v.MinimumShouldMatch)
+	case *DisMaxQuery:
+		// Matches are those of any alternative, as in a disjunction.
+		queries := make([]string, len(v.Queries))
+		for i, sub := range v.Queries {
+			queries[i] = Canonical(sub)
+		}
+		sort.Strings(queries)
+		sb.WriteString("any(" + strings.Join(queries, " ") + ")")
+	case *ConstantScoreQuery:
+		writeCanonical(sb, v.Filter)
+	case *FunctionScoreQuery:
+		// Functions only score the matches of the query.
+		if v.Query == nil {
+			sb.WriteString("all()")
+		} else {
+			writeCanonical(sb, v.Query)
+		}
+	case *MatchAllQuery:
+		sb.WriteString("all()")
+	case *MatchNoneQuery:
+		sb.WriteString("none()")
+	default:
+		fmt.Fprintf(sb, "%T%+v", q, q)
+	}
+}
+
+// TimeDependent reports whether the scores of q depend on the current time,
+// as those of decay functions from "now" do, so that its results cannot be
+// cached.
+func TimeDependent(q Query) bool {
+	switch v := q.(type) {
+	case *BooleanQuery:
+		for _, c := range v.Clauses {
+			if TimeDependent(c.Query) {
+				return true
+			}
+		}
+	case *DisMaxQuery:
+		for _, sub := range v.Queries {
+			if TimeDependent(sub) {
+				return true
+			}
+		}
+	case *ConstantScoreQuery:
+		return TimeDependent(v.Filter)
+	case *FunctionScoreQuery:
+		if v.Query != nil && TimeDependent(v.Query) {
+			return true
+		}
+		for _, f := range v.Functions {
+			if f.Decay != nil {
+				if s, ok := f.Decay.Origin.(string); f.Decay.Origin == nil || ok && strings.TrimSpace(s) == "now" {
+					return true
+				}
+			}
+			if f.Filter != nil && TimeDependent(f.Filter) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func quoteAll(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = strconv.Quote(t)
+	}
+	return "[" + strings.Join(quoted, " ") + "]"
+}
@@ -0,0 +1,771 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Clause types accepted by the JSON query DSL.
+const (
+	ClauseTerm          = "term"
+	ClauseMatch         = "match"
+	ClauseMultiMatch    = "multi_match"
+	ClausePrefix        = "prefix"
+	ClauseWildcard      = "wildcard"
+	ClauseRegex         = "regex"
+	ClauseFuzzy         = "fuzzy"
+	ClausePhrase        = "phrase"
+	ClauseProximity     = "proximity"
+	ClauseRange         = "range"
+	ClauseBool          = "bool"
+	ClauseDisMax        = "dis_max"
+	ClauseConstantScore = "constant_score"
+	ClauseFunctionScore = "function_score"
+	ClauseMatchAll      = "match_all"
+	ClauseMatchNone     = "match_none"
+)
+
+// Operators combining the terms of a match clause.
+const (
+	OperatorOr  = "or"
+	OperatorAnd = "and"
+)
+
+// Modes of a multi_match clause.
+const (
+	MultiMatchBestFields  = "best_fields"
+	MultiMatchMostFields  = "most_fields"
+	MultiMatchCrossFields = "cross_fields"
+)
+
+// Modes combining the values of a function_score clause's functions
+// (score_mode) and their result with the query score (boost_mode).
+// CombineFirst only applies to score_mode and CombineReplace to boost_mode.
+const (
+	CombineMultiply = "multiply"
+	CombineSum      = "sum"
+	CombineAvg      = "avg"
+	CombineMax      = "max"
+	CombineMin      = "min"
+	CombineFirst    = "first"
+	CombineReplace  = "replace"
+)
+
+// Modifiers applied by a field_value_factor function. The log modifiers
+// are base 10 and the ln modifiers natural; the 1p and 2p forms add one or
+// two to the value first.
+const (
+	ModifierNone       = "none"
+	ModifierLog        = "log"
+	ModifierLog1p      = "log1p"
+	ModifierLog2p      = "log2p"
+	ModifierLn         = "ln"
+	ModifierLn1p       = "ln1p"
+	ModifierLn2p       = "ln2p"
+	ModifierSquare     = "square"
+	ModifierSqrt       = "sqrt"
+	ModifierReciprocal = "reciprocal"
+)
+
+// Shapes of a decay function.
+const (
+	DecayGauss  = "gauss"
+	DecayExp    = "exp"
+	DecayLinear = "linear"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Clause is the JSON form of a query. The Type discriminates which of the
+// remaining fields apply; an empty Type is a term query, so the original
+// {"type", "field", "value"} request shape remains valid.
+//
+//	{"type": "term", "field": "title", "value": "search"}
+//	{"type": "match", "field": "title", "value": "Quick Search", "operator": "and"}
+//	{"type": "range", "field": "price", "gte": 10, "lt": 20}
+//	{"type": "bool", "must": [...], "filter": [...], "should": [...], "must_not": [...]}
+//	{"type": "dis_max", "queries": [...], "tie_breaker": 0.3}
+//	{"type": "constant_score", "filter": {...}, "boost": 2}
+//	{"type": "function_score", "query": {...}, "functions": [...], "score_mode": "sum"}
+//
+// A clause may also be wrapped in an object keyed by its type, e.g.
+// {"range": {"field": "price", "gte": 10}}.
+type Clause struct {
+	Type  string      `json:"type"`
+	Field string      `json:"field,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	Boost float32     `json:"boost,omitempty"`
+
+	// Prefix and Pattern are accepted in place of Value for prefix,
+	// wildcard and regex clauses.
+	Prefix  string `json:"prefix,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+
+	// Fuzzy options. A nil Fuzziness selects the distance from the term length.
+	Fuzziness    *int `json:"fuzziness,omitempty"`
+	PrefixLength int  `json:"prefix_length,omitempty"`
+
+	// Match options. Operator is "or" (the default) or "and";
+	// MinimumShouldMatch also applies to the terms of an "or" match.
+	Operator string `json:"operator,omitempty"`
+
+	// Multi-match options. Fields may carry a boost, as in "title^3".
+	Fields     []string `json:"fields,omitempty"`
+	Mode       string   `json:"mode,omitempty"`
+	TieBreaker float32  `json:"tie_breaker,omitempty"`
+
+	// Phrase and proximity options.
+	Terms []string `json:"terms,omitempty"`
+	Slop  int      `json:"slop,omitempty"`
+
+	// Range bounds. At most one lower and one upper bound may be set.
+	GT  interface{} `json:"gt,omitempty"`
+	GTE interface{} `json:"gte,omitempty"`
+	LT  interface{} `json:"lt,omitempty"`
+	LTE interface{} `json:"lte,omitempty"`
+
+	// Boolean clauses.
+	Must               []Clause `json:"must,omitempty"`
+	Should             []Clause `json:"should,omitempty"`
+	MustNot            []Clause `json:"must_not,omitempty"`
+	MinimumShouldMatch int      `json:"minimum_should_match,omitempty"`
+
+	// Dis-max alternatives; TieBreaker weighs the non-best scores.
+	Queries []Clause `json:"queries,omitempty"`
+
+	// Filter holds the unscored clauses of a bool clause, which must all
+	// match, or the single query whose matches a constant_score clause
+	// scores.
+	Filter ClauseList `json:"filter,omitempty"`
+
+	// Function score options. Query defaults to match_all.
+	Query     *Clause          `json:"query,omitempty"`
+	Functions []FunctionClause `json:"functions,omitempty"`
+	ScoreMode string           `json:"score_mode,omitempty"`
+	BoostMode string           `json:"boost_mode,omitempty"`
+}
+
+// FunctionClause is the JSON form of a function_score function: an
+// optional filter and weight, and at most one of field_value_factor,
+// gauss, exp, linear and random_score.
+//
+//	{"field_value_factor": {"field": "likes", "factor": 1.2, "modifier": "log1p", "missing": 0}}
+//	{"gauss": {"field": "published", "origin": "now", "scale": "10d", "offset": "1d", "decay": 0.5}}
+//	{"random_score": {"seed": 42}}
+//	{"filter": {"term": {"field": "tag", "value": "go"}}, "weight": 2}
+type FunctionClause struct {
+	Filter           *Clause                 `json:"filter,omitempty"`
+	Weight           *float32                `json:"weight,omitempty"`
+	FieldValueFactor *FieldValueFactorClause `json:"field_value_factor,omitempty"`
+	Gauss            *DecayClause            `json:"gauss,omitempty"`
+	Exp              *DecayClause            `json:"exp,omitempty"`
+	Linear           *DecayClause            `json:"linear,omitempty"`
+	RandomScore      *RandomScoreClause      `json:"random_score,omitempty"`
+}
+
+// FieldValueFactorClause is the JSON form of a field_value_factor function.
+// Factor defaults to 1 and Modifier to "none".
+type FieldValueFactorClause struct {
+	Field    string   `json:"field"`
+	Factor   *float64 `json:"factor,omitempty"`
+	Modifier string   `json:"modifier,omitempty"`
+	Missing  *float64 `json:"missing,omitempty"`
+}
+
+// DecayClause is the JSON form of a gauss, exp or linear decay function.
+// Decay defaults to 0.5.
+type DecayClause struct {
+	Field  string      `json:"field"`
+	Origin interface{} `json:"origin,omitempty"`
+	Scale  interface{} `json:"scale"`
+	Offset interface{} `json:"offset,omitempty"`
+	Decay  *float64    `json:"decay,omitempty"`
+}
+
+// RandomScoreClause is the JSON form of a random_score function. The seed
+// is required, so that results are reproducible.
+type RandomScoreClause struct {
+	Seed  *int64 `json:"seed,omitempty"`
+	Field string `json:"field,omitempty"`
+}
+
+// ClauseList is a list of clauses that may also be written as a single
+// clause object.
+type ClauseList []Clause
+
+// UnmarshalJSON decodes either a clause array or a single clause.
+func (l *ClauseList) UnmarshalJSON(data []byte) error {
+	if isJSONObject(data) {
+		var c Clause
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		*l = ClauseList{c}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]Clause)(l))
+}
+
+// wrappedTypes maps the keys of the wrapped clause form to clause types.
+var wrappedTypes = map[string]string{
+	ClauseTerm:          ClauseTerm,
+	ClauseMatch:         ClauseMatch,
+	ClauseMultiMatch:    ClauseMultiMatch,
+	ClausePrefix:        ClausePrefix,
+	ClauseWildcard:      ClauseWildcard,
+	ClauseRegex:         ClauseRegex,
+	"regexp":            ClauseRegex,
+	ClauseFuzzy:         ClauseFuzzy,
+	ClausePhrase:        ClausePhrase,
+	ClauseProximity:     ClauseProximity,
+	ClauseRange:         ClauseRange,
+	ClauseBool:          ClauseBool,
+	ClauseDisMax:        ClauseDisMax,
+	ClauseMatchAll:      ClauseMatchAll,
+	ClauseMatchNone:     ClauseMatchNone,
+	ClauseConstantScore: ClauseConstantScore,
+	ClauseFunctionScore: ClauseFunctionScore,
+}
+
+// clauseFields has Clause's fields without its UnmarshalJSON method.
+type clauseFields Clause
+
+// UnmarshalJSON decodes both the flat and the wrapped clause forms.
+// Numbers are always decoded as json.Number so that large longs keep full
+// precision, whatever decoder options the caller used.
+func (c *Clause) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) == 1 {
+		for key, inner := range fields {
+			if typ, ok := wrappedTypes[key]; ok && isJSONObject(inner) {
+				if err := decodeUseNumber(inner, (*clauseFields)(c)); err != nil {
+					return err
+				}
+				c.Type = typ
+				return nil
+			}
+		}
+	}
+	return decodeUseNumber(data, (*clauseFields)(c))
+}
+
+func isJSONObject(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+func decodeUseNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Parse decodes a JSON clause and converts it into a query AST.
+func Parse(data []byte) (Query, error) {
+	var c Clause
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return c.ToQuery()
+}
+
+// ToQuery validates the clause and converts it into a query AST.
+func (c *Clause) ToQuery() (Query, error) {
+	return c.toQuery(0)
+}
+
+func (c *Clause) toQuery(depth int) (Query, error) {
+	switch c.Type {
+	case "", ClauseTerm:
+		value, err := c.stringValue()
+		if err != nil {
+			return nil, err
+		}
+		return &TermQuery{Field: c.Field, Term: value, Boost: c.Boost}, nil
+	case ClauseMatch:
+		return c.matchQuery()
+	case ClauseMultiMatch:
+		return c.multiMatchQuery()
+	case ClausePrefix:
+		value, err := c.stringValue()
+		if err != nil {
+			return nil, err
+		}
+		return &PrefixQuery{Field: c.Field, Prefix: value, Boost: c.Boost}, nil
+	case ClauseWildcard:
+		value, err := c.stringValue()
+		if err != nil {
+			return nil, err
+		}
+		return &WildcardQuery{Field: c.Field, Pattern: value, Boost: c.Boost}, nil
+	case ClauseRegex:
+		value, err := c.stringValue()
+		if err != nil {
+			return nil, err
+		}
+		return &RegexQuery{Field: c.Field, Pattern: value, Boost: c.Boost}, nil
+	case ClauseFuzzy:
+		return c.fuzzyQuery()
+	case ClausePhrase, ClauseProximity:
+		return c.phraseQuery()
+	case ClauseRange:
+		return c.rangeQuery()
+	case ClauseBool:
+		return c.boolQuery(depth)
+	case ClauseDisMax:
+		return c.disMaxQuery(depth)
+	case ClauseConstantScore:
+		return c.constantScoreQuery(depth)
+	case ClauseFunctionScore:
+		return c.functionScoreQuery(depth)
+	case ClauseMatchAll:
+		return &MatchAllQuery{Boost: c.Boost}, nil
+	case ClauseMatchNone:
+		return &MatchNoneQuery{}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown query type %q", ErrInvalidQuery, c.Type)
+	}
+}
+
+// stringValue returns the clause value as a term string. Numbers and
+// booleans are accepted so that term queries on numeric fields can be
+// written naturally.
+func (c *Clause) stringValue() (string, error) {
+	if c.Field == "" {
+		return "", fmt.Errorf("%w: %s query requires a field", ErrInvalidQuery, c.typeName())
+	}
+	var value string
+	switch v := c.Value.(type) {
+	case nil:
+		value = c.Prefix
+		if c.Pattern != "" {
+			value = c.Pattern
+		}
+	case string:
+		value = v
+	case json.Number:
+		value = v.String()
+	case float64:
+		value = strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		value = strconv.FormatBool(v)
+	default:
+		return "", fmt.Errorf("%w: %s query value must be a string, number or boolean", ErrInvalidQuery, c.typeName())
+	}
+	if value == "" {
+		return "", fmt.Errorf("%w: %s query requires a value", ErrInvalidQuery, c.typeName())
+	}
+	return value, nil
+}
+
+func (c *Clause) typeName() string {
+	if c.Type == "" {
+		return ClauseTerm
+	}
+	return c.Type
+}
+
+func (c *Clause) matchQuery() (Query, error) {
+	value, err := c.stringValue()
+	if err != nil {
+		return nil, err
+	}
+	op, err := c.matchOperator()
+	if err != nil {
+		return nil, err
+	}
+	return &MatchQuery{
+		Field:              c.Field,
+		Text:               value,
+		Operator:           op,
+		MinimumShouldMatch: c.MinimumShouldMatch,
+		Boost:              c.Boost,
+	}, nil
+}
+
+// matchOperator validates the operator and minimum_should_match of a match
+// or multi_match clause and returns the occurrence of its terms.
+func (c *Clause) matchOperator() (BooleanOp, error) {
+	op := BooleanShould
+	switch c.Operator {
+	case "", OperatorOr:
+	case OperatorAnd:
+		op = BooleanMust
+	default:
+		return 0, fmt.Errorf("%w: operator must be %q or %q", ErrInvalidQuery, OperatorOr, OperatorAnd)
+	}
+	if c.MinimumShouldMatch < 0 {
+		return 0, fmt.Errorf("%w: minimum_should_match must not be negative", ErrInvalidQuery)
+	}
+	if c.MinimumShouldMatch > 0 && op == BooleanMust {
+		return 0, fmt.Errorf("%w: minimum_should_match requires operator %q", ErrInvalidQuery, OperatorOr)
+	}
+	return op, nil
+}
+
+func (c *Clause) multiMatchQuery() (Query, error) {
+	if c.Field != "" {
+		return nil, fmt.Errorf("%w: multi_match query takes fields, not field", ErrInvalidQuery)
+	}
+	if len(c.Fields) == 0 {
+		return nil, fmt.Errorf("%w: multi_match query requires fields", ErrInvalidQuery)
+	}
+	if len(c.Fields) > MaxBooleanClauses {
+		return nil, fmt.Errorf("%w: multi_match query exceeds %d fields", ErrInvalidQuery, MaxBooleanClauses)
+	}
+	// stringValue requires a field; any will do to read the value.
+	withField := *c
+	withField.Field = c.Fields[0]
+	value, err := withField.stringValue()
+	if err != nil {
+		return nil, err
+	}
+	op, err := c.matchOperator()
+	if err != nil {
+		return nil, err
+	}
+	mode := c.Mode
+	switch mode {
+	case "":
+		mode = MultiMatchBestFields
+	case MultiMatchBestFields, MultiMatchMostFields, MultiMatchCrossFields:
+	default:
+		return nil, fmt.Errorf("%w: mode must be %q, %q or %q", ErrInvalidQuery,
+			MultiMatchBestFields, MultiMatchMostFields, MultiMatchCrossFields)
+	}
+	if c.TieBreaker < 0 || c.TieBreaker > 1 {
+		return nil, fmt.Errorf("%w: tie_breaker must be between 0 and 1", ErrInvalidQuery)
+	}
+
+	q := &MultiMatchQuery{
+		Fields:             make([]FieldBoost, len(c.Fields)),
+		Text:               value,
+		Mode:               mode,
+		TieBreaker:         c.TieBreaker,
+		Operator:           op,
+		MinimumShouldMatch: c.MinimumShouldMatch,
+		Boost:              c.Boost,
+	}
+	for i, f := range c.Fields {
+		if q.Fields[i], err = parseFieldBoost(f); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// parseFieldBoost parses a field name with an optional boost, such as
+// "title^3".
+func parseFieldBoost(s string) (FieldBoost, error) {
+	name, boost, found := strings.Cut(s, "^")
+	if name == "" {
+		return FieldBoost{}, fmt.Errorf("%w: field %q has no name", ErrInvalidQuery, s)
+	}
+	fb := FieldBoost{Field: name, Boost: 1}
+	if found {
+		b, err := strconv.ParseFloat(boost, 32)
+		if err != nil || b < 0 || math.IsInf(b, 0) {
+			return FieldBoost{}, fmt.Errorf("%w: field %q has an invalid boost", ErrInvalidQuery, s)
+		}
+		fb.Boost = float32(b)
+	}
+	return fb, nil
+}
+
+func (c *Clause) fuzzyQuery() (Query, error) {
+	value, err := c.stringValue()
+	if err != nil {
+		return nil, err
+	}
+	distance := AutoFuzziness(value)
+	if c.Fuzziness != nil {
+		distance = *c.Fuzziness
+	}
+	if distance < 0 || distance > MaxFuzzyDistance {
+		return nil, fmt.Errorf("%w: fuzziness must be between 0 and %d", ErrInvalidQuery, MaxFuzzyDistance)
+	}
+	if c.PrefixLength < 0 {
+		return nil, fmt.Errorf("%w: prefix_length must not be negative", ErrInvalidQuery)
+	}
+	return &FuzzyQuery{
+		Field:        c.Field,
+		Term:         value,
+		MaxDistance:  distance,
+		PrefixLength: c.PrefixLength,
+		Boost:        c.Boost,
+	}, nil
+}
+
+// AutoFuzziness returns the edit distance used when a fuzzy query does not
+// specify one: exact below MinFuzzyTermLength bytes, one edit up to five
+// bytes and MaxFuzzyDistance beyond that.
+func AutoFuzziness(term string) int {
+	switch {
+	case len(term) < MinFuzzyTermLength:
+		return 0
+	case len(term) <= 5:
+		return 1
+	default:
+		return MaxFuzzyDistance
+	}
+}
+
+func (c *Clause) phraseQuery() (Query, error) {
+	if c.Field == "" {
+		return nil, fmt.Errorf("%w: %s query requires a field", ErrInvalidQuery, c.Type)
+	}
+	if len(c.Terms) == 0 {
+		return nil, fmt.Errorf("%w: %s query requires terms", ErrInvalidQuery, c.Type)
+	}
+	if c.Slop < 0 {
+		return nil, fmt.Errorf("%w: slop must not be negative", ErrInvalidQuery)
+	}
+	if c.Type == ClausePhrase {
+		if len(c.Terms) > MaxPhraseLength {
+			return nil, fmt.Errorf("%w: phrase exceeds %d terms", ErrInvalidQuery, MaxPhraseLength)
+		}
+		return &PhraseQuery{Field: c.Field, Terms: c.Terms, Slop: c.Slop, Boost: c.Boost}, nil
+	}
+	if len(c.Terms) > MaxProximityTerms {
+		return nil, fmt.Errorf("%w: proximity query exceeds %d terms", ErrInvalidQuery, MaxProximityTerms)
+	}
+	if c.Slop > MaxProximitySlop {
+		return nil, fmt.Errorf("%w: slop exceeds %d", ErrInvalidQuery, MaxProximitySlop)
+	}
+	return &ProximityQuery{Field: c.Field, Terms: c.Terms, Slop: c.Slop, Boost: c.Boost}, nil
+}
+
+func (c *Clause) rangeQuery() (Query, error) {
+	if c.Field == "" {
+		return nil, fmt.Errorf("%w: range query requires a field", ErrInvalidQuery)
+	}
+	if c.GT != nil && c.GTE != nil {
+		return nil, fmt.Errorf("%w: range query cannot set both gt and gte", ErrInvalidQuery)
+	}
+	if c.LT != nil && c.LTE != nil {
+		return nil, fmt.Errorf("%w: range query cannot set both lt and lte", ErrInvalidQuery)
+	}
+	q := &RangeQuery{Field: c.Field, IncludeLower: true, IncludeUpper: true, Boost: c.Boost}
+	switch {
+	case c.GT != nil:
+		q.Lower, q.IncludeLower = c.GT, false
+	case c.GTE != nil:
+		q.Lower = c.GTE
+	}
+	switch {
+	case c.LT != nil:
+		q.Upper, q.IncludeUpper = c.LT, false
+	case c.LTE != nil:
+		q.Upper = c.LTE
+	}
+	return q, nil
+}
+
+func (c *Clause) boolQuery(depth int) (Query, error) {
+	if depth >= MaxBooleanDepth {
+		return nil, fmt.Errorf("%w: boolean nesting exceeds depth %d", ErrInvalidQuery, MaxBooleanDepth)
+	}
+	total := len(c.Must) + len(c.Filter) + len(c.Should) + len(c.MustNot)
+	if total == 0 {
+		return nil, fmt.Errorf("%w: bool query requires at least one clause", ErrInvalidQuery)
+	}
+	if total > MaxBooleanClauses {
+		return nil, fmt.Errorf("%w: bool query exceeds %d clauses", ErrInvalidQuery, MaxBooleanClauses)
+	}
+	if c.MinimumShouldMatch < 0 || c.MinimumShouldMatch > len(c.Should) {
+		return nil, fmt.Errorf("%w: minimum_should_match must be between 0 and the number of should clauses", ErrInvalidQuery)
+	}
+
+	bq := &BooleanQuery{
+		Clauses:            make([]BooleanClause, 0, total),
+		MinimumShouldMatch: c.MinimumShouldMatch,
+	}
+	groups := []struct {
+		occur   BooleanOp
+		clauses []Clause
+	}{
+		{BooleanMust, c.Must},
+		{BooleanFilter, c.Filter},
+		{BooleanShould, c.Should},
+		{BooleanMustNot, c.MustNot},
+	}
+	for _, g := range groups {
+		for i := range g.clauses {
+			sub, err := g.clauses[i].toQuery(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			bq.Clauses = append(bq.Clauses, BooleanClause{Occur: g.occur, Query: sub})
+		}
+	}
+	return bq, nil
+}
+
+func (c *Clause) disMaxQuery(depth int) (Query, error) {
+	if depth >= MaxBooleanDepth {
+		return nil, fmt.Errorf("%w: boolean nesting exceeds depth %d", ErrInvalidQuery, MaxBooleanDepth)
+	}
+	if len(c.Queries) == 0 {
+		return nil, fmt.Errorf("%w: dis_max query requires at least one query", ErrInvalidQuery)
+	}
+	if len(c.Queries) > MaxBooleanClauses {
+		return nil, fmt.Errorf("%w: dis_max query exceeds %d queries", ErrInvalidQuery, MaxBooleanClauses)
+	}
+	if c.TieBreaker < 0 || c.TieBreaker > 1 {
+		return nil, fmt.Errorf("%w: tie_breaker must be between 0 and 1", ErrInvalidQuery)
+	}
+	q := &DisMaxQuery{Queries: make([]Query, len(c.Queries)), TieBreaker: c.TieBreaker, Boost: c.Boost}
+	for i := range c.Queries {
+		var err error
+		if q.Queries[i], err = c.Queries[i].toQuery(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (c *Clause) constantScoreQuery(depth int) (Query, error) {
+	if depth >= MaxBooleanDepth {
+		return nil, fmt.Errorf("%w: boolean nesting exceeds depth %d", ErrInvalidQuery, MaxBooleanDepth)
+	}
+	if len(c.Filter) != 1 {
+		return nil, fmt.Errorf("%w: constant_score query requires one filter", ErrInvalidQuery)
+	}
+	filter, err := c.Filter[0].toQuery(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &ConstantScoreQuery{Filter: filter, Boost: c.Boost}, nil
+}
+
+func (c *Clause) functionScoreQuery(depth int) (Query, error) {
+	if depth >= MaxBooleanDepth {
+		return nil, fmt.Errorf("%w: boolean nesting exceeds depth %d", ErrInvalidQuery, MaxBooleanDepth)
+	}
+	if len(c.Functions) == 0 {
+		return nil, fmt.Errorf("%w: function_score query requires at least one function", ErrInvalidQuery)
+	}
+	if len(c.Functions) > MaxBooleanClauses {
+		return nil, fmt.Errorf("%w: function_score query exceeds %d functions", ErrInvalidQuery, MaxBooleanClauses)
+	}
+	switch c.ScoreMode {
+	case "", CombineMultiply, CombineSum, CombineAvg, CombineFirst, CombineMax, CombineMin:
+	default:
+		return nil, fmt.Errorf("%w: score_mode must be one of %s, %s, %s, %s, %s or %s", ErrInvalidQuery,
+			CombineMultiply, CombineSum, CombineAvg, CombineFirst, CombineMax, CombineMin)
+	}
+	switch c.BoostMode {
+	case "", CombineMultiply, CombineReplace, CombineSum, CombineAvg, CombineMax, CombineMin:
+	default:
+		return nil, fmt.Errorf("%w: boost_mode must be one of %s, %s, %s, %s, %s or %s", ErrInvalidQuery,
+			CombineMultiply, CombineReplace, CombineSum, CombineAvg, CombineMax, CombineMin)
+	}
+
+	q := &FunctionScoreQuery{
+		Functions: make([]ScoreFunction, len(c.Functions)),
+		ScoreMode: c.ScoreMode,
+		BoostMode: c.BoostMode,
+		Boost:     c.Boost,
+	}
+	if c.Query != nil {
+		var err error
+		if q.Query, err = c.Query.toQuery(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	for i := range c.Functions {
+		var err error
+		if q.Functions[i], err = c.Functions[i].toFunction(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (f *FunctionClause) toFunction(depth int) (ScoreFunction, error) {
+	var fn ScoreFunction
+	if f.Weight != nil {
+		w := float64(*f.Weight)
+		if !(w > 0) || math.IsInf(w, 0) {
+			return fn, fmt.Errorf("%w: function weight must be positive", ErrInvalidQuery)
+		}
+		fn.Weight = *f.Weight
+	}
+	if f.Filter != nil {
+		var err error
+		if fn.Filter, err = f.Filter.toQuery(depth); err != nil {
+			return fn, err
+		}
+	}
+
+	kinds := 0
+	if v := f.FieldValueFactor; v != nil {
+		kinds++
+		if v.Field == "" {
+			return fn, fmt.Errorf("%w: field_value_factor requires a field", ErrInvalidQuery)
+		}
+		switch v.Modifier {
+		case "", ModifierNone, ModifierLog, ModifierLog1p, ModifierLog2p, ModifierLn, ModifierLn1p,
+			ModifierLn2p, ModifierSquare, ModifierSqrt, ModifierReciprocal:
+		default:
+			return fn, fmt.Errorf("%w: unknown field_value_factor modifier %q", ErrInvalidQuery, v.Modifier)
+		}
+		fn.FieldValueFactor = &FieldValueFactor{Field: v.Field, Factor: 1, Modifier: v.Modifier, Missing: v.Missing}
+		if v.Factor != nil {
+			fn.FieldValueFactor.Factor = *v.Factor
+		}
+	}
+	for _, d := range []struct {
+		shape  string
+		clause *DecayClause
+	}{{DecayGauss, f.Gauss}, {DecayExp, f.Exp}, {DecayLinear, f.Linear}} {
+		if d.clause == nil {
+			continue
+		}
+		kinds++
+		if d.clause.Field == "" {
+			return fn, fmt.Errorf("%w: %s function requires a field", ErrInvalidQuery, d.shape)
+		}
+		if d.clause.Scale == nil {
+			return fn, fmt.Errorf("%w: %s function requires a scale", ErrInvalidQuery, d.shape)
+		}
+		decay := 0.5
+		if d.clause.Decay != nil {
+			decay = *d.clause.Decay
+		}
+		if !(decay > 0 && decay < 1) {
+			return fn, fmt.Errorf("%w: %s function decay must be between 0 and 1", ErrInvalidQuery, d.shape)
+		}
+		fn.Decay = &DecayFunction{
+			Shape:  d.shape,
+			Field:  d.clause.Field,
+			Origin: d.clause.Origin,
+			Scale:  d.clause.Scale,
+			Offset: d.clause.Offset,
+			Decay:  decay,
+		}
+	}
+	if v := f.RandomScore; v != nil {
+		kinds++
+		if v.Seed == nil {
+			return fn, fmt.Errorf("%w: random_score requires a seed", ErrInvalidQuery)
+		}
+		fn.RandomScore = &RandomScore{Seed: *v.Seed, Field: v.Field}
+	}
+
+	switch {
+	case kinds > 1:
+		return fn, fmt.Errorf("%w: a function may only set one of field_value_factor, gauss, exp, linear and random_score", ErrInvalidQuery)
+	case kinds == 0 && f.Weight == nil:
+		return fn, fmt.Errorf("%w: a function requires field_value_factor, gauss, exp, linear, random_score or weight", ErrInvalidQuery)
+	}
+	return fn, nil
+}
@@ -0,0 +1,348 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+
+	"GoSearch/internal/analysis"
+)
+
+// FieldAnalyzer returns the analyzer for query text on a field and whether
+// the field indexes positions, which phrase queries need.
+type FieldAnalyzer func(field string) (analysis.Analyzer, bool, error)
+
+// AnalyzeMatches returns q with every MatchQuery and MultiMatchQuery
+// analyzed into the queries that execute it. q itself is not modified.
+//
+// Each analyzed token becomes a term query. Tokens stacked at one
+// position, such as single-word synonyms, match as alternatives. Where
+// tokens span several positions, as multi-word synonyms do, every path
+// through the token graph becomes an alternative phrase, or a conjunction
+// of its terms if the field has no positions. These units are then
+// combined with the match operator. Text without tokens matches nothing.
+//
+// A multi-field match builds a match per field and takes the best of them,
+// or their sum in MultiMatchMostFields mode. In MultiMatchCrossFields mode
+// the fields are searched as one: each unit matches its terms in any of
+// the fields, blending their statistics, and the operator applies across
+// fields. Fields whose analyzers produce different tokens form separate
+// groups, of which the best is taken.
+func AnalyzeMatches(q Query, analyzerFor FieldAnalyzer) (Query, error) {
+	switch v := q.(type) {
+	case *MatchQuery:
+		a, positions, err := analyzerFor(v.Field)
+		if err != nil {
+			return nil, err
+		}
+		terms := &fieldTerms{field: v.Field, boost: v.Boost, positions: positions}
+		return matchTokens(a.Analyze(v.Field, v.Text), v.Operator, v.MinimumShouldMatch, terms)
+	case *MultiMatchQuery:
+		return multiMatch(v, analyzerFor)
+	case *BooleanQuery:
+		bq := &BooleanQuery{
+			Clauses:            make([]BooleanClause, len(v.Clauses)),
+			MinimumShouldMatch: v.MinimumShouldMatch,
+		}
+		for i, c := range v.Clauses {
+			sub, err := AnalyzeMatches(c.Query, analyzerFor)
+			if err != nil {
+				return nil, err
+			}
+			bq.Clauses[i] = BooleanClause{Occur: c.Occur, Query: sub}
+		}
+		return bq, nil
+	case *DisMaxQuery:
+		dq := &DisMaxQuery{Queries: make([]Query, len(v.Queries)), TieBreaker: v.TieBreaker, Boost: v.Boost}
+		for i, sub := range v.Queries {
+			var err error
+			if dq.Queries[i], err = AnalyzeMatches(sub, analyzerFor); err != nil {
+				return nil, err
+			}
+		}
+		return dq, nil
+	case *ConstantScoreQuery:
+		filter, err := AnalyzeMatches(v.Filter, analyzerFor)
+		if err != nil {
+			return nil, err
+		}
+		return &ConstantScoreQuery{Filter: filter, Boost: v.Boost}, nil
+	case *FunctionScoreQuery:
+		fq := *v
+		if v.Query != nil {
+			var err error
+			if fq.Query, err = AnalyzeMatches(v.Query, analyzerFor); err != nil {
+				return nil, err
+			}
+		}
+		fq.Functions = make([]ScoreFunction, len(v.Functions))
+		for i, f := range v.Functions {
+			if f.Filter != nil {
+				var err error
+				if f.Filter, err = AnalyzeMatches(f.Filter, analyzerFor); err != nil {
+					return nil, err
+				}
+			}
+			fq.Functions[i] = f
+		}
+		return &fq, nil
+	default:
+		return q, nil
+	}
+}
+
+// matchTerms builds the leaf queries of analyzed match text.
+type matchTerms interface {
+	// term returns the query for a single term.
+	term(term string) Query
+	// path returns the query for a path of several tokens through a token
+	// graph.
+	path(path []analysis.Token) Query
+}
+
+// matchTokens builds the query for analyzed tokens, combining the units
+// that no token spans across with operator.
+func matchTokens(tokens []analysis.Token, operator BooleanOp, minimumShouldMatch int, terms matchTerms) (Query, error) {
+	tokens = append([]analysis.Token(nil), tokens...)
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].Position < tokens[j].Position })
+
+	var units []Query
+	for start := 0; start < len(tokens); {
+		end := start + 1
+		last := tokens[start].Position + max(tokens[start].PositionLength, 1)
+		graph := tokens[start].PositionLength > 1
+		for end < len(tokens) && tokens[end].Position < last {
+			last = max(last, tokens[end].Position+max(tokens[end].PositionLength, 1))
+			graph = graph || tokens[end].PositionLength > 1
+			end++
+		}
+		var unit Query
+		if graph {
+			var err error
+			if unit, err = graphQuery(tokens[start:end], terms); err != nil {
+				return nil, err
+			}
+		} else {
+			unit = stackedQuery(tokens[start:end], terms)
+		}
+		units = append(units, unit)
+		start = end
+	}
+
+	if len(units) > MaxBooleanClauses {
+		return nil, fmt.Errorf("%w: match query exceeds %d clauses", ErrInvalidQuery, MaxBooleanClauses)
+	}
+	switch {
+	case len(units) == 0, minimumShouldMatch > len(units):
+		return &MatchNoneQuery{}, nil
+	case len(units) == 1:
+		return units[0], nil
+	}
+	bq := &BooleanQuery{Clauses: make([]BooleanClause, len(units))}
+	for i, unit := range units {
+		bq.Clauses[i] = BooleanClause{Occur: operator, Query: unit}
+	}
+	if operator == BooleanShould {
+		bq.MinimumShouldMatch = minimumShouldMatch
+	}
+	return bq, nil
+}
+
+// stackedQuery matches any of the distinct terms of tokens sharing a
+// position.
+func stackedQuery(tokens []analysis.Token, terms matchTerms) Query {
+	var alternatives []Query
+	seen := make(map[string]bool, len(tokens))
+	for _, tok := range tokens {
+		if seen[tok.Term] {
+			continue
+		}
+		seen[tok.Term] = true
+		alternatives = append(alternatives, terms.term(tok.Term))
+	}
+	return anyOf(alternatives)
+}
+
+// graphQuery matches any path through a token graph.
+func graphQuery(tokens []analysis.Token, terms matchTerms) (Query, error) {
+	var alternatives []Query
+	for _, path := range analysis.GraphPaths(tokens, MaxBooleanClauses) {
+		if len(path) == 1 {
+			alternatives = append(alternatives, terms.term(path[0].Term))
+			continue
+		}
+		if len(path) > MaxPhraseLength {
+			return nil, fmt.Errorf("%w: phrase exceeds %d terms", ErrInvalidQuery, MaxPhraseLength)
+		}
+		alternatives = append(alternatives, terms.path(path))
+	}
+	return anyOf(alternatives), nil
+}
+
+// anyOf returns a query matching any of alternatives.
+func anyOf(alternatives []Query) Query {
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	bq := &BooleanQuery{Clauses: make([]BooleanClause, len(alternatives))}
+	for i, alt := range alternatives {
+		bq.Clauses[i] = BooleanClause{Occur: BooleanShould, Query: alt}
+	}
+	return bq
+}
+
+// fieldTerms builds the terms and phrases of a match on one field.
+type fieldTerms struct {
+	field     string
+	boost     float32
+	positions bool
+}
+
+func (f *fieldTerms) term(term string) Query {
+	return &TermQuery{Field: f.field, Term: term, Boost: f.boost}
+}
+
+// path returns a phrase of the path's terms, keeping gaps left by removed
+// tokens, or a conjunction of them if the field has no positions.
+func (f *fieldTerms) path(path []analysis.Token) Query {
+	terms := make([]string, len(path))
+	offsets := make([]int, len(path))
+	gaps := false
+	for i, tok := range path {
+		terms[i] = tok.Term
+		offsets[i] = tok.Position - path[0].Position
+		gaps = gaps || offsets[i] != i
+	}
+	if f.positions {
+		phrase := &PhraseQuery{Field: f.field, Terms: terms, Boost: f.boost}
+		if gaps {
+			phrase.Positions = offsets
+		}
+		return phrase
+	}
+	all := &BooleanQuery{Clauses: make([]BooleanClause, len(terms))}
+	for i, term := range terms {
+		all.Clauses[i] = BooleanClause{Occur: BooleanMust, Query: f.term(term)}
+	}
+	return all
+}
+
+// blendedTerms builds the terms and phrases of a match across fields that
+// analyze text alike.
+type blendedTerms struct {
+	fields     []*fieldTerms
+	tieBreaker float32
+}
+
+func (b *blendedTerms) term(term string) Query {
+	if len(b.fields) == 1 {
+		return b.fields[0].term(term)
+	}
+	q := &BlendedTermQuery{Terms: make([]TermQuery, len(b.fields)), TieBreaker: b.tieBreaker}
+	for i, f := range b.fields {
+		q.Terms[i] = TermQuery{Field: f.field, Term: term, Boost: f.boost}
+	}
+	return q
+}
+
+func (b *blendedTerms) path(path []analysis.Token) Query {
+	queries := make([]Query, len(b.fields))
+	for i, f := range b.fields {
+		queries[i] = f.path(path)
+	}
+	return bestOf(queries, b.tieBreaker)
+}
+
+// bestOf returns a query scoring the best of queries.
+func bestOf(queries []Query, tieBreaker float32) Query {
+	if len(queries) == 1 {
+		return queries[0]
+	}
+	return &DisMaxQuery{Queries: queries, TieBreaker: tieBreaker}
+}
+
+func multiMatch(q *MultiMatchQuery, analyzerFor FieldAnalyzer) (Query, error) {
+	boost := q.Boost
+	if boost == 0 {
+		boost = 1
+	}
+	fields := make([]*fieldTerms, len(q.Fields))
+	tokens := make([][]analysis.Token, len(q.Fields))
+	for i, f := range q.Fields {
+		a, positions, err := analyzerFor(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = &fieldTerms{field: f.Field, boost: f.Boost * boost, positions: positions}
+		tokens[i] = a.Analyze(f.Field, q.Text)
+	}
+
+	var queries []Query
+	add := func(sub Query, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, none := sub.(*MatchNoneQuery); !none {
+			queries = append(queries, sub)
+		}
+		return nil
+	}
+	if q.Mode == MultiMatchCrossFields {
+		for _, group := range groupBySameTokens(tokens) {
+			terms := &blendedTerms{tieBreaker: q.TieBreaker}
+			for _, i := range group {
+				terms.fields = append(terms.fields, fields[i])
+			}
+			if err := add(matchTokens(tokens[group[0]], q.Operator, q.MinimumShouldMatch, terms)); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for i := range fields {
+			if err := add(matchTokens(tokens[i], q.Operator, q.MinimumShouldMatch, fields[i])); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch {
+	case len(queries) == 0:
+		return &MatchNoneQuery{}, nil
+	case q.Mode == MultiMatchMostFields:
+		return anyOf(queries), nil
+	default:
+		return bestOf(queries, q.TieBreaker), nil
+	}
+}
+
+// groupBySameTokens groups the indexes of identical token streams, in order
+// of first appearance.
+func groupBySameTokens(streams [][]analysis.Token) [][]int {
+	var groups [][]int
+	for i, tokens := range streams {
+		found := false
+		for g, group := range groups {
+			if sameTokens(streams[group[0]], tokens) {
+				groups[g] = append(group, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []int{i})
+		}
+	}
+	return groups
+}
+
+func sameTokens(a, b []analysis.Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Term != b[i].Term || a[i].Position != b[i].Position ||
+			max(a[i].PositionLength, 1) != max(b[i].PositionLength, 1) {
+			return false
+		}
+	}
+	return true
+}
@@ -14,6 +14,13 @@ const (
 	QueryTypeFuzzy
 	QueryTypeMatchAll
 	QueryTypeMatchNone
+	QueryTypeRange
+	QueryTypeMatch
+	QueryTypeMultiMatch
+	QueryTypeDisMax
+	QueryTypeBlendedTerm
+	QueryTypeConstantScore
+	QueryTypeFunctionScore
 )
 
 // Query is the interface for all query AST nodes.
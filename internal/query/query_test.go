@@ -1,7 +1,14 @@
 package query
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+
+	"GoSearch/internal/analysis"
 )
 
 func TestQueryTypes(t *testing.T) {
@@ -20,6 +27,8 @@ func TestQueryTypes(t *testing.T) {
 		{"FuzzyQuery", &FuzzyQuery{Field: "title", Term: "search", MaxDistance: 1}, QueryTypeFuzzy},
 		{"MatchAllQuery", &MatchAllQuery{}, QueryTypeMatchAll},
 		{"MatchNoneQuery", &MatchNoneQuery{}, QueryTypeMatchNone},
+		{"RangeQuery", &RangeQuery{Field: "price", Lower: 10}, QueryTypeRange},
+		{"MatchQuery", &MatchQuery{Field: "title", Text: "quick fox"}, QueryTypeMatch},
 	}
 
 	for _, tt := range tests {
@@ -158,3 +167,733 @@ func TestRewrite_NoFlattenMustNot(t *testing.T) {
 		t.Errorf("expected 1 clause (not flattened), got %d", len(bq.Clauses))
 	}
 }
+
+func TestRewrite_NoFlattenMinimumShouldMatch(t *testing.T) {
+	a := &TermQuery{Field: "f", Term: "a"}
+	b := &TermQuery{Field: "f", Term: "b"}
+	c := &TermQuery{Field: "f", Term: "c"}
+	or := func(msm int, qs ...Query) *BooleanQuery {
+		bq := &BooleanQuery{MinimumShouldMatch: msm}
+		for _, q := range qs {
+			bq.Clauses = append(bq.Clauses, BooleanClause{Occur: BooleanShould, Query: q})
+		}
+		return bq
+	}
+
+	tests := []struct {
+		q    Query
+		want string
+	}{
+		// Two of (a OR b, c) is not two of (a, b, c).
+		{or(2, or(0, a, b), c), "((f:a f:b) f:c)~2"},
+		{or(0, or(2, a, b), c), "((f:a f:b)~2 f:c)"},
+		{or(1, or(1, a, b), c), "(f:a f:b f:c)~1"},
+	}
+	for _, tt := range tests {
+		if got := queryString(Rewrite(tt.q)); got != tt.want {
+			t.Errorf("Rewrite() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestRewrite_Filter(t *testing.T) {
+	a := &TermQuery{Field: "f", Term: "a"}
+	b := &TermQuery{Field: "f", Term: "b"}
+	c := &TermQuery{Field: "f", Term: "c"}
+	bq := func(clauses ...BooleanClause) *BooleanQuery { return &BooleanQuery{Clauses: clauses} }
+
+	tests := []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"must flattens into filter", bq(BooleanClause{BooleanFilter, bq(BooleanClause{BooleanMust, a}, BooleanClause{BooleanFilter, b})}, BooleanClause{BooleanMust, c}), "(#f:a #f:b +f:c)"},
+		{"filter flattens into must", bq(BooleanClause{BooleanMust, bq(BooleanClause{BooleanMust, a}, BooleanClause{BooleanFilter, b})}, BooleanClause{BooleanMust, c}), "(+f:a #f:b +f:c)"},
+		{"should does not flatten into filter", bq(BooleanClause{BooleanFilter, bq(BooleanClause{BooleanShould, a}, BooleanClause{BooleanShould, b})}, BooleanClause{BooleanMust, c}), "(#(f:a f:b) +f:c)"},
+		{"match_all filter dropped", bq(BooleanClause{BooleanFilter, &MatchAllQuery{}}, BooleanClause{BooleanFilter, a}), "(#f:a)"},
+		{"match_all filter keeps should optional", bq(BooleanClause{BooleanFilter, &MatchAllQuery{}}, BooleanClause{BooleanShould, a}), "(#all f:a)"},
+		{"match_none filter", bq(BooleanClause{BooleanFilter, &MatchNoneQuery{}}, BooleanClause{BooleanMust, a}), "none"},
+		{"single filter not unwrapped", bq(BooleanClause{BooleanFilter, a}), "(#f:a)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryString(Rewrite(tt.q)); got != tt.want {
+				t.Errorf("Rewrite() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewrite_DisMaxAndConstantScore(t *testing.T) {
+	a := &TermQuery{Field: "f", Term: "a"}
+	b := &TermQuery{Field: "f", Term: "b"}
+	c := &TermQuery{Field: "f", Term: "c"}
+
+	tests := []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"dis_max drops match_none", &DisMaxQuery{Queries: []Query{a, &MatchNoneQuery{}, b}, TieBreaker: 0.5}, "dismax(f:a | f:b)~0.5"},
+		{"dis_max of nothing", &DisMaxQuery{Queries: []Query{&MatchNoneQuery{}}}, "none"},
+		{"single dis_max query", &DisMaxQuery{Queries: []Query{a, &MatchNoneQuery{}}, TieBreaker: 0.5}, "f:a"},
+		{"boosted single dis_max query", &DisMaxQuery{Queries: []Query{a}, Boost: 2}, "dismax(f:a)^2"},
+		{"nested dis_max flattens", &DisMaxQuery{Queries: []Query{&DisMaxQuery{Queries: []Query{a, b}}, c}}, "dismax(f:a | f:b | f:c)"},
+		{"tie breaker keeps nesting", &DisMaxQuery{Queries: []Query{&DisMaxQuery{Queries: []Query{a, b}, TieBreaker: 0.1}, c}}, "dismax(dismax(f:a | f:b)~0.1 | f:c)"},
+		{"dis_max rewrites its queries", &DisMaxQuery{Queries: []Query{&BooleanQuery{Clauses: []BooleanClause{{Occur: BooleanMust, Query: a}}}, b}}, "dismax(f:a | f:b)"},
+		{"constant score of match_none", &ConstantScoreQuery{Filter: &BooleanQuery{Clauses: []BooleanClause{{Occur: BooleanMust, Query: &MatchNoneQuery{}}}}}, "none"},
+		{"constant score of match_all", &ConstantScoreQuery{Filter: &MatchAllQuery{Boost: 3}, Boost: 2}, "all^2"},
+		{"nested constant score", &ConstantScoreQuery{Filter: &ConstantScoreQuery{Filter: a, Boost: 5}, Boost: 2}, "const(f:a)^2"},
+		{"constant score in dis_max", &DisMaxQuery{Queries: []Query{&ConstantScoreQuery{Filter: &MatchNoneQuery{}}, a}}, "f:a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryString(Rewrite(tt.q)); got != tt.want {
+				t.Errorf("Rewrite() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewrite_FunctionScore(t *testing.T) {
+	a := &TermQuery{Field: "f", Term: "a"}
+	must := func(q Query) Query {
+		return &BooleanQuery{Clauses: []BooleanClause{{Occur: BooleanMust, Query: q}}}
+	}
+	weight := []ScoreFunction{{Filter: must(a), Weight: 2}}
+
+	tests := []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"rewrites its query and filters", &FunctionScoreQuery{Query: must(a), Functions: weight}, "fscore(f:a; f:a=>weight^2)"},
+		{"match_none query", &FunctionScoreQuery{Query: must(&MatchNoneQuery{}), Functions: weight}, "none"},
+		{"in a bool", must(&FunctionScoreQuery{Functions: weight, Boost: 2}), "fscore(all; f:a=>weight^2)^2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryString(Rewrite(tt.q)); got != tt.want {
+				t.Errorf("Rewrite() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_LegacyTermShape(t *testing.T) {
+	q, err := Parse([]byte(`{"field": "title", "value": "search"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tq, ok := q.(*TermQuery)
+	if !ok {
+		t.Fatalf("expected TermQuery, got %T", q)
+	}
+	if tq.Field != "title" || tq.Term != "search" {
+		t.Errorf("got %+v", tq)
+	}
+}
+
+func TestParse_Range(t *testing.T) {
+	tests := []struct {
+		name                       string
+		json                       string
+		wantLower, wantUpper       interface{}
+		includeLower, includeUpper bool
+	}{
+		{"gte lt", `{"type":"range","field":"price","gte":10,"lt":20}`, json.Number("10"), json.Number("20"), true, false},
+		{"gt lte", `{"type":"range","field":"price","gt":10,"lte":20}`, json.Number("10"), json.Number("20"), false, true},
+		{"lower only", `{"type":"range","field":"date","gte":"2024-01-01"}`, "2024-01-01", nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse([]byte(tt.json))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rq, ok := q.(*RangeQuery)
+			if !ok {
+				t.Fatalf("expected RangeQuery, got %T", q)
+			}
+			if rq.Lower != tt.wantLower || rq.Upper != tt.wantUpper {
+				t.Errorf("bounds = %v, %v; want %v, %v", rq.Lower, rq.Upper, tt.wantLower, tt.wantUpper)
+			}
+			if rq.IncludeLower != tt.includeLower || rq.IncludeUpper != tt.includeUpper {
+				t.Errorf("inclusive = %v, %v; want %v, %v", rq.IncludeLower, rq.IncludeUpper, tt.includeLower, tt.includeUpper)
+			}
+		})
+	}
+}
+
+func TestParse_Bool(t *testing.T) {
+	q, err := Parse([]byte(`{
+		"type": "bool",
+		"must": [{"type": "term", "field": "title", "value": "search"}],
+		"should": [{"type": "prefix", "field": "tags", "value": "tut"}],
+		"must_not": [{"type": "range", "field": "price", "gt": 100}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bq, ok := q.(*BooleanQuery)
+	if !ok {
+		t.Fatalf("expected BooleanQuery, got %T", q)
+	}
+	want := []BooleanOp{BooleanMust, BooleanShould, BooleanMustNot}
+	if len(bq.Clauses) != len(want) {
+		t.Fatalf("expected %d clauses, got %d", len(want), len(bq.Clauses))
+	}
+	for i, c := range bq.Clauses {
+		if c.Occur != want[i] {
+			t.Errorf("clause %d occur = %d, want %d", i, c.Occur, want[i])
+		}
+	}
+}
+
+func TestParse_WrappedForm(t *testing.T) {
+	q, err := Parse([]byte(`{
+		"bool": {
+			"must": [{"term": {"field": "status", "value": "published"}}],
+			"should": [{"prefix": {"field": "title", "prefix": "search"}}],
+			"must_not": [{"range": {"field": "price", "gte": 100}}]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bq, ok := q.(*BooleanQuery)
+	if !ok {
+		t.Fatalf("expected BooleanQuery, got %T", q)
+	}
+	if pq, ok := bq.Clauses[1].Query.(*PrefixQuery); !ok || pq.Prefix != "search" {
+		t.Errorf("should clause = %#v", bq.Clauses[1].Query)
+	}
+	if rq, ok := bq.Clauses[2].Query.(*RangeQuery); !ok || rq.Lower != json.Number("100") {
+		t.Errorf("must_not clause = %#v", bq.Clauses[2].Query)
+	}
+
+	q, err = Parse([]byte(`{"regexp": {"field": "title", "pattern": "colou?r"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rq, ok := q.(*RegexQuery); !ok || rq.Pattern != "colou?r" {
+		t.Errorf("regexp clause = %#v", q)
+	}
+}
+
+func TestParse_NumericTermValue(t *testing.T) {
+	q, err := Parse([]byte(`{"type":"term","field":"price","value":9007199254740993}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.(*TermQuery).Term; got != "9007199254740993" {
+		t.Errorf("Term = %q, want full precision", got)
+	}
+}
+
+func TestParse_Fuzziness(t *testing.T) {
+	q, err := Parse([]byte(`{"type":"fuzzy","field":"title","value":"serch"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.(*FuzzyQuery).MaxDistance; got != 1 {
+		t.Errorf("auto fuzziness = %d, want 1", got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	deep := `{"type":"term","field":"f","value":"x"}`
+	for i := 0; i <= MaxBooleanDepth; i++ {
+		deep = fmt.Sprintf(`{"type":"bool","must":[%s]}`, deep)
+	}
+	wide := `{"type":"bool","should":[` +
+		strings.TrimSuffix(strings.Repeat(`{"field":"f","value":"x"},`, MaxBooleanClauses+1), ",") + `]}`
+
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"malformed", `{"type":`},
+		{"unknown type", `{"type":"nope","field":"f","value":"x"}`},
+		{"missing field", `{"type":"term","value":"x"}`},
+		{"missing value", `{"type":"prefix","field":"f"}`},
+		{"gt and gte", `{"type":"range","field":"f","gt":1,"gte":2}`},
+		{"empty bool", `{"type":"bool"}`},
+		{"fuzziness too large", `{"type":"fuzzy","field":"f","value":"abcdef","fuzziness":3}`},
+		{"minimum should match", `{"type":"bool","should":[{"field":"f","value":"x"}],"minimum_should_match":2}`},
+		{"match operator", `{"type":"match","field":"f","value":"x","operator":"xor"}`},
+		{"match minimum should match", `{"type":"match","field":"f","value":"x","minimum_should_match":-1}`},
+		{"match and minimum should match", `{"type":"match","field":"f","value":"x y","operator":"and","minimum_should_match":1}`},
+		{"too deep", deep},
+		{"too many clauses", wide},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.json)); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("expected ErrInvalidQuery, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParse_Match(t *testing.T) {
+	q, err := Parse([]byte(`{"match":{"field":"title","value":"Quick Search","operator":"and","boost":2}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := q.(*MatchQuery)
+	if !ok {
+		t.Fatalf("expected MatchQuery, got %T", q)
+	}
+	if m.Field != "title" || m.Text != "Quick Search" || m.Operator != BooleanMust || m.Boost != 2 {
+		t.Errorf("unexpected match query: %+v", m)
+	}
+
+	q, err = Parse([]byte(`{"type":"match","field":"title","value":"a b c","minimum_should_match":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := q.(*MatchQuery); m.Operator != BooleanShould || m.MinimumShouldMatch != 2 {
+		t.Errorf("unexpected match query: %+v", m)
+	}
+}
+
+// queryString renders a query compactly for comparison in tests.
+func queryString(q Query) string {
+	switch v := q.(type) {
+	case *TermQuery:
+		if v.Boost != 0 && v.Boost != 1 {
+			return fmt.Sprintf("%s:%s^%g", v.Field, v.Term, v.Boost)
+		}
+		return v.Field + ":" + v.Term
+	case *BlendedTermQuery:
+		fields := make([]string, len(v.Terms))
+		for i, tq := range v.Terms {
+			fields[i] = tq.Field
+		}
+		return fmt.Sprintf("blended(%s:%s)", strings.Join(fields, ","), v.Terms[0].Term)
+	case *DisMaxQuery:
+		parts := make([]string, len(v.Queries))
+		for i, sub := range v.Queries {
+			parts[i] = queryString(sub)
+		}
+		s := "dismax(" + strings.Join(parts, " | ") + ")"
+		if v.TieBreaker != 0 {
+			s += fmt.Sprintf("~%g", v.TieBreaker)
+		}
+		if v.Boost != 0 && v.Boost != 1 {
+			s += fmt.Sprintf("^%g", v.Boost)
+		}
+		return s
+	case *ConstantScoreQuery:
+		s := "const(" + queryString(v.Filter) + ")"
+		if v.Boost != 0 && v.Boost != 1 {
+			s += fmt.Sprintf("^%g", v.Boost)
+		}
+		return s
+	case *FunctionScoreQuery:
+		inner := "all"
+		if v.Query != nil {
+			inner = queryString(v.Query)
+		}
+		parts := make([]string, len(v.Functions))
+		for i, f := range v.Functions {
+			switch {
+			case f.FieldValueFactor != nil:
+				parts[i] = fmt.Sprintf("%s(%g*%s)", f.FieldValueFactor.Modifier, f.FieldValueFactor.Factor, f.FieldValueFactor.Field)
+			case f.Decay != nil:
+				parts[i] = fmt.Sprintf("%s(%s)", f.Decay.Shape, f.Decay.Field)
+			case f.RandomScore != nil:
+				parts[i] = fmt.Sprintf("random(%d)", f.RandomScore.Seed)
+			default:
+				parts[i] = "weight"
+			}
+			if f.Filter != nil {
+				parts[i] = queryString(f.Filter) + "=>" + parts[i]
+			}
+			if f.Weight != 0 && f.Weight != 1 {
+				parts[i] += fmt.Sprintf("^%g", f.Weight)
+			}
+		}
+		s := fmt.Sprintf("fscore(%s; %s)", inner, strings.Join(parts, ", "))
+		if v.ScoreMode != "" || v.BoostMode != "" {
+			s += fmt.Sprintf("[%s,%s]", v.ScoreMode, v.BoostMode)
+		}
+		if v.Boost != 0 && v.Boost != 1 {
+			s += fmt.Sprintf("^%g", v.Boost)
+		}
+		return s
+	case *PhraseQuery:
+		s := fmt.Sprintf("%s:%q", v.Field, strings.Join(v.Terms, " "))
+		if v.Positions != nil {
+			s += fmt.Sprint(v.Positions)
+		}
+		return s
+	case *BooleanQuery:
+		parts := make([]string, len(v.Clauses))
+		for i, c := range v.Clauses {
+			prefix := map[BooleanOp]string{BooleanMust: "+", BooleanShould: "", BooleanMustNot: "-", BooleanFilter: "#"}[c.Occur]
+			parts[i] = prefix + queryString(c.Query)
+		}
+		s := "(" + strings.Join(parts, " ") + ")"
+		if v.MinimumShouldMatch > 0 {
+			s += fmt.Sprintf("~%d", v.MinimumShouldMatch)
+		}
+		return s
+	case *MatchAllQuery:
+		if v.Boost != 0 && v.Boost != 1 {
+			return fmt.Sprintf("all^%g", v.Boost)
+		}
+		return "all"
+	case *MatchNoneQuery:
+		return "none"
+	default:
+		return fmt.Sprintf("%T", q)
+	}
+}
+
+// testFieldAnalyzer analyzes title with the standard analyzer, body with
+// synonyms and stopwords, plain like body but without positions, and tags
+// as keywords.
+func testFieldAnalyzer(t *testing.T) FieldAnalyzer {
+	t.Helper()
+	registry := analysis.NewRegistry()
+	if err := registry.DefineTokenFilter("syn", analysis.TokenFilterDef{
+		Type:     "synonym_graph",
+		Synonyms: []string{"ny, new york", "wotw, war of the worlds"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Define("syn", analysis.AnalyzerDef{Tokenizer: "standard", Filters: []string{"lowercase", "syn", "stop"}}); err != nil {
+		t.Fatal(err)
+	}
+	analyzerFor := func(field string) (analysis.Analyzer, bool, error) {
+		switch field {
+		case "title":
+			a, err := registry.Get("standard")
+			return a, true, err
+		case "body":
+			a, err := registry.Get("syn")
+			return a, true, err
+		case "plain":
+			a, err := registry.Get("syn")
+			return a, false, err
+		case "tags":
+			return analysis.NewKeywordAnalyzer(), false, nil
+		}
+		return nil, false, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, field)
+	}
+	return analyzerFor
+}
+
+func TestAnalyzeMatches(t *testing.T) {
+	analyzerFor := testFieldAnalyzer(t)
+
+	tests := []struct {
+		name string
+		q    *MatchQuery
+		want string
+	}{
+		{"single term", &MatchQuery{Field: "title", Text: "Search", Operator: BooleanShould}, "title:search"},
+		{"or", &MatchQuery{Field: "title", Text: "Quick Search", Operator: BooleanShould}, "(title:quick title:search)"},
+		{"and", &MatchQuery{Field: "title", Text: "Quick Search", Operator: BooleanMust}, "(+title:quick +title:search)"},
+		{"minimum should match", &MatchQuery{Field: "title", Text: "a b c", Operator: BooleanShould, MinimumShouldMatch: 2}, "(title:a title:b title:c)~2"},
+		{"minimum should match too large", &MatchQuery{Field: "title", Text: "a b", Operator: BooleanShould, MinimumShouldMatch: 3}, "none"},
+		{"no tokens", &MatchQuery{Field: "body", Text: "the", Operator: BooleanShould}, "none"},
+		{"synonym phrase", &MatchQuery{Field: "body", Text: "NY city", Operator: BooleanMust}, `(+(body:ny body:"new york") +body:city)`},
+		{"synonym without positions", &MatchQuery{Field: "plain", Text: "ny", Operator: BooleanShould}, "(plain:ny (+plain:new +plain:york))"},
+		{"phrase with stopword gaps", &MatchQuery{Field: "body", Text: "wotw", Operator: BooleanShould}, `(body:wotw body:"war worlds"[0 3])`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := AnalyzeMatches(tt.q, analyzerFor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := queryString(q); got != tt.want {
+				t.Errorf("AnalyzeMatches() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	nested := &BooleanQuery{Clauses: []BooleanClause{
+		{Occur: BooleanMust, Query: &MatchQuery{Field: "title", Text: "Search", Operator: BooleanShould}},
+		{Occur: BooleanMustNot, Query: &TermQuery{Field: "title", Term: "Draft"}},
+	}}
+	q, err := AnalyzeMatches(nested, analyzerFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queryString(q), "(+title:search -title:Draft)"; got != want {
+		t.Errorf("AnalyzeMatches() = %s, want %s", got, want)
+	}
+	if _, ok := nested.Clauses[0].Query.(*MatchQuery); !ok {
+		t.Error("AnalyzeMatches modified its input")
+	}
+
+	if _, err := AnalyzeMatches(&MatchQuery{Field: "missing", Text: "x"}, analyzerFor); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery for unknown field, got %v", err)
+	}
+}
+
+func TestParse_MultiMatch(t *testing.T) {
+	q, err := Parse([]byte(`{"multi_match":{"fields":["title^3","body","tags^0.5"],"value":"quick fox","tie_breaker":0.3}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := q.(*MultiMatchQuery)
+	if !ok {
+		t.Fatalf("expected MultiMatchQuery, got %T", q)
+	}
+	want := []FieldBoost{{"title", 3}, {"body", 1}, {"tags", 0.5}}
+	if !reflect.DeepEqual(m.Fields, want) {
+		t.Errorf("Fields = %v, want %v", m.Fields, want)
+	}
+	if m.Mode != MultiMatchBestFields || m.TieBreaker != 0.3 || m.Operator != BooleanShould {
+		t.Errorf("unexpected multi_match query: %+v", m)
+	}
+
+	for _, body := range []string{
+		`{"multi_match":{"value":"x"}}`,
+		`{"multi_match":{"fields":["title"]}}`,
+		`{"multi_match":{"field":"title","fields":["body"],"value":"x"}}`,
+		`{"multi_match":{"fields":["title^x"],"value":"x"}}`,
+		`{"multi_match":{"fields":["title^-1"],"value":"x"}}`,
+		`{"multi_match":{"fields":["^2"],"value":"x"}}`,
+		`{"multi_match":{"fields":["title"],"value":"x","mode":"phrase"}}`,
+		`{"multi_match":{"fields":["title"],"value":"x","tie_breaker":2}}`,
+		`{"multi_match":{"fields":["title"],"value":"x","operator":"and","minimum_should_match":1}}`,
+	} {
+		if _, err := Parse([]byte(body)); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", body, err)
+		}
+	}
+}
+
+func TestAnalyzeMatches_MultiMatch(t *testing.T) {
+	analyzerFor := testFieldAnalyzer(t)
+	fields := func(names ...string) []FieldBoost {
+		out := make([]FieldBoost, len(names))
+		for i, name := range names {
+			fb, err := parseFieldBoost(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[i] = fb
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		q    *MultiMatchQuery
+		want string
+	}{
+		{"best fields", &MultiMatchQuery{Fields: fields("title^2", "tags"), Text: "quick fox", Mode: MultiMatchBestFields, TieBreaker: 0.5, Operator: BooleanShould},
+			"dismax((title:quick^2 title:fox^2) | tags:quick fox)~0.5"},
+		{"most fields", &MultiMatchQuery{Fields: fields("title^2", "tags"), Text: "quick fox", Mode: MultiMatchMostFields, Operator: BooleanShould},
+			"((title:quick^2 title:fox^2) tags:quick fox)"},
+		{"query boost", &MultiMatchQuery{Fields: fields("title^2"), Text: "fox", Mode: MultiMatchBestFields, Boost: 3},
+			"title:fox^6"},
+		{"cross fields", &MultiMatchQuery{Fields: fields("title", "body"), Text: "quick fox", Mode: MultiMatchCrossFields, Operator: BooleanMust},
+			"(+blended(title,body:quick) +blended(title,body:fox))"},
+		{"cross fields groups", &MultiMatchQuery{Fields: fields("title", "body", "tags"), Text: "quick fox", Mode: MultiMatchCrossFields, Operator: BooleanShould},
+			"dismax((blended(title,body:quick) blended(title,body:fox)) | tags:quick fox)"},
+		{"minimum should match per group", &MultiMatchQuery{Fields: fields("title", "body", "tags"), Text: "quick fox", Mode: MultiMatchCrossFields, Operator: BooleanShould, MinimumShouldMatch: 2},
+			"(blended(title,body:quick) blended(title,body:fox))~2"},
+		{"cross fields synonyms", &MultiMatchQuery{Fields: fields("body", "plain"), Text: "ny", Mode: MultiMatchCrossFields, Operator: BooleanShould},
+			`(blended(body,plain:ny) dismax(body:"new york" | (+plain:new +plain:york)))`},
+		{"no tokens", &MultiMatchQuery{Fields: fields("body", "plain"), Text: "the", Mode: MultiMatchBestFields, Operator: BooleanShould},
+			"none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := AnalyzeMatches(tt.q, analyzerFor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := queryString(q); got != tt.want {
+				t.Errorf("AnalyzeMatches() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_DisMaxAndConstantScore(t *testing.T) {
+	q, err := Parse([]byte(`{"dis_max":{"queries":[{"term":{"field":"title","value":"fox"}},{"constant_score":{"filter":{"term":{"field":"tags","value":"animal"}},"boost":2}}],"tie_breaker":0.3,"boost":1.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queryString(q), "dismax(title:fox | const(tags:animal)^2)~0.3^1.5"; got != want {
+		t.Errorf("Parse() = %s, want %s", got, want)
+	}
+
+	// A filter may also be written as a one-element array.
+	q, err = Parse([]byte(`{"type":"constant_score","filter":[{"type":"match_all"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queryString(q); got != "const(all)" {
+		t.Errorf("Parse() = %s, want const(all)", got)
+	}
+
+	deep := `{"type":"term","field":"f","value":"x"}`
+	for i := 0; i <= MaxBooleanDepth; i++ {
+		deep = `{"type":"constant_score","filter":` + deep + `}`
+	}
+	for _, body := range []string{
+		`{"dis_max":{"queries":[]}}`,
+		`{"dis_max":{"queries":[{"term":{"field":"f"}}]}}`,
+		`{"dis_max":{"queries":[{"match_all":{}}],"tie_breaker":1.5}}`,
+		`{"constant_score":{"boost":2}}`,
+		`{"constant_score":{"filter":[{"match_all":{}},{"match_none":{}}]}}`,
+		deep,
+	} {
+		if _, err := Parse([]byte(body)); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", body, err)
+		}
+	}
+}
+
+func TestParse_FunctionScore(t *testing.T) {
+	q, err := Parse([]byte(`{"function_score":{
+		"query":{"term":{"field":"title","value":"fox"}},
+		"functions":[
+			{"field_value_factor":{"field":"likes","factor":1.2,"modifier":"log1p","missing":1}},
+			{"gauss":{"field":"published","origin":"now","scale":"10d","offset":"1d"}},
+			{"filter":{"term":{"field":"tags","value":"animal"}},"weight":2},
+			{"random_score":{"seed":42},"weight":0.5}
+		],
+		"score_mode":"sum","boost_mode":"replace","boost":3}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "fscore(title:fox; log1p(1.2*likes), gauss(published), tags:animal=>weight^2, random(42)^0.5)[sum,replace]^3"
+	if got := queryString(q); got != want {
+		t.Errorf("Parse() = %s, want %s", got, want)
+	}
+	fq := q.(*FunctionScoreQuery)
+	if m := fq.Functions[0].FieldValueFactor.Missing; m == nil || *m != 1 {
+		t.Errorf("missing = %v, want 1", m)
+	}
+	d := fq.Functions[1].Decay
+	if d.Origin != "now" || d.Scale != "10d" || d.Offset != "1d" || d.Decay != 0.5 {
+		t.Errorf("decay = %+v, want the given origin, scale and offset and a decay of 0.5", d)
+	}
+
+	// The query defaults to match_all and the factor to 1.
+	q, err = Parse([]byte(`{"type":"function_score","functions":[{"field_value_factor":{"field":"likes"}},{"exp":{"field":"price","origin":10,"scale":5}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queryString(q), "fscore(all; (1*likes), exp(price))"; got != want {
+		t.Errorf("Parse() = %s, want %s", got, want)
+	}
+	if origin := q.(*FunctionScoreQuery).Functions[1].Decay.Origin; origin != json.Number("10") {
+		t.Errorf("origin = %#v, want json.Number 10", origin)
+	}
+
+	for _, body := range []string{
+		`{"function_score":{"functions":[]}}`,
+		`{"function_score":{"functions":[{}]}}`,
+		`{"function_score":{"functions":[{"weight":0}]}}`,
+		`{"function_score":{"functions":[{"weight":-1}]}}`,
+		`{"function_score":{"functions":[{"random_score":{"seed":1},"field_value_factor":{"field":"f"}}]}}`,
+		`{"function_score":{"functions":[{"random_score":{}}]}}`,
+		`{"function_score":{"functions":[{"field_value_factor":{}}]}}`,
+		`{"function_score":{"functions":[{"field_value_factor":{"field":"f","modifier":"cube"}}]}}`,
+		`{"function_score":{"functions":[{"linear":{"field":"f","origin":0}}]}}`,
+		`{"function_score":{"functions":[{"gauss":{"field":"f","scale":1,"decay":1}}]}}`,
+		`{"function_score":{"functions":[{"weight":2}],"score_mode":"replace"}}`,
+		`{"function_score":{"functions":[{"weight":2}],"boost_mode":"first"}}`,
+		`{"function_score":{"query":{"term":{"field":"f"}},"functions":[{"weight":2}]}}`,
+		`{"function_score":{"functions":[{"filter":{"term":{"field":"f"}},"weight":2}]}}`,
+	} {
+		if _, err := Parse([]byte(body)); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", body, err)
+		}
+	}
+}
+
+func TestTimeDependent(t *testing.T) {
+	decay := func(origin interface{}) Query {
+		return &FunctionScoreQuery{Functions: []ScoreFunction{{Decay: &DecayFunction{Shape: DecayGauss, Field: "published", Origin: origin, Scale: "1d"}}}}
+	}
+	tests := []struct {
+		q    Query
+		want bool
+	}{
+		{decay("now"), true},
+		{decay(nil), true},
+		{decay("2024-01-01"), false},
+		{&BooleanQuery{Clauses: []BooleanClause{{Occur: BooleanShould, Query: &TermQuery{Field: "f", Term: "a"}}, {Occur: BooleanShould, Query: decay("now")}}}, true},
+		{&FunctionScoreQuery{Query: &DisMaxQuery{Queries: []Query{decay("now")}}, Functions: []ScoreFunction{{Weight: 2}}}, true},
+		{&TermQuery{Field: "f", Term: "now"}, false},
+	}
+	for _, tt := range tests {
+		if got := TimeDependent(tt.q); got != tt.want {
+			t.Errorf("TimeDependent(%s) = %v, want %v", queryString(tt.q), got, tt.want)
+		}
+	}
+}
+
+func TestParse_BoolFilter(t *testing.T) {
+	q, err := Parse([]byte(`{"bool":{"must":[{"term":{"field":"title","value":"fox"}}],"filter":[{"term":{"field":"status","value":"published"}},{"range":{"field":"price","lt":10}}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queryString(q), "(+title:fox #status:published #*query.RangeQuery)"; got != want {
+		t.Errorf("Parse() = %s, want %s", got, want)
+	}
+
+	// A single filter may be given as an object.
+	q, err = Parse([]byte(`{"bool":{"filter":{"term":{"field":"status","value":"published"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queryString(q), "(#status:published)"; got != want {
+		t.Errorf("Parse() = %s, want %s", got, want)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	a := &TermQuery{Field: "f", Term: "a"}
+	b := &TermQuery{Field: "f", Term: "b", Boost: 2}
+	same := [][2]Query{
+		{
+			&BooleanQuery{Clauses: []BooleanClause{{BooleanFilter, a}, {BooleanMust, b}}},
+			&BooleanQuery{Clauses: []BooleanClause{{BooleanMust, &TermQuery{Field: "f", Term: "b"}}, {BooleanFilter, a}}},
+		},
+		{&ConstantScoreQuery{Filter: a, Boost: 3}, a},
+		{&DisMaxQuery{Queries: []Query{a, b}, TieBreaker: 0.5}, &DisMaxQuery{Queries: []Query{b, a}}},
+		{&MatchAllQuery{Boost: 2}, &MatchAllQuery{}},
+		{&FunctionScoreQuery{Query: a, Functions: []ScoreFunction{{Weight: 2}}}, a},
+		{&FunctionScoreQuery{Functions: []ScoreFunction{{Filter: a, Weight: 2}}}, &MatchAllQuery{}},
+	}
+	for _, pair := range same {
+		if x, y := Canonical(pair[0]), Canonical(pair[1]); x != y {
+			t.Errorf("Canonical() = %s and %s, want equal", x, y)
+		}
+	}
+
+	different := [][2]Query{
+		{&TermQuery{Field: "f", Term: "a b"}, &PhraseQuery{Field: "f", Terms: []string{"a", "b"}}},
+		{&TermQuery{Field: "f:a", Term: "b"}, &TermQuery{Field: "f", Term: "a:b"}},
+		{
+			&BooleanQuery{Clauses: []BooleanClause{{BooleanFilter, a}}},
+			&BooleanQuery{Clauses: []BooleanClause{{BooleanMustNot, a}}},
+		},
+		{
+			&BooleanQuery{Clauses: []BooleanClause{{BooleanShould, a}, {BooleanShould, b}}, MinimumShouldMatch: 2},
+			&BooleanQuery{Clauses: []BooleanClause{{BooleanShould, a}, {BooleanShould, b}}},
+		},
+		{&RangeQuery{Field: "f", Lower: "10"}, &RangeQuery{Field: "f", Lower: json.Number("10")}},
+		{&RangeQuery{Field: "f", Lower: json.Number("10"), IncludeLower: true}, &RangeQuery{Field: "f", Lower: json.Number("10")}},
+		{&PhraseQuery{Field: "f", Terms: []string{"a", "b"}}, &PhraseQuery{Field: "f", Terms: []string{"a", "b"}, Slop: 1}},
+	}
+	for _, pair := range different {
+		if x, y := Canonical(pair[0]), Canonical(pair[1]); x == y {
+			t.Errorf("Canonical() = %s for both %T and %T", x, pair[0], pair[1])
+		}
+	}
+}
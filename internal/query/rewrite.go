@@ -2,7 +2,12 @@ package query
 
 // Rewrite applies optimization rules to a query AST until a fixed point is reached.
 // Rules: flatten nested booleans, remove MatchAll from AND, short-circuit MatchNone in AND,
-// propagate NOT(MatchAll) → MatchNone.
+// propagate NOT(MatchAll) → MatchNone. Filter clauses are required like must
+// clauses, and flatten with them. Dis-max queries drop MatchNone alternatives,
+// unwrap a single one and flatten nested dis-max queries without tie-breakers;
+// constant-score queries unwrap nested constant scores and turn into MatchAll or
+// MatchNone with such a filter. Function-score queries rewrite their query and
+// function filters, and match nothing when their query does not.
 func Rewrite(q Query) Query {
 	for {
 		rewritten := rewriteOnce(q)
@@ -17,6 +22,12 @@ func rewriteOnce(q Query) Query {
 	switch v := q.(type) {
 	case *BooleanQuery:
 		return rewriteBoolean(v)
+	case *DisMaxQuery:
+		return rewriteDisMax(v)
+	case *ConstantScoreQuery:
+		return rewriteConstantScore(v)
+	case *FunctionScoreQuery:
+		return rewriteFunctionScore(v)
 	default:
 		return q
 	}
@@ -30,9 +41,13 @@ func rewriteBoolean(q *BooleanQuery) Query {
 
 		// Flatten nested booleans with same operator.
 		if inner, ok := rewritten.(*BooleanQuery); ok {
-			if canFlatten(c.Occur, inner) {
+			if canFlatten(c.Occur, q.MinimumShouldMatch, inner) {
 				for _, ic := range inner.Clauses {
-					clauses = append(clauses, BooleanClause{Occur: c.Occur, Query: ic.Query})
+					occur := c.Occur
+					if ic.Occur == BooleanFilter {
+						occur = BooleanFilter
+					}
+					clauses = append(clauses, BooleanClause{Occur: occur, Query: ic.Query})
 				}
 				continue
 			}
@@ -41,13 +56,24 @@ func rewriteBoolean(q *BooleanQuery) Query {
 		clauses = append(clauses, BooleanClause{Occur: c.Occur, Query: rewritten})
 	}
 
-	// Remove MatchAll from AND (must) clauses.
+	// Remove MatchAll from AND (must and filter) clauses, unless it is all
+	// that keeps should clauses optional.
+	required, hasShould := 0, false
+	for _, c := range clauses {
+		if _, ok := c.Query.(*MatchAllQuery); ok {
+			continue
+		}
+		if isRequired(c.Occur) {
+			required++
+		}
+		hasShould = hasShould || c.Occur == BooleanShould
+	}
 	filtered := make([]BooleanClause, 0, len(clauses))
 	hasMust := false
 	for _, c := range clauses {
-		if c.Occur == BooleanMust {
+		if isRequired(c.Occur) {
 			hasMust = true
-			if _, ok := c.Query.(*MatchAllQuery); ok {
+			if _, ok := c.Query.(*MatchAllQuery); ok && (required > 0 || !hasShould) {
 				continue // Remove MatchAll from AND.
 			}
 		}
@@ -56,7 +82,7 @@ func rewriteBoolean(q *BooleanQuery) Query {
 
 	// Short-circuit: MatchNone in AND → MatchNone.
 	for _, c := range filtered {
-		if c.Occur == BooleanMust {
+		if isRequired(c.Occur) {
 			if _, ok := c.Query.(*MatchNoneQuery); ok {
 				return &MatchNoneQuery{}
 			}
@@ -79,20 +105,90 @@ func rewriteBoolean(q *BooleanQuery) Query {
 	}
 }
 
+// isRequired reports whether clauses with the occurrence must match.
+func isRequired(occur BooleanOp) bool {
+	return occur == BooleanMust || occur == BooleanFilter
+}
+
 // canFlatten returns true if an inner boolean can be flattened into the outer clause.
-// AND(AND(a,b)) → AND(a,b) and OR(OR(a,b)) → OR(a,b).
-func canFlatten(outerOccur BooleanOp, inner *BooleanQuery) bool {
+// AND(AND(a,b)) → AND(a,b) and OR(OR(a,b)) → OR(a,b). Required clauses of
+// either kind flatten into a filter clause, and filter clauses into a must
+// clause, where they remain filters. Should clauses are not
+// flattened when either query requires more than one of them to match, as
+// their counts would mix.
+func canFlatten(outerOccur BooleanOp, outerMinShould int, inner *BooleanQuery) bool {
 	if outerOccur == BooleanMustNot {
 		return false
 	}
+	if outerOccur == BooleanShould && (outerMinShould > 1 || inner.MinimumShouldMatch > 1) {
+		return false
+	}
 	for _, c := range inner.Clauses {
-		if c.Occur != outerOccur {
+		if c.Occur != outerOccur && !(isRequired(c.Occur) && isRequired(outerOccur)) {
 			return false
 		}
 	}
 	return true
 }
 
+func rewriteDisMax(q *DisMaxQuery) Query {
+	queries := make([]Query, 0, len(q.Queries))
+	for _, sub := range q.Queries {
+		rewritten := rewriteOnce(sub)
+		switch v := rewritten.(type) {
+		case *MatchNoneQuery:
+			continue
+		case *DisMaxQuery:
+			// max(max(a, b), c) = max(a, b, c) when neither adds the others.
+			if q.TieBreaker == 0 && v.TieBreaker == 0 && (v.Boost == 0 || v.Boost == 1) {
+				queries = append(queries, v.Queries...)
+				continue
+			}
+		}
+		queries = append(queries, rewritten)
+	}
+	if len(queries) == 0 {
+		return &MatchNoneQuery{}
+	}
+	if len(queries) == 1 && (q.Boost == 0 || q.Boost == 1) {
+		return queries[0]
+	}
+	return &DisMaxQuery{Queries: queries, TieBreaker: q.TieBreaker, Boost: q.Boost}
+}
+
+func rewriteConstantScore(q *ConstantScoreQuery) Query {
+	filter := rewriteOnce(q.Filter)
+	switch v := filter.(type) {
+	case *MatchNoneQuery:
+		return filter
+	case *MatchAllQuery:
+		return &MatchAllQuery{Boost: q.Boost}
+	case *ConstantScoreQuery:
+		// The inner score is ignored, so only its filter matters.
+		filter = v.Filter
+	}
+	return &ConstantScoreQuery{Filter: filter, Boost: q.Boost}
+}
+
+func rewriteFunctionScore(q *FunctionScoreQuery) Query {
+	inner := rewriteOnce(q.Query)
+	if _, ok := inner.(*MatchNoneQuery); ok {
+		return inner
+	}
+	functions := make([]ScoreFunction, len(q.Functions))
+	for i, f := range q.Functions {
+		f.Filter = rewriteOnce(f.Filter)
+		functions[i] = f
+	}
+	return &FunctionScoreQuery{
+		Query:     inner,
+		Functions: functions,
+		ScoreMode: q.ScoreMode,
+		BoostMode: q.BoostMode,
+		Boost:     q.Boost,
+	}
+}
+
 // queryEqual checks structural equality for fixed-point detection.
 func queryEqual(a, b Query) bool {
 	if a == nil && b == nil {
@@ -120,6 +216,40 @@ func queryEqual(a, b Query) bool {
 		}
 		return true
 	}
+	switch av := a.(type) {
+	case *DisMaxQuery:
+		bv := b.(*DisMaxQuery)
+		if len(av.Queries) != len(bv.Queries) || av.TieBreaker != bv.TieBreaker || av.Boost != bv.Boost {
+			return false
+		}
+		for i := range av.Queries {
+			if !queryEqual(av.Queries[i], bv.Queries[i]) {
+				return false
+			}
+		}
+		return true
+	case *ConstantScoreQuery:
+		bv := b.(*ConstantScoreQuery)
+		return av.Boost == bv.Boost && queryEqual(av.Filter, bv.Filter)
+	case *FunctionScoreQuery:
+		bv := b.(*FunctionScoreQuery)
+		if av.ScoreMode != bv.ScoreMode || av.BoostMode != bv.BoostMode || av.Boost != bv.Boost ||
+			len(av.Functions) != len(bv.Functions) || !queryEqual(av.Query, bv.Query) {
+			return false
+		}
+		for i, af := range av.Functions {
+			bf := bv.Functions[i]
+			if af.Weight != bf.Weight || af.FieldValueFactor != bf.FieldValueFactor || af.Decay != bf.Decay ||
+				af.RandomScore != bf.RandomScore || !queryEqual(af.Filter, bf.Filter) {
+				return false
+			}
+		}
+		return true
+	case *MatchAllQuery:
+		return av.Boost == b.(*MatchAllQuery).Boost
+	case *MatchNoneQuery:
+		return true
+	}
 	// For leaf nodes, pointer equality is sufficient after one pass.
 	return a == b
 }
@@ -16,6 +16,7 @@ const (
 	BooleanMust    BooleanOp = iota // AND
 	BooleanShould                   // OR
 	BooleanMustNot                  // NOT
+	BooleanFilter                   // AND, without scoring
 )
 
 // BooleanClause is a single clause within a BooleanQuery.
@@ -60,11 +61,15 @@ type RegexQuery struct {
 func (q *RegexQuery) Type() QueryType { return QueryTypeRegex }
 
 // PhraseQuery matches documents where terms appear in exact sequence.
+// Positions, if set, gives the position of each term relative to the
+// first, leaving room for removed stopwords; otherwise the terms are
+// consecutive.
 type PhraseQuery struct {
-	Field string
-	Terms []string
-	Slop  int
-	Boost float32
+	Field     string
+	Terms     []string
+	Positions []int
+	Slop      int
+	Boost     float32
 }
 
 func (q *PhraseQuery) Type() QueryType { return QueryTypePhrase }
@@ -101,3 +106,149 @@ func (q *MatchAllQuery) Type() QueryType { return QueryTypeMatchAll }
 type MatchNoneQuery struct{}
 
 func (q *MatchNoneQuery) Type() QueryType { return QueryTypeMatchNone }
+
+// RangeQuery matches documents whose field value falls between the bounds.
+// A nil bound is unbounded. Bounds are interpreted according to the field
+// type: numerically for long, double, date and boolean fields, and
+// lexicographically for keyword and text terms.
+type RangeQuery struct {
+	Field        string
+	Lower        interface{}
+	Upper        interface{}
+	IncludeLower bool
+	IncludeUpper bool
+	Boost        float32
+}
+
+func (q *RangeQuery) Type() QueryType { return QueryTypeRange }
+
+// MatchQuery matches the terms of Text as the field's search analyzer
+// produces them. Operator is BooleanShould, where MinimumShouldMatch terms
+// must match, or BooleanMust, where all of them must. It is resolved into
+// term, phrase and boolean queries by AnalyzeMatches before execution.
+type MatchQuery struct {
+	Field              string
+	Text               string
+	Operator           BooleanOp
+	MinimumShouldMatch int
+	Boost              float32
+}
+
+func (q *MatchQuery) Type() QueryType { return QueryTypeMatch }
+
+// FieldBoost is a field searched by a multi-field query and the boost of
+// its matches.
+type FieldBoost struct {
+	Field string
+	Boost float32
+}
+
+// MultiMatchQuery matches analyzed text against several fields. Mode is
+// one of MultiMatchBestFields, MultiMatchMostFields and
+// MultiMatchCrossFields; the other options are those of MatchQuery. Like
+// MatchQuery it is resolved by AnalyzeMatches before execution.
+type MultiMatchQuery struct {
+	Fields             []FieldBoost
+	Text               string
+	Mode               string
+	TieBreaker         float32
+	Operator           BooleanOp
+	MinimumShouldMatch int
+	Boost              float32
+}
+
+func (q *MultiMatchQuery) Type() QueryType { return QueryTypeMultiMatch }
+
+// DisMaxQuery matches documents matching any of Queries and scores them by
+// the best score among those that match, plus TieBreaker times the sum of
+// the others.
+type DisMaxQuery struct {
+	Queries    []Query
+	TieBreaker float32
+	Boost      float32
+}
+
+func (q *DisMaxQuery) Type() QueryType { return QueryTypeDisMax }
+
+// BlendedTermQuery matches a term in any of several fields and scores it as
+// though the fields were one: each field's score uses the largest document
+// frequency of the term among the fields, and the scores are combined as
+// by a DisMaxQuery. Each TermQuery names a field and carries its boost.
+type BlendedTermQuery struct {
+	Terms      []TermQuery
+	TieBreaker float32
+}
+
+func (q *BlendedTermQuery) Type() QueryType { return QueryTypeBlendedTerm }
+
+// ConstantScoreQuery matches the documents of Filter without scoring them:
+// every match scores Boost, or 1 if Boost is zero.
+type ConstantScoreQuery struct {
+	Filter Query
+	Boost  float32
+}
+
+func (q *ConstantScoreQuery) Type() QueryType { return QueryTypeConstantScore }
+
+// FunctionScoreQuery matches the documents of Query, or every document if
+// Query is nil, and rescores them with Functions. The values of the
+// functions that apply to a document are combined by ScoreMode, and the
+// result is combined with the query score by BoostMode; both default to
+// CombineMultiply. A document no function applies to has a function value
+// of 1. The final score is multiplied by Boost, or 1 if Boost is zero.
+type FunctionScoreQuery struct {
+	Query     Query
+	Functions []ScoreFunction
+	ScoreMode string
+	BoostMode string
+	Boost     float32
+}
+
+func (q *FunctionScoreQuery) Type() QueryType { return QueryTypeFunctionScore }
+
+// ScoreFunction computes a value for each document from its doc values.
+// It applies only to the documents matching Filter, if set, that have the
+// values it reads. At most one of FieldValueFactor, Decay and RandomScore
+// is set; the value is multiplied by Weight, or 1 if Weight is zero, and a
+// function with none of them has the value Weight.
+type ScoreFunction struct {
+	Filter           Query
+	Weight           float32
+	FieldValueFactor *FieldValueFactor
+	Decay            *DecayFunction
+	RandomScore      *RandomScore
+}
+
+// FieldValueFactor computes Modifier(Factor * value) from the first value
+// of a numeric field. Documents without a value use Missing, if set.
+type FieldValueFactor struct {
+	Field    string
+	Factor   float64
+	Modifier string
+	Missing  *float64
+}
+
+// DecayFunction scores a document by the distance of its numeric or date
+// field value closest to Origin: 1 within Offset of it, decreasing beyond
+// that along Shape so that a value Scale further away scores Decay, or 0.5
+// if Decay is zero. Origin, Scale and Offset are read according to the
+// field type: on date fields, Origin is a date or "now" (the default) and
+// Scale and Offset are durations such as "7d" or milliseconds.
+type DecayFunction struct {
+	Shape  string
+	Field  string
+	Origin interface{}
+	Scale  interface{}
+	Offset interface{}
+	Decay  float64
+}
+
+// RandomScore gives documents pseudo-random values in [0, 1) determined by
+// Seed, so that the same seed orders documents the same way. With Field
+// set, values derive from the field's doc values, and documents with the
+// same first value score alike; otherwise they derive from the document's
+// position within its segment.
+type RandomScore struct {
+	Seed  int64
+	Field string
+}
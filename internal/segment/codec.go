@@ -0,0 +1,324 @@
+package segment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"GoSearch/internal/index"
+	"GoSearch/internal/indexing"
+)
+
+// FormatVersion is the version of the postings, stored-fields and
+// deletions formats.
+const FormatVersion = uint32(1)
+
+var (
+	ErrCorrupt            = errors.New("segment data is corrupt")
+	ErrUnsupportedVersion = errors.New("unsupported segment format version")
+)
+
+// EncodePostings serializes an inverted index into the postings file
+// format:
+//
+//	magic[8] | version uint32 | fieldCount uvarint | field*
+//
+// Fields are written in name order as the name, the term count and every
+// term in byte order. A term is its bytes, which may be binary numeric trie
+// terms, followed by the document count and, per document, the delta-coded
+// doc ID, the frequency and the delta-coded positions.
+func EncodePostings(inverted map[string]map[string]*indexing.PostingsList) []byte {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, index.MagicPostings...)
+	buf = binary.LittleEndian.AppendUint32(buf, FormatVersion)
+
+	fields := sortedKeys(inverted)
+	buf = binary.AppendUvarint(buf, uint64(len(fields)))
+	for _, field := range fields {
+		buf = appendString(buf, field)
+		terms := sortedKeys(inverted[field])
+		buf = binary.AppendUvarint(buf, uint64(len(terms)))
+		for _, term := range terms {
+			buf = appendString(buf, term)
+			entries := inverted[field][term].Entries
+			buf = binary.AppendUvarint(buf, uint64(len(entries)))
+			var prevDoc uint32
+			for _, e := range entries {
+				buf = binary.AppendUvarint(buf, uint64(e.DocID-prevDoc))
+				buf = binary.AppendUvarint(buf, uint64(e.Freq))
+				buf = binary.AppendUvarint(buf, uint64(len(e.Positions)))
+				var prevPos uint32
+				for _, p := range e.Positions {
+					buf = binary.AppendUvarint(buf, uint64(p-prevPos))
+					prevPos = p
+				}
+				prevDoc = e.DocID
+			}
+		}
+	}
+	return buf
+}
+
+// DecodePostings parses a postings file produced by EncodePostings.
+func DecodePostings(data []byte) (map[string]*FieldPostings, error) {
+	r, err := newReader(data, index.MagicPostings)
+	if err != nil {
+		return nil, err
+	}
+	fieldCount := r.count()
+	fields := make(map[string]*FieldPostings, fieldCount)
+	for i := uint64(0); i < fieldCount && r.err == nil; i++ {
+		name := r.string()
+		termCount := r.count()
+		f := &FieldPostings{
+			Terms:    make([]string, 0, termCount),
+			Postings: make([]*Postings, 0, termCount),
+		}
+		for j := uint64(0); j < termCount && r.err == nil; j++ {
+			term := r.string()
+			if n := len(f.Terms); n > 0 && term <= f.Terms[n-1] {
+				return nil, fmt.Errorf("%w: field %q terms out of order", ErrCorrupt, name)
+			}
+			docCount := r.count()
+			p := &Postings{
+				DocIDs:    make([]uint32, 0, docCount),
+				Freqs:     make([]uint32, 0, docCount),
+				Positions: make([][]uint32, 0, docCount),
+			}
+			var doc uint32
+			for k := uint64(0); k < docCount && r.err == nil; k++ {
+				doc += uint32(r.uvarint())
+				p.DocIDs = append(p.DocIDs, doc)
+				p.Freqs = append(p.Freqs, uint32(r.uvarint()))
+				posCount := r.count()
+				var positions []uint32
+				var pos uint32
+				for l := uint64(0); l < posCount && r.err == nil; l++ {
+					pos += uint32(r.uvarint())
+					positions = append(positions, pos)
+				}
+				p.Positions = append(p.Positions, positions)
+			}
+			f.Terms = append(f.Terms, term)
+			f.Postings = append(f.Postings, p)
+		}
+		fields[name] = f
+	}
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// EncodeStored serializes the stored fields and external IDs of a write
+// buffer into the stored-fields file format:
+//
+//	magic[8] | version uint32 | maxDoc uvarint | doc*
+//
+// Every doc ID below maxDoc is written as its external ID, the field count
+// and the name and value of each field in name order.
+func EncodeStored(buf *indexing.WriteBuffer) []byte {
+	ids := make([]string, buf.NextDocID)
+	for ext, doc := range buf.ExternalToInternal {
+		if doc < buf.NextDocID {
+			ids[doc] = ext
+		}
+	}
+
+	out := make([]byte, 0, 64)
+	out = append(out, index.MagicStored...)
+	out = binary.LittleEndian.AppendUint32(out, FormatVersion)
+	out = binary.AppendUvarint(out, uint64(buf.NextDocID))
+	for doc := uint32(0); doc < buf.NextDocID; doc++ {
+		out = appendString(out, ids[doc])
+		stored := buf.StoredFields[doc]
+		names := sortedKeys(stored)
+		out = binary.AppendUvarint(out, uint64(len(names)))
+		for _, name := range names {
+			out = appendString(out, name)
+			out = appendString(out, string(stored[name]))
+		}
+	}
+	return out
+}
+
+// DecodeStored parses a stored-fields file produced by EncodeStored,
+// returning the external ID and stored fields of every document.
+func DecodeStored(data []byte) ([]string, []map[string][]byte, error) {
+	r, err := newReader(data, index.MagicStored)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxDoc := r.count()
+	ids := make([]string, 0, maxDoc)
+	stored := make([]map[string][]byte, 0, maxDoc)
+	for doc := uint64(0); doc < maxDoc && r.err == nil; doc++ {
+		ids = append(ids, r.string())
+		n := r.count()
+		var fields map[string][]byte
+		if n > 0 {
+			fields = make(map[string][]byte, n)
+		}
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			name := r.string()
+			fields[name] = []byte(r.string())
+		}
+		stored = append(stored, fields)
+	}
+	if err := r.finish(); err != nil {
+		return nil, nil, err
+	}
+	return ids, stored, nil
+}
+
+// EncodeDeletions serializes a write buffer's deletions into the deletions
+// file format:
+//
+//	magic[8] | version uint32 | deletedCount uvarint | docID* | tombstoneCount uvarint | id*
+//
+// Deleted doc IDs are the segment's own documents deleted before commit,
+// delta-coded in ascending order. Tombstones are the external IDs, in byte
+// order, whose documents in older segments are deleted.
+func EncodeDeletions(buf *indexing.WriteBuffer) []byte {
+	docs := make([]uint32, 0, len(buf.DeletedDocs))
+	for doc := range buf.DeletedDocs {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i] < docs[j] })
+
+	out := make([]byte, 0, 64)
+	out = append(out, index.MagicDeletions...)
+	out = binary.LittleEndian.AppendUint32(out, FormatVersion)
+	out = binary.AppendUvarint(out, uint64(len(docs)))
+	var prev uint32
+	for _, doc := range docs {
+		out = binary.AppendUvarint(out, uint64(doc-prev))
+		prev = doc
+	}
+	tombstones := sortedKeys(buf.Deletions)
+	out = binary.AppendUvarint(out, uint64(len(tombstones)))
+	for _, id := range tombstones {
+		out = appendString(out, id)
+	}
+	return out
+}
+
+// DecodeDeletions parses a deletions file produced by EncodeDeletions.
+func DecodeDeletions(data []byte) (deleted []uint32, tombstones []string, err error) {
+	r, err := newReader(data, index.MagicDeletions)
+	if err != nil {
+		return nil, nil, err
+	}
+	n := r.count()
+	deleted = make([]uint32, 0, n)
+	var doc uint32
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		delta := uint32(r.uvarint())
+		if i > 0 && delta == 0 {
+			return nil, nil, fmt.Errorf("%w: duplicate deleted doc %d", ErrCorrupt, doc)
+		}
+		doc += delta
+		deleted = append(deleted, doc)
+	}
+	n = r.count()
+	tombstones = make([]string, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		tombstones = append(tombstones, r.string())
+	}
+	if err := r.finish(); err != nil {
+		return nil, nil, err
+	}
+	return deleted, tombstones, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// reader is a sticky-error cursor over an encoded segment file.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newReader(data []byte, magic string) (*reader, error) {
+	if isLegacyJSON(data) {
+		return nil, fmt.Errorf("%w: legacy JSON file", ErrUnsupportedVersion)
+	}
+	if len(data) < len(magic)+4 || string(data[:len(magic)]) != magic {
+		return nil, fmt.Errorf("%w: bad magic", ErrCorrupt)
+	}
+	if v := binary.LittleEndian.Uint32(data[len(magic):]); v != FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, v)
+	}
+	return &reader{data: data, pos: len(magic) + 4}, nil
+}
+
+// isLegacyJSON reports whether data is a postings or stored-fields file
+// written as JSON, before segment files had a magic header. Open reads
+// those with the legacy decoders.
+func isLegacyJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && (data[0] == '{' || bytes.Equal(data, []byte("null")))
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad uvarint at offset %d", ErrCorrupt, r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// count reads an element count. Every element takes at least one byte, so
+// counts beyond the remaining data are rejected before allocating.
+func (r *reader) count() uint64 {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("%w: count %d exceeds data", ErrCorrupt, n)
+		return 0
+	}
+	return n
+}
+
+func (r *reader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("%w: string length %d exceeds data", ErrCorrupt, n)
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+int(n)])
+	r.pos += int(n)
+	return s
+}
+
+func (r *reader) finish() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos != len(r.data) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, len(r.data)-r.pos)
+	}
+	return nil
+}
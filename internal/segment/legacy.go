@@ -0,0 +1,102 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Segments committed before segment files had a magic header stored
+// postings.bin and stored.bin as JSON and had no deletions or doc values.
+// They are still read so that their documents stay searchable and can be
+// exported into a new index.
+
+// legacyIDField is the document field older releases took external IDs from.
+const legacyIDField = "id"
+
+// decodeLegacyPostings parses a JSON postings file, an object of fields to
+// terms to {"Entries": [{"DocID", "Freq", "Positions"}]}. Older releases
+// never reused doc IDs, so every ID is below the document count in
+// meta.json.
+func decodeLegacyPostings(data []byte, maxDoc uint32) (map[string]*FieldPostings, error) {
+	type entry struct {
+		DocID     uint32
+		Freq      uint32
+		Positions []uint32
+	}
+	var inverted map[string]map[string]struct{ Entries []entry }
+	if err := json.Unmarshal(data, &inverted); err != nil {
+		return nil, fmt.Errorf("%w: legacy postings: %v", ErrCorrupt, err)
+	}
+	fields := make(map[string]*FieldPostings, len(inverted))
+	for name, terms := range inverted {
+		f := &FieldPostings{
+			Terms:    sortedKeys(terms),
+			Postings: make([]*Postings, 0, len(terms)),
+		}
+		for _, term := range f.Terms {
+			entries := terms[term].Entries
+			sort.SliceStable(entries, func(i, j int) bool { return entries[i].DocID < entries[j].DocID })
+			p := &Postings{
+				DocIDs:    make([]uint32, 0, len(entries)),
+				Freqs:     make([]uint32, 0, len(entries)),
+				Positions: make([][]uint32, 0, len(entries)),
+			}
+			for i, e := range entries {
+				if e.DocID >= maxDoc {
+					return nil, fmt.Errorf("%w: legacy postings: doc %d out of range", ErrCorrupt, e.DocID)
+				}
+				if i > 0 && e.DocID == entries[i-1].DocID {
+					return nil, fmt.Errorf("%w: legacy postings: field %q term %q lists doc %d twice",
+						ErrCorrupt, name, term, e.DocID)
+				}
+				p.DocIDs = append(p.DocIDs, e.DocID)
+				p.Freqs = append(p.Freqs, e.Freq)
+				p.Positions = append(p.Positions, e.Positions)
+			}
+			f.Postings = append(f.Postings, p)
+		}
+		fields[name] = f
+	}
+	return fields, nil
+}
+
+// decodeLegacyStored parses a JSON stored-fields file, an object of doc IDs
+// to field names to base64 values, into the stored fields of maxDoc
+// documents.
+func decodeLegacyStored(data []byte, maxDoc uint32) ([]map[string][]byte, error) {
+	var byDoc map[string]map[string][]byte
+	if err := json.Unmarshal(data, &byDoc); err != nil {
+		return nil, fmt.Errorf("%w: legacy stored fields: %v", ErrCorrupt, err)
+	}
+	stored := make([]map[string][]byte, maxDoc)
+	for key, fields := range byDoc {
+		doc, err := strconv.ParseUint(key, 10, 32)
+		if err != nil || doc >= uint64(maxDoc) {
+			return nil, fmt.Errorf("%w: legacy stored fields: doc ID %q out of range", ErrCorrupt, key)
+		}
+		stored[doc] = fields
+	}
+	return stored, nil
+}
+
+// legacyExternalIDs recovers the external IDs of a legacy segment, which
+// did not record them, from the stored "id" field or, for documents that do
+// not store it, the terms indexed for it.
+func legacyExternalIDs(fields map[string]*FieldPostings, stored []map[string][]byte) []string {
+	ids := make([]string, len(stored))
+	for doc, s := range stored {
+		ids[doc] = string(s[legacyIDField])
+	}
+	if f := fields[legacyIDField]; f != nil {
+		for i, term := range f.Terms {
+			for _, doc := range f.Postings[i].DocIDs {
+				if int(doc) < len(ids) && ids[doc] == "" {
+					ids[doc] = term
+				}
+			}
+		}
+	}
+	return ids
+}
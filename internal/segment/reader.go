@@ -0,0 +1,222 @@
+package segment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+)
+
+// FieldPostings holds the sorted terms of one field and their postings.
+type FieldPostings struct {
+	Terms    []string
+	Postings []*Postings
+}
+
+// Postings is a term's postings list with per-document positions.
+type Postings struct {
+	DocIDs    []uint32
+	Freqs     []uint32
+	Positions [][]uint32
+}
+
+// Reader is a committed segment loaded into memory. It is immutable and
+// safe for concurrent searches.
+type Reader struct {
+	id          string
+	maxDoc      uint32
+	docCount    int
+	avgDocLen   float32
+	fields      map[string]*FieldPostings
+	externalIDs []string
+	docsByID    map[string]uint32
+	stored      []map[string][]byte
+	docValues   *docvalues.Segment
+	deleted     map[uint32]bool
+	tombstones  []string
+}
+
+var _ engine.Segment = (*Reader)(nil)
+
+// Open loads the segment with the given ID from an index directory.
+func Open(dir *index.IndexDir, segmentID string) (*Reader, error) {
+	read := func(name string) ([]byte, error) {
+		data, err := os.ReadFile(dir.SegmentFile(segmentID, name))
+		if err != nil {
+			return nil, fmt.Errorf("segment %s: read %s: %w", segmentID, name, err)
+		}
+		return data, nil
+	}
+
+	metaData, err := read("meta.json")
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		DocCount  int `json:"doc_count"`
+		TermCount int `json:"term_count"`
+	}
+	if err := json.Unmarshal(metaData, &meta); err != nil {
+		return nil, fmt.Errorf("segment %s: %w: meta.json: %v", segmentID, ErrCorrupt, err)
+	}
+
+	r := &Reader{
+		id:        segmentID,
+		docCount:  meta.DocCount,
+		avgDocLen: float32(meta.TermCount) / float32(max(meta.DocCount, 1)),
+	}
+	postingsData, err := read("postings.bin")
+	if err != nil {
+		return nil, err
+	}
+	storedData, err := read("stored.bin")
+	if err != nil {
+		return nil, err
+	}
+	if isLegacyJSON(postingsData) || isLegacyJSON(storedData) {
+		if err := r.openLegacy(postingsData, storedData, meta.DocCount); err != nil {
+			return nil, fmt.Errorf("segment %s: %w", segmentID, err)
+		}
+	} else {
+		if r.fields, err = DecodePostings(postingsData); err != nil {
+			return nil, fmt.Errorf("segment %s: postings: %w", segmentID, err)
+		}
+		if r.externalIDs, r.stored, err = DecodeStored(storedData); err != nil {
+			return nil, fmt.Errorf("segment %s: stored fields: %w", segmentID, err)
+		}
+	}
+	r.maxDoc = uint32(len(r.externalIDs))
+	r.docsByID = make(map[string]uint32, len(r.externalIDs))
+	for doc, id := range r.externalIDs {
+		if id != "" {
+			r.docsByID[id] = uint32(doc)
+		}
+	}
+
+	// Segments written before deletions were persisted have no file.
+	deletionsData, err := read("deletions.bin")
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		deleted, tombstones, err := DecodeDeletions(deletionsData)
+		if err != nil {
+			return nil, fmt.Errorf("segment %s: deletions: %w", segmentID, err)
+		}
+		r.tombstones = tombstones
+		r.deleted = make(map[uint32]bool, len(deleted))
+		for _, doc := range deleted {
+			if doc >= r.maxDoc {
+				return nil, fmt.Errorf("segment %s: %w: deleted doc %d out of range", segmentID, ErrCorrupt, doc)
+			}
+			r.deleted[doc] = true
+		}
+	}
+
+	// Segments written before doc values existed have no file either.
+	docValuesData, err := read("docvalues.bin")
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		r.docValues = docvalues.NewBuilder().Build(r.maxDoc)
+	case err != nil:
+		return nil, err
+	default:
+		if r.docValues, err = docvalues.Decode(docValuesData); err != nil {
+			return nil, fmt.Errorf("segment %s: doc values: %w", segmentID, err)
+		}
+	}
+	if dv := r.docValues.MaxDoc(); dv != r.maxDoc {
+		return nil, fmt.Errorf("segment %s: %w: doc values cover %d docs, stored fields %d",
+			segmentID, ErrCorrupt, dv, r.maxDoc)
+	}
+	return r, nil
+}
+
+// openLegacy loads the JSON postings and stored fields of a segment
+// committed before the binary format.
+func (r *Reader) openLegacy(postingsData, storedData []byte, docCount int) error {
+	if docCount < 0 || int64(docCount) > math.MaxUint32 {
+		return fmt.Errorf("%w: doc count %d", ErrCorrupt, docCount)
+	}
+	var err error
+	if r.fields, err = decodeLegacyPostings(postingsData, uint32(docCount)); err != nil {
+		return err
+	}
+	if r.stored, err = decodeLegacyStored(storedData, uint32(docCount)); err != nil {
+		return err
+	}
+	r.externalIDs = legacyExternalIDs(r.fields, r.stored)
+	return nil
+}
+
+// ID returns the segment ID.
+func (r *Reader) ID() string { return r.id }
+
+func (r *Reader) MaxDoc() uint32 { return r.maxDoc }
+
+func (r *Reader) DocCount() int { return r.docCount }
+
+func (r *Reader) AvgDocLength() float32 { return r.avgDocLen }
+
+func (r *Reader) Terms(field string) []string {
+	if f := r.fields[field]; f != nil {
+		return f.Terms
+	}
+	return nil
+}
+
+func (r *Reader) Postings(field, term string) *engine.Postings {
+	f := r.fields[field]
+	if f == nil {
+		return nil
+	}
+	i := sort.SearchStrings(f.Terms, term)
+	if i == len(f.Terms) || f.Terms[i] != term {
+		return nil
+	}
+	p := f.Postings[i]
+	return &engine.Postings{DocIDs: p.DocIDs, Freqs: p.Freqs, Positions: p.Positions}
+}
+
+func (r *Reader) DocValues() *docvalues.Segment { return r.docValues }
+
+// ExternalID returns the external ID of a document, or "" if it has none.
+func (r *Reader) ExternalID(docID uint32) string {
+	if docID >= r.maxDoc {
+		return ""
+	}
+	return r.externalIDs[docID]
+}
+
+// Lookup returns the doc ID of the document with the given external ID.
+// Deleted documents are found too.
+func (r *Reader) Lookup(externalID string) (uint32, bool) {
+	doc, ok := r.docsByID[externalID]
+	return doc, ok
+}
+
+// IsDeleted reports whether a document was deleted before the segment was
+// committed. Deletions by newer segments are in their Tombstones.
+func (r *Reader) IsDeleted(docID uint32) bool {
+	return r.deleted[docID]
+}
+
+// Tombstones returns the external IDs, in byte order, whose documents in
+// older segments this segment deletes.
+func (r *Reader) Tombstones() []string { return r.tombstones }
+
+// Stored returns the stored fields of a document.
+func (r *Reader) Stored(docID uint32) map[string][]byte {
+	if docID >= r.maxDoc {
+		return nil
+	}
+	return r.stored[docID]
+}
@@ -0,0 +1,294 @@
+package segment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/index"
+	"GoSearch/internal/indexing"
+	"GoSearch/internal/numeric"
+)
+
+func testBuffer(t *testing.T) *indexing.WriteBuffer {
+	t.Helper()
+	schema := &index.Schema{Fields: []index.FieldDef{
+		{Name: "id", Type: index.FieldTypeKeyword, Stored: true, Indexed: true},
+		{Name: "title", Type: index.FieldTypeText, Analyzer: "standard", Stored: true, Indexed: true, Positions: true},
+		{Name: "tags", Type: index.FieldTypeKeyword, Stored: true, Indexed: true, MultiValued: true, DocValues: true},
+		{Name: "price", Type: index.FieldTypeLong, Indexed: true, DocValues: true},
+	}}
+	w := indexing.NewWriter(schema, analysis.NewRegistry())
+	docs := []indexing.Document{
+		{Fields: map[string]interface{}{"id": "a", "title": "quick brown fox", "tags": []interface{}{"x", "y"}, "price": float64(-5)}},
+		{Fields: map[string]interface{}{"id": "b", "title": "the quick quick dog", "price": float64(300)}},
+		{Fields: map[string]interface{}{"id": "c"}},
+	}
+	if err := w.AddDocuments(docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.DeleteDocument("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.DeleteDocument("older"); err != nil {
+		t.Fatal(err)
+	}
+	return w.Buffer()
+}
+
+// writeSegment writes a buffer's segment files the way a commit does.
+func writeSegment(t *testing.T, buf *indexing.WriteBuffer) *index.IndexDir {
+	t.Helper()
+	dir := index.NewIndexDir(t.TempDir())
+	files := map[string][]byte{
+		"meta.json":     []byte(`{"doc_count": 3, "term_count": 12}`),
+		"postings.bin":  EncodePostings(buf.InvertedIndex),
+		"stored.bin":    EncodeStored(buf),
+		"docvalues.bin": docvalues.Encode(buf.DocValues.Build(buf.NextDocID)),
+		"deletions.bin": EncodeDeletions(buf),
+	}
+	if err := os.MkdirAll(dir.SegmentDir("seg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir.SegmentDir("seg"), name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestOpen_RoundTrip(t *testing.T) {
+	buf := testBuffer(t)
+	r, err := Open(writeSegment(t, buf), "seg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID() != "seg" || r.MaxDoc() != 3 || r.DocCount() != 3 || r.AvgDocLength() != 4 {
+		t.Errorf("stats: id=%s maxDoc=%d docCount=%d avg=%v", r.ID(), r.MaxDoc(), r.DocCount(), r.AvgDocLength())
+	}
+
+	for field, terms := range buf.InvertedIndex {
+		if got := len(r.Terms(field)); got != len(terms) {
+			t.Errorf("field %q has %d terms, want %d", field, got, len(terms))
+		}
+		for term, pl := range terms {
+			p := r.Postings(field, term)
+			if p == nil {
+				t.Errorf("%s:%q missing", field, term)
+				continue
+			}
+			for i, e := range pl.Entries {
+				if p.DocIDs[i] != e.DocID || p.Freqs[i] != e.Freq {
+					t.Errorf("%s:%q entry %d = (%d, %d), want (%d, %d)",
+						field, term, i, p.DocIDs[i], p.Freqs[i], e.DocID, e.Freq)
+				}
+			}
+		}
+	}
+	// Binary trie terms of numeric fields survive the round trip.
+	if p := r.Postings("price", numeric.EncodeTerm(-5, 0)); p == nil || p.DocIDs[0] != 0 {
+		t.Errorf("numeric term postings = %+v", p)
+	}
+	if p := r.Postings("title", "quick"); p == nil || !reflect.DeepEqual(p.Freqs, []uint32{1, 2}) {
+		t.Errorf("quick postings = %+v", p)
+	}
+	if r.Postings("title", "missing") != nil || r.Postings("missing", "quick") != nil {
+		t.Error("expected nil postings for missing term or field")
+	}
+
+	if r.ExternalID(1) != "b" || r.ExternalID(3) != "" {
+		t.Errorf("external IDs = %q, %q", r.ExternalID(1), r.ExternalID(3))
+	}
+	if doc, ok := r.Lookup("b"); !ok || doc != 1 {
+		t.Errorf("Lookup(b) = %d, %v", doc, ok)
+	}
+	if r.IsDeleted(1) || !r.IsDeleted(2) {
+		t.Errorf("IsDeleted(1) = %v, IsDeleted(2) = %v", r.IsDeleted(1), r.IsDeleted(2))
+	}
+	if want := []string{"c", "older"}; !reflect.DeepEqual(r.Tombstones(), want) {
+		t.Errorf("tombstones = %q, want %q", r.Tombstones(), want)
+	}
+	if got := string(r.Stored(0)["title"]); got != "quick brown fox" {
+		t.Errorf("stored title = %q", got)
+	}
+	if r.DocValues().SortedSetField("tags") == nil {
+		t.Error("doc values not loaded")
+	}
+}
+
+func TestDecodePostings_Positions(t *testing.T) {
+	buf := testBuffer(t)
+	fields, err := DecodePostings(EncodePostings(buf.InvertedIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fields["title"]
+	for i, term := range f.Terms {
+		for j, e := range buf.InvertedIndex["title"][term].Entries {
+			if !reflect.DeepEqual(f.Postings[i].Positions[j], e.Positions) {
+				t.Errorf("%q doc %d positions = %v, want %v", term, e.DocID, f.Postings[i].Positions[j], e.Positions)
+			}
+		}
+	}
+}
+
+func TestOpen_WithoutDeletions(t *testing.T) {
+	dir := writeSegment(t, testBuffer(t))
+	if err := os.Remove(dir.SegmentFile("seg", "deletions.bin")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(dir, "seg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.IsDeleted(2) || len(r.Tombstones()) != 0 {
+		t.Error("segment without deletions.bin should have no deletions")
+	}
+}
+
+func TestOpen_WithoutDocValues(t *testing.T) {
+	dir := writeSegment(t, testBuffer(t))
+	if err := os.Remove(dir.SegmentFile("seg", "docvalues.bin")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(dir, "seg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.DocValues().MaxDoc(); got != r.MaxDoc() {
+		t.Errorf("empty doc values should cover %d docs, got %d", r.MaxDoc(), got)
+	}
+	if r.DocValues().SortedSet("tags") != nil {
+		t.Error("segment without docvalues.bin should have no doc values fields")
+	}
+}
+
+func TestOpen_LegacyJSON(t *testing.T) {
+	dir := writeSegment(t, testBuffer(t))
+	legacy := map[string]string{
+		"meta.json": `{"doc_count":3,"term_count":4}`,
+		"postings.bin": `{"title":{"quick":{"Entries":[{"DocID":2,"Freq":1,"Positions":[1]},{"DocID":0,"Freq":2,"Positions":[0,3]}]}},` +
+			`"id":{"b":{"Entries":[{"DocID":1,"Freq":1,"Positions":null}]}}}`,
+		"stored.bin": `{"0":{"id":"YQ==","title":"cXVpY2s="},"2":{"id":"Yw=="}}`,
+	}
+	for name, data := range legacy {
+		if err := os.WriteFile(dir.SegmentFile("seg", name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"docvalues.bin", "deletions.bin"} {
+		if err := os.Remove(dir.SegmentFile("seg", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := Open(dir, "seg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.MaxDoc() != 3 || r.DocValues().MaxDoc() != 3 {
+		t.Fatalf("expected 3 docs, got %d with doc values for %d", r.MaxDoc(), r.DocValues().MaxDoc())
+	}
+	p := r.Postings("title", "quick")
+	if p == nil {
+		t.Fatal("missing postings for title:quick")
+	}
+	if !reflect.DeepEqual(p.DocIDs, []uint32{0, 2}) || !reflect.DeepEqual(p.Freqs, []uint32{2, 1}) ||
+		!reflect.DeepEqual(p.Positions, [][]uint32{{0, 3}, {1}}) {
+		t.Errorf("title:quick postings = %+v", p)
+	}
+	// Doc 1 does not store its ID, which is recovered from the id terms.
+	for doc, want := range []string{"a", "b", "c"} {
+		if got := r.ExternalID(uint32(doc)); got != want {
+			t.Errorf("doc %d: external ID %q, want %q", doc, got, want)
+		}
+		if got, ok := r.Lookup(want); !ok || got != uint32(doc) {
+			t.Errorf("Lookup(%q) = %d, %v", want, got, ok)
+		}
+	}
+	if got := string(r.Stored(0)["title"]); got != "quick" {
+		t.Errorf("stored title = %q", got)
+	}
+	if r.Stored(1) != nil || r.IsDeleted(0) || len(r.Tombstones()) != 0 {
+		t.Error("legacy segment should have no stored fields for doc 1 and no deletions")
+	}
+
+	if _, _, err := DecodeStored([]byte(legacy["stored.bin"])); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("legacy stored fields: expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestOpen_LegacyJSONCorrupt(t *testing.T) {
+	tests := map[string]string{
+		"doc out of range": `{"title":{"quick":{"Entries":[{"DocID":3,"Freq":1}]}}}`,
+		"duplicate doc":    `{"title":{"quick":{"Entries":[{"DocID":1,"Freq":1},{"DocID":1,"Freq":1}]}}}`,
+		"stored doc ID":    `{"x":{}}`,
+		"truncated":        `{"title":`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := writeSegment(t, testBuffer(t))
+			file := "postings.bin"
+			if name == "stored doc ID" {
+				file = "stored.bin"
+			}
+			files := map[string]string{
+				"meta.json":    `{"doc_count":3,"term_count":3}`,
+				"postings.bin": `{}`,
+				"stored.bin":   `{}`,
+				file:           data,
+			}
+			for f, data := range files {
+				if err := os.WriteFile(dir.SegmentFile("seg", f), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Remove(dir.SegmentFile("seg", "docvalues.bin")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Open(dir, "seg"); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("expected ErrCorrupt, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode_Corrupt(t *testing.T) {
+	buf := testBuffer(t)
+	postings := EncodePostings(buf.InvertedIndex)
+	stored := EncodeStored(buf)
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrCorrupt},
+		{"bad magic", append([]byte("GTSRXXX\x00"), postings[8:]...), ErrCorrupt},
+		{"version", append(append([]byte{}, postings[:8]...), 9, 0, 0, 0), ErrUnsupportedVersion},
+		{"truncated", postings[:len(postings)-3], ErrCorrupt},
+		{"trailing", append(append([]byte{}, postings...), 0), ErrCorrupt},
+		{"huge count", append(append([]byte{}, postings[:12]...), 0xff, 0xff, 0xff, 0x0f), ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodePostings(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if _, _, err := DecodeStored(stored[:len(stored)-1]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("truncated stored fields: expected ErrCorrupt, got %v", err)
+	}
+	deletions := EncodeDeletions(buf)
+	if _, _, err := DecodeDeletions(deletions[:len(deletions)-1]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("truncated deletions: expected ErrCorrupt, got %v", err)
+	}
+	if _, _, err := DecodeStored(postings); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("postings as stored fields: expected ErrCorrupt, got %v", err)
+	}
+}
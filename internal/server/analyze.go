@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/index"
+	"GoSearch/internal/query"
+)
+
+// MaxAnalyzeTextBytes bounds the text of an analyze request.
+const MaxAnalyzeTextBytes = 1 << 20
+
+// maxAnalyzeBodyBytes bounds the body of an analyze request before it is
+// decoded. JSON escapes a byte of text in at most six, and the rest leaves
+// room for an inline analyzer definition.
+const maxAnalyzeBodyBytes = 6*MaxAnalyzeTextBytes + 64<<10
+
+var ErrInvalidAnalyze = errors.New("invalid analyze request")
+
+// analyzeRequest is the body of an analyze request. It names the analyzer
+// of a field, an analyzer of the index, or defines one inline from built-in
+// components and those the index declares.
+type analyzeRequest struct {
+	Field    string `json:"field,omitempty"`
+	Analyzer string `json:"analyzer,omitempty"`
+	Text     string `json:"text"`
+
+	analysis.AnalyzerDef
+}
+
+// analyzeToken is a token in an analyze response. Offsets are byte offsets
+// into the request text.
+type analyzeToken struct {
+	Term           string `json:"term"`
+	Position       int    `json:"position"`
+	PositionLength int    `json:"position_length,omitempty"`
+	StartOffset    int    `json:"start_offset"`
+	EndOffset      int    `json:"end_offset"`
+}
+
+// analyzeStage is the output of one component of a pipeline analyzer.
+type analyzeStage struct {
+	Type   string          `json:"type"`
+	Name   string          `json:"name"`
+	Text   *string         `json:"text,omitempty"`
+	Tokens *[]analyzeToken `json:"tokens,omitempty"`
+}
+
+// analyzeResponse is the result of an analyze request. Stages are only
+// reported for analyzers built from components.
+type analyzeResponse struct {
+	Analyzer string         `json:"analyzer,omitempty"`
+	Tokens   []analyzeToken `json:"tokens"`
+	Stages   []analyzeStage `json:"stages,omitempty"`
+}
+
+// resolveAnalyzer returns the analyzer req selects from registry and its
+// name, which is empty for an inline definition.
+func resolveAnalyzer(schema *index.Schema, registry *analysis.Registry, req *analyzeRequest) (analysis.Analyzer, string, error) {
+	inline := req.Tokenizer != "" || len(req.CharFilters) > 0 || len(req.Filters) > 0
+	sources := 0
+	for _, set := range []bool{req.Field != "", req.Analyzer != "", inline} {
+		if set {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		return nil, "", fmt.Errorf("%w: one of field, analyzer or tokenizer is required", ErrInvalidAnalyze)
+	case sources > 1:
+		return nil, "", fmt.Errorf("%w: field, analyzer and an inline definition are mutually exclusive", ErrInvalidAnalyze)
+	}
+	if len(req.Text) > MaxAnalyzeTextBytes {
+		return nil, "", fmt.Errorf("%w: text longer than %d bytes", ErrInvalidAnalyze, MaxAnalyzeTextBytes)
+	}
+
+	if inline {
+		p, err := registry.NewPipeline(req.AnalyzerDef)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidAnalyze, err)
+		}
+		return p, "", nil
+	}
+
+	name := req.Analyzer
+	if req.Field != "" {
+		f := schema.Field(req.Field)
+		if f == nil {
+			return nil, "", fmt.Errorf("%w: unknown field %q", ErrInvalidAnalyze, req.Field)
+		}
+		switch f.Type {
+		case index.FieldTypeText:
+			name = f.Analyzer
+		case index.FieldTypeKeyword:
+			return analysis.NewKeywordAnalyzer(), index.AnalyzerKeyword, nil
+		default:
+			return nil, "", fmt.Errorf("%w: field %q of type %q is not analyzed", ErrInvalidAnalyze, req.Field, f.Type)
+		}
+	}
+	a, err := registry.Get(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidAnalyze, err)
+	}
+	return a, name, nil
+}
+
+// analyze runs a over text, reporting the stages of a pipeline.
+func analyze(a analysis.Analyzer, name, field, text string) analyzeResponse {
+	resp := analyzeResponse{Analyzer: name}
+	p, ok := a.(*analysis.Pipeline)
+	if !ok {
+		resp.Tokens = analyzeTokens(a.Analyze(field, text))
+		return resp
+	}
+	tokens, stages := p.AnalyzeStages(text)
+	resp.Tokens = analyzeTokens(tokens)
+	for _, s := range stages {
+		stage := analyzeStage{Type: s.Kind, Name: s.Name}
+		if s.Kind == analysis.StageCharFilter {
+			stage.Text = &s.Text
+		} else {
+			tokens := analyzeTokens(s.Tokens)
+			stage.Tokens = &tokens
+		}
+		resp.Stages = append(resp.Stages, stage)
+	}
+	return resp
+}
+
+func analyzeTokens(tokens []analysis.Token) []analyzeToken {
+	out := make([]analyzeToken, len(tokens))
+	for i, tok := range tokens {
+		out[i] = analyzeToken{
+			Term:           tok.Term,
+			Position:       tok.Position,
+			PositionLength: tok.PositionLength,
+			StartOffset:    tok.StartByte,
+			EndOffset:      tok.EndByte,
+		}
+	}
+	return out
+}
+
+// searchAnalyzers returns the analyzers of match queries on the fields of
+// schema: a text field's search analyzer, or else one keeping the whole
+// value as a single term, as keyword and numeric fields are indexed.
+func searchAnalyzers(schema *index.Schema, registry *analysis.Registry) query.FieldAnalyzer {
+	return func(field string) (analysis.Analyzer, bool, error) {
+		f := schema.Field(field)
+		if f == nil || f.Type != index.FieldTypeText {
+			return analysis.NewKeywordAnalyzer(), false, nil
+		}
+		a, err := registry.Get(f.SearchAnalyzerName())
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: field %q: %v", query.ErrInvalidQuery, field, err)
+		}
+		return a, f.Positions, nil
+	}
+}
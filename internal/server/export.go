@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"GoSearch/internal/engine"
+	"GoSearch/internal/query"
+)
+
+// exportFlushInterval is the number of exported documents written between
+// flushes of the response.
+const exportFlushInterval = 256
+
+var ErrInvalidCursor = errors.New("invalid export cursor")
+
+// exportRequest is the body of an export. A nil query exports every live
+// document.
+type exportRequest struct {
+	Query  *query.Clause `json:"query,omitempty"`
+	PIT    *pitRequest   `json:"pit,omitempty"`
+	Cursor string        `json:"cursor,omitempty"`
+}
+
+// formatExportCursor returns the cursor of an exported document. It names
+// the committed segment rather than its ordinal, so an export can resume in
+// a later generation as long as the segment still exists.
+func formatExportCursor(segmentID string, docID uint32) string {
+	return segmentID + ":" + strconv.FormatUint(uint64(docID), 10)
+}
+
+// exportStart returns the segment ordinal and doc ID at which an export
+// resuming after cursor starts. An empty cursor starts at the beginning.
+func exportStart(segments []hitSegment, cursor string) (int, uint32, error) {
+	if cursor == "" {
+		return 0, 0, nil
+	}
+	i := strings.LastIndexByte(cursor, ':')
+	if i <= 0 {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+	id := cursor[:i]
+	doc, err := strconv.ParseUint(cursor[i+1:], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+	for ord, seg := range segments {
+		if segmentID(seg) != id {
+			continue
+		}
+		if uint32(doc) >= seg.MaxDoc() {
+			return 0, 0, fmt.Errorf("%w: doc %d out of range for segment %s", ErrInvalidCursor, doc, id)
+		}
+		return ord, uint32(doc) + 1, nil
+	}
+	return 0, 0, fmt.Errorf("%w: segment %s no longer exists", ErrInvalidCursor, id)
+}
+
+// streamExport writes every live document of segments matching q, from the
+// given start, as one NDJSON line each. The last line reports completion,
+// or the error that ended the export together with the cursor to resume
+// from. The response is flushed periodically so it streams with chunked
+// transfer encoding.
+func streamExport(w http.ResponseWriter, r *http.Request, searcher *engine.Searcher, segments []hitSegment, q query.Query, startSeg int, startDoc uint32, generation uint64) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	exported := 0
+	var cursor string
+	err := searcher.Scan(q, startSeg, startDoc, func(ord int, docID uint32) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		seg := segments[ord]
+		cursor = formatExportCursor(segmentID(seg), docID)
+		line := map[string]interface{}{
+			"doc_id": docID,
+			"cursor": cursor,
+		}
+		if extID := seg.ExternalID(docID); extID != "" {
+			line["id"] = extID
+		}
+		if stored := seg.Stored(docID); stored != nil {
+			fields := make(map[string]string, len(stored))
+			for k, v := range stored {
+				fields[k] = string(v)
+			}
+			line["stored_fields"] = fields
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+		exported++
+		if exported%exportFlushInterval == 0 {
+			return flush()
+		}
+		return nil
+	})
+
+	trailer := map[string]interface{}{
+		"exported":   exported,
+		"generation": generation,
+	}
+	if cursor != "" {
+		trailer["cursor"] = cursor
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			// The client is gone; it resumes from its last cursor.
+			return
+		}
+		trailer["error"] = map[string]string{"message": err.Error()}
+	} else {
+		trailer["done"] = true
+	}
+	_ = enc.Encode(trailer)
+	_ = flush()
+}
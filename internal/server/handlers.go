@@ -4,21 +4,33 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
-	"strings"
 	"time"
 
+	"GoSearch/internal/aggregation"
+	"GoSearch/internal/analysis"
 	"GoSearch/internal/engine"
+	"GoSearch/internal/highlight"
 	"GoSearch/internal/index"
 	"GoSearch/internal/indexing"
-	"GoSearch/internal/scoring"
+	"GoSearch/internal/query"
+	"GoSearch/internal/suggest"
 )
 
+// DefaultMaxResultWindow is the default limit on from + size for search
+// requests. Deeper pages are read with search_after on a point in time.
+const DefaultMaxResultWindow = 10_000
+
 // Handler holds HTTP handlers for the GoSearch API.
 type Handler struct {
 	mgr    *IndexManager
 	logger *slog.Logger
+
+	// MaxResultWindow limits from + size for search requests.
+	MaxResultWindow int
 }
 
 // NewHandler creates a new Handler backed by the given IndexManager.
@@ -26,7 +38,7 @@ func NewHandler(mgr *IndexManager, logger *slog.Logger) *Handler {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &Handler{mgr: mgr, logger: logger}
+	return &Handler{mgr: mgr, logger: logger, MaxResultWindow: DefaultMaxResultWindow}
 }
 
 // RegisterRoutes registers all API routes on the given mux.
@@ -46,6 +58,20 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 
 	// Search.
 	mux.HandleFunc("POST /indexes/{name}/search", h.handleSearch)
+
+	// Point in time.
+	mux.HandleFunc("POST /indexes/{name}/_pit", h.handleOpenPIT)
+	mux.HandleFunc("DELETE /indexes/{name}/_pit/{id}", h.handleClosePIT)
+
+	// Export.
+	mux.HandleFunc("POST /indexes/{name}/_export", h.handleExport)
+
+	// Autocomplete.
+	mux.HandleFunc("POST /indexes/{name}/_suggest", h.handleSuggest)
+
+	// Analyzers.
+	mux.HandleFunc("POST /indexes/{name}/_reload_analyzers", h.handleReloadAnalyzers)
+	mux.HandleFunc("POST /indexes/{name}/_analyze", h.handleAnalyze)
 }
 
 // --- Index Lifecycle ---
@@ -72,6 +98,10 @@ func (h *Handler) handleCreateIndex(w http.ResponseWriter, r *http.Request) {
 		Name            string          `json:"name"`
 		DefaultAnalyzer string          `json:"default_analyzer"`
 		Fields          []index.FieldDef `json:"fields"`
+		Analyzers       map[string]analysis.AnalyzerDef `json:"analyzers"`
+		CharFilters     map[string]analysis.CharFilterDef `json:"char_filters"`
+		Tokenizers      map[string]analysis.TokenizerDef `json:"tokenizers"`
+		TokenFilters    map[string]analysis.TokenFilterDef `json:"token_filters"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
@@ -86,6 +116,10 @@ func (h *Handler) handleCreateIndex(w http.ResponseWriter, r *http.Request) {
 	schema := &index.Schema{
 		DefaultAnalyzer: req.DefaultAnalyzer,
 		Fields:          req.Fields,
+		Analyzers:       req.Analyzers,
+		CharFilters:     req.CharFilters,
+		Tokenizers:      req.Tokenizers,
+		TokenFilters:    req.TokenFilters,
 	}
 
 	if err := h.mgr.CreateIndex(req.Name, schema); err != nil {
@@ -287,17 +321,153 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// --- Analyzers ---
+
+func (h *Handler) handleReloadAnalyzers(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	inst, err := h.mgr.GetIndex(name)
+	if err != nil {
+		if errors.Is(err, ErrIndexNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := inst.ReloadAnalyzers(); err != nil {
+		if errors.Is(err, index.ErrSchemaInvalidAnalyzer) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "reload analyzers: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "reloaded",
+	})
+}
+
+func (h *Handler) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	inst, err := h.mgr.GetIndex(name)
+	if err != nil {
+		if errors.Is(err, ErrIndexNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var req analyzeRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxAnalyzeBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	analyzer, analyzerName, err := resolveAnalyzer(inst.Schema, inst.Registry(), &req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, analyze(analyzer, analyzerName, req.Field, req.Text))
+}
+
 // --- Search ---
 
 // searchRequest represents a search query.
 type searchRequest struct {
-	Query struct {
-		Type  string `json:"type"`
-		Field string `json:"field"`
-		Value string `json:"value"`
-	} `json:"query"`
-	TopK    int  `json:"top_k"`
-	Explain bool `json:"explain"`
+	Query        query.Clause                   `json:"query"`
+	TopK         int                            `json:"top_k"`
+	Explain      bool                           `json:"explain"`
+	Aggregations map[string]aggregation.Request `json:"aggregations,omitempty"`
+	Highlight    *highlight.Request             `json:"highlight,omitempty"`
+
+	// From and Size select a page of hits; Size overrides TopK.
+	From int  `json:"from"`
+	Size *int `json:"size,omitempty"`
+
+	// SearchAfter is the sort value of the last hit of the previous page:
+	// [score, doc].
+	SearchAfter []float64 `json:"search_after,omitempty"`
+
+	// PIT searches an open point in time instead of the latest data.
+	PIT *pitRequest `json:"pit,omitempty"`
+
+	// Suggest asks for spelling corrections when there are few hits.
+	Suggest *suggestRequest `json:"suggest,omitempty"`
+
+	// RequestCache set to false bypasses the result cache.
+	RequestCache *bool `json:"request_cache,omitempty"`
+}
+
+// suggestRequest holds the suggesters run alongside a search.
+type suggestRequest struct {
+	Phrase *suggest.PhraseRequest `json:"phrase,omitempty"`
+}
+
+// pitRequest names a point in time and extends its keep-alive.
+type pitRequest struct {
+	ID        string `json:"id"`
+	KeepAlive string `json:"keep_alive"`
+}
+
+// docSortValue encodes a hit's segment ordinal and doc ID as the tiebreak
+// of its sort value. It fits a JSON number exactly.
+func docSortValue(d engine.ScoredDoc) uint64 {
+	return uint64(d.Segment)<<32 | uint64(d.DocID)
+}
+
+// parseSearchAfter decodes a [score, doc] sort value.
+func parseSearchAfter(values []float64) (engine.ScoredDoc, error) {
+	if len(values) != 2 {
+		return engine.ScoredDoc{}, errors.New("search_after must be [score, doc]")
+	}
+	doc := values[1]
+	if doc < 0 || doc != math.Trunc(doc) || doc >= 1<<53 {
+		return engine.ScoredDoc{}, fmt.Errorf("search_after doc %v is not a valid doc sort value", doc)
+	}
+	key := uint64(doc)
+	return engine.ScoredDoc{
+		Score:   float32(values[0]),
+		Segment: int(key >> 32),
+		DocID:   uint32(key),
+	}, nil
+}
+
+// validatePaging applies defaults to the paging options and checks them
+// against the result window.
+func (h *Handler) validatePaging(req *searchRequest) error {
+	size := req.TopK
+	if req.Size != nil {
+		size = *req.Size
+	} else if size <= 0 {
+		size = 10
+	}
+	if req.From < 0 || size < 0 {
+		return errors.New("from and size must not be negative")
+	}
+	if req.SearchAfter != nil && req.From > 0 {
+		return errors.New("from must be 0 when search_after is set")
+	}
+	// Doc sort values hold segment ordinals, which only a point in time
+	// keeps stable across commits.
+	if req.SearchAfter != nil && req.PIT == nil {
+		return errors.New("search_after requires a pit")
+	}
+	if req.From+size > h.MaxResultWindow {
+		return fmt.Errorf("from + size must be at most %d; use search_after with a pit to page deeper", h.MaxResultWindow)
+	}
+	req.TopK = size
+	return nil
 }
 
 func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
@@ -318,179 +488,480 @@ func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.TopK <= 0 {
-		req.TopK = 10
+	if err := h.validatePaging(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var after *engine.ScoredDoc
+	if req.SearchAfter != nil {
+		a, err := parseSearchAfter(req.SearchAfter)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		after = &a
 	}
 
-	start := time.Now()
+	// Read before the analyzers, which a reset of the cache may replace.
+	cacheEpoch := inst.results.currentEpoch()
 
-	// Acquire snapshot for consistent read.
-	snap, err := inst.Snapshots.Acquire()
+	q, err := req.Query.ToQuery()
+	if err == nil {
+		q, err = query.AnalyzeMatches(q, searchAnalyzers(inst.Schema, inst.Registry()))
+	}
+	if err == nil {
+		q = query.Rewrite(q)
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to acquire snapshot: "+err.Error())
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer func() { _ = snap.Release() }()
+
+	var aggs *aggregation.Collector
+	if len(req.Aggregations) > 0 {
+		aggs, err = aggregation.NewCollector(inst.Schema, req.Aggregations)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var hl *highlight.Highlighter
+	if req.Highlight != nil {
+		hl, err = highlight.New(inst.Schema, inst.Registry(), q, *req.Highlight)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var phrase *suggest.PhraseSuggester
+	if req.Suggest != nil && req.Suggest.Phrase != nil {
+		phrase, err = suggest.NewPhrase(inst.Schema, inst.Registry(), *req.Suggest.Phrase)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	start := time.Now()
+
+	// Search a point in time, or a fresh snapshot plus the write buffer.
+	var segments []hitSegment
+	var generation uint64
+	if req.PIT != nil {
+		keepAlive, err := parseKeepAlive(req.PIT.KeepAlive)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		pit, err := inst.pit(req.PIT.ID, keepAlive)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		segments, generation = pit.segments, pit.snap.Generation
+	} else {
+		snap, err := inst.Snapshots.Acquire()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to acquire snapshot: "+err.Error())
+			return
+		}
+		defer func() { _ = snap.Release() }()
+		if segments, err = inst.searchSegments(snap, true); err != nil {
+			writeError(w, searchErrorStatus(err), "failed to open segments: "+err.Error())
+			return
+		}
+		generation = snap.Generation
+	}
+
+	cacheKey, cacheable := resultCacheKey(req, q, segments)
+	if cacheable {
+		if cached, ok := inst.results.get(generation, cacheKey); ok {
+			response := make(map[string]json.RawMessage, len(cached)+1)
+			for name, v := range cached {
+				response[name] = v
+			}
+			response["took_ms"], _ = json.Marshal(time.Since(start).Milliseconds())
+			writeJSON(w, http.StatusOK, response)
+			return
+		}
+	}
 
 	// Create execution context with timeout.
 	execCtx := engine.NewExecutionContext(30*time.Second, 10000, 1000)
 
-	// Execute search against the write buffer (MVP: in-memory search).
-	// In a full implementation, this would search committed segments via FST + postings.
-	hits := executeSearch(inst, req, execCtx)
+	hits, total, err := executeSearch(inst, segments, q, req, after, aggs, hl, execCtx)
+	if err != nil {
+		writeError(w, searchErrorStatus(err), err.Error())
+		return
+	}
+
+	var corrections []suggest.PhraseSuggestion
+	if phrase != nil && phrase.Wanted(total) {
+		engineSegments := make([]engine.Segment, len(segments))
+		for i, seg := range segments {
+			engineSegments[i] = seg
+		}
+		suggestCtx := engine.NewExecutionContext(30*time.Second, suggest.MaxStatesVisited, suggest.MaxExpandedTerms)
+		if corrections, err = phrase.Suggest(engineSegments, suggestCtx); err != nil {
+			writeError(w, searchErrorStatus(err), err.Error())
+			return
+		}
+	}
 
 	took := time.Since(start)
 
 	response := map[string]interface{}{
 		"status":     "success",
 		"took_ms":    took.Milliseconds(),
-		"total_hits": len(hits),
-		"generation": snap.Generation,
+		"total_hits": total,
+		"generation": generation,
 		"timed_out":  execCtx.TimedOut,
 		"hits":       hits,
 	}
+	if req.PIT != nil {
+		response["pit_id"] = req.PIT.ID
+	}
+	if aggs != nil {
+		results, err := aggs.Results()
+		if err != nil {
+			writeError(w, searchErrorStatus(err), err.Error())
+			return
+		}
+		response["aggregations"] = results
+	}
+	if phrase != nil {
+		if corrections == nil {
+			corrections = []suggest.PhraseSuggestion{}
+		}
+		response["suggest"] = map[string]interface{}{"phrase": corrections}
+	}
+	if cacheable && !execCtx.TimedOut {
+		inst.results.put(cacheEpoch, generation, cacheKey, response)
+	}
 
 	writeJSON(w, http.StatusOK, response)
 }
 
-// executeSearch performs a search against the index.
-// MVP implementation: searches the in-memory inverted index from the write buffer.
-func executeSearch(inst *IndexInstance, req searchRequest, execCtx *engine.ExecutionContext) []map[string]interface{} {
-	field := req.Query.Field
-	value := req.Query.Value
-
-	if field == "" || value == "" {
-		return nil
+// resultCacheKey returns the result cache key of a validated search request
+// and its query on the given segments: the request's JSON with the page size
+// normalized into TopK. Requests on a point in time or on uncommitted
+// documents, which the generation does not fix, are not cached, nor are
+// those scored relative to the current time or that bypass the cache.
+func resultCacheKey(req searchRequest, q query.Query, segments []hitSegment) (string, bool) {
+	if req.PIT != nil || (req.RequestCache != nil && !*req.RequestCache) || query.TimeDependent(q) {
+		return "", false
+	}
+	for _, seg := range segments {
+		if _, ok := seg.(*bufferSegment); ok {
+			return "", false
+		}
 	}
-
-	// Check execution limits.
-	if err := execCtx.CheckLimits(); err != nil {
-		return nil
+	req.Size, req.RequestCache = nil, nil
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", false
 	}
+	return string(data), true
+}
 
-	// For MVP, search the committed manifest's segment data is not yet implemented.
-	// Instead, search the current write buffer if a writer is active.
-	inst.writerMu.Lock()
-	w := inst.writer
-	inst.writerMu.Unlock()
-
-	if w == nil {
-		return nil
+// searchErrorStatus maps query execution errors to HTTP status codes.
+// Errors caused by the request itself are client errors.
+func searchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, query.ErrInvalidQuery),
+		errors.Is(err, aggregation.ErrInvalidAggregation),
+		errors.Is(err, engine.ErrUnsupportedQuery),
+		errors.Is(err, engine.ErrMatchLimitExceeded),
+		errors.Is(err, engine.ErrStateLimitExceeded):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
 	}
+}
 
-	buf := w.Buffer()
-	fieldMap, ok := buf.InvertedIndex[field]
-	if !ok {
-		return nil
+// executeSearch performs a search over the given segments and returns
+// the requested page of formatted hits together with the total number of
+// matching documents. Every matching document is also fed to aggs, and
+// hits are highlighted by hl, when non-nil.
+func executeSearch(inst *IndexInstance, segments []hitSegment, q query.Query, req searchRequest, after *engine.ScoredDoc, aggs *aggregation.Collector, hl *highlight.Highlighter, execCtx *engine.ExecutionContext) ([]map[string]interface{}, int, error) {
+	engineSegments := make([]engine.Segment, len(segments))
+	for i, seg := range segments {
+		engineSegments[i] = seg
+	}
+	searcher := engine.NewSearcher(inst.Schema, engineSegments, execCtx)
+	searcher.SetFilterCache(inst.filterCache)
+	var collectors []engine.SegmentCollector
+	if aggs != nil {
+		collectors = append(collectors, aggs)
+	}
+
+	// Collect through the end of the page, then skip to its start. Size 0
+	// still collects one document so totals and aggregations are computed.
+	k := max(req.From+req.TopK, 1)
+	var topDocs *engine.TopDocs
+	var err error
+	if after != nil {
+		topDocs, err = searcher.SearchAfter(q, k, *after, collectors...)
+	} else {
+		topDocs, err = searcher.Search(q, k, collectors...)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	docs := topDocs.Docs
+	if req.From < len(docs) {
+		docs = docs[req.From:]
+	} else {
+		docs = nil
+	}
+	if len(docs) > req.TopK {
+		docs = docs[:req.TopK]
 	}
 
-	// Handle different query types.
-	var matchingTerms []string
-	switch req.Query.Type {
-	case "term":
-		if _, ok := fieldMap[value]; ok {
-			matchingTerms = []string{value}
+	// Format results.
+	hits := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		seg := segments[doc.Segment]
+		hit := map[string]interface{}{
+			"doc_id": doc.DocID,
+			"score":  doc.Score,
+			"sort":   []interface{}{doc.Score, docSortValue(doc)},
+		}
+		if extID := seg.ExternalID(doc.DocID); extID != "" {
+			hit["id"] = extID
 		}
-	case "prefix":
-		for term := range fieldMap {
-			if strings.HasPrefix(term, value) {
-				matchingTerms = append(matchingTerms, term)
-				execCtx.TermsMatched++
-				if err := execCtx.CheckLimits(); err != nil {
-					break
+
+		// Include stored fields if available.
+		if stored := seg.Stored(doc.DocID); stored != nil {
+			fields := make(map[string]string, len(stored))
+			for k, v := range stored {
+				fields[k] = string(v)
+			}
+			hit["stored_fields"] = fields
+
+			if hl != nil {
+				if frags := hl.Highlight(stored); len(frags) > 0 {
+					hit["highlight"] = frags
 				}
 			}
 		}
-	default:
-		// Default to term query.
-		if _, ok := fieldMap[value]; ok {
-			matchingTerms = []string{value}
+
+		if req.Explain {
+			explanation, err := searcher.Explain(q, doc.Segment, doc.DocID)
+			if err != nil {
+				return nil, 0, err
+			}
+			hit["explanation"] = explanation
 		}
-	}
 
-	if len(matchingTerms) == 0 {
-		return nil
+		hits[i] = hit
 	}
 
-	// Collect matching documents using iterators and scorer.
-	scorer := scoring.NewBM25Scorer(int64(buf.DocCount), float32(buf.TermCount)/float32(max(buf.DocCount, 1)))
-	collector := engine.NewTopKCollector(req.TopK)
+	return hits, topDocs.TotalHits, nil
+}
 
-	for _, term := range matchingTerms {
-		pl := fieldMap[term]
-		if pl == nil {
-			continue
+// --- Point in Time ---
+
+func (h *Handler) handleOpenPIT(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	inst, err := h.mgr.GetIndex(name)
+	if err != nil {
+		if errors.Is(err, ErrIndexNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
 		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	keepAlive, err := parseKeepAlive(r.URL.Query().Get("keep_alive"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := inst.OpenPIT(keepAlive)
+	if err != nil {
+		writeError(w, searchErrorStatus(err), "failed to open point in time: "+err.Error())
+		return
+	}
 
-		idf := scorer.IDF(int64(len(pl.Entries)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"pit_id":        id,
+		"keep_alive_ms": keepAlive.Milliseconds(),
+	})
+}
 
-		// Build postings iterator.
-		docIDs := make([]uint32, len(pl.Entries))
-		freqs := make([]uint32, len(pl.Entries))
-		for i, e := range pl.Entries {
-			docIDs[i] = e.DocID
-			freqs[i] = e.Freq
+func (h *Handler) handleClosePIT(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	inst, err := h.mgr.GetIndex(name)
+	if err != nil {
+		if errors.Is(err, ErrIndexNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
 		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-		it := engine.NewSlicePostingsIterator(docIDs, freqs)
-		for it.Next() {
-			score := scorer.Score(it.Freq(), 100, idf) // Approximate doc length.
-			collector.Collect(it.DocID(), score)
+	id := r.PathValue("id")
+	if err := inst.ClosePIT(id); err != nil {
+		if errors.Is(err, ErrPITNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
 		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	// Format results.
-	results := collector.Results()
-	hits := make([]map[string]interface{}, len(results))
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "closed",
+		"pit_id": id,
+	})
+}
 
-	// Build reverse mapping: internal ID → external ID.
-	internalToExternal := make(map[uint32]string, len(buf.ExternalToInternal))
-	for ext, internal := range buf.ExternalToInternal {
-		internalToExternal[internal] = ext
-	}
+// --- Export ---
 
-	for i, doc := range results {
-		hit := map[string]interface{}{
-			"doc_id": doc.DocID,
-			"score":  doc.Score,
+// handleExport streams every committed document matching a query as NDJSON
+// in segment and doc ID order, without scoring. Exports read a point in
+// time or a snapshot pinned for the duration of the request, and resume
+// after the cursor of the last document received.
+func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	inst, err := h.mgr.GetIndex(name)
+	if err != nil {
+		if errors.Is(err, ErrIndexNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
 		}
-		if extID, ok := internalToExternal[doc.DocID]; ok {
-			hit["id"] = extID
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var req exportRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
 		}
+	}
 
-		// Include stored fields if available.
-		if stored, ok := buf.StoredFields[doc.DocID]; ok {
-			fields := make(map[string]string, len(stored))
-			for k, v := range stored {
-				fields[k] = string(v)
-			}
-			hit["stored_fields"] = fields
+	clause := req.Query
+	if clause == nil {
+		clause = &query.Clause{Type: query.ClauseMatchAll}
+	}
+	q, err := clause.ToQuery()
+	if err == nil {
+		q, err = query.AnalyzeMatches(q, searchAnalyzers(inst.Schema, inst.Registry()))
+	}
+	if err == nil {
+		q = query.Rewrite(q)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var segments []hitSegment
+	var generation uint64
+	if req.PIT != nil {
+		keepAlive, err := parseKeepAlive(req.PIT.KeepAlive)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		pit, err := inst.pit(req.PIT.ID, keepAlive)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		segments, generation = pit.segments, pit.snap.Generation
+	} else {
+		snap, err := inst.Snapshots.Acquire()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to acquire snapshot: "+err.Error())
+			return
+		}
+		defer func() { _ = snap.Release() }()
+		if segments, err = inst.searchSegments(snap, false); err != nil {
+			writeError(w, searchErrorStatus(err), "failed to open segments: "+err.Error())
+			return
 		}
+		generation = snap.Generation
+	}
 
-		if req.Explain {
-			for _, term := range matchingTerms {
-				pl := fieldMap[term]
-				if pl == nil {
-					continue
-				}
-				// Find the term frequency for this doc.
-				var tf uint32
-				for _, e := range pl.Entries {
-					if e.DocID == doc.DocID {
-						tf = e.Freq
-						break
-					}
-				}
-				explanation := scorer.Explain(field, term, tf, 100, int64(len(pl.Entries)))
-				hit["explanation"] = explanation
-				break
-			}
+	startSeg, startDoc, err := exportStart(segments, req.Cursor)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	engineSegments := make([]engine.Segment, len(segments))
+	for i, seg := range segments {
+		engineSegments[i] = seg
+	}
+	searcher := engine.NewSearcher(inst.Schema, engineSegments, engine.NewExecutionContext(30*time.Second, 10000, 1000))
+	searcher.SetFilterCache(inst.filterCache)
+	streamExport(w, r, searcher, segments, q, startSeg, startDoc, generation)
+}
+
+// --- Autocomplete ---
+
+func (h *Handler) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	inst, err := h.mgr.GetIndex(name)
+	if err != nil {
+		if errors.Is(err, ErrIndexNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
 		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-		hits[i] = hit
+	var req suggest.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	suggester, err := suggest.New(inst.Schema, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	return hits
+	start := time.Now()
+
+	snap, err := inst.Snapshots.Acquire()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to acquire snapshot: "+err.Error())
+		return
+	}
+	defer func() { _ = snap.Release() }()
+	segments, err := inst.searchSegments(snap, true)
+	if err != nil {
+		writeError(w, searchErrorStatus(err), "failed to open segments: "+err.Error())
+		return
+	}
+	engineSegments := make([]engine.Segment, len(segments))
+	for i, seg := range segments {
+		engineSegments[i] = seg
+	}
+
+	execCtx := engine.NewExecutionContext(30*time.Second, suggest.MaxStatesVisited, suggest.MaxExpandedTerms)
+	suggestions, err := suggester.Suggest(engineSegments, execCtx)
+	if err != nil {
+		writeError(w, searchErrorStatus(err), err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":      "success",
+		"took_ms":     time.Since(start).Milliseconds(),
+		"generation":  snap.Generation,
+		"suggestions": suggestions,
+	})
 }
 
 // --- Helpers ---
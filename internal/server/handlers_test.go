@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func term(field, value string) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{"field": field, "value": value}}
+}
+
+// explanation returns the explanation of a search response's first hit.
+func explanation(t *testing.T, resp map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	hits, _ := resp["hits"].([]interface{})
+	if len(hits) == 0 {
+		t.Fatalf("expected hits, got %v", resp)
+	}
+	e, ok := hits[0].(map[string]interface{})["explanation"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("hit has no explanation: %v", hits[0])
+	}
+	return e
+}
+
+func jsonString(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSearch_RewritesDisMaxAndConstantScore(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true, doc("a", "quick fox"), doc("b", "lazy dog"))
+	explain := func(q map[string]interface{}) map[string]interface{} {
+		return explanation(t, s.search(map[string]interface{}{"query": q, "explain": true}))
+	}
+	termExplanation := jsonString(t, explain(term("title", "fox")))
+
+	// A dis-max whose only other alternative matches nothing runs as its
+	// remaining query.
+	got := explain(map[string]interface{}{"dis_max": map[string]interface{}{
+		"queries": []interface{}{term("title", "fox"), map[string]interface{}{"match_none": map[string]interface{}{}}},
+	}})
+	if jsonString(t, got) != termExplanation {
+		t.Errorf("dis_max was not unwrapped:\ngot  %s\nwant %s", jsonString(t, got), termExplanation)
+	}
+
+	// Nested constant scores keep the outer score over the inner filter.
+	got = explain(map[string]interface{}{"constant_score": map[string]interface{}{
+		"filter": map[string]interface{}{"constant_score": map[string]interface{}{"filter": term("title", "fox"), "boost": 5}},
+		"boost":  2,
+	}})
+	details, _ := got["details"].([]interface{})
+	if got["value"] != float64(2) || len(details) != 1 || jsonString(t, details[0]) != termExplanation {
+		t.Errorf("nested constant_score was not flattened: %s", jsonString(t, got))
+	}
+
+	// A constant score over everything is a boosted match_all.
+	resp := s.search(map[string]interface{}{
+		"query": map[string]interface{}{"constant_score": map[string]interface{}{
+			"filter": map[string]interface{}{"match_all": map[string]interface{}{}},
+			"boost":  3,
+		}},
+		"explain": true,
+	})
+	if got := explanation(t, resp); got["description"] != "match_all" || got["value"] != float64(3) {
+		t.Errorf("constant_score over match_all: got %s", jsonString(t, got))
+	}
+	if resp["total_hits"] != float64(2) {
+		t.Errorf("total_hits = %v, want 2", resp["total_hits"])
+	}
+}
+
+func TestSearch_RewritesFunctionScore(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true,
+		map[string]interface{}{"id": "a", "title": "quick fox", "price": float64(10)},
+		map[string]interface{}{"id": "b", "title": "lazy fox", "price": float64(100)},
+		map[string]interface{}{"id": "c", "title": "lazy dog", "price": float64(1000)},
+	)
+	matchAll := map[string]interface{}{"match_all": map[string]interface{}{}}
+	withMatchAll := func(q map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"bool": map[string]interface{}{"must": []interface{}{matchAll, q}}}
+	}
+	resp := s.search(map[string]interface{}{
+		"query": map[string]interface{}{"function_score": map[string]interface{}{
+			"query": withMatchAll(term("title", "fox")),
+			"functions": []interface{}{
+				map[string]interface{}{"filter": withMatchAll(term("title", "lazy")), "weight": 10},
+				map[string]interface{}{"field_value_factor": map[string]interface{}{"field": "price"}},
+			},
+			"score_mode": "sum",
+		}},
+		"explain": true,
+	})
+	if got := hitIDs(resp); len(got) != 2 || got[0] != "b" || got[1] != "a" {
+		t.Fatalf("hits = %v, want [b a]", got)
+	}
+
+	// The query's match_all clause is dropped, so the explanation shows the
+	// term query's score where the bool's sum would be.
+	details, _ := explanation(t, resp)["details"].([]interface{})
+	if len(details) < 2 {
+		t.Fatalf("unexpected explanation %s", jsonString(t, explanation(t, resp)))
+	}
+	if desc, _ := details[0].(map[string]interface{})["description"].(string); !strings.HasPrefix(desc, "weight(title:fox)") {
+		t.Errorf("function_score query was not rewritten: %s", jsonString(t, details[0]))
+	}
+
+	// A function score over a query that matches nothing matches nothing.
+	resp = s.search(map[string]interface{}{
+		"query": map[string]interface{}{"function_score": map[string]interface{}{
+			"query": map[string]interface{}{"bool": map[string]interface{}{"must": []interface{}{
+				term("title", "fox"), map[string]interface{}{"match_none": map[string]interface{}{}},
+			}}},
+			"functions": []interface{}{
+				map[string]interface{}{"field_value_factor": map[string]interface{}{"field": "price"}},
+			},
+		}},
+	})
+	if resp["total_hits"] != float64(0) {
+		t.Errorf("total_hits = %v, want 0", resp["total_hits"])
+	}
+}
+
+func TestSearch_RegexAndProximity(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true, doc("a", "the colour red"), doc("b", "color me blue"), doc("c", "red and quite blue"))
+
+	resp := s.search(map[string]interface{}{
+		"query": map[string]interface{}{"regexp": map[string]interface{}{"field": "title", "pattern": "colou?r"}},
+	})
+	if got := hitIDs(resp); len(got) != 2 {
+		t.Errorf("regexp hits = %v, want a and b", got)
+	}
+
+	proximity := func(slop int, terms ...string) map[string]interface{} {
+		return map[string]interface{}{"proximity": map[string]interface{}{"field": "title", "terms": terms, "slop": slop}}
+	}
+	if got := hitIDs(s.search(map[string]interface{}{"query": proximity(0, "red", "colour")})); len(got) != 1 || got[0] != "a" {
+		t.Errorf("proximity hits = %v, want [a]", got)
+	}
+	if got := hitIDs(s.search(map[string]interface{}{"query": proximity(1, "blue", "red")})); len(got) != 0 {
+		t.Errorf("proximity slop 1 hits = %v, want none", got)
+	}
+	if got := hitIDs(s.search(map[string]interface{}{"query": proximity(2, "blue", "red")})); len(got) != 1 || got[0] != "c" {
+		t.Errorf("proximity slop 2 hits = %v, want [c]", got)
+	}
+
+	status, _ := s.do(http.MethodPost, "/indexes/docs/search", map[string]interface{}{
+		"query": map[string]interface{}{"regexp": map[string]interface{}{"field": "title", "pattern": "^red"}},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("anchored regexp: expected 400, got %d", status)
+	}
+}
+
+func TestAnalyze_BodyLimit(t *testing.T) {
+	s := newTestServer(t)
+	analyze := func(text string) int {
+		status, _ := s.do(http.MethodPost, "/indexes/docs/_analyze", map[string]interface{}{"field": "title", "text": text})
+		return status
+	}
+	if status := analyze("quick fox"); status != http.StatusOK {
+		t.Errorf("small text: expected 200, got %d", status)
+	}
+	if status := analyze(strings.Repeat("a", MaxAnalyzeTextBytes+1)); status != http.StatusBadRequest {
+		t.Errorf("text over the limit: expected 400, got %d", status)
+	}
+	if status := analyze(strings.Repeat("a", maxAnalyzeBodyBytes)); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over the limit: expected 413, got %d", status)
+	}
+}
+
+func TestSearch_TooManyHistogramBuckets(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true,
+		map[string]interface{}{"id": "a", "title": "fox", "price": float64(0)},
+		map[string]interface{}{"id": "b", "title": "fox", "price": float64(1_000_000)},
+	)
+	status, resp := s.do(http.MethodPost, "/indexes/docs/search", map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+		"aggregations": map[string]interface{}{
+			"prices": map[string]interface{}{"histogram": map[string]interface{}{"field": "price", "interval": 1}},
+		},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %v", status, resp)
+	}
+}
+
+func TestSearchAndExport_LegacyJSONSegment(t *testing.T) {
+	s := newTestServer(t)
+	s.index(false, doc("a", "quick fox"), doc("b", "lazy dog"))
+	res, err := s.inst.Commit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rewrite the segment as older releases committed it.
+	legacy := map[string]string{
+		"meta.json": `{"doc_count":2,"term_count":6}`,
+		"postings.bin": `{"id":{"a":{"Entries":[{"DocID":0,"Freq":1}]},"b":{"Entries":[{"DocID":1,"Freq":1}]}},` +
+			`"title":{"quick":{"Entries":[{"DocID":0,"Freq":1,"Positions":[0]}]},"fox":{"Entries":[{"DocID":0,"Freq":1,"Positions":[1]}]},` +
+			`"lazy":{"Entries":[{"DocID":1,"Freq":1,"Positions":[0]}]},"dog":{"Entries":[{"DocID":1,"Freq":1,"Positions":[1]}]}}}`,
+		"stored.bin": `{"0":{"id":"YQ==","title":"cXVpY2sgZm94"},"1":{"id":"Yg==","title":"bGF6eSBkb2c="}}`,
+	}
+	for name, data := range legacy {
+		if err := os.WriteFile(s.inst.Dir.SegmentFile(res.SegmentID, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"docvalues.bin", "deletions.bin"} {
+		if err := os.Remove(s.inst.Dir.SegmentFile(res.SegmentID, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+	}
+	s.inst.dropSegmentReader(res.SegmentID)
+
+	resp := s.search(map[string]interface{}{
+		"query": map[string]interface{}{"phrase": map[string]interface{}{"field": "title", "terms": []string{"quick", "fox"}}},
+	})
+	if ids := hitIDs(resp); len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("phrase search on legacy segment: hits %v", ids)
+	}
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/indexes/docs/_export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var exported []string
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var line map[string]interface{}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		if id, ok := line["id"].(string); ok {
+			exported = append(exported, id)
+		}
+	}
+	if strings.Join(exported, ",") != "a,b" {
+		t.Errorf("export of legacy segment: ids %v", exported)
+	}
+}
@@ -7,13 +7,17 @@ import (
 	"log/slog"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"GoSearch/internal/analysis"
 	"GoSearch/internal/commit"
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/engine"
 	"GoSearch/internal/index"
 	"GoSearch/internal/indexing"
 	"GoSearch/internal/recovery"
+	"GoSearch/internal/segment"
 	"GoSearch/internal/snapshot"
 )
 
@@ -24,12 +28,19 @@ var (
 	ErrIndexEmpty       = errors.New("no documents to commit")
 )
 
+// FilterCacheBytes bounds the memory of each index's cache of filter
+// clause matches.
+const FilterCacheBytes = 64 << 20
+
 // IndexInstance holds all runtime state for a single index.
 type IndexInstance struct {
-	Name     string
-	Dir      *index.IndexDir
-	Schema   *index.Schema
-	Registry *analysis.Registry
+	Name   string
+	Dir    *index.IndexDir
+	Schema *index.Schema
+
+	// Analyzers built from the schema and the synonyms directory; replaced
+	// by ReloadAnalyzers.
+	registry atomic.Pointer[analysis.Registry]
 
 	// Writer state (single-writer model).
 	writerMu sync.Mutex
@@ -41,6 +52,19 @@ type IndexInstance struct {
 	// Committer for the 7-phase commit protocol.
 	Committer *commit.Committer
 
+	// Committed segments loaded for search, by segment ID.
+	readersMu sync.Mutex
+	readers   map[string]*segment.Reader
+
+	// Open point-in-time views.
+	pits pitRegistry
+
+	// Matches of filter clauses on committed segments.
+	filterCache *engine.FilterCache
+
+	// Responses to searches of the current generation.
+	results *resultCache
+
 	// Current manifest (nil for empty index).
 	manifestMu      sync.RWMutex
 	currentManifest *index.Manifest
@@ -50,9 +74,8 @@ type IndexInstance struct {
 
 // IndexManager manages multiple indexes within a single process.
 type IndexManager struct {
-	rootDir  *index.RootDir
-	logger   *slog.Logger
-	registry *analysis.Registry
+	rootDir *index.RootDir
+	logger  *slog.Logger
 
 	mu      sync.RWMutex
 	indexes map[string]*IndexInstance
@@ -70,10 +93,9 @@ func NewIndexManager(dataDir string, logger *slog.Logger) (*IndexManager, error)
 	}
 
 	mgr := &IndexManager{
-		rootDir:  rootDir,
-		logger:   logger,
-		registry: analysis.NewRegistry(),
-		indexes:  make(map[string]*IndexInstance),
+		rootDir: rootDir,
+		logger:  logger,
+		indexes: make(map[string]*IndexInstance),
 	}
 
 	// Load existing indexes from disk.
@@ -116,6 +138,10 @@ func (m *IndexManager) openIndex(name string) (*IndexInstance, error) {
 	if err != nil {
 		return nil, fmt.Errorf("load schema: %w", err)
 	}
+	registry, err := newRegistry(idxDir, schema)
+	if err != nil {
+		return nil, fmt.Errorf("build analyzers: %w", err)
+	}
 
 	// Run crash recovery.
 	recoveryOpts := recovery.DefaultOptions()
@@ -145,16 +171,25 @@ func (m *IndexManager) openIndex(name string) (*IndexInstance, error) {
 	}
 	committer := commit.NewCommitter(idxDir, commitOpts)
 
-	return &IndexInstance{
+	inst := &IndexInstance{
 		Name:            name,
 		Dir:             idxDir,
 		Schema:          schema,
-		Registry:        m.registry,
 		Snapshots:       snapMgr,
 		Committer:       committer,
 		currentManifest: result.Manifest,
+		filterCache:     engine.NewFilterCache(FilterCacheBytes),
+		results:         newResultCache(ResultCacheBytes, snapMgr.CurrentGeneration()),
 		logger:          m.logger.With("index", name),
-	}, nil
+	}
+	inst.registry.Store(registry)
+	return inst, nil
+}
+
+// newRegistry builds the analyzers of an index, reading files such as
+// synonym lists from its synonyms directory.
+func newRegistry(dir *index.IndexDir, schema *index.Schema) (*analysis.Registry, error) {
+	return schema.NewRegistry(os.DirFS(dir.SynonymsDir()))
 }
 
 // CreateIndex creates a new index with the given schema.
@@ -170,6 +205,11 @@ func (m *IndexManager) CreateIndex(name string, schema *index.Schema) error {
 	if err := schema.Validate(); err != nil {
 		return fmt.Errorf("invalid schema: %w", err)
 	}
+	idxDir := m.rootDir.IndexDir(name)
+	registry, err := newRegistry(idxDir, schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
 
 	schema.CreatedAt = time.Now().UTC()
 	if schema.Version == 0 {
@@ -177,7 +217,6 @@ func (m *IndexManager) CreateIndex(name string, schema *index.Schema) error {
 	}
 
 	// Create index directory structure.
-	idxDir := m.rootDir.IndexDir(name)
 	if err := idxDir.EnsureDirectories(); err != nil {
 		return fmt.Errorf("create index directories: %w", err)
 	}
@@ -200,14 +239,16 @@ func (m *IndexManager) CreateIndex(name string, schema *index.Schema) error {
 	committer := commit.NewCommitter(idxDir, commitOpts)
 
 	inst := &IndexInstance{
-		Name:      name,
-		Dir:       idxDir,
-		Schema:    schema,
-		Registry:  m.registry,
-		Snapshots: snapMgr,
-		Committer: committer,
-		logger:    m.logger.With("index", name),
+		Name:        name,
+		Dir:         idxDir,
+		Schema:      schema,
+		Snapshots:   snapMgr,
+		Committer:   committer,
+		filterCache: engine.NewFilterCache(FilterCacheBytes),
+		results:     newResultCache(ResultCacheBytes, 0),
+		logger:      m.logger.With("index", name),
 	}
+	inst.registry.Store(registry)
 
 	m.indexes[name] = inst
 	m.logger.Info("index created", "name", name)
@@ -224,7 +265,8 @@ func (m *IndexManager) DeleteIndex(name string) error {
 		return ErrIndexNotFound
 	}
 
-	// Check for active snapshots.
+	// Check for active snapshots, after releasing expired points in time.
+	inst.expirePITs()
 	if inst.Snapshots.ActiveSnapshotCount() > 0 {
 		return fmt.Errorf("cannot delete index with %d active readers", inst.Snapshots.ActiveSnapshotCount())
 	}
@@ -263,6 +305,28 @@ func (m *IndexManager) ListIndexes() []string {
 	return names
 }
 
+// Registry returns the analyzers of the index.
+func (inst *IndexInstance) Registry() *analysis.Registry {
+	return inst.registry.Load()
+}
+
+// ReloadAnalyzers rebuilds the analyzers of the index from its schema and
+// the current contents of its synonyms directory. Searches started
+// afterwards use the new analyzers, as do writers acquired afterwards;
+// documents already indexed keep the terms they were indexed with. On error
+// the current analyzers are kept.
+func (inst *IndexInstance) ReloadAnalyzers() error {
+	registry, err := newRegistry(inst.Dir, inst.Schema)
+	if err != nil {
+		return err
+	}
+	inst.registry.Store(registry)
+	// Cached responses may hold matches analyzed the old way.
+	inst.results.reset(0)
+	inst.logger.Info("analyzers reloaded")
+	return nil
+}
+
 // AcquireWriter returns an exclusive writer for the index.
 // The caller must call ReleaseWriter when done.
 func (inst *IndexInstance) AcquireWriter() (*indexing.Writer, error) {
@@ -271,7 +335,7 @@ func (inst *IndexInstance) AcquireWriter() (*indexing.Writer, error) {
 		inst.writerMu.Unlock()
 		return nil, ErrWriterBusy
 	}
-	w := indexing.NewWriter(inst.Schema, inst.Registry)
+	w := indexing.NewWriter(inst.Schema, inst.Registry())
 	inst.writer = w
 	inst.writerMu.Unlock()
 	return w, nil
@@ -312,7 +376,7 @@ func (inst *IndexInstance) Commit(ctx context.Context) (*commit.CommitResult, er
 	}
 
 	buf := w.Buffer()
-	if buf.DocCount == 0 {
+	if buf.DocCount == 0 && len(buf.Deletions) == 0 {
 		return nil, ErrIndexEmpty
 	}
 
@@ -336,15 +400,19 @@ func (inst *IndexInstance) Commit(ctx context.Context) (*commit.CommitResult, er
 		return nil, fmt.Errorf("load new manifest: %w", err)
 	}
 
-	// Update snapshot manager.
+	// Update snapshot manager. Expired points in time are released first
+	// so their segments can be reclaimed.
+	inst.expirePITs()
 	segmentIDs := make([]string, len(newManifest.Segments))
 	for i, seg := range newManifest.Segments {
 		segmentIDs[i] = seg.ID
 	}
 	reclaimable := inst.Snapshots.UpdateGeneration(result.Generation, segmentIDs)
+	inst.results.reset(result.Generation)
 
 	// Reclaim old segments.
 	for _, segID := range reclaimable {
+		inst.dropSegmentReader(segID)
 		segDir := inst.Dir.SegmentDir(segID)
 		if err := os.RemoveAll(segDir); err != nil {
 			inst.logger.Warn("failed to reclaim segment", "segment", segID, "error", err)
@@ -371,20 +439,23 @@ func (inst *IndexInstance) Commit(ctx context.Context) (*commit.CommitResult, er
 // buildSegmentData converts a WriteBuffer into SegmentData for the committer.
 func buildSegmentData(buf *indexing.WriteBuffer) *commit.SegmentData {
 	// Serialize the inverted index and stored fields into segment files.
-	// For MVP, we store the raw data as JSON.
 	files := make(map[string][]byte)
 
 	// FST placeholder: serialize term dictionary.
 	fstData := serializeTermDictionary(buf)
 	files["fst.bin"] = fstData
 
-	// Postings: serialize postings lists.
-	postingsData := serializePostings(buf)
-	files["postings.bin"] = postingsData
+	// Postings lists, binary so numeric trie terms survive.
+	files["postings.bin"] = segment.EncodePostings(buf.InvertedIndex)
 
-	// Stored fields.
-	storedData := serializeStoredFields(buf)
-	files["stored.bin"] = storedData
+	// Stored fields and external IDs.
+	files["stored.bin"] = segment.EncodeStored(buf)
+
+	// Column-oriented doc values.
+	files["docvalues.bin"] = docvalues.Encode(buf.DocValues.Build(buf.NextDocID))
+
+	// Deleted buffered docs and tombstones for older segments.
+	files["deletions.bin"] = segment.EncodeDeletions(buf)
 
 	// Segment metadata.
 	metaData := serializeSegmentMeta(buf)
@@ -393,8 +464,8 @@ func buildSegmentData(buf *indexing.WriteBuffer) *commit.SegmentData {
 	return &commit.SegmentData{
 		Files:         files,
 		DocCount:      uint32(buf.DocCount),
-		DocCountAlive: uint32(buf.DocCount),
-		DelCount:      0,
+		DocCountAlive: uint32(buf.LiveDocCount()),
+		DelCount:      uint32(len(buf.DeletedDocs)),
 		MinDocID:      0,
 		MaxDocID:      uint64(buf.NextDocID),
 	}
@@ -422,18 +493,6 @@ func serializeTermDictionary(buf *indexing.WriteBuffer) []byte {
 	return data
 }
 
-// serializePostings serializes postings lists.
-func serializePostings(buf *indexing.WriteBuffer) []byte {
-	data, _ := encodeJSON(buf.InvertedIndex)
-	return data
-}
-
-// serializeStoredFields serializes stored field values.
-func serializeStoredFields(buf *indexing.WriteBuffer) []byte {
-	data, _ := encodeJSON(buf.StoredFields)
-	return data
-}
-
 // serializeSegmentMeta serializes segment metadata.
 func serializeSegmentMeta(buf *indexing.WriteBuffer) []byte {
 	meta := map[string]interface{}{
@@ -453,9 +512,12 @@ func (inst *IndexInstance) IndexInfo() map[string]interface{} {
 	info := map[string]interface{}{
 		"name":             inst.Name,
 		"generation":       inst.Snapshots.CurrentGeneration(),
+		"open_pits":        inst.expirePITs(),
 		"active_snapshots": inst.Snapshots.ActiveSnapshotCount(),
 		"schema_version":   inst.Schema.Version,
 		"fields":           len(inst.Schema.Fields),
+		"filter_cache":     inst.filterCache.Stats(),
+		"result_cache":     inst.results.stats(),
 	}
 
 	if manifest != nil {
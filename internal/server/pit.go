@@ -0,0 +1,145 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"GoSearch/internal/snapshot"
+)
+
+// Point-in-time keep-alive limits.
+const (
+	DefaultPITKeepAlive = time.Minute
+	MaxPITKeepAlive     = 24 * time.Hour
+)
+
+var (
+	ErrPITNotFound      = errors.New("point in time not found or expired")
+	ErrInvalidKeepAlive = errors.New("invalid keep_alive")
+)
+
+// pointInTime is a pinned snapshot that searches can page through while
+// commits continue. It sees committed segments only, not the write buffer.
+type pointInTime struct {
+	id        string
+	snap      *snapshot.Snapshot
+	segments  []hitSegment
+	expiresAt time.Time
+}
+
+// pitRegistry holds the open points in time of an index. Expired entries
+// are released lazily whenever the registry is used.
+type pitRegistry struct {
+	mu   sync.Mutex
+	pits map[string]*pointInTime
+}
+
+// parseKeepAlive parses a keep-alive duration such as "30s" or "5m". An
+// empty value takes the default.
+func parseKeepAlive(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultPITKeepAlive, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidKeepAlive, err)
+	}
+	if d <= 0 || d > MaxPITKeepAlive {
+		return 0, fmt.Errorf("%w: must be positive and at most %s", ErrInvalidKeepAlive, MaxPITKeepAlive)
+	}
+	return d, nil
+}
+
+// OpenPIT pins the current generation for keepAlive and returns the new
+// point in time's ID.
+func (inst *IndexInstance) OpenPIT(keepAlive time.Duration) (string, error) {
+	snap, err := inst.Snapshots.Acquire()
+	if err != nil {
+		return "", fmt.Errorf("acquire snapshot: %w", err)
+	}
+	segments, err := inst.searchSegments(snap, false)
+	if err != nil {
+		_ = snap.Release()
+		return "", err
+	}
+	id, err := generatePITID()
+	if err != nil {
+		_ = snap.Release()
+		return "", err
+	}
+
+	r := &inst.pits
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expireLocked(time.Now())
+	if r.pits == nil {
+		r.pits = make(map[string]*pointInTime)
+	}
+	r.pits[id] = &pointInTime{
+		id:        id,
+		snap:      snap,
+		segments:  segments,
+		expiresAt: time.Now().Add(keepAlive),
+	}
+	return id, nil
+}
+
+// pit returns an open point in time and extends its keep-alive.
+func (inst *IndexInstance) pit(id string, keepAlive time.Duration) (*pointInTime, error) {
+	r := &inst.pits
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.expireLocked(now)
+	p, ok := r.pits[id]
+	if !ok {
+		return nil, ErrPITNotFound
+	}
+	p.expiresAt = now.Add(keepAlive)
+	return p, nil
+}
+
+// ClosePIT releases a point in time before its keep-alive expires.
+func (inst *IndexInstance) ClosePIT(id string) error {
+	r := &inst.pits
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expireLocked(time.Now())
+	p, ok := r.pits[id]
+	if !ok {
+		return ErrPITNotFound
+	}
+	delete(r.pits, id)
+	return p.snap.Release()
+}
+
+// expirePITs releases points in time whose keep-alive has passed and
+// returns the number still open.
+func (inst *IndexInstance) expirePITs() int {
+	r := &inst.pits
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expireLocked(time.Now())
+	return len(r.pits)
+}
+
+func (r *pitRegistry) expireLocked(now time.Time) {
+	for id, p := range r.pits {
+		if !now.Before(p.expiresAt) {
+			_ = p.snap.Release()
+			delete(r.pits, id)
+		}
+	}
+}
+
+func generatePITID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
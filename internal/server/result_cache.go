@@ -0,0 +1,154 @@
+package server
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+)
+
+// ResultCacheBytes bounds the JSON size of the search responses each index
+// caches.
+const ResultCacheBytes = 32 << 20
+
+// resultCache is an LRU cache of search responses, keyed by normalized
+// request, for the current generation of an index. The committed segments
+// of a generation never change, so entries stay valid until the index
+// moves to a new generation or its analyzers are reloaded, when the cache
+// is reset. Every reset starts a new epoch; a response is only stored if
+// no reset happened since the search read the epoch, so a search that
+// raced a commit or reload cannot store a stale response.
+type resultCache struct {
+	mu         sync.Mutex
+	maxBytes   int64
+	bytes      int64
+	generation uint64
+	epoch      uint64
+	lru        *list.List // of *resultCacheEntry, most recently used first
+	entries    map[string]*list.Element
+
+	hits, misses, evictions int64
+}
+
+type resultCacheEntry struct {
+	key      string
+	response map[string]json.RawMessage
+	size     int64
+}
+
+// ResultCacheStats reports the state of an index's result cache.
+type ResultCacheStats struct {
+	Generation  uint64 `json:"generation"`
+	Entries     int    `json:"entries"`
+	MemoryBytes int64  `json:"memory_bytes"`
+	Hits        int64  `json:"hits"`
+	Misses      int64  `json:"misses"`
+	Evictions   int64  `json:"evictions"`
+}
+
+func newResultCache(maxBytes int64, generation uint64) *resultCache {
+	return &resultCache{
+		maxBytes:   maxBytes,
+		generation: generation,
+		epoch:      1,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// currentEpoch returns the epoch a search must pass to put. It must be read
+// before the search resolves anything a reset invalidates.
+func (c *resultCache) currentEpoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// get returns the cached response to a request on a generation.
+func (c *resultCache) get(generation uint64, key string) (map[string]json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation > c.generation {
+		c.resetLocked(generation)
+	}
+	el, ok := c.entries[key]
+	if !ok || generation != c.generation {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return el.Value.(*resultCacheEntry).response, true
+}
+
+// put caches the response to a request on a generation, unless the cache
+// was reset since epoch or the response does not fit. took_ms is left out,
+// as every request measures its own.
+func (c *resultCache) put(epoch, generation uint64, key string, response map[string]interface{}) {
+	encoded := make(map[string]json.RawMessage, len(response))
+	size := int64(len(key))
+	for name, v := range response {
+		if name == "took_ms" {
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		encoded[name] = data
+		size += int64(len(name) + len(data))
+	}
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch != c.epoch || generation != c.generation {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		// Another search computed the same response concurrently.
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&resultCacheEntry{key: key, response: encoded, size: size})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		entry := c.lru.Remove(c.lru.Back()).(*resultCacheEntry)
+		delete(c.entries, entry.key)
+		c.bytes -= entry.size
+		c.evictions++
+	}
+}
+
+// reset drops every entry and moves the cache to generation, or keeps its
+// generation if that is newer.
+func (c *resultCache) reset(generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation < c.generation {
+		generation = c.generation
+	}
+	c.resetLocked(generation)
+}
+
+func (c *resultCache) resetLocked(generation uint64) {
+	c.generation = generation
+	c.epoch++
+	c.bytes = 0
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+func (c *resultCache) stats() ResultCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ResultCacheStats{
+		Generation:  c.generation,
+		Entries:     c.lru.Len(),
+		MemoryBytes: c.bytes,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+	}
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"GoSearch/internal/indexing"
+	"GoSearch/internal/query"
+)
+
+func testResponse(hits int) map[string]interface{} {
+	return map[string]interface{}{"status": "success", "total_hits": hits, "took_ms": 3}
+}
+
+func TestResultCache_GetPut(t *testing.T) {
+	c := newResultCache(1<<20, 1)
+	if _, ok := c.get(1, "k"); ok {
+		t.Fatal("empty cache should miss")
+	}
+	c.put(c.currentEpoch(), 1, "k", testResponse(7))
+	got, ok := c.get(1, "k")
+	if !ok {
+		t.Fatal("expected a hit after put")
+	}
+	if string(got["total_hits"]) != "7" {
+		t.Errorf("total_hits = %s, want 7", got["total_hits"])
+	}
+	if _, ok := got["took_ms"]; ok {
+		t.Error("took_ms should not be cached")
+	}
+	if st := c.stats(); st.Hits != 1 || st.Misses != 1 || st.Entries != 1 || st.MemoryBytes <= 0 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestResultCache_NewerGenerationResets(t *testing.T) {
+	c := newResultCache(1<<20, 1)
+	c.put(c.currentEpoch(), 1, "k", testResponse(1))
+
+	// A search on a newer generation than the cache has seen resets it.
+	if _, ok := c.get(2, "k"); ok {
+		t.Error("entry of generation 1 served for generation 2")
+	}
+	if st := c.stats(); st.Generation != 2 || st.Entries != 0 || st.MemoryBytes != 0 {
+		t.Errorf("expected an empty cache on generation 2, got %+v", st)
+	}
+
+	// Searches on an older generation, such as one pinned before the
+	// commit, neither hit nor store.
+	c.put(c.currentEpoch(), 1, "old", testResponse(1))
+	if _, ok := c.get(1, "old"); ok {
+		t.Error("older generation should not be cached")
+	}
+
+	c.put(c.currentEpoch(), 2, "k", testResponse(2))
+	c.reset(3)
+	if st := c.stats(); st.Generation != 3 || st.Entries != 0 {
+		t.Errorf("reset(3): expected an empty cache on generation 3, got %+v", st)
+	}
+	// A reset to an older generation, as on analyzer reload, keeps the
+	// newer one.
+	c.reset(0)
+	if st := c.stats(); st.Generation != 3 {
+		t.Errorf("reset(0) moved the cache back to generation %d", st.Generation)
+	}
+}
+
+func TestResultCache_EpochGuard(t *testing.T) {
+	c := newResultCache(1<<20, 1)
+	epoch := c.currentEpoch()
+	c.reset(1)
+	c.put(epoch, 1, "k", testResponse(1))
+	if _, ok := c.get(1, "k"); ok {
+		t.Error("response computed before a reset was stored")
+	}
+}
+
+func TestResultCache_ByteBoundedEviction(t *testing.T) {
+	probe := newResultCache(1<<20, 1)
+	probe.put(probe.currentEpoch(), 1, "a", testResponse(1))
+	size := probe.stats().MemoryBytes
+
+	// Room for two entries of the same size.
+	c := newResultCache(2*size+size/2, 1)
+	epoch := c.currentEpoch()
+	c.put(epoch, 1, "a", testResponse(1))
+	c.put(epoch, 1, "b", testResponse(1))
+	if _, ok := c.get(1, "a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	// a was used last, so c evicts b.
+	c.put(epoch, 1, "c", testResponse(1))
+	if _, ok := c.get(1, "b"); ok {
+		t.Error("least recently used entry b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(1, key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+	st := c.stats()
+	if st.Entries != 2 || st.Evictions != 1 || st.MemoryBytes != 2*size || st.MemoryBytes > c.maxBytes {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	// A response larger than the whole cache is not stored and evicts
+	// nothing.
+	huge := testResponse(1)
+	huge["hits"] = make([]int, c.maxBytes)
+	c.put(epoch, 1, "huge", huge)
+	if _, ok := c.get(1, "huge"); ok {
+		t.Error("oversized response was cached")
+	}
+	if st := c.stats(); st.Entries != 2 || st.Evictions != 1 {
+		t.Errorf("oversized response changed the cache: %+v", st)
+	}
+}
+
+func TestResultCache_EpochGuardAgainstCommit(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true, doc("a", "fox"))
+	c := s.inst.results
+
+	epoch := c.currentEpoch()
+	generation := s.inst.Snapshots.CurrentGeneration()
+	s.index(true, doc("b", "fox"))
+
+	c.put(epoch, generation, "k", testResponse(1))
+	c.put(epoch, s.inst.Snapshots.CurrentGeneration(), "k", testResponse(1))
+	if st := c.stats(); st.Entries != 0 {
+		t.Errorf("search that raced a commit was cached: %+v", st)
+	}
+}
+
+func TestResultCache_EpochGuardAgainstReloadAnalyzers(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true, doc("a", "fox"))
+	c := s.inst.results
+	generation := s.inst.Snapshots.CurrentGeneration()
+
+	c.put(c.currentEpoch(), generation, "before", testResponse(1))
+	epoch := c.currentEpoch()
+	if err := s.inst.ReloadAnalyzers(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get(generation, "before"); ok {
+		t.Error("reload did not drop cached responses")
+	}
+	c.put(epoch, generation, "k", testResponse(1))
+	if _, ok := c.get(generation, "k"); ok {
+		t.Error("search that raced an analyzer reload was cached")
+	}
+	if st := c.stats(); st.Generation != generation {
+		t.Errorf("reload moved the cache to generation %d, want %d", st.Generation, generation)
+	}
+}
+
+func TestSearch_ResultCache(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true, doc("a", "quick fox"), doc("b", "lazy dog"))
+	req := map[string]interface{}{
+		"query": map[string]interface{}{"term": map[string]interface{}{"field": "title", "value": "fox"}},
+	}
+
+	first := s.search(req)
+	second := s.search(req)
+	if got := hitIDs(second); len(got) != 1 || got[0] != "a" {
+		t.Errorf("cached response hits = %v, want [a]", got)
+	}
+	if first["total_hits"] != second["total_hits"] {
+		t.Errorf("cached total_hits %v != %v", second["total_hits"], first["total_hits"])
+	}
+	if st := s.inst.results.stats(); st.Hits != 1 || st.Entries != 1 {
+		t.Errorf("expected one cached entry hit once, got %+v", st)
+	}
+
+	// request_cache:false neither reads nor fills the cache.
+	req["request_cache"] = false
+	s.search(req)
+	req["size"] = 3
+	s.search(req)
+	if st := s.inst.results.stats(); st.Hits != 1 || st.Entries != 1 {
+		t.Errorf("request_cache:false used the cache: %+v", st)
+	}
+
+	// A commit starts a new generation with an empty cache.
+	s.index(true, doc("c", "fox"))
+	delete(req, "request_cache")
+	delete(req, "size")
+	if got := hitIDs(s.search(req)); len(got) != 2 {
+		t.Errorf("search after commit returned %v, want 2 hits", got)
+	}
+}
+
+// cacheKeyRequest decodes a search request and its query the way
+// handleSearch does.
+func cacheKeyRequest(t *testing.T, body string) (searchRequest, query.Query) {
+	t.Helper()
+	var req searchRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{MaxResultWindow: DefaultMaxResultWindow}
+	if err := h.validatePaging(&req); err != nil {
+		t.Fatal(err)
+	}
+	q, err := req.Query.ToQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, q
+}
+
+func TestResultCacheKey(t *testing.T) {
+	committed := []hitSegment{}
+	withBuffer := []hitSegment{newBufferSegment(indexing.NewWriteBuffer())}
+	decay := `{"query": {"function_score": {"query": {"match_all": {}},
+		"functions": [{"gauss": {"field": "price", "origin": %s, "scale": "1d"}}]}}}`
+
+	tests := []struct {
+		name      string
+		body      string
+		segments  []hitSegment
+		cacheable bool
+	}{
+		{"committed", `{"query": {"match_all": {}}}`, committed, true},
+		{"pit", `{"query": {"match_all": {}}, "pit": {"id": "p"}}`, committed, false},
+		{"request_cache false", `{"query": {"match_all": {}}, "request_cache": false}`, committed, false},
+		{"request_cache true", `{"query": {"match_all": {}}, "request_cache": true}`, committed, true},
+		{"write buffer", `{"query": {"match_all": {}}}`, withBuffer, false},
+		{"decay from now", fmt.Sprintf(decay, `"now"`), committed, false},
+		{"decay from default origin", `{"query": {"function_score": {"query": {"match_all": {}},
+			"functions": [{"gauss": {"field": "price", "scale": "1d"}}]}}}`, committed, false},
+		{"decay from fixed origin", fmt.Sprintf(decay, `10`), committed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, q := cacheKeyRequest(t, tt.body)
+			key, ok := resultCacheKey(req, q, tt.segments)
+			if ok != tt.cacheable {
+				t.Fatalf("cacheable = %v, want %v", ok, tt.cacheable)
+			}
+			if ok && key == "" {
+				t.Error("cacheable request has an empty key")
+			}
+		})
+	}
+
+	// Size and top_k spell the same page; request_cache does not change it.
+	a, qa := cacheKeyRequest(t, `{"query": {"match_all": {}}, "size": 5}`)
+	b, qb := cacheKeyRequest(t, `{"query": {"match_all": {}}, "top_k": 5, "request_cache": true}`)
+	ka, _ := resultCacheKey(a, qa, committed)
+	kb, _ := resultCacheKey(b, qb, committed)
+	if ka != kb {
+		t.Errorf("equivalent requests have different keys:\n%s\n%s", ka, kb)
+	}
+	c, qc := cacheKeyRequest(t, `{"query": {"match_all": {}}, "size": 6}`)
+	if kc, _ := resultCacheKey(c, qc, committed); kc == ka {
+		t.Error("different page sizes share a key")
+	}
+}
+
+func TestSearch_PITNotCached(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true, doc("a", "fox"))
+	status, resp := s.do(http.MethodPost, "/indexes/docs/_pit", nil)
+	if status != http.StatusOK {
+		t.Fatalf("open pit: status %d: %v", status, resp)
+	}
+	req := map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+		"pit":   map[string]interface{}{"id": resp["pit_id"]},
+	}
+	s.search(req)
+	s.search(req)
+	if st := s.inst.results.stats(); st.Entries != 0 || st.Hits != 0 {
+		t.Errorf("pit search used the cache: %+v", st)
+	}
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/indexing"
+	"GoSearch/internal/segment"
+	"GoSearch/internal/snapshot"
+)
+
+// hitSegment is a searchable segment that also returns the external IDs
+// and stored fields of its documents for formatting hits.
+type hitSegment interface {
+	engine.Segment
+	ExternalID(docID uint32) string
+	Stored(docID uint32) map[string][]byte
+}
+
+var _ hitSegment = (*segment.Reader)(nil)
+
+// bufferSegment adapts a writer's in-memory buffer to engine.Segment so
+// uncommitted documents can be searched. Sorted term lists and doc values
+// are built on first use.
+type bufferSegment struct {
+	buf         *indexing.WriteBuffer
+	terms       map[string][]string
+	docValues   *docvalues.Segment
+	externalIDs map[uint32]string
+}
+
+var (
+	_ hitSegment      = (*bufferSegment)(nil)
+	_ engine.LiveDocs = (*bufferSegment)(nil)
+	_ engine.LiveDocs = liveSegment{}
+)
+
+func newBufferSegment(buf *indexing.WriteBuffer) *bufferSegment {
+	return &bufferSegment{buf: buf, terms: make(map[string][]string)}
+}
+
+func (s *bufferSegment) MaxDoc() uint32 { return s.buf.NextDocID }
+
+func (s *bufferSegment) DocCount() int { return s.buf.DocCount }
+
+func (s *bufferSegment) AvgDocLength() float32 {
+	return float32(s.buf.TermCount) / float32(max(s.buf.DocCount, 1))
+}
+
+func (s *bufferSegment) Terms(field string) []string {
+	if terms, ok := s.terms[field]; ok {
+		return terms
+	}
+	fieldMap := s.buf.InvertedIndex[field]
+	terms := make([]string, 0, len(fieldMap))
+	for term := range fieldMap {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	s.terms[field] = terms
+	return terms
+}
+
+func (s *bufferSegment) Postings(field, term string) *engine.Postings {
+	pl := s.buf.InvertedIndex[field][term]
+	if pl == nil || len(pl.Entries) == 0 {
+		return nil
+	}
+	p := &engine.Postings{
+		DocIDs:    make([]uint32, len(pl.Entries)),
+		Freqs:     make([]uint32, len(pl.Entries)),
+		Positions: make([][]uint32, len(pl.Entries)),
+	}
+	for i, e := range pl.Entries {
+		p.DocIDs[i] = e.DocID
+		p.Freqs[i] = e.Freq
+		p.Positions[i] = e.Positions
+	}
+	return p
+}
+
+func (s *bufferSegment) DocValues() *docvalues.Segment {
+	if s.docValues == nil {
+		s.docValues = s.buf.DocValues.Build(s.buf.NextDocID)
+	}
+	return s.docValues
+}
+
+func (s *bufferSegment) ExternalID(docID uint32) string {
+	if s.externalIDs == nil {
+		s.externalIDs = make(map[uint32]string, len(s.buf.ExternalToInternal))
+		for ext, internal := range s.buf.ExternalToInternal {
+			s.externalIDs[internal] = ext
+		}
+	}
+	return s.externalIDs[docID]
+}
+
+func (s *bufferSegment) Stored(docID uint32) map[string][]byte {
+	return s.buf.StoredFields[docID]
+}
+
+func (s *bufferSegment) IsDeleted(docID uint32) bool { return s.buf.DeletedDocs[docID] }
+
+// Tombstones returns the external IDs whose committed documents the buffer
+// deletes.
+func (s *bufferSegment) Tombstones() []string {
+	ids := make([]string, 0, len(s.buf.Deletions))
+	for id := range s.buf.Deletions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// tombstoneSource is a segment that deletes documents of older segments.
+type tombstoneSource interface {
+	Tombstones() []string
+}
+
+// liveSegment is a committed segment with documents deleted by newer
+// segments hidden.
+type liveSegment struct {
+	*segment.Reader
+	deleted map[uint32]bool
+}
+
+func (s liveSegment) IsDeleted(docID uint32) bool {
+	return s.deleted[docID] || s.Reader.IsDeleted(docID)
+}
+
+// applyTombstones hides, in every committed segment, the documents deleted
+// by the tombstones of the segments after it.
+func applyTombstones(segments []hitSegment) {
+	var newer []string
+	for i := len(segments) - 1; i >= 0; i-- {
+		seg := segments[i]
+		if r, ok := seg.(*segment.Reader); ok && len(newer) > 0 {
+			var deleted map[uint32]bool
+			for _, id := range newer {
+				if doc, ok := r.Lookup(id); ok {
+					if deleted == nil {
+						deleted = make(map[uint32]bool)
+					}
+					deleted[doc] = true
+				}
+			}
+			if deleted != nil {
+				segments[i] = liveSegment{Reader: r, deleted: deleted}
+			}
+		}
+		if t, ok := seg.(tombstoneSource); ok {
+			newer = append(newer, t.Tombstones()...)
+		}
+	}
+}
+
+// segmentID returns the ID of a committed segment, or "" for the buffer.
+func segmentID(seg hitSegment) string {
+	if s, ok := seg.(interface{ ID() string }); ok {
+		return s.ID()
+	}
+	return ""
+}
+
+// segmentReader returns the committed segment with the given ID, loading
+// it on first use.
+func (inst *IndexInstance) segmentReader(id string) (*segment.Reader, error) {
+	inst.readersMu.Lock()
+	defer inst.readersMu.Unlock()
+	if r, ok := inst.readers[id]; ok {
+		return r, nil
+	}
+	r, err := segment.Open(inst.Dir, id)
+	if err != nil {
+		return nil, err
+	}
+	if inst.readers == nil {
+		inst.readers = make(map[string]*segment.Reader)
+	}
+	inst.readers[id] = r
+	return r, nil
+}
+
+// dropSegmentReader forgets a reclaimed segment.
+func (inst *IndexInstance) dropSegmentReader(id string) {
+	inst.readersMu.Lock()
+	delete(inst.readers, id)
+	inst.readersMu.Unlock()
+	inst.filterCache.DropSegment(id)
+}
+
+// searchSegments returns the committed segments pinned by snap in commit
+// order, followed by the write buffer when includeBuffer is set. Segment
+// ordinals, and so search_after cursors, follow this order.
+func (inst *IndexInstance) searchSegments(snap *snapshot.Snapshot, includeBuffer bool) ([]hitSegment, error) {
+	var ids []string
+	if len(snap.Segments) > 0 {
+		var err error
+		if ids, err = inst.manifestSegmentIDs(snap.Generation); err != nil {
+			return nil, err
+		}
+	}
+
+	segments := make([]hitSegment, 0, len(ids)+1)
+	for _, id := range ids {
+		r, err := inst.segmentReader(id)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, r)
+	}
+	if includeBuffer {
+		inst.writerMu.Lock()
+		w := inst.writer
+		inst.writerMu.Unlock()
+		if w != nil && (w.Buffer().DocCount > 0 || len(w.Buffer().Deletions) > 0) {
+			segments = append(segments, newBufferSegment(w.Buffer()))
+		}
+	}
+	applyTombstones(segments)
+	return segments, nil
+}
+
+// manifestSegmentIDs returns the IDs of the segments in a generation's
+// manifest in commit order: by the generation that created them, then by
+// ID. The manifest of an older generation is read from disk.
+func (inst *IndexInstance) manifestSegmentIDs(generation uint64) ([]string, error) {
+	inst.manifestMu.RLock()
+	manifest := inst.currentManifest
+	inst.manifestMu.RUnlock()
+	if manifest == nil || manifest.Generation != generation {
+		var err error
+		if manifest, err = index.LoadManifest(inst.Dir, generation); err != nil {
+			return nil, fmt.Errorf("load manifest: %w", err)
+		}
+	}
+
+	segs := make([]index.SegmentMeta, len(manifest.Segments))
+	copy(segs, manifest.Segments)
+	sort.Slice(segs, func(i, j int) bool {
+		if segs[i].GenerationCreated != segs[j].GenerationCreated {
+			return segs[i].GenerationCreated < segs[j].GenerationCreated
+		}
+		return segs[i].ID < segs[j].ID
+	})
+	ids := make([]string, len(segs))
+	for i, seg := range segs {
+		ids[i] = seg.ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"GoSearch/internal/index"
+	"GoSearch/internal/indexing"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testSchema() *index.Schema {
+	return &index.Schema{
+		DefaultAnalyzer: "standard",
+		Fields: []index.FieldDef{
+			{Name: "id", Type: index.FieldTypeKeyword, Stored: true, Indexed: true},
+			{Name: "title", Type: index.FieldTypeText, Analyzer: "standard", Stored: true, Indexed: true, Positions: true},
+			{Name: "body", Type: index.FieldTypeText, Analyzer: "standard", Indexed: true, Positions: true},
+			{Name: "price", Type: index.FieldTypeLong, Indexed: true, DocValues: true},
+		},
+	}
+}
+
+// testServer serves the API over a fresh data directory holding one empty
+// index named "docs".
+type testServer struct {
+	t    *testing.T
+	mux  *http.ServeMux
+	inst *IndexInstance
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	mgr, err := NewIndexManager(t.TempDir(), testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.CreateIndex("docs", testSchema()); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := mgr.GetIndex("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewHandler(mgr, testLogger()).RegisterRoutes(mux)
+	return &testServer{t: t, mux: mux, inst: inst}
+}
+
+// do sends a request with a JSON body and returns the response status and
+// decoded body.
+func (s *testServer) do(method, path string, body interface{}) (int, map[string]interface{}) {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(method, path, reader))
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		s.t.Fatalf("%s %s: decode response %q: %v", method, path, rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+// index ingests documents into the write buffer and commits them when
+// commit is set.
+func (s *testServer) index(commit bool, docs ...map[string]interface{}) {
+	s.t.Helper()
+	s.inst.writerMu.Lock()
+	held := s.inst.writer != nil
+	s.inst.writerMu.Unlock()
+	if !held {
+		if _, err := s.inst.AcquireWriter(); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	converted := make([]indexing.Document, len(docs))
+	for i, d := range docs {
+		converted[i] = indexing.Document{Fields: d}
+	}
+	if err := s.inst.IngestDocuments(converted); err != nil {
+		s.t.Fatal(err)
+	}
+	if commit {
+		if _, err := s.inst.Commit(context.Background()); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+}
+
+// search runs a search and fails the test unless it succeeds.
+func (s *testServer) search(req map[string]interface{}) map[string]interface{} {
+	s.t.Helper()
+	status, resp := s.do(http.MethodPost, "/indexes/docs/search", req)
+	if status != http.StatusOK {
+		s.t.Fatalf("search %v: status %d: %v", req, status, resp)
+	}
+	return resp
+}
+
+// hitIDs returns the external IDs of a search response's hits in order.
+func hitIDs(resp map[string]interface{}) []string {
+	hits, _ := resp["hits"].([]interface{})
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i], _ = h.(map[string]interface{})["id"].(string)
+	}
+	return ids
+}
+
+func doc(id, title string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "title": title}
+}
+
+func TestSearchAfter_RequiresPIT(t *testing.T) {
+	s := newTestServer(t)
+	s.index(true, doc("a", "quick fox"))
+	status, _ := s.do(http.MethodPost, "/indexes/docs/search", map[string]interface{}{
+		"query":        map[string]interface{}{"match_all": map[string]interface{}{}},
+		"search_after": []float64{1, 0},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("search_after without pit: expected 400, got %d", status)
+	}
+}
+
+func TestSearchAfter_PITStableAcrossCommits(t *testing.T) {
+	s := newTestServer(t)
+	for i := 0; i < 3; i++ {
+		s.index(true, doc(fmt.Sprintf("a%d", i), "fox"), doc(fmt.Sprintf("b%d", i), "fox"))
+	}
+	status, resp := s.do(http.MethodPost, "/indexes/docs/_pit?keep_alive=1m", nil)
+	if status != http.StatusOK {
+		t.Fatalf("open pit: status %d: %v", status, resp)
+	}
+	pit := map[string]interface{}{"id": resp["pit_id"]}
+
+	seen := make(map[string]bool)
+	var after []interface{}
+	for page := 0; ; page++ {
+		req := map[string]interface{}{
+			"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+			"size":  2,
+			"pit":   pit,
+		}
+		if after != nil {
+			req["search_after"] = after
+		}
+		resp := s.search(req)
+		ids := hitIDs(resp)
+		if len(ids) == 0 {
+			break
+		}
+		for _, id := range ids {
+			if seen[id] {
+				t.Fatalf("page %d repeats %q", page, id)
+			}
+			seen[id] = true
+		}
+		hits := resp["hits"].([]interface{})
+		after = hits[len(hits)-1].(map[string]interface{})["sort"].([]interface{})
+
+		// Commits between pages neither shift nor add hits.
+		s.index(true, doc(fmt.Sprintf("new%d", page), "fox"))
+	}
+	if len(seen) != 6 {
+		t.Errorf("expected the 6 documents of the pit, got %d: %v", len(seen), seen)
+	}
+}
+
+func TestManifestSegmentIDs_CommitOrder(t *testing.T) {
+	s := newTestServer(t)
+	// Eleven commits put seg_gen_10 and seg_gen_11 before seg_gen_2 in
+	// byte order.
+	for i := 0; i < 11; i++ {
+		s.index(true, doc(fmt.Sprintf("d%d", i), "fox"))
+	}
+	gen := s.inst.Snapshots.CurrentGeneration()
+	ids, err := s.inst.manifestSegmentIDs(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 11 {
+		t.Fatalf("expected 11 segments, got %v", ids)
+	}
+	manifest, err := index.LoadManifest(s.inst.Dir, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := make(map[string]uint64)
+	for _, seg := range manifest.Segments {
+		created[seg.ID] = seg.GenerationCreated
+	}
+	for i := 1; i < len(ids); i++ {
+		if created[ids[i-1]] >= created[ids[i]] {
+			t.Errorf("segment %s (gen %d) ordered before %s (gen %d)",
+				ids[i-1], created[ids[i-1]], ids[i], created[ids[i]])
+		}
+	}
+
+	// An older generation's manifest is read from disk.
+	older, err := s.inst.manifestSegmentIDs(gen - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(older) != 10 || older[0] != ids[0] {
+		t.Errorf("generation %d: expected the first 10 segments, got %v", gen-1, older)
+	}
+}
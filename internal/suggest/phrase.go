@@ -0,0 +1,352 @@
+package suggest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/automaton"
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/query"
+)
+
+// Phrase suggest limits and defaults.
+const (
+	DefaultPhraseSize    = 3
+	DefaultMaxEdits      = 2
+	MaxPhraseTerms       = 10
+	MaxCandidatesPerTerm = 5
+
+	// beamWidth is the number of partial corrections kept while combining
+	// the candidates of successive terms.
+	beamWidth = 50
+
+	// editPenalty scales a candidate's frequency once per edit, so a
+	// correction must be far more frequent than the term it replaces.
+	editPenalty = 0.1
+)
+
+// PhraseRequest asks for corrected versions of a query text, generated
+// from the term dictionary of a field.
+//
+//	{"text": "serch engnes", "field": "title", "size": 3, "collate": true}
+type PhraseRequest struct {
+	Text  string `json:"text"`
+	Field string `json:"field"`
+	Size  int    `json:"size,omitempty"`
+
+	// MaxEdits is the edit distance allowed per term, 1 or 2. Terms shorter
+	// than automaton.MinFuzzyTermLength are never corrected.
+	MaxEdits int `json:"max_edits,omitempty"`
+
+	// MinHits is the hit count a search must fall short of for
+	// suggestions to be computed. The default 1 suggests only when
+	// nothing matched.
+	MinHits int `json:"min_hits,omitempty"`
+
+	// Collate drops corrections whose terms do not all occur together in
+	// at least one document of the field.
+	Collate bool `json:"collate,omitempty"`
+}
+
+// PhraseSuggestion is a corrected query text. Score compares suggestions
+// of the same request; it is the product of the per-term scores.
+type PhraseSuggestion struct {
+	Text         string  `json:"text"`
+	Score        float64 `json:"score"`
+	CollateMatch bool    `json:"collate_match,omitempty"`
+}
+
+// PhraseSuggester corrects the terms of a query text.
+type PhraseSuggester struct {
+	schema   *index.Schema
+	field    string
+	terms    []string
+	size     int
+	maxEdits int
+	minHits  int
+	collate  bool
+}
+
+// NewPhrase validates a request and analyzes its text with the field's
+// analyzer.
+func NewPhrase(schema *index.Schema, registry *analysis.Registry, req PhraseRequest) (*PhraseSuggester, error) {
+	f, err := lookupField(schema, req.Field)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Indexed {
+		return nil, fmt.Errorf("%w: field %q is not indexed", ErrInvalidSuggest, req.Field)
+	}
+	var analyzer analysis.Analyzer
+	switch f.Type {
+	case index.FieldTypeText:
+		if analyzer, err = registry.Get(f.SearchAnalyzerName()); err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", ErrInvalidSuggest, req.Field, err)
+		}
+	case index.FieldTypeKeyword:
+		analyzer = analysis.NewKeywordAnalyzer()
+	default:
+		return nil, fmt.Errorf("%w: field %q has unsupported type %q", ErrInvalidSuggest, req.Field, f.Type)
+	}
+	if req.Text == "" {
+		return nil, fmt.Errorf("%w: text is required", ErrInvalidSuggest)
+	}
+	if req.Size < 0 || req.Size > MaxSize {
+		return nil, fmt.Errorf("%w: size must be between 0 and %d", ErrInvalidSuggest, MaxSize)
+	}
+	if req.MaxEdits < 0 || req.MaxEdits > automaton.MaxEditDistance {
+		return nil, fmt.Errorf("%w: max_edits must be at most %d", ErrInvalidSuggest, automaton.MaxEditDistance)
+	}
+	if req.MinHits < 0 {
+		return nil, fmt.Errorf("%w: min_hits must not be negative", ErrInvalidSuggest)
+	}
+
+	p := &PhraseSuggester{
+		schema:   schema,
+		field:    req.Field,
+		size:     req.Size,
+		maxEdits: req.MaxEdits,
+		minHits:  req.MinHits,
+		collate:  req.Collate,
+	}
+	if p.size == 0 {
+		p.size = DefaultPhraseSize
+	}
+	if p.maxEdits == 0 {
+		p.maxEdits = DefaultMaxEdits
+	}
+	if p.minHits == 0 {
+		p.minHits = 1
+	}
+	for _, tok := range analyzer.Analyze(req.Field, req.Text) {
+		p.terms = append(p.terms, tok.Term)
+	}
+	if len(p.terms) > MaxPhraseTerms {
+		return nil, fmt.Errorf("%w: text has %d terms, at most %d are corrected", ErrInvalidSuggest, len(p.terms), MaxPhraseTerms)
+	}
+	return p, nil
+}
+
+// Wanted reports whether a search with totalHits hits gets suggestions.
+func (p *PhraseSuggester) Wanted(totalHits int) bool {
+	return totalHits < p.minHits
+}
+
+// candidate is a possible replacement for one query term.
+type candidate struct {
+	term  string
+	score float64
+}
+
+// correction is a partial or complete corrected phrase.
+type correction struct {
+	terms []string
+	score float64
+}
+
+// Suggest returns corrections of the text that score higher than the text
+// itself, best first. A candidate term scores by its live document
+// frequency, scaled down by editPenalty per edit.
+func (p *PhraseSuggester) Suggest(segments []engine.Segment, ctx *engine.ExecutionContext) ([]PhraseSuggestion, error) {
+	if len(p.terms) == 0 {
+		return nil, nil
+	}
+	var totalDocs int
+	for _, seg := range segments {
+		totalDocs += seg.DocCount()
+	}
+
+	perTerm := make([][]candidate, len(p.terms))
+	original := 1.0
+	for i, term := range p.terms {
+		cands, err := p.candidates(term, segments, totalDocs, ctx)
+		if err != nil {
+			return nil, err
+		}
+		perTerm[i] = cands
+		for _, c := range cands {
+			if c.term == term {
+				original *= c.score
+			}
+		}
+	}
+
+	beam := []correction{{score: 1}}
+	for _, cands := range perTerm {
+		next := make([]correction, 0, len(beam)*len(cands))
+		for _, partial := range beam {
+			for _, c := range cands {
+				terms := append(append(make([]string, 0, len(partial.terms)+1), partial.terms...), c.term)
+				next = append(next, correction{terms: terms, score: partial.score * c.score})
+			}
+		}
+		sortCorrections(next)
+		if len(next) > beamWidth {
+			next = next[:beamWidth]
+		}
+		beam = next
+	}
+
+	var out []PhraseSuggestion
+	for _, c := range beam {
+		if len(out) == p.size || c.score <= original {
+			break
+		}
+		s := PhraseSuggestion{Text: strings.Join(c.terms, " "), Score: c.score}
+		if p.collate {
+			ok, err := p.matches(c.terms, segments, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			s.CollateMatch = true
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// candidates returns the best replacements for a term across segments,
+// always including the term itself.
+func (p *PhraseSuggester) candidates(term string, segments []engine.Segment, totalDocs int, ctx *engine.ExecutionContext) ([]candidate, error) {
+	docFreqs := map[string]int{term: 0}
+	var a automaton.Automaton
+	if len(term) >= automaton.MinFuzzyTermLength {
+		lev, err := automaton.NewLevenshteinAutomaton([]byte(term), p.maxEdits)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSuggest, err)
+		}
+		a = lev
+	}
+
+	for _, seg := range segments {
+		matched := []string{term}
+		if a != nil {
+			terms := seg.Terms(p.field)
+			scope := term[:fuzzyPrefixLength]
+			start := sort.SearchStrings(terms, scope)
+			end := start
+			for end < len(terms) && strings.HasPrefix(terms[end], scope) {
+				end++
+			}
+			var err error
+			if matched, err = engine.IntersectTerms(a, terms[start:end], ctx); err != nil {
+				return nil, err
+			}
+		}
+		for _, t := range matched {
+			if df := liveDocFreq(seg, p.field, t); df > 0 {
+				docFreqs[t] += df
+			}
+		}
+	}
+
+	var original candidate
+	cands := make([]candidate, 0, len(docFreqs))
+	for t, df := range docFreqs {
+		dist := editDistance(term, t)
+		if dist > p.maxEdits || (df == 0 && t != term) {
+			continue
+		}
+		c := candidate{term: t, score: termScore(df, dist, totalDocs)}
+		if t == term {
+			original = c
+			continue
+		}
+		cands = append(cands, c)
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].score != cands[j].score {
+			return cands[i].score > cands[j].score
+		}
+		return cands[i].term < cands[j].term
+	})
+	if len(cands) > MaxCandidatesPerTerm {
+		cands = cands[:MaxCandidatesPerTerm]
+	}
+	return append(cands, original), nil
+}
+
+// termScore is a term's share of the documents, scaled by editPenalty per
+// edit. A term absent from the dictionary scores as a single document one
+// edit beyond the maximum, below every candidate that was found.
+func termScore(docFreq, dist, totalDocs int) float64 {
+	if docFreq == 0 {
+		docFreq, dist = 1, automaton.MaxEditDistance+1
+	}
+	score := float64(docFreq) / float64(max(totalDocs, 1))
+	for i := 0; i < dist; i++ {
+		score *= editPenalty
+	}
+	return score
+}
+
+// matches reports whether some live document contains all terms.
+func (p *PhraseSuggester) matches(terms []string, segments []engine.Segment, ctx *engine.ExecutionContext) (bool, error) {
+	q := &query.BooleanQuery{}
+	for _, t := range terms {
+		q.Clauses = append(q.Clauses, query.BooleanClause{
+			Occur: query.BooleanMust,
+			Query: &query.TermQuery{Field: p.field, Term: t},
+		})
+	}
+	top, err := engine.NewSearcher(p.schema, segments, ctx).Search(q, 1)
+	if err != nil {
+		return false, err
+	}
+	return top.TotalHits > 0, nil
+}
+
+func sortCorrections(cs []correction) {
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].score != cs[j].score {
+			return cs[i].score > cs[j].score
+		}
+		return strings.Join(cs[i].terms, " ") < strings.Join(cs[j].terms, " ")
+	})
+}
+
+// liveDocFreq counts the live documents of a segment containing a term.
+func liveDocFreq(seg engine.Segment, field, term string) int {
+	postings := seg.Postings(field, term)
+	if postings == nil {
+		return 0
+	}
+	live, ok := seg.(engine.LiveDocs)
+	if !ok {
+		return len(postings.DocIDs)
+	}
+	n := 0
+	for _, doc := range postings.DocIDs {
+		if !live.IsDeleted(doc) {
+			n++
+		}
+	}
+	return n
+}
+
+// editDistance returns the Levenshtein distance between two byte strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,245 @@
+package suggest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"GoSearch/internal/automaton"
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+)
+
+// Suggest limits.
+const (
+	DefaultSize  = 5
+	MaxSize      = 100
+	MaxFuzziness = automaton.MaxEditDistance
+
+	// MaxExpandedTerms bounds the terms a single request may complete to,
+	// across all segments. Short prefixes of large fields hit it first.
+	MaxExpandedTerms = 50_000
+	MaxStatesVisited = 10 * MaxExpandedTerms
+
+	// fuzzyPrefixLength is the number of leading bytes a fuzzy completion
+	// must share with the prefix. Typos in the first character are rare
+	// and tolerating them would walk the whole term dictionary.
+	fuzzyPrefixLength = 1
+)
+
+var ErrInvalidSuggest = errors.New("invalid suggest request")
+
+// Request is the JSON form of a completion request.
+//
+//	{"field": "title", "prefix": "sea", "size": 5, "fuzziness": 1}
+type Request struct {
+	Field  string `json:"field"`
+	Prefix string `json:"prefix"`
+	Size   int    `json:"size,omitempty"`
+
+	// Fuzziness is the number of edits tolerated in the prefix. Prefixes
+	// shorter than automaton.MinFuzzyTermLength are matched exactly.
+	Fuzziness int `json:"fuzziness,omitempty"`
+
+	// WeightField is a numeric doc values field. A completion is weighted by
+	// the largest value among the documents containing it instead of by
+	// its document frequency. Documents without a value do not count.
+	WeightField string `json:"weight_field,omitempty"`
+}
+
+// Suggestion is a completion of the prefix. Fuzzy is set for completions
+// that only match the prefix with edits.
+type Suggestion struct {
+	Text   string  `json:"text"`
+	Weight float64 `json:"weight"`
+	Fuzzy  bool    `json:"fuzzy,omitempty"`
+}
+
+// Suggester completes a prefix from the term dictionaries of a field.
+type Suggester struct {
+	field     string
+	prefix    string
+	size      int
+	automaton automaton.Automaton
+	// scope is the prefix shared by every completion; terms outside it are
+	// never stepped through the automaton.
+	scope string
+
+	weightField string
+	weightKind  numeric.Kind
+}
+
+// New validates a request against the schema and returns its Suggester.
+func New(schema *index.Schema, req Request) (*Suggester, error) {
+	f, err := lookupField(schema, req.Field)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Indexed {
+		return nil, fmt.Errorf("%w: field %q is not indexed", ErrInvalidSuggest, req.Field)
+	}
+	if _, ok := index.NumericKind(f.Type); ok {
+		return nil, fmt.Errorf("%w: field %q is numeric", ErrInvalidSuggest, req.Field)
+	}
+	if req.Prefix == "" {
+		return nil, fmt.Errorf("%w: prefix is required", ErrInvalidSuggest)
+	}
+	if req.Size < 0 || req.Size > MaxSize {
+		return nil, fmt.Errorf("%w: size must be between 0 and %d", ErrInvalidSuggest, MaxSize)
+	}
+	if req.Fuzziness < 0 || req.Fuzziness > MaxFuzziness {
+		return nil, fmt.Errorf("%w: fuzziness must be between 0 and %d", ErrInvalidSuggest, MaxFuzziness)
+	}
+
+	s := &Suggester{
+		field:  req.Field,
+		prefix: req.Prefix,
+		size:   req.Size,
+		scope:  req.Prefix,
+	}
+	if s.size == 0 {
+		s.size = DefaultSize
+	}
+	if req.Fuzziness > 0 && len(req.Prefix) >= automaton.MinFuzzyTermLength {
+		a, err := automaton.NewFuzzyPrefixAutomaton([]byte(req.Prefix), req.Fuzziness)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSuggest, err)
+		}
+		s.automaton = a
+		s.scope = req.Prefix[:fuzzyPrefixLength]
+	} else {
+		s.automaton = automaton.NewPrefixAutomaton([]byte(req.Prefix))
+	}
+
+	if req.WeightField != "" {
+		wf, err := lookupField(schema, req.WeightField)
+		if err != nil {
+			return nil, err
+		}
+		kind, ok := index.NumericKind(wf.Type)
+		if !ok || !wf.DocValues {
+			return nil, fmt.Errorf("%w: weight field %q must be numeric with doc_values enabled", ErrInvalidSuggest, req.WeightField)
+		}
+		s.weightField, s.weightKind = req.WeightField, kind
+	}
+	return s, nil
+}
+
+func lookupField(schema *index.Schema, name string) (*index.FieldDef, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: field is required", ErrInvalidSuggest)
+	}
+	var f *index.FieldDef
+	if schema != nil {
+		f = schema.Field(name)
+	}
+	if f == nil {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSuggest, name)
+	}
+	return f, nil
+}
+
+// completion accumulates the weight of one term across segments.
+type completion struct {
+	weight  float64
+	matched bool
+}
+
+// Suggest returns the best completions across segments. Completions that
+// match the prefix exactly rank before fuzzy ones, then by descending
+// weight and finally in byte order. Deleted documents carry no weight, and
+// terms found only in deleted documents are not suggested.
+func (s *Suggester) Suggest(segments []engine.Segment, ctx *engine.ExecutionContext) ([]Suggestion, error) {
+	completions := make(map[string]*completion)
+	for _, seg := range segments {
+		if err := s.collect(seg, completions, ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Suggestion, 0, len(completions))
+	for term, c := range completions {
+		if c.matched {
+			out = append(out, Suggestion{
+				Text:   term,
+				Weight: c.weight,
+				Fuzzy:  !strings.HasPrefix(term, s.prefix),
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Fuzzy != b.Fuzzy {
+			return !a.Fuzzy
+		}
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		return a.Text < b.Text
+	})
+	if len(out) > s.size {
+		out = out[:s.size]
+	}
+	return out, nil
+}
+
+// collect adds the completions found in one segment.
+func (s *Suggester) collect(seg engine.Segment, completions map[string]*completion, ctx *engine.ExecutionContext) error {
+	terms := seg.Terms(s.field)
+	start := sort.SearchStrings(terms, s.scope)
+	end := start
+	for end < len(terms) && strings.HasPrefix(terms[end], s.scope) {
+		end++
+	}
+	matched, err := engine.IntersectTerms(s.automaton, terms[start:end], ctx)
+	if err != nil {
+		return err
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	live, _ := seg.(engine.LiveDocs)
+	var weights *docvalues.NumericField
+	if dv := seg.DocValues(); dv != nil && s.weightField != "" {
+		weights = dv.NumericField(s.weightField)
+	}
+
+	for _, term := range matched {
+		c := completions[term]
+		if c == nil {
+			c = &completion{}
+			completions[term] = c
+		}
+		if s.weightField == "" {
+			if df := liveDocFreq(seg, s.field, term); df > 0 {
+				c.weight += float64(df)
+				c.matched = true
+			}
+			continue
+		}
+		p := seg.Postings(s.field, term)
+		if p == nil || weights == nil {
+			continue
+		}
+		for _, doc := range p.DocIDs {
+			if live != nil && live.IsDeleted(doc) {
+				continue
+			}
+			for _, v := range weights.Values(doc) {
+				w := float64(v)
+				if s.weightKind == numeric.KindDouble {
+					w = numeric.SortableToDouble(v)
+				}
+				if !c.matched || w > c.weight {
+					c.weight = w
+				}
+				c.matched = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package suggest
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"GoSearch/internal/analysis"
+	"GoSearch/internal/docvalues"
+	"GoSearch/internal/engine"
+	"GoSearch/internal/index"
+	"GoSearch/internal/numeric"
+)
+
+// termSegment is an engine.Segment with a "title" term dictionary, a
+// "rating" doc values column and optionally deleted documents.
+type termSegment struct {
+	terms    []string
+	postings map[string][]uint32
+	dv       *docvalues.Segment
+	deleted  map[uint32]bool
+}
+
+func (s *termSegment) MaxDoc() uint32        { return s.dv.MaxDoc() }
+func (s *termSegment) DocCount() int         { return int(s.dv.MaxDoc()) }
+func (s *termSegment) AvgDocLength() float32 { return 1 }
+func (s *termSegment) Terms(field string) []string {
+	if field != "title" {
+		return nil
+	}
+	return s.terms
+}
+func (s *termSegment) Postings(field, term string) *engine.Postings {
+	docs, ok := s.postings[term]
+	if field != "title" || !ok {
+		return nil
+	}
+	freqs := make([]uint32, len(docs))
+	for i := range freqs {
+		freqs[i] = 1
+	}
+	return &engine.Postings{DocIDs: docs, Freqs: freqs}
+}
+func (s *termSegment) DocValues() *docvalues.Segment { return s.dv }
+func (s *termSegment) IsDeleted(docID uint32) bool   { return s.deleted[docID] }
+
+// testDoc is a document with space-separated title terms and a rating.
+type testDoc struct {
+	title  string
+	rating float64
+}
+
+func newSegment(docs []testDoc, deleted ...uint32) *termSegment {
+	s := &termSegment{postings: make(map[string][]uint32), deleted: make(map[uint32]bool)}
+	b := docvalues.NewBuilder()
+	for i, d := range docs {
+		doc := uint32(i)
+		for _, term := range strings.Fields(d.title) {
+			if _, ok := s.postings[term]; !ok {
+				s.terms = append(s.terms, term)
+			}
+			s.postings[term] = append(s.postings[term], doc)
+		}
+		if d.rating != 0 {
+			b.AddNumeric("rating", doc, numeric.DoubleToSortable(d.rating))
+		}
+	}
+	sort.Strings(s.terms)
+	for _, doc := range deleted {
+		s.deleted[doc] = true
+	}
+	s.dv = b.Build(uint32(len(docs)))
+	return s
+}
+
+func testSchema() *index.Schema {
+	return &index.Schema{Fields: []index.FieldDef{
+		{Name: "title", Type: index.FieldTypeText, Indexed: true, Analyzer: "standard"},
+		{Name: "rating", Type: index.FieldTypeDouble, Indexed: true, DocValues: true},
+		{Name: "views", Type: index.FieldTypeLong, Indexed: true},
+		{Name: "body", Type: index.FieldTypeText, Analyzer: "standard"},
+	}}
+}
+
+func testContext() *engine.ExecutionContext {
+	return engine.NewExecutionContext(time.Minute, MaxStatesVisited, MaxExpandedTerms)
+}
+
+func suggest(t *testing.T, req Request, segments ...engine.Segment) []Suggestion {
+	t.Helper()
+	s, err := New(testSchema(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Suggest(segments, testContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSuggest_DocFreqAcrossSegments(t *testing.T) {
+	a := newSegment([]testDoc{
+		{title: "search engine"},
+		{title: "search tips"},
+		{title: "seattle"},
+	})
+	b := newSegment([]testDoc{
+		{title: "seattle weather"},
+		{title: "seattle search"},
+		{title: "sea"},
+	}, 2)
+
+	got := suggest(t, Request{Field: "title", Prefix: "sea"}, a, b)
+	want := []Suggestion{
+		{Text: "search", Weight: 3},
+		{Text: "seattle", Weight: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSuggest_Size(t *testing.T) {
+	seg := newSegment([]testDoc{{title: "apple apricot avocado"}, {title: "apricot"}})
+	got := suggest(t, Request{Field: "title", Prefix: "a", Size: 1}, seg)
+	if len(got) != 1 || got[0].Text != "apricot" {
+		t.Errorf("got %+v, want [apricot]", got)
+	}
+}
+
+func TestSuggest_WeightField(t *testing.T) {
+	seg := newSegment([]testDoc{
+		{title: "search", rating: 2},
+		{title: "search", rating: 3.5},
+		{title: "seattle", rating: 4},
+		{title: "season"},
+		{title: "seal", rating: 9},
+	}, 4)
+
+	got := suggest(t, Request{Field: "title", Prefix: "sea", WeightField: "rating"}, seg)
+	want := []Suggestion{
+		{Text: "seattle", Weight: 4},
+		{Text: "search", Weight: 3.5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSuggest_Fuzzy(t *testing.T) {
+	seg := newSegment([]testDoc{
+		{title: "search"},
+		{title: "searching"},
+		{title: "searching"},
+		{title: "sxarf"},
+		{title: "tearful"},
+	})
+
+	got := suggest(t, Request{Field: "title", Prefix: "seqrc", Fuzziness: 1}, seg)
+	want := []Suggestion{
+		{Text: "searching", Weight: 2, Fuzzy: true},
+		{Text: "search", Weight: 1, Fuzzy: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Exact completions rank before fuzzy ones regardless of weight.
+	got = suggest(t, Request{Field: "title", Prefix: "sear", Fuzziness: 1}, seg)
+	want = []Suggestion{
+		{Text: "searching", Weight: 2},
+		{Text: "search", Weight: 1},
+		{Text: "sxarf", Weight: 1, Fuzzy: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Prefixes too short for fuzzy matching are matched exactly.
+	got = suggest(t, Request{Field: "title", Prefix: "sx", Fuzziness: 1}, seg)
+	want = []Suggestion{{Text: "sxarf", Weight: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []Request{
+		{Prefix: "a"},
+		{Field: "missing", Prefix: "a"},
+		{Field: "views", Prefix: "1"},
+		{Field: "body", Prefix: "a"},
+		{Field: "title"},
+		{Field: "title", Prefix: "a", Size: MaxSize + 1},
+		{Field: "title", Prefix: "abc", Fuzziness: 3},
+		{Field: "title", Prefix: "a", WeightField: "views"},
+		{Field: "title", Prefix: "a", WeightField: "title"},
+	}
+	for _, req := range tests {
+		if _, err := New(testSchema(), req); !errors.Is(err, ErrInvalidSuggest) {
+			t.Errorf("New(%+v) = %v, want ErrInvalidSuggest", req, err)
+		}
+	}
+}
+
+func phraseSuggest(t *testing.T, req PhraseRequest, segments ...engine.Segment) []PhraseSuggestion {
+	t.Helper()
+	p, err := NewPhrase(testSchema(), analysis.NewRegistry(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := p.Suggest(segments, testContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func suggestionTexts(suggestions []PhraseSuggestion) []string {
+	texts := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		texts[i] = s.Text
+	}
+	return texts
+}
+
+func TestPhraseSuggest_CorrectsEachTerm(t *testing.T) {
+	seg := newSegment([]testDoc{
+		{title: "search engines"},
+		{title: "search engines"},
+		{title: "search tips"},
+		{title: "seared tuna"},
+	})
+
+	got := phraseSuggest(t, PhraseRequest{Text: "Serch Engnes", Field: "title"}, seg)
+	texts := suggestionTexts(got)
+	if len(texts) == 0 || texts[0] != "search engines" {
+		t.Fatalf("got %v, want search engines first", texts)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Score > got[i-1].Score {
+			t.Errorf("suggestions not in score order: %+v", got)
+		}
+	}
+}
+
+func TestPhraseSuggest_NoCorrectionNeeded(t *testing.T) {
+	seg := newSegment([]testDoc{{title: "search engines"}, {title: "search tips"}})
+	if got := phraseSuggest(t, PhraseRequest{Text: "search tips", Field: "title"}, seg); len(got) != 0 {
+		t.Errorf("got %+v, want no suggestions", got)
+	}
+}
+
+func TestPhraseSuggest_Collate(t *testing.T) {
+	seg := newSegment([]testDoc{
+		{title: "search engines"},
+		{title: "tuna tips"},
+		{title: "tuna tips"},
+		{title: "tuna tips"},
+		{title: "search"},
+		{title: "search"},
+	})
+
+	// "serch tups" is closest to "search tips", which no document contains.
+	got := phraseSuggest(t, PhraseRequest{Text: "serch tups", Field: "title", Size: 5}, seg)
+	if texts := suggestionTexts(got); len(texts) == 0 || texts[0] != "search tips" {
+		t.Fatalf("without collate got %v, want search tips first", texts)
+	}
+
+	got = phraseSuggest(t, PhraseRequest{Text: "serch tups", Field: "title", Size: 5, Collate: true}, seg)
+	for _, s := range got {
+		if s.Text == "search tips" || !s.CollateMatch {
+			t.Errorf("collated suggestion %+v", s)
+		}
+	}
+}
+
+func TestPhraseSuggest_SkipsDeletedDocs(t *testing.T) {
+	seg := newSegment([]testDoc{{title: "search"}, {title: "starch"}, {title: "starch"}}, 1, 2)
+	got := phraseSuggest(t, PhraseRequest{Text: "sarch", Field: "title"}, seg)
+	if texts := suggestionTexts(got); !reflect.DeepEqual(texts, []string{"search"}) {
+		t.Errorf("got %v, want [search]", texts)
+	}
+}
+
+func TestPhraseSuggester_Wanted(t *testing.T) {
+	p, err := NewPhrase(testSchema(), analysis.NewRegistry(), PhraseRequest{Text: "a", Field: "title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Wanted(0) || p.Wanted(1) {
+		t.Error("default min_hits should suggest only without hits")
+	}
+	p, err = NewPhrase(testSchema(), analysis.NewRegistry(), PhraseRequest{Text: "a", Field: "title", MinHits: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Wanted(4) || p.Wanted(5) {
+		t.Error("min_hits 5 should suggest below 5 hits")
+	}
+}
+
+func TestNewPhrase_Invalid(t *testing.T) {
+	tests := []PhraseRequest{
+		{Field: "title"},
+		{Text: "a", Field: "views"},
+		{Text: "a", Field: "body"},
+		{Text: "a", Field: "title", MaxEdits: 3},
+		{Text: "a", Field: "title", MinHits: -1},
+		{Text: "a b c d e f g h i j k", Field: "title"},
+	}
+	for _, req := range tests {
+		if _, err := NewPhrase(testSchema(), analysis.NewRegistry(), req); !errors.Is(err, ErrInvalidSuggest) {
+			t.Errorf("NewPhrase(%+v) = %v, want ErrInvalidSuggest", req, err)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "abc", 0},
+		{"abc", "", 3},
+		{"search", "serch", 1},
+		{"search", "saerch", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}